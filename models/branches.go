@@ -36,6 +36,7 @@ type ProtectedBranch struct {
 	ApprovalsWhitelistUserIDs []int64        `xorm:"JSON TEXT"`
 	ApprovalsWhitelistTeamIDs []int64        `xorm:"JSON TEXT"`
 	RequiredApprovals         int64          `xorm:"NOT NULL DEFAULT 0"`
+	RequireSignedCommits      bool           `xorm:"NOT NULL DEFAULT false"`
 	CreatedUnix               util.TimeStamp `xorm:"created"`
 	UpdatedUnix               util.TimeStamp `xorm:"updated"`
 }
@@ -67,6 +68,31 @@ func (protectBranch *ProtectedBranch) CanUserPush(userID int64) bool {
 	return in
 }
 
+// Reasons of ErrNotAllowedToPush
+const (
+	// ProtectedBranchPushDisabled means nobody can push to the branch directly
+	ProtectedBranchPushDisabled = "push_disabled"
+	// ProtectedBranchNotWhitelisted means only the whitelisted users and teams can push to the branch
+	ProtectedBranchNotWhitelisted = "not_whitelisted"
+)
+
+// CheckUserPush returns an ErrNotAllowedToPush telling why the user can't push to this protected branch,
+// or nil if the user can
+func (protectBranch *ProtectedBranch) CheckUserPush(user *User) error {
+	if protectBranch.CanUserPush(user.ID) {
+		return nil
+	}
+	reason := ProtectedBranchNotWhitelisted
+	if !protectBranch.EnableWhitelist {
+		reason = ProtectedBranchPushDisabled
+	}
+	return ErrNotAllowedToPush{
+		BranchName: protectBranch.BranchName,
+		UserName:   user.Name,
+		Reason:     reason,
+	}
+}
+
 // CanUserMerge returns if some user could merge a pull request to this protected branch
 func (protectBranch *ProtectedBranch) CanUserMerge(userID int64) bool {
 	if !protectBranch.EnableMergeWhitelist {
@@ -4,7 +4,11 @@
 
 package models
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
 // ErrNameReserved represents a "reserved name" error.
 type ErrNameReserved struct {
@@ -733,6 +737,652 @@ func (err ErrRepoFileAlreadyExist) Error() string {
 	return fmt.Sprintf("repository file already exists [file_name: %s]", err.FileName)
 }
 
+// ErrRepoFileDoesNotExist represents a "RepoFileDoesNotExist" kind of error.
+type ErrRepoFileDoesNotExist struct {
+	FileName string
+}
+
+// IsErrRepoFileDoesNotExist checks if an error is a ErrRepoFileDoesNotExist.
+func IsErrRepoFileDoesNotExist(err error) bool {
+	_, ok := err.(ErrRepoFileDoesNotExist)
+	return ok
+}
+
+func (err ErrRepoFileDoesNotExist) Error() string {
+	return fmt.Sprintf("repository file does not exist [file_name: %s]", err.FileName)
+}
+
+// ErrRepoFilesDoNotExist represents a "RepoFilesDoNotExist" kind of error.
+type ErrRepoFilesDoNotExist struct {
+	FileNames []string
+}
+
+// IsErrRepoFilesDoNotExist checks if an error is a ErrRepoFilesDoNotExist.
+func IsErrRepoFilesDoNotExist(err error) bool {
+	_, ok := err.(ErrRepoFilesDoNotExist)
+	return ok
+}
+
+func (err ErrRepoFilesDoNotExist) Error() string {
+	return fmt.Sprintf("repository files do not exist [file_names: %s]", strings.Join(err.FileNames, ", "))
+}
+
+// ErrFilePathConflict represents a "FilePathConflict" kind of error.
+type ErrFilePathConflict struct {
+	Path string
+}
+
+// IsErrFilePathConflict checks if an error is an ErrFilePathConflict.
+func IsErrFilePathConflict(err error) bool {
+	_, ok := err.(ErrFilePathConflict)
+	return ok
+}
+
+func (err ErrFilePathConflict) Error() string {
+	return fmt.Sprintf("path is changed by more than one operation [path: %s]", err.Path)
+}
+
+// ErrFileDirectoryConflict represents a "FileDirectoryConflict" kind of error.
+type ErrFileDirectoryConflict struct {
+	Path  string
+	Entry string
+}
+
+// IsErrFileDirectoryConflict checks if an error is an ErrFileDirectoryConflict.
+func IsErrFileDirectoryConflict(err error) bool {
+	_, ok := err.(ErrFileDirectoryConflict)
+	return ok
+}
+
+func (err ErrFileDirectoryConflict) Error() string {
+	return fmt.Sprintf("file path conflicts with an existing entry beneath or above it [path: %s, entry: %s]", err.Path, err.Entry)
+}
+
+// ErrFilenameInvalid represents a "FilenameInvalid" kind of error.
+type ErrFilenameInvalid struct {
+	Path string
+}
+
+// IsErrFilenameInvalid checks if an error is an ErrFilenameInvalid.
+func IsErrFilenameInvalid(err error) bool {
+	_, ok := err.(ErrFilenameInvalid)
+	return ok
+}
+
+func (err ErrFilenameInvalid) Error() string {
+	return fmt.Sprintf("path contains a malformed path component [path: %s]", err.Path)
+}
+
+// ErrSHADoesNotMatch represents a "SHADoesNotMatch" kind of error.
+type ErrSHADoesNotMatch struct {
+	Path       string
+	GivenSHA   string
+	CurrentSHA string
+}
+
+// IsErrSHADoesNotMatch checks if an error is a ErrSHADoesNotMatch.
+func IsErrSHADoesNotMatch(err error) bool {
+	_, ok := err.(ErrSHADoesNotMatch)
+	return ok
+}
+
+func (err ErrSHADoesNotMatch) Error() string {
+	return fmt.Sprintf("sha does not match [given: %s, expected: %s]", err.GivenSHA, err.CurrentSHA)
+}
+
+// ErrPathCaseConflict represents a "PathCaseConflict" kind of error.
+type ErrPathCaseConflict struct {
+	Path  string
+	Entry string
+}
+
+// IsErrPathCaseConflict checks if an error is an ErrPathCaseConflict.
+func IsErrPathCaseConflict(err error) bool {
+	_, ok := err.(ErrPathCaseConflict)
+	return ok
+}
+
+func (err ErrPathCaseConflict) Error() string {
+	return fmt.Sprintf("file path only differs in case from an existing entry [path: %s, entry: %s]", err.Path, err.Entry)
+}
+
+// ErrFormatFailed represents a "FormatFailed" kind of error.
+type ErrFormatFailed struct {
+	Path      string
+	Formatter string
+	Output    string
+}
+
+// IsErrFormatFailed checks if an error is an ErrFormatFailed.
+func IsErrFormatFailed(err error) bool {
+	_, ok := err.(ErrFormatFailed)
+	return ok
+}
+
+func (err ErrFormatFailed) Error() string {
+	return fmt.Sprintf("formatter failed on the file [path: %s, formatter: %s, output: %s]", err.Path, err.Formatter, err.Output)
+}
+
+// ErrInvalidDataFile represents a "InvalidDataFile" kind of error.
+type ErrInvalidDataFile struct {
+	Path   string
+	Format string
+	// Line and Column locate the error from 1, a Column of 0 meaning it is not known
+	Line   int
+	Column int
+	Reason string
+}
+
+// IsErrInvalidDataFile checks if an error is an ErrInvalidDataFile.
+func IsErrInvalidDataFile(err error) bool {
+	_, ok := err.(ErrInvalidDataFile)
+	return ok
+}
+
+func (err ErrInvalidDataFile) Error() string {
+	return fmt.Sprintf("file does not parse [path: %s, format: %s, line: %d, column: %d, reason: %s]", err.Path, err.Format, err.Line, err.Column, err.Reason)
+}
+
+// ErrContentSHAMismatch represents a "ContentSHAMismatch" kind of error.
+type ErrContentSHAMismatch struct {
+	Path       string
+	GivenSHA   string
+	ContentSHA string
+}
+
+// IsErrContentSHAMismatch checks if an error is a ErrContentSHAMismatch.
+func IsErrContentSHAMismatch(err error) bool {
+	_, ok := err.(ErrContentSHAMismatch)
+	return ok
+}
+
+func (err ErrContentSHAMismatch) Error() string {
+	return fmt.Sprintf("content sha does not match [path: %s, given: %s, content: %s]", err.Path, err.GivenSHA, err.ContentSHA)
+}
+
+// ErrCommitIDDoesNotMatch represents a "CommitIDDoesNotMatch" kind of error.
+type ErrCommitIDDoesNotMatch struct {
+	GivenCommitID   string
+	CurrentCommitID string
+}
+
+// IsErrCommitIDDoesNotMatch checks if an error is a ErrCommitIDDoesNotMatch.
+func IsErrCommitIDDoesNotMatch(err error) bool {
+	_, ok := err.(ErrCommitIDDoesNotMatch)
+	return ok
+}
+
+func (err ErrCommitIDDoesNotMatch) Error() string {
+	return fmt.Sprintf("file CommitID does not match [given: %s, expected: %s]", err.GivenCommitID, err.CurrentCommitID)
+}
+
+// ErrSHANotFound represents a "SHANotFound" kind of error.
+type ErrSHANotFound struct {
+	SHA string
+}
+
+// IsErrSHANotFound checks if an error is a ErrSHANotFound.
+func IsErrSHANotFound(err error) bool {
+	_, ok := err.(ErrSHANotFound)
+	return ok
+}
+
+func (err ErrSHANotFound) Error() string {
+	return fmt.Sprintf("no file found with the sha [sha: %s]", err.SHA)
+}
+
+// ErrSHAMatchesMultiplePaths represents a "SHAMatchesMultiplePaths" kind of error.
+type ErrSHAMatchesMultiplePaths struct {
+	SHA   string
+	Paths []string
+}
+
+// IsErrSHAMatchesMultiplePaths checks if an error is a ErrSHAMatchesMultiplePaths.
+func IsErrSHAMatchesMultiplePaths(err error) bool {
+	_, ok := err.(ErrSHAMatchesMultiplePaths)
+	return ok
+}
+
+func (err ErrSHAMatchesMultiplePaths) Error() string {
+	return fmt.Sprintf("sha matches more than one file [sha: %s, paths: %s]", err.SHA, strings.Join(err.Paths, ", "))
+}
+
+// ErrSignedCommitRequired represents a "SignedCommitRequired" kind of error.
+type ErrSignedCommitRequired struct {
+	BranchName string
+}
+
+// IsErrSignedCommitRequired checks if an error is a ErrSignedCommitRequired.
+func IsErrSignedCommitRequired(err error) bool {
+	_, ok := err.(ErrSignedCommitRequired)
+	return ok
+}
+
+func (err ErrSignedCommitRequired) Error() string {
+	return fmt.Sprintf("branch requires signed commits but no signing key is available [branch: %s]", err.BranchName)
+}
+
+// ErrSigningKeyNotAllowed represents a "SigningKeyNotAllowed" kind of error.
+type ErrSigningKeyNotAllowed struct {
+	KeyID    string
+	UserName string
+}
+
+// IsErrSigningKeyNotAllowed checks if an error is a ErrSigningKeyNotAllowed.
+func IsErrSigningKeyNotAllowed(err error) bool {
+	_, ok := err.(ErrSigningKeyNotAllowed)
+	return ok
+}
+
+func (err ErrSigningKeyNotAllowed) Error() string {
+	return fmt.Sprintf("user is not allowed to sign commits with the key [key_id: %s, user: %s]", err.KeyID, err.UserName)
+}
+
+// ErrInvalidCommitDate represents a "InvalidCommitDate" kind of error.
+type ErrInvalidCommitDate struct {
+	Date   string
+	Reason string
+}
+
+// IsErrInvalidCommitDate checks if an error is a ErrInvalidCommitDate.
+func IsErrInvalidCommitDate(err error) bool {
+	_, ok := err.(ErrInvalidCommitDate)
+	return ok
+}
+
+func (err ErrInvalidCommitDate) Error() string {
+	return fmt.Sprintf("commit date is invalid [date: %s, reason: %s]", err.Date, err.Reason)
+}
+
+// ErrParentCommitNotExist represents a "ParentCommitNotExist" kind of error.
+type ErrParentCommitNotExist struct {
+	ID string
+}
+
+// IsErrParentCommitNotExist checks if an error is a ErrParentCommitNotExist.
+func IsErrParentCommitNotExist(err error) bool {
+	_, ok := err.(ErrParentCommitNotExist)
+	return ok
+}
+
+func (err ErrParentCommitNotExist) Error() string {
+	return fmt.Sprintf("parent commit does not exist [id: %s]", err.ID)
+}
+
+// ErrCommitNotExist represents a "CommitNotExist" kind of error.
+type ErrCommitNotExist struct {
+	ID string
+}
+
+// IsErrCommitNotExist checks if an error is a ErrCommitNotExist.
+func IsErrCommitNotExist(err error) bool {
+	_, ok := err.(ErrCommitNotExist)
+	return ok
+}
+
+func (err ErrCommitNotExist) Error() string {
+	return fmt.Sprintf("commit does not exist [id: %s]", err.ID)
+}
+
+// ErrInvalidCoAuthor represents a "InvalidCoAuthor" kind of error.
+type ErrInvalidCoAuthor struct {
+	Name   string
+	Email  string
+	Reason string
+}
+
+// IsErrInvalidCoAuthor checks if an error is a ErrInvalidCoAuthor.
+func IsErrInvalidCoAuthor(err error) bool {
+	_, ok := err.(ErrInvalidCoAuthor)
+	return ok
+}
+
+func (err ErrInvalidCoAuthor) Error() string {
+	return fmt.Sprintf("co-author is invalid [name: %s, email: %s, reason: %s]", err.Name, err.Email, err.Reason)
+}
+
+// ErrInvalidAuthorTrailer represents a "InvalidAuthorTrailer" kind of error.
+type ErrInvalidAuthorTrailer struct {
+	Trailer string
+	Value   string
+	Reason  string
+}
+
+// IsErrInvalidAuthorTrailer checks if an error is a ErrInvalidAuthorTrailer.
+func IsErrInvalidAuthorTrailer(err error) bool {
+	_, ok := err.(ErrInvalidAuthorTrailer)
+	return ok
+}
+
+func (err ErrInvalidAuthorTrailer) Error() string {
+	return fmt.Sprintf("author trailer is invalid [trailer: %s, value: %s, reason: %s]", err.Trailer, err.Value, err.Reason)
+}
+
+// ErrCommitMessageRejected represents a "CommitMessageRejected" kind of error.
+type ErrCommitMessageRejected struct {
+	RepoName string
+	Rule     string
+	Reason   string
+}
+
+// IsErrCommitMessageRejected checks if an error is a ErrCommitMessageRejected.
+func IsErrCommitMessageRejected(err error) bool {
+	_, ok := err.(ErrCommitMessageRejected)
+	return ok
+}
+
+func (err ErrCommitMessageRejected) Error() string {
+	return fmt.Sprintf("commit message rejected [repo: %s, rule: %s, reason: %s]", err.RepoName, err.Rule, err.Reason)
+}
+
+// ErrQuotaExceeded represents a "QuotaExceeded" kind of error.
+type ErrQuotaExceeded struct {
+	RepoName string
+	Quota    int64
+	LFS      bool
+}
+
+// IsErrQuotaExceeded checks if an error is a ErrQuotaExceeded.
+func IsErrQuotaExceeded(err error) bool {
+	_, ok := err.(ErrQuotaExceeded)
+	return ok
+}
+
+func (err ErrQuotaExceeded) Error() string {
+	if err.LFS {
+		return fmt.Sprintf("repository LFS size quota exceeded [repo: %s, quota: %d]", err.RepoName, err.Quota)
+	}
+	return fmt.Sprintf("repository size quota exceeded [repo: %s, quota: %d]", err.RepoName, err.Quota)
+}
+
+// ErrEmptyCommit represents a "EmptyCommit" kind of error.
+type ErrEmptyCommit struct {
+	BranchName string
+}
+
+// IsErrEmptyCommit checks if an error is a ErrEmptyCommit.
+func IsErrEmptyCommit(err error) bool {
+	_, ok := err.(ErrEmptyCommit)
+	return ok
+}
+
+func (err ErrEmptyCommit) Error() string {
+	return fmt.Sprintf("commit would not change any file [branch: %s]", err.BranchName)
+}
+
+// ErrAmendNotAllowed represents a "AmendNotAllowed" kind of error.
+type ErrAmendNotAllowed struct {
+	BranchName string
+	Reason     string
+}
+
+// IsErrAmendNotAllowed checks if an error is a ErrAmendNotAllowed.
+func IsErrAmendNotAllowed(err error) bool {
+	_, ok := err.(ErrAmendNotAllowed)
+	return ok
+}
+
+func (err ErrAmendNotAllowed) Error() string {
+	return fmt.Sprintf("head commit cannot be amended [branch: %s, reason: %s]", err.BranchName, err.Reason)
+}
+
+// ErrForceNotAllowed represents a "ForceNotAllowed" kind of error.
+type ErrForceNotAllowed struct {
+	BranchName string
+	Reason     string
+}
+
+// IsErrForceNotAllowed checks if an error is a ErrForceNotAllowed.
+func IsErrForceNotAllowed(err error) bool {
+	_, ok := err.(ErrForceNotAllowed)
+	return ok
+}
+
+func (err ErrForceNotAllowed) Error() string {
+	return fmt.Sprintf("branch cannot be force-updated [branch: %s, reason: %s]", err.BranchName, err.Reason)
+}
+
+// ErrForkNotAllowed represents a "ForkNotAllowed" kind of error.
+type ErrForkNotAllowed struct {
+	ForkName string
+	UserName string
+	Reason   string
+}
+
+// IsErrForkNotAllowed checks if an error is a ErrForkNotAllowed.
+func IsErrForkNotAllowed(err error) bool {
+	_, ok := err.(ErrForkNotAllowed)
+	return ok
+}
+
+func (err ErrForkNotAllowed) Error() string {
+	return fmt.Sprintf("fork cannot be committed to [fork: %s, user: %s, reason: %s]", err.ForkName, err.UserName, err.Reason)
+}
+
+// ErrNotFastForward represents an error that a push would not fast-forward a branch to the new commit
+type ErrNotFastForward struct {
+	BranchName string
+}
+
+// IsErrNotFastForward checks if an error is a ErrNotFastForward.
+func IsErrNotFastForward(err error) bool {
+	_, ok := err.(ErrNotFastForward)
+	return ok
+}
+
+func (err ErrNotFastForward) Error() string {
+	return fmt.Sprintf("push is not a fast-forward of the branch [branch: %s]", err.BranchName)
+}
+
+// ErrEntryIsSubmodule represents a "EntryIsSubmodule" kind of error.
+type ErrEntryIsSubmodule struct {
+	Path string
+}
+
+// IsErrEntryIsSubmodule checks if an error is a ErrEntryIsSubmodule.
+func IsErrEntryIsSubmodule(err error) bool {
+	_, ok := err.(ErrEntryIsSubmodule)
+	return ok
+}
+
+func (err ErrEntryIsSubmodule) Error() string {
+	return fmt.Sprintf("entry is a submodule [path: %s]", err.Path)
+}
+
+// ErrFileIgnored represents a "FileIgnored" kind of error.
+type ErrFileIgnored struct {
+	Path    string
+	Pattern string
+}
+
+// IsErrFileIgnored checks if an error is a ErrFileIgnored.
+func IsErrFileIgnored(err error) bool {
+	_, ok := err.(ErrFileIgnored)
+	return ok
+}
+
+func (err ErrFileIgnored) Error() string {
+	return fmt.Sprintf("file is ignored by git [path: %s, pattern: %s]", err.Path, err.Pattern)
+}
+
+// ErrFilterUnavailable represents a "FilterUnavailable" kind of error.
+type ErrFilterUnavailable struct {
+	Path   string
+	Filter string
+}
+
+// IsErrFilterUnavailable checks if an error is a ErrFilterUnavailable.
+func IsErrFilterUnavailable(err error) bool {
+	_, ok := err.(ErrFilterUnavailable)
+	return ok
+}
+
+func (err ErrFilterUnavailable) Error() string {
+	return fmt.Sprintf("filter driver of the file is not configured [path: %s, filter: %s]", err.Path, err.Filter)
+}
+
+// ErrCommitPolicyDenied represents a "CommitPolicyDenied" kind of error.
+type ErrCommitPolicyDenied struct {
+	BranchName string
+	Reason     string
+}
+
+// IsErrCommitPolicyDenied checks if an error is a ErrCommitPolicyDenied.
+func IsErrCommitPolicyDenied(err error) bool {
+	_, ok := err.(ErrCommitPolicyDenied)
+	return ok
+}
+
+func (err ErrCommitPolicyDenied) Error() string {
+	return fmt.Sprintf("commit policy denied the changes [branch: %s, reason: %s]", err.BranchName, err.Reason)
+}
+
+// ErrPathNotAllowed represents a "PathNotAllowed" kind of error.
+type ErrPathNotAllowed struct {
+	BranchName string
+	Path       string
+	Reason     string
+}
+
+// IsErrPathNotAllowed checks if an error is a ErrPathNotAllowed.
+func IsErrPathNotAllowed(err error) bool {
+	_, ok := err.(ErrPathNotAllowed)
+	return ok
+}
+
+func (err ErrPathNotAllowed) Error() string {
+	return fmt.Sprintf("path may not be changed [branch: %s, path: %s, reason: %s]", err.BranchName, err.Path, err.Reason)
+}
+
+// ErrPatchConflict represents a "PatchConflict" kind of error.
+type ErrPatchConflict struct {
+	Path          string
+	RejectedHunks []string
+}
+
+// IsErrPatchConflict checks if an error is a ErrPatchConflict.
+func IsErrPatchConflict(err error) bool {
+	_, ok := err.(ErrPatchConflict)
+	return ok
+}
+
+func (err ErrPatchConflict) Error() string {
+	return fmt.Sprintf("patch does not apply cleanly [path: %s, rejected hunks: %d]", err.Path, len(err.RejectedHunks))
+}
+
+// ErrFileTooBig represents a "FileTooBig" kind of error.
+type ErrFileTooBig struct {
+	Path    string
+	MaxSize int64
+}
+
+// IsErrFileTooBig checks if an error is a ErrFileTooBig.
+func IsErrFileTooBig(err error) bool {
+	_, ok := err.(ErrFileTooBig)
+	return ok
+}
+
+func (err ErrFileTooBig) Error() string {
+	return fmt.Sprintf("file is too big [path: %s, max size: %d]", err.Path, err.MaxSize)
+}
+
+// ErrInvalidSymlinkTarget represents a "InvalidSymlinkTarget" kind of error.
+type ErrInvalidSymlinkTarget struct {
+	Path   string
+	Target string
+	Reason string
+}
+
+// IsErrInvalidSymlinkTarget checks if an error is a ErrInvalidSymlinkTarget.
+func IsErrInvalidSymlinkTarget(err error) bool {
+	_, ok := err.(ErrInvalidSymlinkTarget)
+	return ok
+}
+
+func (err ErrInvalidSymlinkTarget) Error() string {
+	return fmt.Sprintf("symlink target is invalid [path: %s, target: %s, reason: %s]", err.Path, err.Target, err.Reason)
+}
+
+// ErrInvalidCharset represents a "InvalidCharset" kind of error.
+type ErrInvalidCharset struct {
+	Path    string
+	Charset string
+	Reason  string
+}
+
+// IsErrInvalidCharset checks if an error is a ErrInvalidCharset.
+func IsErrInvalidCharset(err error) bool {
+	_, ok := err.(ErrInvalidCharset)
+	return ok
+}
+
+func (err ErrInvalidCharset) Error() string {
+	return fmt.Sprintf("charset is invalid [path: %s, charset: %s, reason: %s]", err.Path, err.Charset, err.Reason)
+}
+
+// ErrInvalidContentURL represents a "InvalidContentURL" kind of error.
+type ErrInvalidContentURL struct {
+	Path   string
+	URL    string
+	Reason string
+}
+
+// IsErrInvalidContentURL checks if an error is a ErrInvalidContentURL.
+func IsErrInvalidContentURL(err error) bool {
+	_, ok := err.(ErrInvalidContentURL)
+	return ok
+}
+
+func (err ErrInvalidContentURL) Error() string {
+	return fmt.Sprintf("content URL is invalid [path: %s, url: %s, reason: %s]", err.Path, err.URL, err.Reason)
+}
+
+// ErrFileTemplateNotExist represents a "FileTemplateNotExist" kind of error.
+type ErrFileTemplateNotExist struct {
+	Name string
+}
+
+// IsErrFileTemplateNotExist checks if an error is a ErrFileTemplateNotExist.
+func IsErrFileTemplateNotExist(err error) bool {
+	_, ok := err.(ErrFileTemplateNotExist)
+	return ok
+}
+
+func (err ErrFileTemplateNotExist) Error() string {
+	return fmt.Sprintf("file template does not exist [name: %s]", err.Name)
+}
+
+// ErrInvalidFileTemplate represents a "InvalidFileTemplate" kind of error.
+type ErrInvalidFileTemplate struct {
+	Name   string
+	Reason string
+}
+
+// IsErrInvalidFileTemplate checks if an error is a ErrInvalidFileTemplate.
+func IsErrInvalidFileTemplate(err error) bool {
+	_, ok := err.(ErrInvalidFileTemplate)
+	return ok
+}
+
+func (err ErrInvalidFileTemplate) Error() string {
+	return fmt.Sprintf("file template is invalid [name: %s, reason: %s]", err.Name, err.Reason)
+}
+
+// ErrRepoIsEmpty represents a "RepoIsEmpty" kind of error.
+type ErrRepoIsEmpty struct {
+	RepoName string
+}
+
+// IsErrRepoIsEmpty checks if an error is a ErrRepoIsEmpty.
+func IsErrRepoIsEmpty(err error) bool {
+	_, ok := err.(ErrRepoIsEmpty)
+	return ok
+}
+
+func (err ErrRepoIsEmpty) Error() string {
+	return fmt.Sprintf("repository is empty [repo: %s]", err.RepoName)
+}
+
 // ErrUserDoesNotHaveAccessToRepo represets an error where the user doesn't has access to a given repo
 type ErrUserDoesNotHaveAccessToRepo struct {
 	UserID   int64
@@ -749,6 +1399,22 @@ func (err ErrUserDoesNotHaveAccessToRepo) Error() string {
 	return fmt.Sprintf("user doesn't have acces to repo [user_id: %d, repo_name: %s]", err.UserID, err.RepoName)
 }
 
+// ErrBulkChangeNotAllowed represents a "BulkChangeNotAllowed" kind of error.
+type ErrBulkChangeNotAllowed struct {
+	UserName string
+	Reason   string
+}
+
+// IsErrBulkChangeNotAllowed checks if an error is a ErrBulkChangeNotAllowed.
+func IsErrBulkChangeNotAllowed(err error) bool {
+	_, ok := err.(ErrBulkChangeNotAllowed)
+	return ok
+}
+
+func (err ErrBulkChangeNotAllowed) Error() string {
+	return fmt.Sprintf("user cannot make bulk changes [user: %s, reason: %s]", err.UserName, err.Reason)
+}
+
 // __________                             .__
 // \______   \____________    ____   ____ |  |__
 //  |    |  _/\_  __ \__  \  /    \_/ ___\|  |  \
@@ -801,6 +1467,91 @@ func (err ErrBranchNameConflict) Error() string {
 	return fmt.Sprintf("branch conflicts with existing branch [name: %s]", err.BranchName)
 }
 
+// ErrBranchNameInvalid represents an error that a branch name is not a valid git branch name
+type ErrBranchNameInvalid struct {
+	BranchName string
+}
+
+// IsErrBranchNameInvalid checks if an error is an ErrBranchNameInvalid.
+func IsErrBranchNameInvalid(err error) bool {
+	_, ok := err.(ErrBranchNameInvalid)
+	return ok
+}
+
+func (err ErrBranchNameInvalid) Error() string {
+	return fmt.Sprintf("branch name is invalid [name: %s]", err.BranchName)
+}
+
+// ErrIdempotencyKeyNotExist represents a "IdempotencyKeyNotExist" kind of error.
+type ErrIdempotencyKeyNotExist struct {
+	RepoID int64
+	DoerID int64
+	Branch string
+	Key    string
+}
+
+// IsErrIdempotencyKeyNotExist checks if an error is a ErrIdempotencyKeyNotExist.
+func IsErrIdempotencyKeyNotExist(err error) bool {
+	_, ok := err.(ErrIdempotencyKeyNotExist)
+	return ok
+}
+
+func (err ErrIdempotencyKeyNotExist) Error() string {
+	return fmt.Sprintf("idempotency key does not exist [repo_id: %d, doer_id: %d, branch: %s, key: %s]", err.RepoID, err.DoerID, err.Branch, err.Key)
+}
+
+// ErrIdempotencyKeyConflict represents an error that an idempotency key was given again to
+// changes other than the ones it was first given to
+type ErrIdempotencyKeyConflict struct {
+	Branch string
+	Key    string
+}
+
+// IsErrIdempotencyKeyConflict checks if an error is a ErrIdempotencyKeyConflict.
+func IsErrIdempotencyKeyConflict(err error) bool {
+	_, ok := err.(ErrIdempotencyKeyConflict)
+	return ok
+}
+
+func (err ErrIdempotencyKeyConflict) Error() string {
+	return fmt.Sprintf("idempotency key was given to other changes [branch: %s, key: %s]", err.Branch, err.Key)
+}
+
+// ErrTemporarilyUnavailable represents an error that a resource needed by an operation is busy,
+// the operation being expected to succeed when retried after RetryAfter
+type ErrTemporarilyUnavailable struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+// IsErrTemporarilyUnavailable checks if an error is an ErrTemporarilyUnavailable.
+func IsErrTemporarilyUnavailable(err error) bool {
+	_, ok := err.(ErrTemporarilyUnavailable)
+	return ok
+}
+
+func (err ErrTemporarilyUnavailable) Error() string {
+	return fmt.Sprintf("temporarily unavailable [reason: %s, retry_after: %v]", err.Reason, err.RetryAfter)
+}
+
+// ErrPushRejected represents an error that a hook of the repository refused a push to a branch
+type ErrPushRejected struct {
+	BranchName string
+	Hook       string
+	// Message is what the hook wrote to explain why, if anything
+	Message string
+}
+
+// IsErrPushRejected checks if an error is an ErrPushRejected.
+func IsErrPushRejected(err error) bool {
+	_, ok := err.(ErrPushRejected)
+	return ok
+}
+
+func (err ErrPushRejected) Error() string {
+	return fmt.Sprintf("push rejected by the %s hook [branch: %s]: %s", err.Hook, err.BranchName, err.Message)
+}
+
 // ErrNotAllowedToMerge represents an error that a branch is protected and the current user is not allowed to modify it
 type ErrNotAllowedToMerge struct {
 	Reason string
@@ -816,6 +1567,23 @@ func (err ErrNotAllowedToMerge) Error() string {
 	return fmt.Sprintf("not allowed to merge [reason: %s]", err.Reason)
 }
 
+// ErrNotAllowedToPush represents an error that a branch is protected and the given user is not allowed to push to it
+type ErrNotAllowedToPush struct {
+	BranchName string
+	UserName   string
+	Reason     string
+}
+
+// IsErrNotAllowedToPush checks if an error is an ErrNotAllowedToPush.
+func IsErrNotAllowedToPush(err error) bool {
+	_, ok := err.(ErrNotAllowedToPush)
+	return ok
+}
+
+func (err ErrNotAllowedToPush) Error() string {
+	return fmt.Sprintf("not allowed to push to protected branch [branch: %s, user: %s, reason: %s]", err.BranchName, err.UserName, err.Reason)
+}
+
 // ErrTagAlreadyExists represents an error that tag with such name already exists
 type ErrTagAlreadyExists struct {
 	TagName string
@@ -0,0 +1,59 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"time"
+
+	"code.gitea.io/gitea/modules/util"
+)
+
+// IdempotencyKey represents a key given by a user to a file operation on a branch of a repository,
+// along with the hash of the request of the operation and its response, to return again when the
+// user gives the key again with the same request
+type IdempotencyKey struct {
+	ID          int64          `xorm:"pk autoincr"`
+	RepoID      int64          `xorm:"UNIQUE(s) NOT NULL"`
+	DoerID      int64          `xorm:"UNIQUE(s) NOT NULL DEFAULT 0"`
+	Branch      string         `xorm:"UNIQUE(s) NOT NULL"`
+	Key         string         `xorm:"UNIQUE(s) NOT NULL"`
+	RequestHash string         `xorm:"VARCHAR(64) NOT NULL DEFAULT ''"`
+	Response    string         `xorm:"LONGTEXT NOT NULL"`
+	CreatedUnix util.TimeStamp `xorm:"INDEX created"`
+}
+
+// GetIdempotencyKey returns the idempotency key given by a user on a branch of a repository
+func GetIdempotencyKey(repoID, doerID int64, branch, key string) (*IdempotencyKey, error) {
+	idempotencyKey := &IdempotencyKey{RepoID: repoID, DoerID: doerID, Branch: branch, Key: key}
+	if has, err := x.Get(idempotencyKey); err != nil {
+		return nil, err
+	} else if !has {
+		return nil, ErrIdempotencyKeyNotExist{RepoID: repoID, DoerID: doerID, Branch: branch, Key: key}
+	}
+	return idempotencyKey, nil
+}
+
+// NewIdempotencyKey records the given idempotency key
+func NewIdempotencyKey(idempotencyKey *IdempotencyKey) error {
+	_, err := x.Insert(idempotencyKey)
+	return err
+}
+
+// DeleteIdempotencyKey deletes the given idempotency key
+func DeleteIdempotencyKey(idempotencyKey *IdempotencyKey) error {
+	_, err := x.ID(idempotencyKey.ID).Delete(new(IdempotencyKey))
+	return err
+}
+
+// IsOlderThan returns whether the idempotency key was recorded for as long as the given duration
+func (idempotencyKey *IdempotencyKey) IsOlderThan(maxAge time.Duration) bool {
+	return int64(idempotencyKey.CreatedUnix) <= time.Now().Add(-maxAge).Unix()
+}
+
+// DeleteIdempotencyKeysOlderThan deletes the idempotency keys recorded for as long as the given duration
+func DeleteIdempotencyKeysOlderThan(maxAge time.Duration) error {
+	_, err := x.Where("created_unix <= ?", time.Now().Add(-maxAge).Unix()).Delete(new(IdempotencyKey))
+	return err
+}
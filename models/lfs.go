@@ -105,3 +105,8 @@ func (repo *Repository) RemoveLFSMetaObjectByOid(oid string) error {
 
 	return sess.Commit()
 }
+
+// GetLFSSize returns the total size of the LFS objects of the repository
+func (repo *Repository) GetLFSSize() (int64, error) {
+	return x.Where("repository_id = ?", repo.ID).SumInt(new(LFSMetaObject), "size")
+}
@@ -210,6 +210,22 @@ var migrations = []Migration{
 	NewMigration("add theme to users", addUserDefaultTheme),
 	// v78 -> v79
 	NewMigration("rename repo is_bare to repo is_empty", renameRepoIsBareToIsEmpty),
+	// v79 -> v80
+	NewMigration("add require signed commits to protected branches", addRequireSignedCommitsToProtectedBranches),
+	// v80 -> v81
+	NewMigration("add max file size to repositories", addMaxFileSizeToRepository),
+	// v81 -> v82
+	NewMigration("add idempotency keys of file operations", addIdempotencyKeyTable),
+	// v82 -> v83
+	NewMigration("add commit message rules to repositories", addCommitMessageRulesToRepository),
+	// v83 -> v84
+	NewMigration("add reject case conflicts to repositories", addRejectCaseConflictsToRepository),
+	// v84 -> v85
+	NewMigration("add formatters to repositories", addFormattersToRepository),
+	// v85 -> v86
+	NewMigration("add trailing whitespace policy to repositories", addTrailingWhitespacePolicyToRepository),
+	// v86 -> v87
+	NewMigration("add validate data files to repositories", addValidateDataFilesToRepository),
 }
 
 // Migrate database to current version
@@ -0,0 +1,25 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package migrations
+
+import (
+	"code.gitea.io/gitea/modules/util"
+
+	"github.com/go-xorm/xorm"
+)
+
+func addIdempotencyKeyTable(x *xorm.Engine) error {
+	type IdempotencyKey struct {
+		ID          int64          `xorm:"pk autoincr"`
+		RepoID      int64          `xorm:"UNIQUE(s) NOT NULL"`
+		DoerID      int64          `xorm:"UNIQUE(s) NOT NULL DEFAULT 0"`
+		Branch      string         `xorm:"UNIQUE(s) NOT NULL"`
+		Key         string         `xorm:"UNIQUE(s) NOT NULL"`
+		RequestHash string         `xorm:"VARCHAR(64) NOT NULL DEFAULT ''"`
+		Response    string         `xorm:"LONGTEXT NOT NULL"`
+		CreatedUnix util.TimeStamp `xorm:"INDEX created"`
+	}
+	return x.Sync2(new(IdempotencyKey))
+}
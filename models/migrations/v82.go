@@ -0,0 +1,16 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package migrations
+
+import "github.com/go-xorm/xorm"
+
+func addCommitMessageRulesToRepository(x *xorm.Engine) error {
+	type Repository struct {
+		CommitMessageMaxSubjectLength int    `xorm:"NOT NULL DEFAULT 0"`
+		CommitMessageRequireBlankLine bool   `xorm:"NOT NULL DEFAULT false"`
+		CommitMessagePattern          string `xorm:"TEXT"`
+	}
+	return x.Sync2(new(Repository))
+}
@@ -0,0 +1,14 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package migrations
+
+import "github.com/go-xorm/xorm"
+
+func addFormattersToRepository(x *xorm.Engine) error {
+	type Repository struct {
+		Formatters map[string]string `xorm:"TEXT JSON"`
+	}
+	return x.Sync2(new(Repository))
+}
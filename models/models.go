@@ -125,6 +125,7 @@ func init() {
 		new(U2FRegistration),
 		new(TeamUnit),
 		new(Review),
+		new(IdempotencyKey),
 	)
 
 	gonicNames := []string{"SSL", "UID"}
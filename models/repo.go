@@ -160,6 +160,18 @@ func NewRepoContext() {
 	RemoveAllWithNotice("Clean up repository temporary data", filepath.Join(setting.AppDataPath, "tmp"))
 }
 
+// TrailingWhitespacePolicy is how the file operations normalize the end of the lines of text files
+type TrailingWhitespacePolicy string
+
+const (
+	// TrailingWhitespaceKeep commits the content as it is
+	TrailingWhitespaceKeep TrailingWhitespacePolicy = ""
+	// TrailingWhitespaceSingleNewline ends the content of non-empty files with exactly one newline
+	TrailingWhitespaceSingleNewline TrailingWhitespacePolicy = "single-newline"
+	// TrailingWhitespaceStrip removes the spaces and tabs ending each line
+	TrailingWhitespaceStrip TrailingWhitespacePolicy = "strip"
+)
+
 // Repository represents a git repository.
 type Repository struct {
 	ID            int64  `xorm:"pk autoincr"`
@@ -202,7 +214,24 @@ type Repository struct {
 	Size          int64              `xorm:"NOT NULL DEFAULT 0"`
 	IndexerStatus *RepoIndexerStatus `xorm:"-"`
 	IsFsckEnabled bool               `xorm:"NOT NULL DEFAULT true"`
-	Topics        []string           `xorm:"TEXT JSON"`
+	// MaxFileSize overrides setting.Repository.MaxFileSize when not 0
+	MaxFileSize int64    `xorm:"NOT NULL DEFAULT 0"`
+	Topics      []string `xorm:"TEXT JSON"`
+	// CommitMessageMaxSubjectLength, CommitMessageRequireBlankLine and CommitMessagePattern are the
+	// rules of the messages of the commits made by the file operations, not checked when unset
+	CommitMessageMaxSubjectLength int    `xorm:"NOT NULL DEFAULT 0"`
+	CommitMessageRequireBlankLine bool   `xorm:"NOT NULL DEFAULT false"`
+	CommitMessagePattern          string `xorm:"TEXT"`
+	// RejectCaseConflicts makes the file operations refuse paths only differing in case from
+	// another entry, which can't both be checked out on case-insensitive filesystems
+	RejectCaseConflicts bool `xorm:"NOT NULL DEFAULT false"`
+	// Formatters are the names of the formatters the file operations format the content of the
+	// files with, by the extension of the files such as ".go", see repofiles.RegisterFormatter
+	Formatters map[string]string `xorm:"TEXT JSON"`
+	// TrailingWhitespacePolicy normalizes the content of the text files committed by the file operations
+	TrailingWhitespacePolicy TrailingWhitespacePolicy `xorm:"VARCHAR(20) NOT NULL DEFAULT ''"`
+	// ValidateDataFiles makes the file operations refuse JSON and YAML files which don't parse
+	ValidateDataFiles bool `xorm:"NOT NULL DEFAULT false"`
 
 	CreatedUnix util.TimeStamp `xorm:"INDEX created"`
 	UpdatedUnix util.TimeStamp `xorm:"INDEX updated"`
@@ -1783,6 +1812,7 @@ func DeleteRepository(doer *User, uid, repoID int64) error {
 		&Webhook{RepoID: repoID},
 		&HookTask{RepoID: repoID},
 		&Notification{RepoID: repoID},
+		&IdempotencyKey{RepoID: repoID},
 	); err != nil {
 		return fmt.Errorf("deleteBeans: %v", err)
 	}
@@ -147,6 +147,7 @@ type ProtectBranchForm struct {
 	RequiredApprovals       int64
 	ApprovalsWhitelistUsers string
 	ApprovalsWhitelistTeams string
+	RequireSignedCommits    bool
 }
 
 // Validate validates the fields
@@ -490,7 +491,7 @@ func (f *NewWikiForm) Validate(ctx *macaron.Context, errs binding.Errors) bindin
 // EditRepoFileForm form for changing repository file
 type EditRepoFileForm struct {
 	TreePath      string `binding:"Required;MaxSize(500)"`
-	Content       string `binding:"Required"`
+	Content       string
 	CommitSummary string `binding:"MaxSize(100)"`
 	CommitMessage string
 	CommitChoice  string `binding:"Required;MaxSize(50)"`
@@ -498,8 +499,11 @@ type EditRepoFileForm struct {
 	LastCommit    string
 }
 
-// Validate validates the fields
+// Validate validates the fields, the content being required to be sent even though it may be empty
 func (f *EditRepoFileForm) Validate(ctx *macaron.Context, errs binding.Errors) binding.Errors {
+	if _, ok := ctx.Req.Form["content"]; !ok {
+		errs.Add([]string{"Content"}, binding.ERR_REQUIRED, "Required")
+	}
 	return validate(errs, ctx.Data, f, ctx.Locale)
 }
 
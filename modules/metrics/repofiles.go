@@ -0,0 +1,25 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// RepoFilesPhaseDuration observes how long the phases of the file operations take, by phase:
+	// clone, write-tree, commit and push
+	RepoFilesPhaseDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    namespace + "repofiles_phase_duration_seconds",
+		Help:    "Duration of the phases of the file operations",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"phase"})
+
+	// RepoFilesOperations counts the file operations, by operation and result: success or failure
+	RepoFilesOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: namespace + "repofiles_operations_total",
+		Help: "Number of file operations",
+	}, []string{"operation", "result"})
+)
@@ -0,0 +1,82 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/setting"
+)
+
+// checkAmend makes sure the given doer may amend the head commit of the branch of the changes of
+// the given options
+func checkAmend(repo *models.Repository, doer *models.User, opts *ChangeRepoFilesOptions) error {
+	reason := ""
+	switch {
+	case !opts.Force:
+		// Amending rewrites the history of the branch as forcing does
+		reason = "not forced"
+	case repo.IsEmpty:
+		reason = "no commit to amend"
+	case opts.CreateNewBranch:
+		reason = "new branch"
+	case len(opts.AdditionalParents) > 0:
+		reason = "additional parents"
+	case opts.bulkChange != nil:
+		reason = "bulk change"
+	}
+	if reason == "" {
+		// Rewriting the history of a protected branch is never allowed
+		protectBranch, err := models.GetProtectedBranchBy(repo.ID, opts.NewBranch)
+		if err != nil {
+			return err
+		} else if protectBranch != nil {
+			reason = "protected branch"
+		}
+	}
+	if reason == "" {
+		// Replacing a commit others may have fetched already is up to the admins of the repository
+		perm, err := models.GetUserRepoPermission(repo, doer)
+		if err != nil {
+			return err
+		} else if !perm.IsAdmin() {
+			reason = "not a repository admin"
+		}
+	}
+	if reason != "" {
+		return models.ErrAmendNotAllowed{BranchName: opts.NewBranch, Reason: reason}
+	}
+	return nil
+}
+
+// checkAmendedCommit makes sure the given doer may amend the given head commit of the given branch,
+// which has to be authored by the doer unless amending the commits of others is allowed
+func checkAmendedCommit(doer *models.User, branch string, commit *git.Commit) error {
+	if setting.Repository.AllowAmendOthersCommits {
+		return nil
+	}
+	author, err := models.GetUserByEmail(commit.Author.Email)
+	if err != nil && !models.IsErrUserNotExist(err) {
+		return err
+	}
+	if author == nil || author.ID != doer.ID {
+		return models.ErrAmendNotAllowed{BranchName: branch, Reason: "commit of another author"}
+	}
+	return nil
+}
+
+// getParentIDs returns the IDs of the parents of the given commit, the amended commit replacing it
+// having the same parents
+func getParentIDs(commit *git.Commit) ([]string, error) {
+	parents := make([]string, 0, commit.ParentCount())
+	for i := 0; i < commit.ParentCount(); i++ {
+		parentID, err := commit.ParentID(i)
+		if err != nil {
+			return nil, err
+		}
+		parents = append(parents, parentID.String())
+	}
+	return parents, nil
+}
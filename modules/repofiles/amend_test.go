@@ -0,0 +1,170 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"testing"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/setting"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getBranchCommit(t *testing.T, repo *models.Repository, branch string) *git.Commit {
+	gitRepo, err := git.OpenRepository(repo.RepoPath())
+	assert.NoError(t, err)
+	commit, err := gitRepo.GetBranchCommit(branch)
+	assert.NoError(t, err)
+	return commit
+}
+
+func TestUpdateRepoFile_Amend(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	baseCommit := getBranchCommit(t, repo, "master")
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{Message: "Add new file"},
+		TreePath:      "new_file.txt",
+		Content:       "tpyo\n",
+	})
+	assert.NoError(t, err)
+	headCommit := getBranchCommit(t, repo, "master")
+	commitsCount := getCommitsCount(t, repo, "master")
+
+	fileResponse, err := UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		CommitOptions: CommitOptions{Amend: true, Force: true},
+		TreePath:      "new_file.txt",
+		Content:       "typo\n",
+	})
+	assert.NoError(t, err)
+	amendedCommit := getBranchCommit(t, repo, "master")
+	assert.EqualValues(t, amendedCommit.ID.String(), fileResponse.Commit.SHA)
+	assert.NotEqual(t, headCommit.ID.String(), amendedCommit.ID.String())
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+
+	// The amended commit replaces the head commit, with its parent, message and author
+	assert.EqualValues(t, 1, amendedCommit.ParentCount())
+	parentID, err := amendedCommit.ParentID(0)
+	assert.NoError(t, err)
+	assert.EqualValues(t, baseCommit.ID.String(), parentID.String())
+	assert.EqualValues(t, "Add new file", amendedCommit.Summary())
+	assert.EqualValues(t, headCommit.Author.Email, amendedCommit.Author.Email)
+	assert.EqualValues(t, headCommit.Author.When.Unix(), amendedCommit.Author.When.Unix())
+
+	// Its tree combines both changes
+	assert.NotEqual(t, headCommit.Tree.ID.String(), amendedCommit.Tree.ID.String())
+	assert.EqualValues(t, "typo\n", getBranchFileContent(t, repo, "master", "new_file.txt"))
+
+	// A new message replaces the one of the head commit
+	_, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		CommitOptions: CommitOptions{
+			Message: "Add a new file",
+			Amend:   true,
+			Force:   true,
+		},
+		TreePath: "new_file.txt",
+		Content:  "typo fixed\n",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "Add a new file", getBranchCommit(t, repo, "master").Summary())
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+}
+
+func TestUpdateRepoFile_AmendNotAllowed(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	other := models.AssertExistsAndLoadBean(t, &models.User{ID: 4}).(*models.User)
+	_, err := CreateRepoFile(repo, other, &CreateRepoFileOptions{
+		TreePath: "new_file.txt",
+		Content:  "content\n",
+	})
+	assert.NoError(t, err)
+	headCommit := getBranchCommit(t, repo, "master")
+
+	amend := func(opts *UpdateRepoFileOptions) error {
+		opts.TreePath = "new_file.txt"
+		opts.Content = "amended\n"
+		opts.Amend = true
+		opts.Force = true
+		_, err := UpdateRepoFile(repo, doer, opts)
+		return err
+	}
+	for _, test := range []struct {
+		opts   *UpdateRepoFileOptions
+		reason string
+	}{
+		{&UpdateRepoFileOptions{}, "commit of another author"},
+		{&UpdateRepoFileOptions{CommitOptions: CommitOptions{NewBranch: "new_branch", CreateNewBranch: true}}, "new branch"},
+	} {
+		err := amend(test.opts)
+		if assert.True(t, models.IsErrAmendNotAllowed(err), "%v", err) {
+			assert.EqualValues(t, test.reason, err.(models.ErrAmendNotAllowed).Reason)
+		}
+	}
+	assert.EqualValues(t, headCommit.ID.String(), getBranchCommit(t, repo, "master").ID.String())
+
+	// Amending rewrites the history of the branch, so it has to be forced
+	_, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		CommitOptions: CommitOptions{Amend: true},
+		TreePath:      "new_file.txt",
+		Content:       "amended\n",
+	})
+	if assert.True(t, models.IsErrAmendNotAllowed(err), "%v", err) {
+		assert.EqualValues(t, "not forced", err.(models.ErrAmendNotAllowed).Reason)
+	}
+	assert.EqualValues(t, headCommit.ID.String(), getBranchCommit(t, repo, "master").ID.String())
+
+	// Amending the commits of others can be allowed
+	oldAllowAmendOthersCommits := setting.Repository.AllowAmendOthersCommits
+	setting.Repository.AllowAmendOthersCommits = true
+	defer func() {
+		setting.Repository.AllowAmendOthersCommits = oldAllowAmendOthersCommits
+	}()
+	assert.NoError(t, amend(&UpdateRepoFileOptions{}))
+	amendedCommit := getBranchCommit(t, repo, "master")
+	assert.NotEqual(t, headCommit.ID.String(), amendedCommit.ID.String())
+	assert.EqualValues(t, headCommit.Author.Email, amendedCommit.Author.Email)
+
+	// But protected branches are never amended
+	protectBranch := &models.ProtectedBranch{
+		RepoID:     repo.ID,
+		BranchName: "master",
+		CanPush:    true,
+	}
+	assert.NoError(t, models.UpdateProtectBranch(repo, protectBranch, models.WhitelistOptions{}))
+	err = amend(&UpdateRepoFileOptions{})
+	if assert.True(t, models.IsErrAmendNotAllowed(err), "%v", err) {
+		assert.EqualValues(t, "protected branch", err.(models.ErrAmendNotAllowed).Reason)
+	}
+	assert.EqualValues(t, amendedCommit.ID.String(), getBranchCommit(t, repo, "master").ID.String())
+}
+
+func TestUpdateRepoFile_AmendNotAdmin(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	writer := models.AssertExistsAndLoadBean(t, &models.User{ID: 4}).(*models.User)
+	assert.NoError(t, repo.GetOwner())
+	assert.NoError(t, repo.AddCollaborator(writer))
+
+	_, err := CreateRepoFile(repo, writer, &CreateRepoFileOptions{
+		TreePath: "new_file.txt",
+		Content:  "tpyo\n",
+	})
+	assert.NoError(t, err)
+	headCommit := getBranchCommit(t, repo, "master")
+
+	// Even their own commit may not be amended by a plain writer of the repository
+	_, err = UpdateRepoFile(repo, writer, &UpdateRepoFileOptions{
+		CommitOptions: CommitOptions{Amend: true, Force: true},
+		TreePath:      "new_file.txt",
+		Content:       "typo\n",
+	})
+	if assert.True(t, models.IsErrAmendNotAllowed(err), "%v", err) {
+		assert.EqualValues(t, models.ErrAmendNotAllowed{BranchName: "master", Reason: "not a repository admin"}, err)
+	}
+	assert.EqualValues(t, headCommit.ID.String(), getBranchCommit(t, repo, "master").ID.String())
+}
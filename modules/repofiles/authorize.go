@@ -0,0 +1,97 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"code.gitea.io/gitea/models"
+)
+
+// PathAuthorizationRequest describes the paths a doer changes that a path authorizer is asked about
+type PathAuthorizationRequest struct {
+	Repo *models.Repository
+	Doer *models.User
+	// Branch is the branch the changes are pushed to
+	Branch string
+	// Paths are the paths written or deleted by the changes, sorted. A directory deleted or renamed
+	// is given by its own path, the files beneath it being changed along.
+	Paths []string
+}
+
+// PathAuthorizationDecision is the answer of a path authorizer: the changes go on if allowed,
+// otherwise the first path denied is given to the doer with the reason
+type PathAuthorizationDecision struct {
+	Allowed bool
+	Path    string
+	Reason  string
+}
+
+// PathAuthorizer allows or denies the doer changing paths through ChangeRepoFiles, e.g. to only let
+// the owners of a directory change its files, beyond the protection of the branch. It is asked
+// before anything is committed, an error aborting the operation rather than denying it.
+type PathAuthorizer interface {
+	AuthorizePaths(request *PathAuthorizationRequest) (*PathAuthorizationDecision, error)
+}
+
+var (
+	pathAuthorizersLock sync.RWMutex
+	pathAuthorizers     []PathAuthorizer
+)
+
+// RegisterPathAuthorizer adds an authorizer the paths changed through ChangeRepoFiles must be allowed
+// by. Authorizers are asked in the order they are registered, which may be at any time.
+func RegisterPathAuthorizer(authorizer PathAuthorizer) {
+	if authorizer == nil {
+		panic("repofiles: RegisterPathAuthorizer authorizer is nil")
+	}
+	pathAuthorizersLock.Lock()
+	defer pathAuthorizersLock.Unlock()
+	pathAuthorizers = append(pathAuthorizers, authorizer)
+}
+
+// getPathAuthorizers returns the authorizers registered so far
+func getPathAuthorizers() []PathAuthorizer {
+	pathAuthorizersLock.RLock()
+	defer pathAuthorizersLock.RUnlock()
+	return pathAuthorizers
+}
+
+// checkPathAuthorizers asks the registered authorizers whether the doer may change the paths of the
+// given prepared files, returning ErrPathNotAllowed with the first path they deny
+func checkPathAuthorizers(repo *models.Repository, doer *models.User, branch string, files []*ChangeRepoFile) error {
+	authorizers := getPathAuthorizers()
+	if len(authorizers) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool, len(files))
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		for _, treePath := range []string{file.fromTreePath, file.treePath} {
+			if !seen[treePath] {
+				seen[treePath] = true
+				paths = append(paths, treePath)
+			}
+		}
+	}
+	sort.Strings(paths)
+
+	request := &PathAuthorizationRequest{Repo: repo, Doer: doer, Branch: branch, Paths: paths}
+	for _, authorizer := range authorizers {
+		decision, err := authorizer.AuthorizePaths(request)
+		if err != nil {
+			return fmt.Errorf("AuthorizePaths: %v", err)
+		} else if decision == nil || !decision.Allowed {
+			notAllowed := models.ErrPathNotAllowed{BranchName: branch}
+			if decision != nil {
+				notAllowed.Path, notAllowed.Reason = decision.Path, decision.Reason
+			}
+			return notAllowed
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"strings"
+	"testing"
+
+	"code.gitea.io/gitea/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ownersAuthorizer only lets the owners of a directory change the paths beneath it
+type ownersAuthorizer struct {
+	owners   map[string]int64
+	requests []*PathAuthorizationRequest
+}
+
+func (authorizer *ownersAuthorizer) AuthorizePaths(request *PathAuthorizationRequest) (*PathAuthorizationDecision, error) {
+	authorizer.requests = append(authorizer.requests, request)
+	for _, treePath := range request.Paths {
+		for dir, ownerID := range authorizer.owners {
+			if (treePath == dir || strings.HasPrefix(treePath, dir+"/")) && request.Doer.ID != ownerID {
+				return &PathAuthorizationDecision{Path: treePath, Reason: dir + " is owned by another user"}, nil
+			}
+		}
+	}
+	return &PathAuthorizationDecision{Allowed: true}, nil
+}
+
+func setPathAuthorizers(authorizers ...PathAuthorizer) func() {
+	oldAuthorizers := pathAuthorizers
+	pathAuthorizers = nil
+	for _, authorizer := range authorizers {
+		RegisterPathAuthorizer(authorizer)
+	}
+	return func() {
+		pathAuthorizers = oldAuthorizers
+	}
+}
+
+func TestChangeRepoFiles_PathAuthorizer(t *testing.T) {
+	// A nil authorizer is refused when registered rather than when changes are committed
+	assert.Panics(t, func() { RegisterPathAuthorizer(nil) })
+
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	pushTestFile(t, repo, doer, "deploy/prod.yml", "replicas: 1\n")
+	authorizer := &ownersAuthorizer{owners: map[string]int64{"deploy": 1}}
+	defer setPathAuthorizers(authorizer)()
+
+	// The batch fails as a whole when one of its paths is denied
+	commitsCount := getCommitsCount(t, repo, "master")
+	_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "docs/deploy.md", Content: "Deploying\n"},
+			{Operation: "update", TreePath: "deploy/prod.yml", Content: "replicas: 3\n"},
+		},
+	})
+	if assert.True(t, models.IsErrPathNotAllowed(err), "%v", err) {
+		assert.EqualValues(t, models.ErrPathNotAllowed{
+			BranchName: "master",
+			Path:       "deploy/prod.yml",
+			Reason:     "deploy is owned by another user",
+		}, err)
+	}
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+	if assert.Len(t, authorizer.requests, 1) {
+		assert.EqualValues(t, doer.ID, authorizer.requests[0].Doer.ID)
+		assert.EqualValues(t, "master", authorizer.requests[0].Branch)
+		assert.EqualValues(t, []string{"deploy/prod.yml", "docs/deploy.md"}, authorizer.requests[0].Paths)
+	}
+
+	// Moving a file out of the directory changes it too
+	_, err = ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{{Operation: "rename", FromTreePath: "deploy/prod.yml", TreePath: "prod.yml"}},
+	})
+	assert.True(t, models.IsErrPathNotAllowed(err), "%v", err)
+
+	_, err = ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{{Operation: "create", TreePath: "docs/deploy.md", Content: "Deploying\n"}},
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "Deploying\n", getBranchFileContent(t, repo, "master", "docs/deploy.md"))
+	assert.EqualValues(t, "replicas: 1\n", getBranchFileContent(t, repo, "master", "deploy/prod.yml"))
+}
@@ -0,0 +1,89 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"fmt"
+
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/structs"
+)
+
+// BulkChange commits many successive changes to a branch on behalf of a trusted importer, much
+// faster than as many calls to ChangeRepoFiles: the commits are pushed without running the git
+// hooks of the repository, and the push event is only simulated once they are all pushed.
+//
+// This comes at a price: the protected branch checks of the hooks are not made, and the push and
+// create webhooks, the activities of the watchers and the issue references are only processed for
+// the commits listed by that single push event. It must never be used for the changes of users,
+// of the API in particular, and only the site administrators may make bulk changes.
+type BulkChange struct {
+	repo        *models.Repository
+	doer        *models.User
+	branch      string
+	tmpRepo     *TemporaryUploadRepository
+	oldCommitID string
+	newCommitID string
+	finished    bool
+}
+
+// NewBulkChange starts a bulk change of the given branch of the given repository by the given
+// doer, which has to be a site administrator. The bulk change has to be finished by Finish.
+func NewBulkChange(repo *models.Repository, doer *models.User, branch string) (*BulkChange, error) {
+	if doer == nil {
+		return nil, models.ErrBulkChangeNotAllowed{Reason: "no doer"}
+	} else if !doer.IsAdmin {
+		return nil, models.ErrBulkChangeNotAllowed{UserName: doer.Name, Reason: "not a site administrator"}
+	}
+	tmpRepo, err := NewTemporaryUploadRepository(repo)
+	if err != nil {
+		return nil, err
+	}
+	return &BulkChange{
+		repo:    repo,
+		doer:    doer,
+		branch:  branch,
+		tmpRepo: tmpRepo,
+	}, nil
+}
+
+// ChangeRepoFiles commits the changes of the given options on top of the branch of the bulk change,
+// as ChangeRepoFiles does otherwise. The branch options are ignored.
+func (b *BulkChange) ChangeRepoFiles(opts *ChangeRepoFilesOptions) (*structs.FilesResponse, error) {
+	if b.finished {
+		return nil, fmt.Errorf("bulk change already finished")
+	}
+	if opts.CreatePullRequest {
+		return nil, fmt.Errorf("bulk change cannot create pull requests")
+	}
+	opts.OldBranch = b.branch
+	opts.NewBranch = b.branch
+	opts.CreateNewBranch = false
+	opts.TemporaryRepository = b.tmpRepo
+	opts.bulkChange = b
+	return ChangeRepoFiles(b.repo, b.doer, opts)
+}
+
+// pushed records that the given commit was pushed on top of the given one
+func (b *BulkChange) pushed(oldCommitID, commitHash string) {
+	if b.oldCommitID == "" {
+		b.oldCommitID = oldCommitID
+	}
+	b.newCommitID = commitHash
+}
+
+// Finish simulates the push event of all the commits of the bulk change, which then cannot be used anymore
+func (b *BulkChange) Finish() error {
+	if b.finished {
+		return nil
+	}
+	b.finished = true
+	b.tmpRepo.Close()
+
+	if b.newCommitID == "" {
+		return nil
+	}
+	return pushUpdate(b.repo, b.doer, b.branch, b.oldCommitID, b.newCommitID)
+}
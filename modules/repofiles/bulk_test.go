@@ -0,0 +1,158 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.gitea.io/gitea/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBulkChange(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 1}).(*models.User)
+
+	// The post-receive hook leaves a mark in the repository when it runs
+	marker := filepath.Join(repo.RepoPath(), "post-receive-ran")
+	assert.NoError(t, os.MkdirAll(filepath.Join(repo.RepoPath(), "hooks"), os.ModePerm))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(repo.RepoPath(), "hooks", "post-receive"),
+		[]byte("#!/usr/bin/env bash\ntouch post-receive-ran\n"), 0755))
+
+	// Only the site administrators may make bulk changes
+	owner := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	_, err := NewBulkChange(repo, owner, "master")
+	assert.True(t, models.IsErrBulkChangeNotAllowed(err), "%v", err)
+	_, err = NewBulkChange(repo, nil, "master")
+	assert.True(t, models.IsErrBulkChangeNotAllowed(err), "%v", err)
+
+	bulkChange, err := NewBulkChange(repo, doer, "master")
+	assert.NoError(t, err)
+	var commitIDs []string
+	for i := 0; i < 3; i++ {
+		filesResponse, err := bulkChange.ChangeRepoFiles(&ChangeRepoFilesOptions{
+			Files: []*ChangeRepoFile{{Operation: "create", TreePath: fmt.Sprintf("file%d.txt", i), Content: "content"}},
+		})
+		assert.NoError(t, err)
+		commitIDs = append(commitIDs, filesResponse.Commit.SHA)
+	}
+	assert.EqualValues(t, "4", getCommitsCount(t, repo, "master"))
+	_, err = os.Stat(marker)
+	assert.True(t, os.IsNotExist(err))
+	assert.EqualValues(t, 0, models.GetCount(t, &models.HookTask{RepoID: repo.ID, HookID: 1, EventType: models.HookEventPush}))
+
+	// All the commits are in the single push event
+	assert.NoError(t, bulkChange.Finish())
+	hookTask := models.AssertExistsAndLoadBean(t, &models.HookTask{RepoID: repo.ID, HookID: 1, EventType: models.HookEventPush}).(*models.HookTask)
+	for _, commitID := range commitIDs {
+		assert.Contains(t, hookTask.PayloadContent, commitID)
+	}
+	_, err = bulkChange.ChangeRepoFiles(&ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{{Operation: "create", TreePath: "late.txt", Content: "late"}},
+	})
+	assert.Error(t, err)
+
+	// The hooks still run for the other changes
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "a.txt",
+		Content:  "a",
+	})
+	assert.NoError(t, err)
+	_, err = os.Stat(marker)
+	assert.NoError(t, err)
+}
+
+func benchmarkThousandEdits(b *testing.B, bulk bool) {
+	repo := prepareTestRepo(b, 1)
+	doer := models.AssertExistsAndLoadBean(b, &models.User{ID: 1}).(*models.User)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var bulkChange *BulkChange
+		var tmpRepo *TemporaryUploadRepository
+		var err error
+		if bulk {
+			bulkChange, err = NewBulkChange(repo, doer, "master")
+		} else {
+			tmpRepo, err = NewTemporaryUploadRepository(repo)
+		}
+		assert.NoError(b, err)
+		for j := 0; j < 1000; j++ {
+			opts := &ChangeRepoFilesOptions{
+				CommitOptions: CommitOptions{TemporaryRepository: tmpRepo},
+				Files:         []*ChangeRepoFile{{Operation: "create", TreePath: fmt.Sprintf("file%d-%d.txt", i, j), Content: "content"}},
+			}
+			if bulk {
+				_, err = bulkChange.ChangeRepoFiles(opts)
+			} else {
+				_, err = ChangeRepoFiles(repo, doer, opts)
+			}
+			assert.NoError(b, err)
+		}
+		if bulk {
+			assert.NoError(b, bulkChange.Finish())
+		} else {
+			tmpRepo.Close()
+		}
+	}
+}
+
+func BenchmarkThousandEdits(b *testing.B) {
+	benchmarkThousandEdits(b, false)
+}
+
+func BenchmarkThousandEdits_BulkChange(b *testing.B) {
+	benchmarkThousandEdits(b, true)
+}
+
+func TestBulkChange_Progress(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 1}).(*models.User)
+
+	var progresses []ChangeRepoFilesProgress
+	recordProgress := func(progress ChangeRepoFilesProgress) {
+		progresses = append(progresses, progress)
+	}
+	files := func(count int) []*ChangeRepoFile {
+		files := make([]*ChangeRepoFile, 0, count)
+		for i := 0; i < count; i++ {
+			files = append(files, &ChangeRepoFile{Operation: "create", TreePath: fmt.Sprintf("file%d.txt", i), Content: "0123456789"})
+		}
+		return files
+	}
+
+	bulkChange, err := NewBulkChange(repo, doer, "master")
+	assert.NoError(t, err)
+	defer bulkChange.Finish()
+	_, err = bulkChange.ChangeRepoFiles(&ChangeRepoFilesOptions{
+		Files:            files(5),
+		Progress:         recordProgress,
+		ProgressInterval: 2,
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, []ChangeRepoFilesProgress{
+		{Files: 2, TotalFiles: 5, Bytes: 20},
+		{Files: 4, TotalFiles: 5, Bytes: 40},
+		{Files: 5, TotalFiles: 5, Bytes: 50},
+	}, progresses)
+
+	// It is called for each file by default, deleted files writing nothing
+	progresses = nil
+	deletes := []*ChangeRepoFile{{Operation: "delete", TreePath: "file0.txt"}}
+	_, err = bulkChange.ChangeRepoFiles(&ChangeRepoFilesOptions{
+		Files:    append(deletes, files(6)[5:]...),
+		Progress: recordProgress,
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, []ChangeRepoFilesProgress{
+		{Files: 1, TotalFiles: 2, Bytes: 0},
+		{Files: 2, TotalFiles: 2, Bytes: 10},
+	}, progresses)
+}
@@ -0,0 +1,53 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"code.gitea.io/gitea/models"
+)
+
+// checkCaseConflicts makes sure none of the paths the given applied files write to, nor their
+// parent directories, only differs in case from another entry of the given tree, if the repository
+// rejects such conflicts. Conflicts between the entries left as they are don't fail the change.
+func checkCaseConflicts(repo *models.Repository, t *TemporaryUploadRepository, files []*ChangeRepoFile, treeHash string) error {
+	if !repo.RejectCaseConflicts {
+		return nil
+	}
+	treePaths := make([]string, 0, len(files))
+	for _, file := range files {
+		if file.Operation == "create" || file.Operation == "rename" || file.fromTreePath != file.treePath {
+			treePaths = append(treePaths, file.treePath)
+		}
+	}
+	if len(treePaths) == 0 {
+		return nil
+	}
+
+	// The entries of the tree, directories included, by their lower case path
+	stdout, stderr, err := t.execStdin("checkCaseConflicts (git ls-tree)", nil, "ls-tree", "-r", "-t", "-z", "--name-only", treeHash)
+	if err != nil {
+		return fmt.Errorf("checkCaseConflicts: %v %s", err, stderr)
+	}
+	entries := make(map[string][]string)
+	for _, entry := range strings.Split(strings.TrimSuffix(stdout, "\x00"), "\x00") {
+		lowerEntry := strings.ToLower(entry)
+		entries[lowerEntry] = append(entries[lowerEntry], entry)
+	}
+
+	for _, treePath := range treePaths {
+		for entryPath := treePath; entryPath != "."; entryPath = path.Dir(entryPath) {
+			for _, entry := range entries[strings.ToLower(entryPath)] {
+				if entry != entryPath {
+					return models.ErrPathCaseConflict{Path: entryPath, Entry: entry}
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"testing"
+
+	"code.gitea.io/gitea/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeRepoFiles_RejectCaseConflicts(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	pushTestFile(t, repo, doer, "docs/Guide.md", "guide")
+
+	// Git tells the paths apart unless the repository rejects them
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{
+			OldBranch:       "master",
+			NewBranch:       "case",
+			CreateNewBranch: true,
+		},
+		TreePath: "readme.md",
+		Content:  "readme",
+	})
+	assert.NoError(t, err)
+
+	repo.RejectCaseConflicts = true
+	assert.NoError(t, models.UpdateRepository(repo, false))
+	commitsCount := getCommitsCount(t, repo, "master")
+	for _, test := range []struct {
+		file *ChangeRepoFile
+		err  error
+	}{
+		{
+			&ChangeRepoFile{Operation: "create", TreePath: "readme.md", Content: "readme"},
+			models.ErrPathCaseConflict{Path: "readme.md", Entry: "README.md"},
+		},
+		{
+			&ChangeRepoFile{Operation: "create", TreePath: "Docs/index.md", Content: "index"},
+			models.ErrPathCaseConflict{Path: "Docs", Entry: "docs"},
+		},
+		{
+			&ChangeRepoFile{Operation: "rename", FromTreePath: "README.md", TreePath: "DOCS/README.md"},
+			models.ErrPathCaseConflict{Path: "DOCS", Entry: "docs"},
+		},
+	} {
+		_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{Files: []*ChangeRepoFile{test.file}})
+		assert.EqualValues(t, test.err, err)
+	}
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+
+	// Changing the case of a path is no conflict, nor are the ones already there
+	_, err = ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{Files: []*ChangeRepoFile{
+		{Operation: "rename", FromTreePath: "docs/Guide.md", TreePath: "docs/guide.md"},
+		{Operation: "create", TreePath: "docs/index.md", Content: "index"},
+	}})
+	assert.NoError(t, err)
+	_, err = ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		CommitOptions: CommitOptions{OldBranch: "case"},
+		Files:         []*ChangeRepoFile{{Operation: "update", TreePath: "readme.md", Content: "updated"}},
+	})
+	assert.NoError(t, err)
+}
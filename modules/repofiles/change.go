@@ -0,0 +1,1474 @@
+// Copyright 2018 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/process"
+	"code.gitea.io/gitea/modules/setting"
+	"code.gitea.io/gitea/modules/structs"
+	"code.gitea.io/gitea/modules/validation"
+)
+
+// ChangeRepoFile describes a single file operation of ChangeRepoFiles.
+// Operation is one of "create", "update", "patch", "delete" or "rename".
+type ChangeRepoFile struct {
+	Operation string
+	TreePath  string
+	// FromTreePath is the current path of the file to update or rename
+	FromTreePath string
+	// ContentReader streams the raw content of the file to create or update, it is read once.
+	// When it is nil, Content given in Encoding is used instead, an empty Content making an empty file.
+	ContentReader io.Reader
+	Content       string
+	// Encoding of Content, either "base64" or empty for raw content
+	Encoding string
+	// Charset is the charset to write the content in, given in UTF-8, such as "utf-16le" or
+	// "iso-8859-1". It is written as it is when empty. BOM makes the content start with the
+	// byte order mark of Charset, UTF-8 when empty.
+	Charset string
+	BOM     bool
+	// ContentURL is fetched as the raw content of the file to create or update in place of
+	// ContentReader and Content, see the repository.content-url settings
+	ContentURL string
+	// ContentSource is the file of a repository whose content is copied as the content of the file
+	// to create or update in place of ContentReader and Content, see ContentSource
+	ContentSource *ContentSource
+	// Patch is the unified diff a patch applies to the file at FromTreePath
+	Patch string
+	// SHA of the blob currently at FromTreePath, checked against the branch when given
+	SHA string
+	// ContentSHA is the expected SHA of the blob the new content of a file to create or update is
+	// written as, or the OID of its LFS object if stored in LFS. The operation fails with
+	// ErrContentSHAMismatch when given and the content hashes otherwise, e.g. once truncated.
+	ContentSHA string
+	// Overwrite lets a rename replace the existing files at TreePath, directories are never replaced
+	Overwrite bool
+	// Mode of the file to create or update, "100644" or "100755" for an executable file. When empty,
+	// created files are not executable and updated files keep their current mode.
+	Mode string
+	// Symlink makes the file to create or update a symlink, its content being the target
+	Symlink bool
+	// RejectIgnored makes a create fail with ErrFileIgnored if TreePath is ignored by the .gitignore files
+	RejectIgnored bool
+	// RemoveSubmodule lets a delete remove the submodule at TreePath along with its section of
+	// .gitmodules. Submodules are refused with ErrEntryIsSubmodule otherwise.
+	RemoveSubmodule bool
+
+	treePath     string
+	fromTreePath string
+	content      io.Reader
+	// fetchedContent is the response body content is read from, if fetched from ContentURL, or the
+	// blob of ContentSource
+	fetchedContent io.Closer
+	// isDir is set once applied if the operation moved or deleted a whole directory
+	isDir bool
+	// deletedPaths are the paths of the files removed by a delete or moved away by a rename of a directory
+	deletedPaths []string
+	// indexMode and indexHash are the mode and the blob the applied file is added to the index with
+	indexMode string
+	indexHash string
+	// lfsMetaObject is the LFS object the content is stored as, if the path is tracked by LFS,
+	// and lfsContentPath the file the content is kept in until it is stored
+	lfsMetaObject  *models.LFSMetaObject
+	lfsContentPath string
+	// size is the size of the hashed content, and sizeDelta and lfsSizeDelta how much the applied
+	// file grows the repository and its LFS objects
+	size         int64
+	sizeDelta    int64
+	lfsSizeDelta int64
+}
+
+// mode returns the mode to write the prepared file with, given the mode it currently has or defaults to
+func (file *ChangeRepoFile) mode(currentMode string) string {
+	if file.Symlink {
+		return symlinkMode
+	} else if file.Mode != "" {
+		return file.Mode
+	}
+	return currentMode
+}
+
+// hashFileBlob writes the blob of the given prepared file to be added with the given mode to the
+// object db of the temporary upload repository and returns its hash
+func hashFileBlob(t *TemporaryUploadRepository, file *ChangeRepoFile, mode string) (string, error) {
+	var objectHash string
+	var err error
+	if mode == symlinkMode {
+		objectHash, err = hashSymlinkTarget(t, file)
+	} else {
+		objectHash, err = hashFileContent(t, file)
+	}
+	if err != nil || file.ContentSHA == "" {
+		return objectHash, err
+	}
+
+	contentSHA := objectHash
+	if file.lfsMetaObject != nil {
+		contentSHA = file.lfsMetaObject.Oid
+	}
+	if !strings.EqualFold(file.ContentSHA, contentSHA) {
+		return "", models.ErrContentSHAMismatch{Path: file.treePath, GivenSHA: file.ContentSHA, ContentSHA: contentSHA}
+	}
+	return objectHash, nil
+}
+
+// NoDefaultMessage can be given as the message of the options to commit with an empty
+// message instead of the default one generated from the file operations
+const NoDefaultMessage = "\x00"
+
+// CommitOptions holds the options of the commit of file changes, shared by ChangeRepoFilesOptions
+// and the options of the functions changing a single file, such as CreateRepoFileOptions.
+// The changes are committed on top of NewBranch, which defaults to OldBranch and must exist,
+// unless CreateNewBranch is set: NewBranch must then not exist yet and is created from OldBranch,
+// which may then also be a tag or any other commit-ish of the repository. OldBranch defaults to
+// the default branch of the repository, and a branch named "HEAD" is the branch HEAD points to.
+type CommitOptions struct {
+	// LastCommitID is the head the branch the changes are committed on top of is expected to have,
+	// e.g. as read by the client: the changes fail with ErrCommitIDDoesNotMatch, giving the current
+	// head, if the branch moved since. It is not checked when empty.
+	LastCommitID    string
+	OldBranch       string
+	NewBranch       string
+	CreateNewBranch bool
+	Message         string
+	Author          *IdentityOptions
+	Committer       *IdentityOptions
+	// AuthorDate and CommitterDate are the dates of the commit in RFC3339 format, the current
+	// time when empty. They may not be in the future by more than the configured skew.
+	AuthorDate    string
+	CommitterDate string
+	// DryRun writes the resulting tree without committing and pushing it, the response
+	// then describes the files in that tree and the commit that would have been made. Its SHA is
+	// the one of the commit made with the same dates, except for signed commits whose SHA isn't
+	// known until they are signed.
+	DryRun bool
+	// CreatePullRequest commits the changes to a new "<doer>-patch-<n>" branch and opens a pull
+	// request into NewBranch instead of failing when the doer may not push to that protected branch
+	CreatePullRequest bool
+	// IncludeDiff adds the diffs of the changed files to the response
+	IncludeDiff bool
+	// TemporaryRepository is used to make the commit instead of a new temporary upload repository, so
+	// that successive changes of the repository are made without cloning it each time. It is left
+	// open for the next changes and must not be used by several changes at once.
+	TemporaryRepository *TemporaryUploadRepository
+	// AllowEmptyCommit commits the changes even if they leave the tree as it is, e.g. to
+	// trigger the push events. Such changes fail with ErrEmptyCommit otherwise.
+	AllowEmptyCommit bool
+	// Amend replaces the head commit of NewBranch with a commit of its tree changed by the changes,
+	// keeping its parents, its author and its message unless given. The head commit must be the
+	// doer's own unless configured otherwise, the doer must be an admin of the repository and
+	// NewBranch must not be protected. As it rewrites the history of NewBranch, Force must be given
+	// along with it, though the amended commit only ever replaces the head commit it is made from.
+	Amend bool
+	// Force commits the changes on top of LastCommitID even if NewBranch moved since, and replaces
+	// the head of the branch by the new commit, discarding the commits made to it in the meantime.
+	// The doer must be an admin of the repository and NewBranch must not be protected. Without it
+	// the push only fast-forwards the branch, failing with ErrNotFastForward otherwise.
+	Force bool
+	// AuthorTrailer is the key of a trailer of the message, such as "From", that gives the author of
+	// the commit as "Name <email>" in place of Author, e.g. when replaying patches. The trailer is
+	// removed from the message, which is committed as it is when it has no such trailer.
+	AuthorTrailer string
+	// CoAuthors are added to the message as "Co-authored-by" trailers, in order and once for each email
+	CoAuthors []IdentityOptions
+	// Signoff adds a "Signed-off-by" trailer of the author to the message, as "git commit -s" does,
+	// unless the message already ends with it
+	Signoff bool
+	// SigningKeyID is the ID or fingerprint of the GPG key to sign the commit with instead of the
+	// one chosen by the signing rules. It must be the signing key of the instance, a key of the
+	// doer or a key of the organization owning the repository, the changes failing otherwise.
+	SigningKeyID string
+	// IdempotencyKey makes the changes only once on NewBranch: when changes with the same key were
+	// already committed to that branch, the response of that commit is returned again instead
+	IdempotencyKey string
+}
+
+// ChangeRepoFilesOptions holds the repository files change options.
+type ChangeRepoFilesOptions struct {
+	CommitOptions
+	Files []*ChangeRepoFile
+	// PathPrefix is the directory the tree paths of the files are relative to, e.g. the directory of
+	// an application in a monorepo. It must be a clean path of an existing directory.
+	PathPrefix string
+	// AdditionalParents are the IDs of commits of the repository made parents of the commit after
+	// the head of the branch, to record a merge
+	AdditionalParents []string
+	// Progress is called as the file operations are applied, every ProgressInterval of them and
+	// after the last one, e.g. for the progress of a large import. ProgressInterval defaults to 1.
+	Progress         ProgressFunc
+	ProgressInterval int
+
+	// bulkChange is the bulk change the changes are part of, see BulkChange
+	bulkChange *BulkChange
+	// baseCommitID is the commit the new branch starts from when OldBranch is not a branch
+	baseCommitID string
+	// changesOnly makes a dry run only list the files changed, see GetRepoFilesChanges
+	changesOnly bool
+	// singleFiles makes the changes apply to files only, not to whole directories, all the
+	// files missing in the index being reported at once with ErrRepoFilesDoNotExist
+	singleFiles bool
+}
+
+// fileResponseFromFiles returns the response of the change of a single file, given the response
+// of the changes of its files
+func fileResponseFromFiles(filesResponse *structs.FilesResponse) *structs.FileResponse {
+	return &structs.FileResponse{
+		Content:           filesResponse.Files[0],
+		Commit:            filesResponse.Commit,
+		Verification:      filesResponse.Verification,
+		PullRequestNumber: filesResponse.PullRequestNumber,
+		Diffs:             filesResponse.Diffs,
+		Trees:             filesResponse.Trees,
+	}
+}
+
+// ChangeRepoFiles applies all the given file operations to the given repository in a single commit.
+// If any of the operations is invalid, nothing is committed. The files of the response are in the
+// order of the operations, deleted files having no content in the new commit being nil.
+func ChangeRepoFiles(repo *models.Repository, doer *models.User, opts *ChangeRepoFilesOptions) (*structs.FilesResponse, error) {
+	filesResponse, err := changeRepoFiles(repo, doer, opts)
+	if err != nil {
+		return nil, err
+	}
+	for i, file := range opts.Files {
+		if file.Operation == "delete" {
+			filesResponse.Files[i] = nil
+		}
+	}
+	return filesResponse, nil
+}
+
+// checkBranches defaults the branch names of the options and makes sure the branch
+// the changes are based on exists and the new branch, if it is to be created, does not
+func (opts *ChangeRepoFilesOptions) checkBranches(repo *models.Repository) error {
+	if err := opts.setDefaultBranches(repo); err != nil {
+		return err
+	}
+
+	// The first commit of a repository creates its first branch
+	if repo.IsEmpty {
+		return checkBranchName(opts.NewBranch)
+	}
+
+	opts.baseCommitID = ""
+	if _, err := repo.GetBranch(opts.baseBranch()); models.IsErrBranchNotExist(err) && opts.CreateNewBranch {
+		// The new branch starts from the commit OldBranch resolves to
+		if opts.baseCommitID, err = resolveCommitID(repo, opts.OldBranch); models.IsErrCommitNotExist(err) {
+			return models.ErrBranchNotExist{Name: opts.OldBranch}
+		} else if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	if opts.CreateNewBranch {
+		if err := checkBranchName(opts.NewBranch); err != nil {
+			return err
+		}
+		if opts.NewBranch == opts.OldBranch {
+			return models.ErrBranchAlreadyExists{BranchName: opts.NewBranch}
+		}
+		if _, err := repo.GetBranch(opts.NewBranch); err == nil {
+			return models.ErrBranchAlreadyExists{BranchName: opts.NewBranch}
+		} else if !models.IsErrBranchNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// setDefaultBranches defaults the branch names of the options not set, and resolves the branch
+// named "HEAD" to the branch the HEAD of the repository points to
+func (opts *ChangeRepoFilesOptions) setDefaultBranches(repo *models.Repository) error {
+	// If no branch name is set, assume the default branch, or master if none is recorded
+	if opts.OldBranch == "" {
+		opts.OldBranch = repo.DefaultBranch
+		if opts.OldBranch == "" {
+			opts.OldBranch = "master"
+		}
+	}
+	if opts.OldBranch == "HEAD" || (opts.NewBranch == "HEAD" && !opts.CreateNewBranch) {
+		branch, err := getHEADBranch(repo)
+		if err != nil {
+			return err
+		}
+		if opts.OldBranch == "HEAD" {
+			opts.OldBranch = branch
+		}
+		if opts.NewBranch == "HEAD" && !opts.CreateNewBranch {
+			opts.NewBranch = branch
+		}
+	}
+	if opts.NewBranch == "" {
+		opts.NewBranch = opts.OldBranch
+	}
+	return nil
+}
+
+// getHEADBranch returns the name of the branch the HEAD of the given repository points to, which
+// the branch of its first commit is named after if the repository is empty
+func getHEADBranch(repo *models.Repository) (string, error) {
+	gitRepo, err := git.OpenRepository(repo.RepoPath())
+	if err != nil {
+		return "", err
+	}
+	branch, err := gitRepo.GetHEADBranch()
+	if err != nil {
+		return "", fmt.Errorf("GetHEADBranch: %v", err)
+	}
+	return branch.Name, nil
+}
+
+// checkBranchName makes sure the given name can be the name of a new branch. The names of
+// the existing ones are not checked, they may have been pushed before these rules applied.
+func checkBranchName(name string) error {
+	if name == "HEAD" || strings.HasPrefix(name, "-") || !validation.IsValidGitRefName(name) {
+		return models.ErrBranchNameInvalid{BranchName: name}
+	}
+	return nil
+}
+
+// checkCanPush makes sure the doer can push the changes to the new branch if it is protected
+func checkCanPush(repo *models.Repository, doer *models.User, opts *ChangeRepoFilesOptions) error {
+	// Protection only applies once a branch exists
+	if opts.CreateNewBranch {
+		return nil
+	}
+	protectBranch, err := models.GetProtectedBranchBy(repo.ID, opts.NewBranch)
+	if err != nil {
+		return err
+	} else if protectBranch == nil {
+		return nil
+	}
+	if err := protectBranch.CheckUserPush(doer); !models.IsErrNotAllowedToPush(err) {
+		return err
+	} else if bypass, bypassErr := canBypassProtection(repo, doer); bypassErr != nil {
+		return bypassErr
+	} else if !bypass {
+		return err
+	}
+	return nil
+}
+
+// canBypassProtection returns if the doer may commit changes to the protected branches of the
+// repository whether whitelisted or not, being one of its administrators when they are allowed to.
+// This only applies to the changes made here, not to the branches pushed to the repository.
+func canBypassProtection(repo *models.Repository, doer *models.User) (bool, error) {
+	if !setting.Repository.AdminsBypassProtection {
+		return false, nil
+	}
+	perm, err := models.GetUserRepoPermission(repo, doer)
+	if err != nil {
+		return false, err
+	} else if perm.IsAdmin() {
+		return true, nil
+	}
+	// The owners of an organization administrate all its repositories
+	if err = repo.GetOwner(); err != nil {
+		return false, err
+	} else if !repo.Owner.IsOrganization() {
+		return false, nil
+	}
+	return repo.Owner.IsOwnedBy(doer.ID)
+}
+
+// baseBranch returns the branch the changes are committed on top of, or the commit-ish the new
+// branch starts from
+func (opts *ChangeRepoFilesOptions) baseBranch() string {
+	if opts.CreateNewBranch {
+		return opts.OldBranch
+	}
+	return opts.NewBranch
+}
+
+// getBaseCommit returns the commit the changes of the checked options are committed on top of
+func (opts *ChangeRepoFilesOptions) getBaseCommit(gitRepo *git.Repository) (*git.Commit, error) {
+	if opts.baseCommitID != "" {
+		return gitRepo.GetCommit(opts.baseCommitID)
+	}
+	return gitRepo.GetBranchCommit(opts.baseBranch())
+}
+
+// defaultMessage generates a commit message for the given prepared files,
+// mirroring the messages suggested by the web editor
+func defaultMessage(files []*ChangeRepoFile) string {
+	if len(files) > 1 {
+		treePaths := make([]string, 0, len(files))
+		for _, file := range files {
+			treePaths = append(treePaths, "'"+file.treePath+"'")
+		}
+		return "Change " + strings.Join(treePaths, ", ")
+	}
+
+	file := files[0]
+	switch file.Operation {
+	case "create":
+		return fmt.Sprintf("Add '%s'", file.treePath)
+	case "delete":
+		return fmt.Sprintf("Delete '%s'", file.treePath)
+	}
+	if file.fromTreePath != file.treePath {
+		return fmt.Sprintf("Rename '%s' to '%s'", file.fromTreePath, file.treePath)
+	}
+	return fmt.Sprintf("Update '%s'", file.treePath)
+}
+
+// trailerRegexp matches the lines of the trailers paragraph ending a commit message
+var trailerRegexp = regexp.MustCompile(`^[A-Za-z0-9-]+: `)
+
+// addTrailer appends the given trailer to the given message, in its trailers paragraph if it ends
+// with one, unless that trailer is already there
+func addTrailer(message, trailer string) string {
+	if message == "" {
+		return trailer
+	}
+
+	paragraphs := strings.Split(message, "\n\n")
+	hasTrailer := false
+	for _, line := range strings.Split(paragraphs[len(paragraphs)-1], "\n") {
+		if !trailerRegexp.MatchString(line) {
+			return message + "\n\n" + trailer
+		}
+		hasTrailer = hasTrailer || strings.TrimSpace(line) == trailer
+	}
+	if hasTrailer {
+		return message
+	}
+	return message + "\n" + trailer
+}
+
+// addSignoff appends the "Signed-off-by" trailer of the given signature to the given message
+func addSignoff(message string, sig *git.Signature) string {
+	return addTrailer(message, fmt.Sprintf("Signed-off-by: %s <%s>", sig.Name, sig.Email))
+}
+
+// checkCoAuthors makes sure the given co-authors can be written as trailers
+func checkCoAuthors(coAuthors []IdentityOptions) error {
+	for _, coAuthor := range coAuthors {
+		if reason := getIdentityProblem(coAuthor); reason != "" {
+			return models.ErrInvalidCoAuthor{Name: coAuthor.Name, Email: coAuthor.Email, Reason: reason}
+		}
+	}
+	return nil
+}
+
+// getIdentityProblem returns why the given identity can't be written as "Name <email>", or "" if it can
+func getIdentityProblem(identity IdentityOptions) string {
+	name, email := strings.TrimSpace(identity.Name), strings.TrimSpace(identity.Email)
+	switch {
+	case name == "":
+		return "no name"
+	case email == "":
+		return "no email"
+	case strings.ContainsAny(name, "<>\n"):
+		return "invalid name"
+	case strings.ContainsAny(email, "<> \t\n") || !strings.Contains(email, "@"):
+		return "invalid email"
+	}
+	return ""
+}
+
+// addCoAuthors appends a "Co-authored-by" trailer to the given message for each of the given checked
+// co-authors in order, but only once for each email
+func addCoAuthors(message string, coAuthors []IdentityOptions) string {
+	emails := make(map[string]bool, len(coAuthors))
+	for _, coAuthor := range coAuthors {
+		email := strings.TrimSpace(coAuthor.Email)
+		if emails[strings.ToLower(email)] {
+			continue
+		}
+		emails[strings.ToLower(email)] = true
+		message = addTrailer(message, fmt.Sprintf("Co-authored-by: %s <%s>", strings.TrimSpace(coAuthor.Name), email))
+	}
+	return message
+}
+
+// prepareChangeRepoFile validates the operation and paths of the given file and decodes its content
+func prepareChangeRepoFile(file *ChangeRepoFile) error {
+	switch file.Operation {
+	case "create", "update", "patch", "delete", "rename":
+	default:
+		return fmt.Errorf("invalid file operation: %s", file.Operation)
+	}
+
+	// Check that the paths given are valid (not git paths)
+	file.treePath = CleanUploadFileName(file.TreePath)
+	if file.treePath == "" {
+		return models.ErrFilenameInvalid{Path: file.TreePath}
+	}
+	file.fromTreePath = file.treePath
+	if file.Operation == "rename" && file.FromTreePath == "" {
+		return models.ErrFilenameInvalid{Path: file.FromTreePath}
+	}
+	if file.FromTreePath != "" {
+		file.fromTreePath = CleanUploadFileName(file.FromTreePath)
+		if file.fromTreePath == "" {
+			return models.ErrFilenameInvalid{Path: file.FromTreePath}
+		}
+	}
+
+	switch file.Mode {
+	case "", "100644", "100755":
+	default:
+		return fmt.Errorf("invalid file mode: %s", file.Mode)
+	}
+	if file.Symlink && file.Mode != "" {
+		return fmt.Errorf("invalid file mode for a symlink: %s", file.Mode)
+	}
+
+	if file.Operation == "create" || file.Operation == "update" {
+		content, err := getContentReader(file)
+		if err != nil {
+			return err
+		}
+		file.content = content
+		if file.Charset != "" || file.BOM {
+			if file.Symlink {
+				return fmt.Errorf("charset given for a symlink: %s", file.TreePath)
+			}
+			if err := encodeContent(file); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkChangeRepoFilesConflicts makes sure no path is touched by more than one of the
+// given prepared files. The smallest conflicting path is reported, so the result does not
+// depend on the order of the files.
+func checkChangeRepoFilesConflicts(files []*ChangeRepoFile) error {
+	counts := make(map[string]int, len(files))
+	for _, file := range files {
+		counts[file.treePath]++
+		if file.fromTreePath != file.treePath {
+			counts[file.fromTreePath]++
+		}
+	}
+
+	conflicts := make([]string, 0)
+	for treePath, count := range counts {
+		if count > 1 {
+			conflicts = append(conflicts, treePath)
+		}
+	}
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		return models.ErrFilePathConflict{Path: conflicts[0]}
+	}
+	return nil
+}
+
+// checkDirectoriesConflicts makes sure no other operation touches a path beneath
+// a directory moved or deleted by one of the given applied files
+func checkDirectoriesConflicts(files []*ChangeRepoFile) error {
+	for _, dir := range files {
+		if !dir.isDir {
+			continue
+		}
+		prefixes := []string{dir.treePath + "/"}
+		if dir.fromTreePath != dir.treePath {
+			prefixes = append(prefixes, dir.fromTreePath+"/")
+		}
+		for _, file := range files {
+			if file == dir {
+				continue
+			}
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(file.treePath, prefix) {
+					return models.ErrFilePathConflict{Path: file.treePath}
+				} else if strings.HasPrefix(file.fromTreePath, prefix) {
+					return models.ErrFilePathConflict{Path: file.fromTreePath}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// isFileInIndex checks if there is a file with exactly the given path in the index
+func isFileInIndex(t *TemporaryUploadRepository, treePath string) (bool, error) {
+	filesInIndex, err := t.LsFiles(treePath)
+	if err != nil {
+		return false, err
+	}
+	isFile, _ := splitFilesInIndex(treePath, filesInIndex)
+	return isFile, nil
+}
+
+// splitFilesInIndex tells apart, among the given files of the index listed for the given path,
+// whether one is a file at exactly that path from the files beneath it as a directory. The files
+// whose path merely starts like it, such as "foobar/x" for "foo", are neither.
+func splitFilesInIndex(treePath string, filesInIndex []string) (bool, []string) {
+	isFile := false
+	filesBeneath := make([]string, 0, len(filesInIndex))
+	for _, file := range filesInIndex {
+		if file == treePath {
+			isFile = true
+		} else if strings.HasPrefix(file, treePath+"/") {
+			filesBeneath = append(filesBeneath, file)
+		}
+	}
+	return isFile, filesBeneath
+}
+
+// checkFilesInIndex makes sure there is a file with exactly the path of each of the given prepared
+// files in the index, reporting all those missing
+func checkFilesInIndex(t *TemporaryUploadRepository, files []*ChangeRepoFile) error {
+	treePaths := make([]string, 0, len(files))
+	for _, file := range files {
+		treePaths = append(treePaths, file.treePath)
+	}
+	filesInIndex, err := t.LsFiles(treePaths...)
+	if err != nil {
+		return err
+	}
+	inIndex := make(map[string]bool, len(filesInIndex))
+	for _, fileInIndex := range filesInIndex {
+		inIndex[fileInIndex] = true
+	}
+
+	missing := make([]string, 0, len(treePaths))
+	for _, treePath := range treePaths {
+		if !inIndex[treePath] {
+			missing = append(missing, treePath)
+		}
+	}
+	if len(missing) > 0 {
+		return models.ErrRepoFilesDoNotExist{FileNames: missing}
+	}
+	return nil
+}
+
+// getExistingEntry returns the tree entry at the given path in the commit,
+// checking it against the given SHA when one is given
+func getExistingEntry(commit *git.Commit, treePath, sha string) (*git.TreeEntry, error) {
+	entry, err := commit.GetTreeEntryByPath(treePath)
+	if err != nil {
+		if git.IsErrNotExist(err) {
+			return nil, models.ErrRepoFileDoesNotExist{FileName: treePath}
+		}
+		return nil, err
+	}
+
+	// Make sure nobody changed the file since the given SHA was read
+	if sha != "" && sha != entry.ID.String() {
+		return nil, models.ErrSHADoesNotMatch{
+			Path:       treePath,
+			GivenSHA:   sha,
+			CurrentSHA: entry.ID.String(),
+		}
+	}
+	return entry, nil
+}
+
+// getExistingFileEntry returns the tree entry of the file at the given path in the commit,
+// checking it against the given SHA when one is given
+func getExistingFileEntry(commit *git.Commit, treePath, sha string) (*git.TreeEntry, error) {
+	entry, err := getExistingEntry(commit, treePath, sha)
+	if err != nil {
+		return nil, err
+	}
+	if entry.IsSubModule() {
+		return nil, models.ErrEntryIsSubmodule{Path: treePath}
+	} else if entry.IsDir() {
+		return nil, models.ErrRepoFileDoesNotExist{FileName: treePath}
+	}
+	return entry, nil
+}
+
+// applyChangeRepoFile applies the given file operation to the index of the temporary upload repository
+func applyChangeRepoFile(t *TemporaryUploadRepository, commit *git.Commit, file *ChangeRepoFile) error {
+	switch file.Operation {
+	case "create":
+		if err := checkTreePathConflicts(t, file.treePath); err != nil {
+			return err
+		}
+		exists, err := isFileInIndex(t, file.treePath)
+		if err != nil {
+			return err
+		} else if exists {
+			return models.ErrRepoFileAlreadyExist{FileName: file.treePath}
+		}
+		if file.RejectIgnored {
+			if err := checkNotIgnored(t, file.treePath); err != nil {
+				return err
+			}
+		}
+		mode := file.mode("100644")
+		objectHash, err := hashFileBlob(t, file, mode)
+		if err != nil {
+			return err
+		}
+		if err := setSizeDeltas(file, nil); err != nil {
+			return err
+		}
+		file.indexMode, file.indexHash = mode, objectHash
+		return t.AddObjectToIndex(mode, objectHash, file.treePath)
+
+	case "update", "patch":
+		fromEntry, err := getExistingFileEntry(commit, file.fromTreePath, file.SHA)
+		if err != nil {
+			return err
+		}
+		if file.Operation == "patch" {
+			patched, err := applyPatch(t, fromEntry, file)
+			if err != nil {
+				return err
+			}
+			defer patched.Close()
+			file.content = patched
+		}
+
+		if file.fromTreePath != file.treePath {
+			// Remove the old path from the index, git will detect the rename from the content
+			if err := t.RemoveFilesFromIndex(file.fromTreePath); err != nil {
+				return err
+			}
+
+			// A file can't be moved onto another existing file
+			if err := checkTreePathConflicts(t, file.treePath); err != nil {
+				return err
+			}
+			exists, err := isFileInIndex(t, file.treePath)
+			if err != nil {
+				return err
+			} else if exists {
+				return models.ErrRepoFileAlreadyExist{FileName: file.treePath}
+			}
+		}
+
+		// e.g. the executable bit is kept unless another mode is given, and a symlink stays one
+		mode := file.mode(fmt.Sprintf("%x", fromEntry.Mode()))
+		objectHash, err := hashFileBlob(t, file, mode)
+		if err != nil {
+			return err
+		}
+		if err := setSizeDeltas(file, fromEntry); err != nil {
+			return err
+		}
+		file.indexMode, file.indexHash = mode, objectHash
+		return t.AddObjectToIndex(mode, objectHash, file.treePath)
+
+	case "rename":
+		fromEntry, err := getExistingEntry(commit, file.fromTreePath, file.SHA)
+		if err != nil {
+			return err
+		}
+		// The path of a submodule is recorded in .gitmodules as well
+		if fromEntry.IsSubModule() {
+			return models.ErrEntryIsSubmodule{Path: file.fromTreePath}
+		} else if fromEntry.IsDir() {
+			return renameDirectory(t, commit, file)
+		}
+		if err := t.RemoveFilesFromIndex(file.fromTreePath); err != nil {
+			return err
+		}
+		if err := checkRenameDestination(t, file, file.treePath); err != nil {
+			return err
+		}
+		// The blob and its mode are kept as they are, so git records a pure rename
+		file.indexMode, file.indexHash = fmt.Sprintf("%x", fromEntry.Mode()), fromEntry.ID.String()
+		return t.AddObjectToIndex(file.indexMode, file.indexHash, file.treePath)
+
+	case "delete":
+		// Either the file itself or, for a directory, all the files beneath it
+		filesInIndex, err := t.LsFiles(file.treePath)
+		if err != nil {
+			return err
+		}
+		// A path can't be both a file and a directory of the index
+		isFile, filesBeneath := splitFilesInIndex(file.treePath, filesInIndex)
+		if isFile {
+			file.deletedPaths = []string{file.treePath}
+		} else {
+			file.deletedPaths = filesBeneath
+			file.isDir = len(filesBeneath) > 0
+		}
+		// Git doesn't track empty directories, so there is nothing to delete for them either
+		if len(file.deletedPaths) == 0 {
+			return models.ErrRepoFileDoesNotExist{FileName: file.treePath}
+		}
+		entry, err := getExistingEntry(commit, file.treePath, file.SHA)
+		if err != nil {
+			return err
+		}
+		if entry.IsSubModule() {
+			if !file.RemoveSubmodule {
+				return models.ErrEntryIsSubmodule{Path: file.treePath}
+			}
+			if err := removeSubmoduleConfig(t, file.treePath); err != nil {
+				return err
+			}
+		}
+		return t.RemoveFilesFromIndex(file.deletedPaths...)
+	}
+	return nil
+}
+
+// checkTreePathConflicts makes sure a file can be added to the index at the given path:
+// a path can't be both a file and a directory, so neither may a directory exist at the
+// path nor a file at one of its parent directories
+func checkTreePathConflicts(t *TemporaryUploadRepository, treePath string) error {
+	treePaths := []string{treePath}
+	for dir := path.Dir(treePath); dir != "."; dir = path.Dir(dir) {
+		treePaths = append(treePaths, dir)
+	}
+	filesInIndex, err := t.LsFiles(treePaths...)
+	if err != nil {
+		return err
+	}
+	for _, fileInIndex := range filesInIndex {
+		if strings.HasPrefix(fileInIndex, treePath+"/") {
+			return models.ErrFileDirectoryConflict{Path: treePath, Entry: fileInIndex}
+		}
+		for _, dir := range treePaths[1:] {
+			if fileInIndex == dir {
+				return models.ErrFileDirectoryConflict{Path: treePath, Entry: fileInIndex}
+			}
+		}
+	}
+	return nil
+}
+
+// checkRenameDestination makes sure the given renamed file may be moved to the given path
+func checkRenameDestination(t *TemporaryUploadRepository, file *ChangeRepoFile, treePath string) error {
+	if err := checkTreePathConflicts(t, treePath); err != nil {
+		return err
+	}
+	if file.Overwrite {
+		return nil
+	}
+	exists, err := isFileInIndex(t, treePath)
+	if err != nil {
+		return err
+	} else if exists {
+		return models.ErrRepoFileAlreadyExist{FileName: treePath}
+	}
+	return nil
+}
+
+// renameDirectory moves all the files beneath the directory of the given renamed file
+func renameDirectory(t *TemporaryUploadRepository, commit *git.Commit, file *ChangeRepoFile) error {
+	if strings.HasPrefix(file.treePath, file.fromTreePath+"/") {
+		return models.ErrFilePathConflict{Path: file.treePath}
+	}
+	exists, err := isFileInIndex(t, file.treePath)
+	if err != nil {
+		return err
+	} else if exists {
+		return models.ErrRepoFileAlreadyExist{FileName: file.treePath}
+	}
+
+	tree, err := commit.SubTree(file.fromTreePath)
+	if err != nil {
+		return err
+	}
+	entries, err := tree.ListEntriesRecursive()
+	if err != nil {
+		return err
+	}
+	file.isDir = true
+	file.deletedPaths = make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			file.deletedPaths = append(file.deletedPaths, file.fromTreePath+"/"+entry.Name())
+		}
+	}
+	if err := t.RemoveFilesFromIndex(file.deletedPaths...); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if err := checkRenameDestination(t, file, file.treePath+"/"+entry.Name()); err != nil {
+			return err
+		}
+		if err := t.AddObjectToIndex(fmt.Sprintf("%x", entry.Mode()), entry.ID.String(), file.treePath+"/"+entry.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveCommitID returns the full ID of the commit the given commit-ish of the repository, e.g. an
+// abbreviated commit ID or a tag, resolves to
+func resolveCommitID(repo *models.Repository, commitish string) (string, error) {
+	stdout, stderr, err := process.GetManager().ExecDir(5*time.Minute,
+		repo.RepoPath(),
+		fmt.Sprintf("resolveCommitID (git rev-parse --verify %s): %s", commitish, repo.RepoPath()),
+		"git", "rev-parse", "--verify", "--quiet", "--end-of-options", commitish+"^{commit}")
+	if err != nil {
+		if stderr == "" {
+			return "", models.ErrCommitNotExist{ID: commitish}
+		}
+		return "", fmt.Errorf("resolveCommitID: %v %s", err, stderr)
+	}
+	return strings.TrimSpace(stdout), nil
+}
+
+// checkBranchHead makes sure the head of the given branch is still the given commit
+func checkBranchHead(repo *models.Repository, branch, commitID string) error {
+	gitRepo, err := git.OpenRepository(repo.RepoPath())
+	if err != nil {
+		return err
+	}
+	headCommitID, err := gitRepo.GetBranchCommitID(branch)
+	if err != nil {
+		return err
+	}
+	if headCommitID != commitID {
+		return models.ErrCommitIDDoesNotMatch{
+			GivenCommitID:   commitID,
+			CurrentCommitID: headCommitID,
+		}
+	}
+	return nil
+}
+
+// getFilesResponseContents describes the files changed by the given prepared operations
+// in the given tree, or, for deleted files, in the commit they were deleted from
+func getFilesResponseContents(repo *models.Repository, tree *git.Tree, parentCommit *git.Commit, branch string, files []*ChangeRepoFile) ([]*structs.FileContentResponse, error) {
+	contents := make([]*structs.FileContentResponse, 0, len(files))
+	for _, file := range files {
+		fileTree := tree
+		if file.Operation == "delete" {
+			fileTree = &parentCommit.Tree
+		}
+		content, err := getFileContentResponse(repo, fileTree, branch, file.treePath)
+		if err != nil {
+			return nil, err
+		}
+		contents = append(contents, content)
+	}
+	return contents, nil
+}
+
+// getFilesResponseTrees describes the root tree and the trees of the parent directories of the
+// files changed by the given prepared operations in the given tree, ordered by path
+func getFilesResponseTrees(tree *git.Tree, files []*ChangeRepoFile) ([]*structs.FileTreeResponse, error) {
+	dirs := map[string]bool{"": true}
+	for _, file := range files {
+		for _, treePath := range []string{file.treePath, file.fromTreePath} {
+			if dir := path.Dir(treePath); treePath != "" && dir != "." {
+				dirs[dir] = true
+			}
+		}
+	}
+
+	trees := make([]*structs.FileTreeResponse, 0, len(dirs))
+	for dir := range dirs {
+		treeResponse := &structs.FileTreeResponse{Path: dir}
+		if dir == "" {
+			treeResponse.SHA = tree.ID.String()
+		} else if entry, err := tree.GetTreeEntryByPath(dir); err != nil && !git.IsErrNotExist(err) {
+			return nil, err
+		} else if err == nil && entry.IsDir() {
+			treeResponse.SHA = entry.ID.String()
+		}
+		trees = append(trees, treeResponse)
+	}
+	sort.Slice(trees, func(i, j int) bool {
+		return trees[i].Path < trees[j].Path
+	})
+	return trees, nil
+}
+
+// setCommitDate sets the date of the signature to the given RFC3339 date, if any
+func setCommitDate(sig *git.Signature, date string) error {
+	if date == "" {
+		return nil
+	}
+	when, err := time.Parse(time.RFC3339, date)
+	if err != nil {
+		return models.ErrInvalidCommitDate{Date: date, Reason: "not a RFC3339 date"}
+	}
+	if when.Unix() < 0 {
+		return models.ErrInvalidCommitDate{Date: date, Reason: "before 1970"}
+	}
+	if when.After(time.Now().Add(setting.Repository.MaxCommitDateSkew)) {
+		return models.ErrInvalidCommitDate{Date: date, Reason: "in the future"}
+	}
+	sig.When = when
+	return nil
+}
+
+// prepareTemporaryUploadRepository clones the given branch of the repository to the temporary
+// upload repository, or creates it there from the given commit if any, and returns its head
+// commit, or initializes it and returns nil if the repository has no commit yet. Only the
+// directory of the given paths is staged when there are some, see sparseIndexPaths.
+func prepareTemporaryUploadRepository(t *TemporaryUploadRepository, repo *models.Repository, branch, commitID string, sparsePaths []string) (*git.Commit, error) {
+	if repo.IsEmpty {
+		return nil, t.Init()
+	}
+
+	if commitID != "" {
+		if err := t.CheckoutCommit(branch, commitID); err != nil {
+			return nil, err
+		}
+	} else if err := t.Checkout(branch); err != nil {
+		return nil, err
+	}
+
+	// Get the commit the changes are based on, the tip of the branch as it was cloned
+	lastCommitID, err := t.GetLastCommitByRef(git.BranchPrefix + branch)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := t.GetCommit(lastCommitID)
+	if err != nil {
+		return nil, err
+	}
+	if dir := getSparseIndexDirectory(commit, sparsePaths); dir != "" {
+		if err := t.SetSparseIndex(dir); err != nil {
+			return nil, err
+		}
+	} else if err := t.SetDefaultIndex(); err != nil {
+		return nil, err
+	}
+
+	// Content is normalized as git would on checkin, e.g. for line endings, and
+	// the attributes tell about paths tracked by LFS
+	if err := t.UseGitAttributes(commit); err != nil {
+		return nil, err
+	}
+	return commit, nil
+}
+
+// setDefaultBranch points the HEAD of the repository to the given branch
+func setDefaultBranch(repo *models.Repository, branch string) error {
+	gitRepo, err := git.OpenRepository(repo.RepoPath())
+	if err != nil {
+		return err
+	}
+	return gitRepo.SetDefaultBranch(branch)
+}
+
+// changeRepoFiles commits the given file operations on top of the base branch and pushes the
+// commit to the new branch. The response describes the deleted files as they were before the commit.
+func changeRepoFiles(repo *models.Repository, doer *models.User, opts *ChangeRepoFilesOptions) (*structs.FilesResponse, error) {
+	var filesResponse *structs.FilesResponse
+	var err error
+	if opts.IdempotencyKey != "" && !opts.DryRun {
+		filesResponse, err = changeRepoFilesOnce(repo, doer, opts)
+	} else {
+		filesResponse, err = commitRepoFiles(repo, doer, opts)
+	}
+	countOperation(opts.Files, err)
+	return filesResponse, err
+}
+
+// commitRepoFiles makes the commit of changeRepoFiles
+func commitRepoFiles(repo *models.Repository, doer *models.User, opts *ChangeRepoFilesOptions) (*structs.FilesResponse, error) {
+	if len(opts.Files) == 0 {
+		return nil, fmt.Errorf("no files to change")
+	}
+	// There is nothing but files to add in a repository without commits
+	if repo.IsEmpty {
+		for _, file := range opts.Files {
+			if file.Operation != "create" {
+				return nil, models.ErrRepoIsEmpty{RepoName: repo.FullName()}
+			}
+		}
+	}
+
+	if err := opts.checkBranches(repo); err != nil {
+		return nil, err
+	}
+	if opts.Amend {
+		if err := checkAmend(repo, doer, opts); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Force {
+		if err := checkForce(repo, doer, opts); err != nil {
+			return nil, err
+		}
+	}
+	if opts.PathPrefix != "" {
+		if err := checkPathPrefix(repo, opts); err != nil {
+			return nil, err
+		}
+	}
+	pullBaseBranch := ""
+	if err := checkCanPush(repo, doer, opts); err != nil {
+		if !opts.CreatePullRequest || !models.IsErrNotAllowedToPush(err) {
+			return nil, err
+		}
+		if pullBaseBranch, err = proposeOnPatchBranch(repo, doer, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	// Validate all the files before touching anything, the contents fetched from ContentURL
+	// being read once the commit is made
+	defer closeFetchedContents(opts.Files)
+	if err := openContentSources(doer, opts.Files); err != nil {
+		return nil, err
+	}
+	for _, file := range opts.Files {
+		if err := prepareChangeRepoFile(file); err != nil {
+			return nil, err
+		}
+	}
+	if opts.PathPrefix != "" {
+		if err := prefixTreePaths(opts.PathPrefix, opts.Files); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkChangeRepoFilesConflicts(opts.Files); err != nil {
+		return nil, err
+	}
+	if err := checkPathAuthorizers(repo, doer, opts.NewBranch, opts.Files); err != nil {
+		return nil, err
+	}
+
+	message := strings.TrimSpace(opts.Message)
+	if opts.Message == NoDefaultMessage {
+		message = ""
+	} else if message == "" {
+		message = defaultMessage(opts.Files)
+	}
+	if err := checkCoAuthors(opts.CoAuthors); err != nil {
+		return nil, err
+	}
+
+	author, committer := GetAuthorAndCommitterUsers(opts.Author, opts.Committer, doer)
+	authorSig := author.NewGitSig()
+	committerSig := committer.NewGitSig()
+	if err := setCommitDate(authorSig, opts.AuthorDate); err != nil {
+		return nil, err
+	}
+	if err := setCommitDate(committerSig, opts.CommitterDate); err != nil {
+		return nil, err
+	}
+
+	t := opts.TemporaryRepository
+	if t == nil {
+		var err error
+		if t, err = NewTemporaryUploadRepository(repo); err != nil {
+			return nil, err
+		}
+		defer t.Close()
+	} else if t.repo.ID != repo.ID {
+		return nil, fmt.Errorf("temporary upload repository of another repository: %s", t.repo.FullName())
+	}
+	// The temporary repository has the new branch start from the given commit-ish directly
+	branch := opts.baseBranch()
+	if opts.baseCommitID != "" {
+		branch = opts.NewBranch
+	}
+	start := time.Now()
+	// fast-import writes the whole tree, the index isn't used to stage the files
+	fastImport := canFastImport(opts.Files)
+	var sparsePaths []string
+	if !fastImport {
+		sparsePaths = sparseIndexPaths(opts.Files)
+	}
+	commit, err := prepareTemporaryUploadRepository(t, repo, branch, opts.baseCommitID, sparsePaths)
+	if err != nil {
+		return nil, err
+	}
+	observePhase("clone", start)
+	lastCommitID := ""
+	if commit != nil {
+		lastCommitID = commit.ID.String()
+	}
+
+	// Assigned LastCommitID in opts if it hasn't been set
+	if opts.LastCommitID == "" || (commit == nil && opts.LastCommitID == git.EmptySHA) {
+		opts.LastCommitID = lastCommitID
+	}
+
+	var parents []string
+	if opts.Amend {
+		if err := checkAmendedCommit(doer, opts.NewBranch, commit); err != nil {
+			return nil, err
+		}
+		if parents, err = getParentIDs(commit); err != nil {
+			return nil, err
+		}
+		if opts.Author == nil {
+			authorSig = &git.Signature{Name: commit.Author.Name, Email: commit.Author.Email, When: commit.Author.When}
+			if err := setCommitDate(authorSig, opts.AuthorDate); err != nil {
+				return nil, err
+			}
+		}
+		if strings.TrimSpace(opts.Message) == "" {
+			message = strings.TrimSpace(commit.Message())
+		}
+	}
+	if opts.AuthorTrailer != "" {
+		var trailerAuthor *IdentityOptions
+		if message, trailerAuthor, err = parseAuthorTrailer(message, opts.AuthorTrailer); err != nil {
+			return nil, err
+		} else if trailerAuthor != nil {
+			authorSig = &git.Signature{Name: trailerAuthor.Name, Email: trailerAuthor.Email, When: authorSig.When}
+		}
+	}
+	message = addCoAuthors(message, opts.CoAuthors)
+	if opts.Signoff {
+		message = addSignoff(message, authorSig)
+	}
+	if err := checkCommitMessage(repo, message); err != nil {
+		return nil, err
+	}
+
+	signingKey, err := getCommitSigningKey(repo, doer, opts.NewBranch, commit, opts.SigningKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.singleFiles {
+		if err := checkFilesInIndex(t, opts.Files); err != nil {
+			return nil, err
+		}
+	}
+	progress := newProgressReporter(opts)
+	treeHash := ""
+	if fastImport {
+		start = time.Now()
+		if treeHash, err = fastImportFiles(t, commit, opts.Files, progress); err != nil {
+			return nil, err
+		}
+		observePhase("write-tree", start)
+	}
+	if treeHash == "" {
+		for _, file := range opts.Files {
+			if err := applyChangeRepoFile(t, commit, file); err != nil {
+				return nil, err
+			}
+			progress.applied(file)
+		}
+		if setting.Repository.VerifyIndex {
+			if err := verifyIndex(t, commit, opts.Files); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := checkDirectoriesConflicts(opts.Files); err != nil {
+		return nil, err
+	}
+	if err := checkSizeQuotas(repo, opts.Files); err != nil {
+		return nil, err
+	}
+	if err := runPreCommitHooks(repo, doer, t, opts); err != nil {
+		return nil, err
+	}
+
+	// Now write the tree
+	if treeHash == "" {
+		start = time.Now()
+		if treeHash, err = t.WriteTree(); err != nil {
+			return nil, err
+		}
+		observePhase("write-tree", start)
+	}
+	if err := checkCaseConflicts(repo, t, opts.Files, treeHash); err != nil {
+		return nil, err
+	}
+	// A merge is recorded even if it leaves the tree as it is
+	if commit != nil && treeHash == commit.Tree.ID.String() && !opts.AllowEmptyCommit && len(opts.AdditionalParents) == 0 {
+		return nil, models.ErrEmptyCommit{BranchName: opts.NewBranch}
+	}
+
+	// Make sure the base branch didn't move since the given LastCommitID or since it was cloned.
+	// The push itself only fast-forwards, so a change made after this check still fails it.
+	if commit != nil && opts.baseCommitID == "" {
+		if err := checkBranchHead(repo, opts.baseBranch(), opts.LastCommitID); err != nil {
+			return nil, err
+		}
+	}
+	if opts.LastCommitID != lastCommitID {
+		return nil, models.ErrCommitIDDoesNotMatch{
+			GivenCommitID:   opts.LastCommitID,
+			CurrentCommitID: lastCommitID,
+		}
+	}
+
+	if opts.DryRun && opts.changesOnly {
+		changes, err := getFilesChanges(t, commit, treeHash)
+		if err != nil {
+			return nil, err
+		}
+		return &structs.FilesResponse{Changes: changes}, nil
+	}
+	if err := checkCommitPolicies(repo, doer, t, commit, treeHash, message, opts); err != nil {
+		return nil, err
+	}
+	if opts.DryRun {
+		tree, err := t.GetTree(treeHash)
+		if err != nil {
+			return nil, err
+		}
+		contents, err := getFilesResponseContents(repo, tree, commit, opts.NewBranch, opts.Files)
+		if err != nil {
+			return nil, err
+		}
+		// The parents are the ones the commit would be made with
+		dryRunParents := parents
+		if !opts.Amend {
+			dryRunParents = make([]string, 0, len(opts.AdditionalParents)+1)
+			if commit != nil {
+				dryRunParents = append(dryRunParents, lastCommitID)
+			}
+			for _, parent := range opts.AdditionalParents {
+				parentID, err := t.resolveCommit(parent)
+				if err != nil {
+					return nil, err
+				}
+				dryRunParents = append(dryRunParents, parentID)
+			}
+		}
+		// The commit object is made in the temporary upload repository only, to know its SHA
+		dryRunCommitHash := ""
+		if signingKey == "" {
+			if dryRunCommitHash, err = t.CommitTreeWithParents(authorSig, committerSig, treeHash, message, "", dryRunParents); err != nil {
+				return nil, err
+			}
+		}
+		if message != "" {
+			message += "\n"
+		}
+		filesResponse := &structs.FilesResponse{
+			Files: contents,
+			Commit: &structs.FileCommitResponse{
+				SHA:       dryRunCommitHash,
+				Author:    getCommitUser(authorSig),
+				Committer: getCommitUser(committerSig),
+				Message:   message,
+				Tree:      &structs.CommitMeta{SHA: treeHash},
+				Parents:   getParentsResponse(repo, dryRunParents),
+			},
+		}
+		if filesResponse.Trees, err = getFilesResponseTrees(tree, opts.Files); err != nil {
+			return nil, err
+		}
+		if filesResponse.Stats, err = getFilesStats(t, commit, treeHash); err != nil {
+			return nil, err
+		}
+		if opts.IncludeDiff {
+			if filesResponse.Diffs, err = getFilesDiffs(t, commit, treeHash); err != nil {
+				return nil, err
+			}
+		}
+		return filesResponse, nil
+	}
+
+	// The LFS objects have to exist by the time the pointers to them are pushed
+	if err := storeLFSObjects(repo, opts.Files); err != nil {
+		return nil, err
+	}
+
+	// Now commit the tree
+	start = time.Now()
+	var commitHash string
+	if opts.Amend {
+		commitHash, err = t.CommitTreeWithParents(authorSig, committerSig, treeHash, message, signingKey, parents)
+	} else {
+		commitHash, err = t.CommitTree(authorSig, committerSig, treeHash, message, signingKey, opts.AdditionalParents...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	observePhase("commit", start)
+
+	// Then push this tree to NewBranch
+	push := t.Push
+	forcedCommitID := ""
+	if opts.bulkChange != nil {
+		push = t.pushWithoutHooks
+	} else if opts.Amend {
+		// The amended commit only replaces the head it was made from
+		push = func(doer *models.User, commitHash, branch string) error {
+			return t.ForcePush(doer, commitHash, branch, lastCommitID)
+		}
+	} else if opts.Force {
+		push = func(doer *models.User, commitHash, branch string) (err error) {
+			forcedCommitID, err = forcePushBranch(repo, t, doer, commitHash, branch)
+			return err
+		}
+	}
+	start = time.Now()
+	if err := push(doer, commitHash, opts.NewBranch); err != nil {
+		// Report a push rejected because the branch moved in the meantime as such
+		if opts.baseCommitID == "" {
+			if headErr := checkBranchHead(repo, opts.baseBranch(), lastCommitID); models.IsErrCommitIDDoesNotMatch(headErr) {
+				return nil, headErr
+			}
+		}
+		return nil, err
+	}
+	observePhase("push", start)
+
+	oldCommitID := opts.LastCommitID
+	if opts.CreateNewBranch || commit == nil {
+		oldCommitID = git.EmptySHA
+	} else if forcedCommitID != "" {
+		oldCommitID = forcedCommitID
+	}
+
+	if opts.bulkChange != nil {
+		opts.bulkChange.pushed(oldCommitID, commitHash)
+	} else if err := pushUpdate(repo, doer, opts.NewBranch, oldCommitID, commitHash); err != nil {
+		return nil, err
+	}
+
+	// The first branch of a repository becomes its default one
+	if commit == nil {
+		if err := setDefaultBranch(repo, opts.NewBranch); err != nil {
+			return nil, err
+		}
+		repo.IsEmpty = false
+		repo.DefaultBranch = opts.NewBranch
+	}
+
+	newCommit, err := t.GetCommit(commitHash)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := getFilesResponseContents(repo, &newCommit.Tree, commit, opts.NewBranch, opts.Files)
+	if err != nil {
+		return nil, err
+	}
+	filesResponse := &structs.FilesResponse{
+		Files:        contents,
+		Commit:       GetFileCommitResponse(repo, newCommit),
+		Verification: GetPayloadCommitVerification(newCommit),
+	}
+	if filesResponse.Trees, err = getFilesResponseTrees(&newCommit.Tree, opts.Files); err != nil {
+		return nil, err
+	}
+	if filesResponse.Stats, err = getFilesStats(t, commit, treeHash); err != nil {
+		return nil, err
+	}
+	if opts.IncludeDiff {
+		if filesResponse.Diffs, err = getFilesDiffs(t, commit, treeHash); err != nil {
+			return nil, err
+		}
+	}
+
+	if pullBaseBranch != "" {
+		if message == "" {
+			message = defaultMessage(opts.Files)
+		}
+		if filesResponse.PullRequestNumber, err = createPullRequest(repo, repo, doer, pullBaseBranch, opts.NewBranch, lastCommitID, message); err != nil {
+			return nil, err
+		}
+	}
+	return filesResponse, nil
+}
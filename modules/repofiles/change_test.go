@@ -0,0 +1,819 @@
+// Copyright 2018 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/setting"
+	"code.gitea.io/gitea/modules/structs"
+	"code.gitea.io/sdk/gitea"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getCommitsCount(t *testing.T, repo *models.Repository, branch string) string {
+	stdout, err := git.NewCommand("rev-list", "--count", branch).RunInDir(repo.RepoPath())
+	assert.NoError(t, err)
+	return strings.TrimSpace(stdout)
+}
+
+func TestChangeRepoFiles(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		CommitOptions: CommitOptions{Message: "Add files"},
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "a.txt", Content: "a"},
+			{Operation: "create", TreePath: "b.txt", Content: "b"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "2", getCommitsCount(t, repo, "master"))
+
+	filesResponse, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		CommitOptions: CommitOptions{Message: "Change files"},
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "dir/c.txt", Content: "c"},
+			{Operation: "update", TreePath: "a.txt", Content: "updated a"},
+			{Operation: "rename", TreePath: "dir/b.txt", FromTreePath: "b.txt"},
+			{Operation: "delete", TreePath: "README.md"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "3", getCommitsCount(t, repo, "master"))
+
+	assert.Len(t, filesResponse.Files, 4)
+	assert.EqualValues(t, "dir/c.txt", filesResponse.Files[0].Path)
+	assert.EqualValues(t, "a.txt", filesResponse.Files[1].Path)
+	assert.EqualValues(t, "dir/b.txt", filesResponse.Files[2].Path)
+	assert.Nil(t, filesResponse.Files[3])
+
+	assert.EqualValues(t, "c", getBranchFileContent(t, repo, "master", "dir/c.txt"))
+	assert.EqualValues(t, "updated a", getBranchFileContent(t, repo, "master", "a.txt"))
+	assert.EqualValues(t, "b", getBranchFileContent(t, repo, "master", "dir/b.txt"))
+
+	stdout, err := git.NewCommand("ls-tree", "-r", "--name-only", "master").RunInDir(repo.RepoPath())
+	assert.NoError(t, err)
+	assert.EqualValues(t, "a.txt\ndir/b.txt\ndir/c.txt", strings.TrimSpace(stdout))
+}
+
+func TestChangeRepoFiles_InvalidOperationFailsBatch(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		CommitOptions: CommitOptions{Message: "Change files"},
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "a.txt", Content: "a"},
+			{Operation: "update", TreePath: "does-not-exist.txt", Content: "b"},
+		},
+	})
+	assert.True(t, models.IsErrRepoFileDoesNotExist(err))
+
+	_, err = ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		CommitOptions: CommitOptions{Message: "Change files"},
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "a.txt", Content: "a"},
+			{Operation: "create", TreePath: "./", Content: "b"},
+		},
+	})
+	assert.True(t, models.IsErrFilenameInvalid(err))
+
+	_, err = ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		CommitOptions: CommitOptions{Message: "Change files"},
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "a.txt", Content: "a"},
+			{Operation: "copy", TreePath: "b.txt"},
+		},
+	})
+	assert.Error(t, err)
+
+	assert.EqualValues(t, "1", getCommitsCount(t, repo, "master"))
+}
+
+func TestChangeRepoFiles_PathConflicts(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	kases := []struct {
+		files []*ChangeRepoFile
+		path  string
+	}{
+		{
+			files: []*ChangeRepoFile{
+				{Operation: "create", TreePath: "a.txt", Content: "a"},
+				{Operation: "create", TreePath: "./a.txt", Content: "other a"},
+			},
+			path: "a.txt",
+		},
+		{
+			files: []*ChangeRepoFile{
+				{Operation: "rename", TreePath: "b.txt", FromTreePath: "README.md"},
+				{Operation: "create", TreePath: "b.txt", Content: "b"},
+			},
+			path: "b.txt",
+		},
+		{
+			files: []*ChangeRepoFile{
+				{Operation: "delete", TreePath: "README.md"},
+				{Operation: "update", TreePath: "README.md", Content: "updated"},
+			},
+			path: "README.md",
+		},
+		{
+			files: []*ChangeRepoFile{
+				{Operation: "create", TreePath: "z.txt", Content: "z"},
+				{Operation: "create", TreePath: "y.txt", Content: "y"},
+				{Operation: "create", TreePath: "z.txt", Content: "z"},
+				{Operation: "create", TreePath: "y.txt", Content: "y"},
+			},
+			path: "y.txt",
+		},
+	}
+	for _, kase := range kases {
+		_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+			CommitOptions: CommitOptions{Message: "Change files"},
+			Files:         kase.files,
+		})
+		assert.True(t, models.IsErrFilePathConflict(err))
+		assert.EqualValues(t, kase.path, err.(models.ErrFilePathConflict).Path)
+	}
+
+	assert.EqualValues(t, "1", getCommitsCount(t, repo, "master"))
+}
+
+func TestChangeRepoFiles_GitDirPaths(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	commitsCount := getCommitsCount(t, repo, "master")
+	for _, treePath := range []string{".git/config", ".GIT/hooks/pre-receive", "a/../.git/HEAD", ".git./config", "GIT~1/config", ".g\u200cit/config"} {
+		for _, file := range []*ChangeRepoFile{
+			{Operation: "create", TreePath: treePath, Content: "content"},
+			{Operation: "update", TreePath: treePath, Content: "content"},
+			{Operation: "update", TreePath: treePath, FromTreePath: "README.md", Content: "content"},
+			{Operation: "rename", TreePath: treePath, FromTreePath: "README.md"},
+			{Operation: "rename", TreePath: "README.txt", FromTreePath: treePath},
+			{Operation: "delete", TreePath: treePath},
+		} {
+			_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{Files: []*ChangeRepoFile{file}})
+			assert.True(t, models.IsErrFilenameInvalid(err), "%s %s: %v", file.Operation, treePath, err)
+		}
+	}
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+}
+
+func TestChangeRepoFiles_DefaultMessage(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	getLastCommitMessage := func() string {
+		stdout, err := git.NewCommand("log", "-1", "--format=%B", "master").RunInDir(repo.RepoPath())
+		assert.NoError(t, err)
+		return strings.TrimSpace(stdout)
+	}
+
+	for _, testCase := range []struct {
+		Message  string
+		Files    []*ChangeRepoFile
+		Expected string
+	}{
+		{"", []*ChangeRepoFile{{Operation: "create", TreePath: "a.txt", Content: "a"}}, "Add 'a.txt'"},
+		{" \n ", []*ChangeRepoFile{{Operation: "update", TreePath: "a.txt", Content: "b"}}, "Update 'a.txt'"},
+		{"", []*ChangeRepoFile{{Operation: "update", TreePath: "b.txt", FromTreePath: "a.txt", Content: "b"}}, "Rename 'a.txt' to 'b.txt'"},
+		{"", []*ChangeRepoFile{{Operation: "rename", TreePath: "c.txt", FromTreePath: "b.txt"}}, "Rename 'b.txt' to 'c.txt'"},
+		{"", []*ChangeRepoFile{{Operation: "delete", TreePath: "c.txt"}}, "Delete 'c.txt'"},
+		{"", []*ChangeRepoFile{
+			{Operation: "create", TreePath: "d.txt", Content: "d"},
+			{Operation: "update", TreePath: "README.md", Content: "readme"},
+		}, "Change 'd.txt', 'README.md'"},
+		{NoDefaultMessage, []*ChangeRepoFile{{Operation: "delete", TreePath: "d.txt"}}, ""},
+	} {
+		_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+			CommitOptions: CommitOptions{Message: testCase.Message},
+			Files:         testCase.Files,
+		})
+		assert.NoError(t, err)
+		assert.EqualValues(t, testCase.Expected, getLastCommitMessage())
+	}
+}
+
+func TestChangeRepoFiles_Signoff(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	sig := doer.NewGitSig()
+	signoff := "Signed-off-by: " + sig.Name + " <" + sig.Email + ">"
+
+	for _, testCase := range []struct {
+		Message  string
+		Expected string
+	}{
+		{"", "Add 'a.txt'\n\n" + signoff},
+		{"Fix typo", "Fix typo\n\n" + signoff},
+		{"Fix typo\n\nin the readme\nand the docs", "Fix typo\n\nin the readme\nand the docs\n\n" + signoff},
+		{"Fix typo\n\nReviewed-by: Someone <someone@example.com>",
+			"Fix typo\n\nReviewed-by: Someone <someone@example.com>\n" + signoff},
+		{"Fix typo\n\n" + signoff, "Fix typo\n\n" + signoff},
+		{"Fix typo\n\n" + signoff + "\nReviewed-by: Someone <someone@example.com>",
+			"Fix typo\n\n" + signoff + "\nReviewed-by: Someone <someone@example.com>"},
+		{NoDefaultMessage, signoff},
+	} {
+		fileResponse, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+			CommitOptions: CommitOptions{Message: testCase.Message, Signoff: true},
+			Files:         []*ChangeRepoFile{{Operation: "create", TreePath: "a.txt", Content: "a"}},
+		})
+		assert.NoError(t, err)
+		stdout, err := git.NewCommand("log", "-1", "--format=%B", "master").RunInDir(repo.RepoPath())
+		assert.NoError(t, err)
+		assert.EqualValues(t, testCase.Expected, strings.TrimSpace(stdout))
+		assert.EqualValues(t, testCase.Expected+"\n", fileResponse.Commit.Message)
+
+		_, err = DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{TreePath: "a.txt"})
+		assert.NoError(t, err)
+	}
+}
+
+func TestChangeRepoFiles_CoAuthors(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	sig := doer.NewGitSig()
+
+	// Each co-author is added once, in order and before the sign-off
+	fileResponse, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		CommitOptions: CommitOptions{
+			Message: "Fix typo",
+			CoAuthors: []IdentityOptions{
+				{Name: "Jane Doe", Email: "jane@example.com"},
+				{Name: " John Doe ", Email: "john@example.com"},
+				{Name: "Jane", Email: "JANE@example.com"},
+			},
+			Signoff: true,
+		},
+		Files: []*ChangeRepoFile{{Operation: "create", TreePath: "a.txt", Content: "a"}},
+	})
+	assert.NoError(t, err)
+	expected := "Fix typo\n\n" +
+		"Co-authored-by: Jane Doe <jane@example.com>\n" +
+		"Co-authored-by: John Doe <john@example.com>\n" +
+		"Signed-off-by: " + sig.Name + " <" + sig.Email + ">"
+	stdout, err := git.NewCommand("log", "-1", "--format=%B", "master").RunInDir(repo.RepoPath())
+	assert.NoError(t, err)
+	assert.EqualValues(t, expected, strings.TrimSpace(stdout))
+	assert.EqualValues(t, expected+"\n", fileResponse.Commit.Message)
+
+	commitsCount := getCommitsCount(t, repo, "master")
+	for _, coAuthor := range []IdentityOptions{
+		{Name: " ", Email: "jane@example.com"},
+		{Name: "Jane Doe", Email: ""},
+		{Name: "Jane <Doe>", Email: "jane@example.com"},
+		{Name: "Jane Doe", Email: "jane"},
+		{Name: "Jane Doe", Email: "jane@example.com>\nSigned-off-by: Someone <someone@example.com"},
+	} {
+		_, err = ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+			CommitOptions: CommitOptions{CoAuthors: []IdentityOptions{coAuthor}},
+			Files:         []*ChangeRepoFile{{Operation: "create", TreePath: "b.txt", Content: "b"}},
+		})
+		assert.True(t, models.IsErrInvalidCoAuthor(err), "%v: %v", coAuthor, err)
+	}
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+}
+
+func TestChangeRepoFiles_Trees(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	getTreeSHA := func(commitID, dir string) string {
+		if dir == "" {
+			stdout, err := git.NewCommand("rev-parse", commitID+"^{tree}").RunInDir(repo.RepoPath())
+			assert.NoError(t, err)
+			return strings.TrimSpace(stdout)
+		}
+		stdout, err := git.NewCommand("ls-tree", commitID, "--", dir).RunInDir(repo.RepoPath())
+		assert.NoError(t, err)
+		if fields := strings.Fields(stdout); len(fields) > 0 {
+			assert.EqualValues(t, "tree", fields[1])
+			return fields[2]
+		}
+		return ""
+	}
+	checkTrees := func(filesResponse *structs.FilesResponse, dirs ...string) {
+		if assert.Len(t, filesResponse.Trees, len(dirs)) {
+			for i, dir := range dirs {
+				assert.EqualValues(t, dir, filesResponse.Trees[i].Path)
+				assert.EqualValues(t, getTreeSHA(filesResponse.Commit.SHA, dir), filesResponse.Trees[i].SHA, dir)
+			}
+		}
+		assert.EqualValues(t, filesResponse.Commit.Tree.SHA, filesResponse.Trees[0].SHA)
+	}
+
+	filesResponse, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "a/b/c.txt", Content: "c"},
+			{Operation: "create", TreePath: "a/d.txt", Content: "d"},
+		},
+	})
+	assert.NoError(t, err)
+	checkTrees(filesResponse, "", "a", "a/b")
+
+	filesResponse, err = ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{
+			{Operation: "delete", TreePath: "a/d.txt"},
+			{Operation: "update", TreePath: "a/b/c.txt", Content: "c2"},
+			{Operation: "rename", TreePath: "e/README.md", FromTreePath: "README.md"},
+		},
+	})
+	assert.NoError(t, err)
+	checkTrees(filesResponse, "", "a", "a/b", "e")
+
+	// The directories removed by the change have no tree anymore
+	fileResponse, err := DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{TreePath: "a/b/c.txt"})
+	assert.NoError(t, err)
+	if assert.Len(t, fileResponse.Trees, 2) {
+		assert.EqualValues(t, "a/b", fileResponse.Trees[1].Path)
+		assert.EqualValues(t, "", fileResponse.Trees[1].SHA)
+		assert.EqualValues(t, fileResponse.Commit.Tree.SHA, fileResponse.Trees[0].SHA)
+	}
+
+	// And the dry runs describe the trees they would write
+	filesResponse, err = ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		CommitOptions: CommitOptions{DryRun: true},
+		Files:         []*ChangeRepoFile{{Operation: "create", TreePath: "e/f.txt", Content: "f"}},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, filesResponse.Trees, 2) {
+		assert.EqualValues(t, filesResponse.Commit.Tree.SHA, filesResponse.Trees[0].SHA)
+		assert.EqualValues(t, "e", filesResponse.Trees[1].Path)
+		assert.NotEqual(t, getTreeSHA("master", "e"), filesResponse.Trees[1].SHA)
+	}
+}
+
+func TestChangeRepoFiles_DryRun(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	commitsCount := getCommitsCount(t, repo, "master")
+	actionsCount := models.GetCount(t, &models.Action{RepoID: repo.ID})
+	filesResponse, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		CommitOptions: CommitOptions{
+			Message:       "Change files",
+			AuthorDate:    "2019-01-01T00:00:00Z",
+			CommitterDate: "2019-01-01T00:00:00Z",
+			DryRun:        true,
+		},
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "a.txt", Content: "a"},
+			{Operation: "delete", TreePath: "README.md"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+	assert.EqualValues(t, actionsCount, models.GetCount(t, &models.Action{RepoID: repo.ID}))
+
+	// The response describes the tree that would have been committed
+	assert.Len(t, filesResponse.Files, 2)
+	assert.EqualValues(t, "a.txt", filesResponse.Files[0].Path)
+	assert.EqualValues(t, "2e65efe2a145dda7ee51d1741299f848e5bf752e", filesResponse.Files[0].SHA)
+	assert.EqualValues(t, 1, filesResponse.Files[0].Size)
+	assert.Nil(t, filesResponse.Files[1])
+	assert.NotEmpty(t, filesResponse.Commit.SHA)
+	assert.Empty(t, filesResponse.Commit.HTMLURL)
+	assert.NotEmpty(t, filesResponse.Commit.Tree.SHA)
+	assert.EqualValues(t, doer.Email, filesResponse.Commit.Author.Email)
+	assert.EqualValues(t, "Change files\n", filesResponse.Commit.Message)
+	assert.Nil(t, filesResponse.Verification)
+
+	// Committing the same changes at the same dates results in the same commit
+	committedResponse, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		CommitOptions: CommitOptions{
+			Message:       "Change files",
+			AuthorDate:    "2019-01-01T00:00:00Z",
+			CommitterDate: "2019-01-01T00:00:00Z",
+		},
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "a.txt", Content: "a"},
+			{Operation: "delete", TreePath: "README.md"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, filesResponse.Commit.Tree.SHA, committedResponse.Commit.Tree.SHA)
+	assert.EqualValues(t, filesResponse.Commit.SHA, committedResponse.Commit.SHA)
+	assert.EqualValues(t, committedResponse.Commit.SHA, getBranchCommit(t, repo, "master").ID.String())
+}
+
+func TestChangeRepoFiles_LastCommitIDDoesNotMatch(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	stdout, err := git.NewCommand("rev-parse", "master").RunInDir(repo.RepoPath())
+	assert.NoError(t, err)
+	lastCommitID := strings.TrimSpace(stdout)
+
+	// The branch moves after the client read its head
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "a.txt",
+		Content:  "a",
+	})
+	assert.NoError(t, err)
+
+	commitsCount := getCommitsCount(t, repo, "master")
+	for _, dryRun := range []bool{true, false} {
+		_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+			CommitOptions: CommitOptions{LastCommitID: lastCommitID, DryRun: dryRun},
+			TreePath:      "b.txt",
+			Content:       "b",
+		})
+		if assert.True(t, models.IsErrCommitIDDoesNotMatch(err)) {
+			assert.EqualValues(t, lastCommitID, err.(models.ErrCommitIDDoesNotMatch).GivenCommitID)
+		}
+	}
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+}
+
+func TestChangeRepoFiles_ProtectedBranch(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	protectBranch := &models.ProtectedBranch{
+		RepoID:     repo.ID,
+		BranchName: "master",
+	}
+	assert.NoError(t, models.UpdateProtectBranch(repo, protectBranch, models.WhitelistOptions{}))
+
+	createFile := func(opts *CreateRepoFileOptions) error {
+		opts.TreePath = "new_file.md"
+		opts.Content = "content"
+		_, err := CreateRepoFile(repo, doer, opts)
+		return err
+	}
+
+	err := createFile(&CreateRepoFileOptions{})
+	if assert.True(t, models.IsErrNotAllowedToPush(err)) {
+		assert.EqualValues(t, models.ErrNotAllowedToPush{
+			BranchName: "master",
+			UserName:   doer.Name,
+			Reason:     models.ProtectedBranchPushDisabled,
+		}, err)
+	}
+
+	// Only whitelisted users can push
+	protectBranch.EnableWhitelist = true
+	assert.NoError(t, models.UpdateProtectBranch(repo, protectBranch, models.WhitelistOptions{}))
+	err = createFile(&CreateRepoFileOptions{})
+	if assert.True(t, models.IsErrNotAllowedToPush(err)) {
+		assert.EqualValues(t, models.ProtectedBranchNotWhitelisted, err.(models.ErrNotAllowedToPush).Reason)
+	}
+
+	// Changes can still be committed to a new branch
+	assert.NoError(t, createFile(&CreateRepoFileOptions{CommitOptions: CommitOptions{NewBranch: "new_branch", CreateNewBranch: true}}))
+
+	assert.NoError(t, models.UpdateProtectBranch(repo, protectBranch, models.WhitelistOptions{UserIDs: []int64{doer.ID}}))
+	assert.NoError(t, createFile(&CreateRepoFileOptions{}))
+}
+
+func TestChangeRepoFiles_ProtectedBranchWhitelist(t *testing.T) {
+	repo := prepareTestRepo(t, 3)
+	owner := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	member := models.AssertExistsAndLoadBean(t, &models.User{ID: 4}).(*models.User)
+	team := models.AssertExistsAndLoadBean(t, &models.Team{ID: 2}).(*models.Team)
+
+	protectBranch := &models.ProtectedBranch{
+		RepoID:          repo.ID,
+		BranchName:      "master",
+		EnableWhitelist: true,
+	}
+	assert.NoError(t, models.UpdateProtectBranch(repo, protectBranch, models.WhitelistOptions{}))
+
+	createFile := func(doer *models.User, treePath string) error {
+		_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{TreePath: treePath, Content: "content"})
+		return err
+	}
+	checkNotWhitelisted := func(err error, doer *models.User) {
+		if assert.True(t, models.IsErrNotAllowedToPush(err), "%v", err) {
+			assert.EqualValues(t, doer.Name, err.(models.ErrNotAllowedToPush).UserName)
+			assert.EqualValues(t, models.ProtectedBranchNotWhitelisted, err.(models.ErrNotAllowedToPush).Reason)
+		}
+	}
+
+	// Nobody, not even the owners of the organization, can push unless whitelisted
+	checkNotWhitelisted(createFile(member, "a.txt"), member)
+	checkNotWhitelisted(createFile(owner, "a.txt"), owner)
+
+	// The members of a whitelisted team can
+	assert.NoError(t, models.UpdateProtectBranch(repo, protectBranch, models.WhitelistOptions{TeamIDs: []int64{team.ID}}))
+	assert.NoError(t, createFile(member, "a.txt"))
+	assert.NoError(t, createFile(owner, "b.txt"))
+
+	// As well as the whitelisted users
+	assert.NoError(t, models.UpdateProtectBranch(repo, protectBranch, models.WhitelistOptions{UserIDs: []int64{member.ID}}))
+	assert.NoError(t, createFile(member, "c.txt"))
+	checkNotWhitelisted(createFile(owner, "d.txt"), owner)
+
+	// The administrators of the repository bypass the protection if allowed to, even when nobody can push
+	oldAdminsBypassProtection := setting.Repository.AdminsBypassProtection
+	setting.Repository.AdminsBypassProtection = true
+	defer func() {
+		setting.Repository.AdminsBypassProtection = oldAdminsBypassProtection
+	}()
+	assert.NoError(t, createFile(owner, "d.txt"))
+	// Which doesn't apply to their git pushes
+	isProtected, err := repo.IsProtectedBranchForPush("master", owner)
+	assert.NoError(t, err)
+	assert.True(t, isProtected)
+	protectBranch.EnableWhitelist = false
+	assert.NoError(t, models.UpdateProtectBranch(repo, protectBranch, models.WhitelistOptions{UserIDs: []int64{member.ID}}))
+	assert.NoError(t, createFile(owner, "e.txt"))
+	err = createFile(member, "e2.txt")
+	if assert.True(t, models.IsErrNotAllowedToPush(err), "%v", err) {
+		assert.EqualValues(t, models.ProtectedBranchPushDisabled, err.(models.ErrNotAllowedToPush).Reason)
+	}
+}
+
+func TestChangeRepoFiles_CommitDates(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	filesResponse, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		CommitOptions: CommitOptions{
+			Message:       "Import a.txt",
+			AuthorDate:    "2005-04-07T22:13:13+02:00",
+			CommitterDate: "2006-01-02T15:04:05Z",
+		},
+		Files: []*ChangeRepoFile{{Operation: "create", TreePath: "a.txt", Content: "a"}},
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "2005-04-07T20:13:13Z", filesResponse.Commit.Author.Date)
+	assert.EqualValues(t, "2006-01-02T15:04:05Z", filesResponse.Commit.Committer.Date)
+
+	stdout, err := git.NewCommand("log", "-1", "--format=%aI %cI", "master").RunInDir(repo.RepoPath())
+	assert.NoError(t, err)
+	assert.EqualValues(t, "2005-04-07T22:13:13+02:00 2006-01-02T15:04:05+00:00", strings.TrimSpace(stdout))
+}
+
+func TestChangeRepoFiles_InvalidCommitDates(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	for _, date := range []string{
+		"2006-01-02 15:04:05",
+		"1969-12-31T23:59:59Z",
+		time.Now().Add(setting.Repository.MaxCommitDateSkew + time.Hour).Format(time.RFC3339),
+	} {
+		_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+			CommitOptions: CommitOptions{Message: "Import a.txt", AuthorDate: date},
+			Files:         []*ChangeRepoFile{{Operation: "create", TreePath: "a.txt", Content: "a"}},
+		})
+		assert.True(t, models.IsErrInvalidCommitDate(err), date)
+		_, err = ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+			CommitOptions: CommitOptions{Message: "Import a.txt", CommitterDate: date},
+			Files:         []*ChangeRepoFile{{Operation: "create", TreePath: "a.txt", Content: "a"}},
+		})
+		assert.True(t, models.IsErrInvalidCommitDate(err), date)
+	}
+	assert.EqualValues(t, "1", getCommitsCount(t, repo, "master"))
+
+	// A date within the skew is accepted
+	_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		CommitOptions: CommitOptions{
+			Message:       "Import a.txt",
+			CommitterDate: time.Now().Add(time.Minute).Format(time.RFC3339),
+		},
+		Files: []*ChangeRepoFile{{Operation: "create", TreePath: "a.txt", Content: "a"}},
+	})
+	assert.NoError(t, err)
+}
+
+func TestChangeRepoFiles_PushEvents(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	// Webhook 1 of the fixtures only receives pushes, this one everything
+	webhook := &models.Webhook{
+		RepoID:      repo.ID,
+		URL:         "www.example.com/everything",
+		ContentType: models.ContentTypeJSON,
+		HookEvent:   &models.HookEvent{SendEverything: true},
+		IsActive:    true,
+	}
+	assert.NoError(t, webhook.UpdateEvent())
+	assert.NoError(t, models.CreateWebhook(webhook))
+
+	fileResponse, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "a.txt",
+		Content:  "a",
+	})
+	assert.NoError(t, err)
+
+	// The push is delivered with the new commit and shown to the watchers
+	for _, hookID := range []int64{1, webhook.ID} {
+		hookTask := models.AssertExistsAndLoadBean(t, &models.HookTask{
+			RepoID:    repo.ID,
+			HookID:    hookID,
+			EventType: models.HookEventPush,
+		}).(*models.HookTask)
+		assert.Contains(t, hookTask.PayloadContent, fileResponse.Commit.SHA)
+	}
+	models.AssertNotExistsBean(t, &models.HookTask{RepoID: repo.ID, EventType: models.HookEventCreate})
+	for _, userID := range []int64{doer.ID, 1, 4} {
+		models.AssertExistsAndLoadBean(t, &models.Action{
+			UserID:  userID,
+			OpType:  models.ActionCommitRepo,
+			RepoID:  repo.ID,
+			RefName: "master",
+		})
+	}
+
+	// A new branch is created before being pushed to
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{
+			OldBranch:       "master",
+			NewBranch:       "push-events",
+			CreateNewBranch: true,
+		},
+		TreePath: "b.txt",
+		Content:  "b",
+	})
+	assert.NoError(t, err)
+	models.AssertExistsAndLoadBean(t, &models.HookTask{RepoID: repo.ID, HookID: webhook.ID, EventType: models.HookEventCreate})
+	models.AssertExistsAndLoadBean(t, &models.HookTask{RepoID: repo.ID, HookID: 1, EventType: models.HookEventPush},
+		models.Cond("payload_content LIKE ?", "%refs/heads/push-events%"))
+	models.AssertNotExistsBean(t, &models.HookTask{RepoID: repo.ID, HookID: 1, EventType: models.HookEventCreate})
+}
+
+func TestChangeRepoFiles_PushEventOldCommitID(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	stdout, err := git.NewCommand("rev-parse", "master").RunInDir(repo.RepoPath())
+	assert.NoError(t, err)
+	oldCommitID := strings.TrimSpace(stdout)
+
+	// The push of a change to the same branch given no LastCommitID is from its current head
+	fileResponse, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "a.txt",
+		Content:  "a",
+	})
+	assert.NoError(t, err)
+	hookTask := models.AssertExistsAndLoadBean(t, &models.HookTask{
+		RepoID:    repo.ID,
+		HookID:    1,
+		EventType: models.HookEventPush,
+	}).(*models.HookTask)
+	var payload gitea.PushPayload
+	assert.NoError(t, json.Unmarshal([]byte(hookTask.PayloadContent), &payload))
+	assert.EqualValues(t, oldCommitID, payload.Before)
+	assert.EqualValues(t, fileResponse.Commit.SHA, payload.After)
+}
+
+func TestChangeRepoFiles_AdditionalParents(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{
+			OldBranch:       "master",
+			NewBranch:       "imported",
+			CreateNewBranch: true,
+		},
+		TreePath: "imported.txt",
+		Content:  "imported",
+	})
+	assert.NoError(t, err)
+	stdout, err := git.NewCommand("rev-parse", "master", "imported").RunInDir(repo.RepoPath())
+	assert.NoError(t, err)
+	heads := strings.Fields(stdout)
+
+	// The short ID of the parent is resolved
+	filesResponse, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		CommitOptions:     CommitOptions{Message: "Merge imported"},
+		Files:             []*ChangeRepoFile{{Operation: "create", TreePath: "imported.txt", Content: "imported"}},
+		AdditionalParents: []string{heads[1][:10]},
+	})
+	assert.NoError(t, err)
+	stdout, err = git.NewCommand("cat-file", "-p", filesResponse.Commit.SHA).RunInDir(repo.RepoPath())
+	assert.NoError(t, err)
+	assert.Contains(t, stdout, "parent "+heads[0]+"\nparent "+heads[1]+"\n")
+
+	commitsCount := getCommitsCount(t, repo, "master")
+	_, err = ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files:             []*ChangeRepoFile{{Operation: "create", TreePath: "a.txt", Content: "a"}},
+		AdditionalParents: []string{"0123456789abcdef0123456789abcdef01234567"},
+	})
+	if assert.True(t, models.IsErrParentCommitNotExist(err)) {
+		assert.EqualValues(t, "0123456789abcdef0123456789abcdef01234567", err.(models.ErrParentCommitNotExist).ID)
+	}
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+}
+
+func TestChangeRepoFiles_HEADBranch(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	_, err := git.NewCommand("symbolic-ref", "HEAD", git.BranchPrefix+"develop").RunInDir(repo.RepoPath())
+	assert.NoError(t, err)
+	developCommitsCount, err := strconv.Atoi(getCommitsCount(t, repo, "develop"))
+	assert.NoError(t, err)
+	masterCommitsCount := getCommitsCount(t, repo, "master")
+
+	// HEAD is committed to as the branch it points to, and pushed under its name
+	fileResponse, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{OldBranch: "HEAD"},
+		TreePath:      "a.txt",
+		Content:       "a",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, fileResponse.Commit.SHA, getBranchCommit(t, repo, "develop").ID.String())
+	models.AssertExistsAndLoadBean(t, &models.Action{
+		UserID:  doer.ID,
+		OpType:  models.ActionCommitRepo,
+		RepoID:  repo.ID,
+		RefName: "develop",
+	})
+	models.AssertNotExistsBean(t, &models.Action{RepoID: repo.ID, RefName: "HEAD"})
+	_, err = repo.GetBranch("HEAD")
+	assert.True(t, models.IsErrBranchNotExist(err), "%v", err)
+
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{OldBranch: "HEAD", NewBranch: "HEAD"},
+		TreePath:      "c.txt",
+		Content:       "c",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "c", getBranchFileContent(t, repo, "develop", "c.txt"))
+	assert.EqualValues(t, strconv.Itoa(developCommitsCount+2), getCommitsCount(t, repo, "develop"))
+	assert.EqualValues(t, masterCommitsCount, getCommitsCount(t, repo, "master"))
+
+	// A repository with no default branch recorded is committed to on master, not HEAD
+	repo.DefaultBranch = ""
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "b.txt",
+		Content:  "b",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "b", getBranchFileContent(t, repo, "master", "b.txt"))
+	assert.EqualValues(t, strconv.Itoa(developCommitsCount+2), getCommitsCount(t, repo, "develop"))
+
+	// No branch named HEAD can be created still
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{
+			OldBranch:       "develop",
+			NewBranch:       "HEAD",
+			CreateNewBranch: true,
+		},
+		TreePath: "d.txt",
+		Content:  "d",
+	})
+	assert.True(t, models.IsErrBranchNameInvalid(err), "%v", err)
+}
+
+func TestChangeRepoFiles_Parents(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	// An edit of a branch has its previous head for parent
+	masterCommitID := getBranchCommit(t, repo, "master").ID.String()
+	filesResponse, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{{Operation: "create", TreePath: "a.txt", Content: "a"}},
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, []*structs.CommitMeta{{
+		URL: setting.AppURL + "api/v1/repos/user2/repo1/git/commits/" + masterCommitID,
+		SHA: masterCommitID,
+	}}, filesResponse.Commit.Parents)
+
+	// A new branch has the head of the branch it starts from
+	developCommitID := getBranchCommit(t, repo, "develop").ID.String()
+	filesResponse, err = ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		CommitOptions: CommitOptions{
+			OldBranch:       "develop",
+			NewBranch:       "parents",
+			CreateNewBranch: true,
+		},
+		Files: []*ChangeRepoFile{{Operation: "create", TreePath: "b.txt", Content: "b"}},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, filesResponse.Commit.Parents, 1) {
+		assert.EqualValues(t, developCommitID, filesResponse.Commit.Parents[0].SHA)
+	}
+
+	// A dry run tells the parents the commit would have, merged ones included
+	masterCommitID = getBranchCommit(t, repo, "master").ID.String()
+	filesResponse, err = ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		CommitOptions:     CommitOptions{DryRun: true},
+		AdditionalParents: []string{developCommitID[:10]},
+		Files:             []*ChangeRepoFile{{Operation: "create", TreePath: "c.txt", Content: "c"}},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, filesResponse.Commit.Parents, 2) {
+		assert.EqualValues(t, masterCommitID, filesResponse.Commit.Parents[0].SHA)
+		assert.EqualValues(t, developCommitID, filesResponse.Commit.Parents[1].SHA)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"unicode/utf8"
+
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/base"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/transform"
+)
+
+// byteOrderMarks are the byte order marks of the unicode charsets, by canonical name
+var byteOrderMarks = map[string][]byte{
+	"utf-8":    {0xef, 0xbb, 0xbf},
+	"utf-16le": {0xff, 0xfe},
+	"utf-16be": {0xfe, 0xff},
+}
+
+// lookupCharset returns the encoding of the given charset label, one of those of the
+// WHATWG encoding standard, and its canonical name
+func lookupCharset(label string) (encoding.Encoding, string, bool) {
+	enc, err := htmlindex.Get(label)
+	if err != nil {
+		return nil, "", false
+	}
+	name, err := htmlindex.Name(enc)
+	if err != nil {
+		return nil, "", false
+	}
+	return enc, name, true
+}
+
+// encodingReader reads the content of a file encoded in a charset, reporting the characters
+// the charset can't represent with ErrInvalidCharset
+type encodingReader struct {
+	r       io.Reader
+	path    string
+	charset string
+}
+
+func (r *encodingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if _, ok := err.(interface{ Replacement() byte }); ok || err == encoding.ErrInvalidUTF8 {
+		err = models.ErrInvalidCharset{Path: r.path, Charset: r.charset, Reason: "content not representable in charset"}
+	}
+	return n, err
+}
+
+// encodeContent makes the UTF-8 content of the given prepared file be written in its Charset,
+// preceded by the byte order mark of that charset if BOM is set
+func encodeContent(file *ChangeRepoFile) error {
+	label := file.Charset
+	if label == "" {
+		label = "utf-8"
+	}
+	enc, name, ok := lookupCharset(label)
+	if !ok {
+		return models.ErrInvalidCharset{Path: file.treePath, Charset: file.Charset, Reason: "unknown charset"}
+	}
+
+	content := file.content
+	if name != "utf-8" {
+		content = &encodingReader{
+			r:       transform.NewReader(content, enc.NewEncoder()),
+			path:    file.treePath,
+			charset: name,
+		}
+	}
+	if file.BOM {
+		bom, ok := byteOrderMarks[name]
+		if !ok {
+			return models.ErrInvalidCharset{Path: file.treePath, Charset: file.Charset, Reason: "no byte order mark"}
+		}
+		content = io.MultiReader(bytes.NewReader(bom), content)
+	}
+	file.content = content
+	return nil
+}
+
+// detectCharset returns the canonical name of the charset of the given beginning of a text
+// content and whether it starts with a byte order mark, or an empty name if it is unknown
+func detectCharset(head []byte) (string, bool) {
+	for name, bom := range byteOrderMarks {
+		if bytes.HasPrefix(head, bom) {
+			return name, true
+		}
+	}
+
+	// The beginning may end in the middle of a character
+	for i := 0; i < utf8.UTFMax && i < len(head); i++ {
+		if utf8.Valid(head[:len(head)-i]) {
+			return "utf-8", false
+		}
+	}
+	label, err := base.DetectEncoding(head)
+	if err != nil {
+		return "", false
+	}
+	if _, name, ok := lookupCharset(label); ok {
+		return name, false
+	}
+	return "", false
+}
+
+// DecodedContent streams the content decoded from its Charset to UTF-8 and without its byte order
+// mark, as given to the file operations to write it back in the same Charset and with the same BOM
+func (content *RepoFileContent) DecodedContent() (io.Reader, error) {
+	r := io.Reader(content.Content)
+	if content.BOM {
+		if _, err := io.CopyN(ioutil.Discard, r, int64(len(byteOrderMarks[content.Charset]))); err != nil {
+			return nil, err
+		}
+	}
+	if enc, name, ok := lookupCharset(content.Charset); ok && name != "utf-8" {
+		r = transform.NewReader(r, enc.NewDecoder())
+	}
+	return r, nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"code.gitea.io/gitea/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateRepoFile_Charset(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "utf16.txt",
+		Content:  "héllo\n",
+		Charset:  "UTF-16LE",
+		BOM:      true,
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "\xff\xfeh\x00\xe9\x00l\x00l\x00o\x00\n\x00", getBranchFileContent(t, repo, "master", "utf16.txt"))
+
+	// The charset is detected when reading the content back
+	content, err := GetRepoFileContent(repo, "master", "utf16.txt", false)
+	assert.NoError(t, err)
+	assert.EqualValues(t, "", content.Encoding)
+	assert.EqualValues(t, "utf-16le", content.Charset)
+	assert.True(t, content.BOM)
+	decoded, err := content.DecodedContent()
+	assert.NoError(t, err)
+	text, err := ioutil.ReadAll(decoded)
+	assert.NoError(t, err)
+	content.Content.Close()
+	assert.EqualValues(t, "héllo\n", string(text))
+
+	// So that it is written back the same way
+	_, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		TreePath: "utf16.txt",
+		Content:  string(text) + "wörld\n",
+		Charset:  content.Charset,
+		BOM:      content.BOM,
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "\xff\xfeh\x00\xe9\x00l\x00l\x00o\x00\n\x00w\x00\xf6\x00r\x00l\x00d\x00\n\x00",
+		getBranchFileContent(t, repo, "master", "utf16.txt"))
+
+	for _, test := range []struct {
+		charset string
+		bom     bool
+		content string
+	}{
+		{"iso-8859-1", false, "h\xe9llo\n"},
+		{"utf-16be", false, "\x00h\x00\xe9\x00l\x00l\x00o\x00\n"},
+		{"", true, "\xef\xbb\xbfhéllo\n"},
+	} {
+		_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+			TreePath: "charset.txt",
+			Content:  "héllo\n",
+			Charset:  test.charset,
+			BOM:      test.bom,
+		})
+		assert.NoError(t, err)
+		assert.EqualValues(t, test.content, getBranchFileContent(t, repo, "master", "charset.txt"), test.charset)
+		_, err = DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{TreePath: "charset.txt"})
+		assert.NoError(t, err)
+	}
+
+	content, err = GetRepoFileContent(repo, "master", "README.md", false)
+	assert.NoError(t, err)
+	content.Content.Close()
+	assert.EqualValues(t, "utf-8", content.Charset)
+	assert.False(t, content.BOM)
+}
+
+func TestCreateRepoFile_InvalidCharset(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	commitsCount := getCommitsCount(t, repo, "master")
+	for _, test := range []struct {
+		charset string
+		bom     bool
+		content string
+		reason  string
+	}{
+		{"klingon", false, "content", "unknown charset"},
+		{"iso-8859-1", true, "content", "no byte order mark"},
+		{"iso-8859-1", false, "€ and 中文", "content not representable in charset"},
+	} {
+		_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+			TreePath: "charset.txt",
+			Content:  test.content,
+			Charset:  test.charset,
+			BOM:      test.bom,
+		})
+		if assert.True(t, models.IsErrInvalidCharset(err), "%s: %v", test.charset, err) {
+			assert.EqualValues(t, test.reason, err.(models.ErrInvalidCharset).Reason)
+		}
+	}
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+}
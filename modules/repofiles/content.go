@@ -0,0 +1,116 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/base"
+	"code.gitea.io/gitea/modules/lfs"
+	"code.gitea.io/gitea/modules/setting"
+)
+
+// RepoFileContent is the content of a file of a repository at a given ref
+type RepoFileContent struct {
+	Path string
+	// SHA of the blob, to be given back when changing the file
+	SHA string
+	// Size of the content, the size of the LFS object when it is resolved
+	Size int64
+	// Encoding the content should be given in as a string, "base64" for binary content
+	// and empty for text, as expected by the file operations
+	Encoding string
+	// Charset is the canonical name of the charset detected for text content, if known, and BOM
+	// whether the content starts with its byte order mark, see DecodedContent
+	Charset string
+	BOM     bool
+	// LFSMetaObject is the LFS object the blob points to, if any
+	LFSMetaObject *models.LFSMetaObject
+	// Content streams the raw content and must be closed
+	Content io.ReadCloser
+}
+
+// GetRepoFileContent returns the content of the file at the given path of the given ref, which may
+// be a branch, a tag or a commit. If resolveLFS is set and the file is a pointer to an LFS object
+// stored on this server, the content of the object is returned instead of the pointer.
+func GetRepoFileContent(repo *models.Repository, ref, treePath string, resolveLFS bool) (*RepoFileContent, error) {
+	if repo.IsEmpty {
+		return nil, models.ErrRepoIsEmpty{RepoName: repo.FullName()}
+	}
+	gitRepo, err := git.OpenRepository(repo.RepoPath())
+	if err != nil {
+		return nil, err
+	}
+	commit, err := gitRepo.GetCommit(ref)
+	if err != nil {
+		return nil, fmt.Errorf("GetCommit [ref: %s]: %v", ref, err)
+	}
+	entry, err := getExistingFileEntry(commit, treePath, "")
+	if err != nil {
+		return nil, err
+	}
+
+	content := &RepoFileContent{
+		Path: treePath,
+		SHA:  entry.ID.String(),
+		Size: entry.Size(),
+	}
+	if content.LFSMetaObject, err = getLFSPointerOfEntry(entry); err != nil {
+		return nil, err
+	}
+
+	var dataRc io.ReadCloser
+	if resolveLFS && content.LFSMetaObject != nil && setting.LFS.StartServer {
+		if dataRc, err = openLFSContent(repo, content.LFSMetaObject); err != nil {
+			return nil, err
+		} else if dataRc != nil {
+			content.Size = content.LFSMetaObject.Size
+		}
+	}
+	if dataRc == nil {
+		if dataRc, err = entry.Blob().DataAsync(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Only the beginning of the content is read to tell whether it is text
+	head := make([]byte, 1024)
+	n, err := io.ReadFull(dataRc, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		dataRc.Close()
+		return nil, err
+	}
+	head = head[:n]
+	if !base.IsTextFile(head) {
+		content.Encoding = "base64"
+	} else {
+		content.Charset, content.BOM = detectCharset(head)
+	}
+	content.Content = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), dataRc), dataRc}
+	return content, nil
+}
+
+// openLFSContent opens the content of the given LFS object of the repository,
+// or returns nil if the object is not stored on this server
+func openLFSContent(repo *models.Repository, pointer *models.LFSMetaObject) (io.ReadCloser, error) {
+	meta, err := repo.GetLFSMetaObjectByOid(pointer.Oid)
+	if err == models.ErrLFSObjectNotExist {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	contentStore := &lfs.ContentStore{BasePath: setting.LFS.ContentPath}
+	if !contentStore.Exists(meta) {
+		return nil, nil
+	}
+	return contentStore.Get(meta, 0)
+}
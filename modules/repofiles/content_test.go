@@ -0,0 +1,98 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readRepoFileContent(t *testing.T, content *RepoFileContent) string {
+	defer content.Content.Close()
+	data, err := ioutil.ReadAll(content.Content)
+	assert.NoError(t, err)
+	return string(data)
+}
+
+func TestGetRepoFileContent(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	readme := getBranchFileContent(t, repo, "master", "README.md")
+	commitID, err := git.NewCommand("rev-parse", "master").RunInDir(repo.RepoPath())
+	assert.NoError(t, err)
+
+	content, err := GetRepoFileContent(repo, "master", "README.md", false)
+	assert.NoError(t, err)
+	assert.EqualValues(t, "README.md", content.Path)
+	assert.EqualValues(t, readmeSHA, content.SHA)
+	assert.EqualValues(t, len(readme), content.Size)
+	assert.EqualValues(t, "", content.Encoding)
+	assert.Nil(t, content.LFSMetaObject)
+	assert.EqualValues(t, readme, readRepoFileContent(t, content))
+
+	// Round trip, the read SHA guards the update
+	_, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		TreePath: "README.md",
+		Content:  readme + "Updated\n",
+		SHA:      content.SHA,
+	})
+	assert.NoError(t, err)
+	content, err = GetRepoFileContent(repo, "master", "README.md", false)
+	assert.NoError(t, err)
+	assert.EqualValues(t, readme+"Updated\n", readRepoFileContent(t, content))
+
+	// Older content is still available by commit
+	content, err = GetRepoFileContent(repo, strings.TrimSpace(commitID), "README.md", false)
+	assert.NoError(t, err)
+	assert.EqualValues(t, readmeSHA, content.SHA)
+	assert.EqualValues(t, readme, readRepoFileContent(t, content))
+}
+
+func TestGetRepoFileContent_Binary(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	data := append([]byte{0, 1, 2, 3}, bytes.Repeat([]byte("binary"), 1000)...)
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath:      "dir/file.bin",
+		ContentReader: bytes.NewReader(data),
+	})
+	assert.NoError(t, err)
+
+	content, err := GetRepoFileContent(repo, "master", "dir/file.bin", false)
+	assert.NoError(t, err)
+	assert.EqualValues(t, "base64", content.Encoding)
+	assert.EqualValues(t, len(data), content.Size)
+	assert.EqualValues(t, string(data), readRepoFileContent(t, content))
+}
+
+func TestGetRepoFileContent_Errors(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "dir/a.txt",
+		Content:  "a",
+	})
+	assert.NoError(t, err)
+
+	for _, treePath := range []string{"missing.md", "dir"} {
+		_, err = GetRepoFileContent(repo, "master", treePath, false)
+		assert.True(t, models.IsErrRepoFileDoesNotExist(err), treePath)
+	}
+
+	_, err = GetRepoFileContent(repo, "does_not_exist", "README.md", false)
+	assert.Error(t, err)
+
+	_, err = GetRepoFileContent(prepareEmptyTestRepo(t), "master", "README.md", false)
+	assert.True(t, models.IsErrRepoIsEmpty(err))
+}
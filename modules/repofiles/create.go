@@ -0,0 +1,62 @@
+// Copyright 2018 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"io"
+
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/structs"
+)
+
+// CreateRepoFileOptions holds the repository create file options
+type CreateRepoFileOptions struct {
+	CommitOptions
+	TreePath string
+	// ContentReader streams the raw content, Content given in Encoding is used when it is nil
+	ContentReader io.Reader
+	Content       string
+	// Encoding of Content, either "base64" or empty for raw content
+	Encoding string
+	// ContentURL is fetched as the raw content in place of ContentReader and Content, see ChangeRepoFile
+	ContentURL string
+	// Charset and BOM encode the content given in UTF-8, see ChangeRepoFile
+	Charset string
+	BOM     bool
+	// ContentSHA is checked against the blob the content is written as, see ChangeRepoFile
+	ContentSHA string
+	// Mode of the file, "100755" for an executable file, see ChangeRepoFile
+	Mode string
+	// Symlink creates a symlink to the path given as content
+	Symlink bool
+	// RejectIgnored refuses a TreePath ignored by the .gitignore files of the repository
+	RejectIgnored bool
+}
+
+// CreateRepoFile adds a new file to the given repository
+func CreateRepoFile(repo *models.Repository, doer *models.User, opts *CreateRepoFileOptions) (*structs.FileResponse, error) {
+	changeOpts := &ChangeRepoFilesOptions{
+		CommitOptions: opts.CommitOptions,
+		Files: []*ChangeRepoFile{{
+			Operation:     "create",
+			TreePath:      opts.TreePath,
+			ContentReader: opts.ContentReader,
+			Content:       opts.Content,
+			Encoding:      opts.Encoding,
+			ContentURL:    opts.ContentURL,
+			Charset:       opts.Charset,
+			BOM:           opts.BOM,
+			ContentSHA:    opts.ContentSHA,
+			Mode:          opts.Mode,
+			Symlink:       opts.Symlink,
+			RejectIgnored: opts.RejectIgnored,
+		}},
+	}
+	filesResponse, err := ChangeRepoFiles(repo, doer, changeOpts)
+	if err != nil {
+		return nil, err
+	}
+	return fileResponseFromFiles(filesResponse), nil
+}
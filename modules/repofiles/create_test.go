@@ -0,0 +1,587 @@
+// Copyright 2018 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/setting"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// pushTestFile adds a file to the master branch with the bare plumbing of a temporary upload repository,
+// so that e.g. dotfiles can be added regardless of the path cleaning done by the file operations
+func pushTestFile(t *testing.T, repo *models.Repository, doer *models.User, treePath, content string) {
+	tmpRepo, err := NewTemporaryUploadRepository(repo)
+	assert.NoError(t, err)
+	defer tmpRepo.Close()
+	assert.NoError(t, tmpRepo.Clone("master"))
+	assert.NoError(t, tmpRepo.SetDefaultIndex())
+	objectHash, err := tmpRepo.HashObject(treePath, strings.NewReader(content))
+	assert.NoError(t, err)
+	assert.NoError(t, tmpRepo.AddObjectToIndex("100644", objectHash, treePath))
+	treeHash, err := tmpRepo.WriteTree()
+	assert.NoError(t, err)
+	commitHash, err := tmpRepo.CommitTree(doer.NewGitSig(), doer.NewGitSig(), treeHash, "Add "+treePath, "")
+	assert.NoError(t, err)
+	assert.NoError(t, tmpRepo.Push(doer, commitHash, "master"))
+}
+
+func TestCreateRepoFile(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	fileResponse, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{Message: "Add docs/new_file.md"},
+		TreePath:      "docs/new_file.md",
+		Content:       "# New File\n",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "new_file.md", fileResponse.Content.Name)
+	assert.EqualValues(t, "docs/new_file.md", fileResponse.Content.Path)
+	assert.EqualValues(t, 11, fileResponse.Content.Size)
+
+	gitRepo, err := git.OpenRepository(repo.RepoPath())
+	assert.NoError(t, err)
+	commit, err := gitRepo.GetBranchCommit("master")
+	assert.NoError(t, err)
+	entry, err := commit.GetTreeEntryByPath("docs/new_file.md")
+	assert.NoError(t, err)
+	assert.EqualValues(t, fileResponse.Content.SHA, entry.ID.String())
+	_, err = commit.GetTreeEntryByPath("README.md")
+	assert.NoError(t, err)
+
+	assert.EqualValues(t, commit.ID.String(), fileResponse.Commit.SHA)
+	assert.EqualValues(t, repo.HTMLURL()+"/commit/"+commit.ID.String(), fileResponse.Commit.HTMLURL)
+	assert.EqualValues(t, doer.Email, fileResponse.Commit.Author.Email)
+	assert.EqualValues(t, doer.Email, fileResponse.Commit.Committer.Email)
+	assert.NotEmpty(t, fileResponse.Commit.Author.Date)
+	assert.EqualValues(t, "Add docs/new_file.md\n", fileResponse.Commit.Message)
+	assert.False(t, fileResponse.Verification.Verified)
+	assert.EqualValues(t, "gpg.error.not_signed_commit", fileResponse.Verification.Reason)
+}
+
+func TestCreateRepoFile_Base64(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	fileResponse, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{Message: "Add new_file.bin"},
+		TreePath:      "new_file.bin",
+		Content:       base64.StdEncoding.EncodeToString([]byte{0, 1, 2, 3}),
+		Encoding:      "base64",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 4, fileResponse.Content.Size)
+}
+
+func TestCreateRepoFile_ContentReader(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	content := []byte{0, 1, 2, 3, 255}
+	fileResponse, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath:      "new_file.bin",
+		ContentReader: bytes.NewReader(content),
+		// ContentReader takes precedence
+		Content: "ignored",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, len(content), fileResponse.Content.Size)
+	assert.EqualValues(t, string(content), getBranchFileContent(t, repo, "master", "new_file.bin"))
+
+	// Malformed base64 content is rejected before anything is committed
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "invalid.bin",
+		Content:  "not base64!",
+		Encoding: "base64",
+	})
+	assert.Error(t, err)
+	assert.EqualValues(t, "2", getCommitsCount(t, repo, "master"))
+}
+
+func TestCreateRepoFile_EmptyContent(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	const emptyBlobSHA = "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391"
+
+	fileResponse, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{TreePath: "empty.txt"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, emptyBlobSHA, fileResponse.Content.SHA)
+	assert.EqualValues(t, 0, fileResponse.Content.Size)
+	assert.EqualValues(t, "", getBranchFileContent(t, repo, "master", "empty.txt"))
+
+	// Whatever the content is given as
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath:      "empty_reader.txt",
+		ContentReader: strings.NewReader(""),
+	})
+	assert.NoError(t, err)
+	fileResponse, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		TreePath: "README.md",
+		Encoding: "base64",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, emptyBlobSHA, fileResponse.Content.SHA)
+	stdout, err := git.NewCommand("ls-tree", "master", "empty_reader.txt", "README.md").RunInDir(repo.RepoPath())
+	assert.NoError(t, err)
+	assert.EqualValues(t, "100644 blob "+emptyBlobSHA+"\tREADME.md\n100644 blob "+emptyBlobSHA+"\tempty_reader.txt\n", stdout)
+}
+
+func TestCreateRepoFile_NewBranch(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	fileResponse, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{
+			OldBranch:       "master",
+			NewBranch:       "new_branch",
+			CreateNewBranch: true,
+			Message:         "Add new_file.md",
+		},
+		TreePath: "new_file.md",
+		Content:  "content",
+	})
+	assert.NoError(t, err)
+	assert.True(t, git.IsBranchExist(repo.RepoPath(), "new_branch"))
+
+	// The commit is the one pushed to the new branch, not the head of the old one
+	gitRepo, err := git.OpenRepository(repo.RepoPath())
+	assert.NoError(t, err)
+	commitID, err := gitRepo.GetBranchCommitID("new_branch")
+	assert.NoError(t, err)
+	assert.EqualValues(t, commitID, fileResponse.Commit.SHA)
+	masterCommitID, err := gitRepo.GetBranchCommitID("master")
+	assert.NoError(t, err)
+	assert.NotEqual(t, masterCommitID, fileResponse.Commit.SHA)
+
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{
+			OldBranch:       "master",
+			NewBranch:       "new_branch",
+			CreateNewBranch: true,
+			Message:         "Add other_file.md",
+		},
+		TreePath: "other_file.md",
+		Content:  "content",
+	})
+	assert.True(t, models.IsErrBranchAlreadyExists(err))
+
+	// Without CreateNewBranch the changes go on top of the existing new branch
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{
+			OldBranch: "master",
+			NewBranch: "new_branch",
+			Message:   "Add other_file.md",
+		},
+		TreePath: "other_file.md",
+		Content:  "content",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "content", getBranchFileContent(t, repo, "new_branch", "new_file.md"))
+	assert.EqualValues(t, "content", getBranchFileContent(t, repo, "new_branch", "other_file.md"))
+	newMasterCommitID, err := gitRepo.GetBranchCommitID("master")
+	assert.NoError(t, err)
+	assert.EqualValues(t, masterCommitID, newMasterCommitID)
+}
+
+func TestCreateRepoFile_NewBranchFromTag(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	tagCommitID := getBranchCommit(t, repo, "master").ID.String()
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{TreePath: "CHANGELOG.md", Content: "changes"})
+	assert.NoError(t, err)
+
+	// The new branch starts from the tag, not from the moved default branch
+	fileResponse, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{
+			OldBranch:       "v1.1",
+			NewBranch:       "release/v1.1",
+			CreateNewBranch: true,
+		},
+		TreePath: "assets/notes.md",
+		Content:  "notes",
+	})
+	assert.NoError(t, err)
+	commit := getBranchCommit(t, repo, "release/v1.1")
+	assert.EqualValues(t, commit.ID.String(), fileResponse.Commit.SHA)
+	parentID, err := commit.ParentID(0)
+	assert.NoError(t, err)
+	assert.EqualValues(t, tagCommitID, parentID.String())
+	assert.EqualValues(t, "notes", getBranchFileContent(t, repo, "release/v1.1", "assets/notes.md"))
+	_, err = GetRepoFileContent(repo, "release/v1.1", "CHANGELOG.md", false)
+	assert.True(t, models.IsErrRepoFileDoesNotExist(err), "%v", err)
+
+	// Or from any commit
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{
+			OldBranch:       tagCommitID[:10],
+			NewBranch:       "hotfix",
+			CreateNewBranch: true,
+		},
+		TreePath: "fix.md",
+		Content:  "fix",
+	})
+	assert.NoError(t, err)
+	parentID, err = getBranchCommit(t, repo, "hotfix").ParentID(0)
+	assert.NoError(t, err)
+	assert.EqualValues(t, tagCommitID, parentID.String())
+
+	// But the changes are only committed on top of branches
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{OldBranch: "v1.1"},
+		TreePath:      "other.md",
+		Content:       "other",
+	})
+	assert.True(t, models.IsErrBranchNotExist(err), "%v", err)
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{
+			OldBranch:       "v9.9",
+			NewBranch:       "release/v9.9",
+			CreateNewBranch: true,
+		},
+		TreePath: "other.md",
+		Content:  "other",
+	})
+	assert.True(t, models.IsErrBranchNotExist(err), "%v", err)
+	assert.False(t, git.IsBranchExist(repo.RepoPath(), "release/v9.9"))
+}
+
+func TestCreateRepoFile_NewBranchDoesNotExist(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{
+			OldBranch: "master",
+			NewBranch: "new_branch",
+			Message:   "Add new_file.md",
+		},
+		TreePath: "new_file.md",
+		Content:  "content",
+	})
+	assert.True(t, models.IsErrBranchNotExist(err))
+	assert.False(t, git.IsBranchExist(repo.RepoPath(), "new_branch"))
+
+	// A new branch can't be created with the name of the branch it is created from
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{
+			OldBranch:       "master",
+			NewBranch:       "master",
+			CreateNewBranch: true,
+			Message:         "Add new_file.md",
+		},
+		TreePath: "new_file.md",
+		Content:  "content",
+	})
+	assert.True(t, models.IsErrBranchAlreadyExists(err))
+}
+
+func TestCreateRepoFile_Errors(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{Message: "Add README.md"},
+		TreePath:      "README.md",
+		Content:       "content",
+	})
+	assert.True(t, models.IsErrRepoFileAlreadyExist(err))
+
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{Message: "Add ./"},
+		TreePath:      "./",
+		Content:       "content",
+	})
+	assert.True(t, models.IsErrFilenameInvalid(err))
+
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{OldBranch: "does_not_exist", Message: "Add new_file.md"},
+		TreePath:      "new_file.md",
+		Content:       "content",
+	})
+	assert.True(t, models.IsErrBranchNotExist(err))
+}
+
+func TestCreateRepoFile_FileDirectoryConflict(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "foo/bar.txt",
+		Content:  "bar",
+	})
+	assert.NoError(t, err)
+
+	// A file can't be created where a directory is
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "foo",
+		Content:  "foo",
+	})
+	assert.EqualValues(t, models.ErrFileDirectoryConflict{Path: "foo", Entry: "foo/bar.txt"}, err)
+
+	// Nor beneath a file
+	for _, treePath := range []string{"README.md/foo", "foo/bar.txt/baz/qux"} {
+		_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+			TreePath: treePath,
+			Content:  "content",
+		})
+		assert.True(t, models.IsErrFileDirectoryConflict(err), treePath)
+	}
+	_, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		FromTreePath: "README.md",
+		TreePath:     "foo/bar.txt/README.md",
+		Content:      "content",
+	})
+	assert.EqualValues(t, models.ErrFileDirectoryConflict{Path: "foo/bar.txt/README.md", Entry: "foo/bar.txt"}, err)
+
+	// Including a file added by the same change
+	_, err = ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "baz", Content: "baz"},
+			{Operation: "create", TreePath: "baz/qux", Content: "qux"},
+		},
+	})
+	assert.EqualValues(t, models.ErrFileDirectoryConflict{Path: "baz/qux", Entry: "baz"}, err)
+	assert.EqualValues(t, "2", getCommitsCount(t, repo, "master"))
+
+	// A file may replace itself with a directory when moved beneath its own path
+	_, err = RenameRepoFile(repo, doer, &RenameRepoFileOptions{
+		FromTreePath: "README.md",
+		TreePath:     "README.md/README.md",
+	})
+	assert.NoError(t, err)
+}
+
+func TestCreateRepoFile_EmptyRepo(t *testing.T) {
+	repo := prepareEmptyTestRepo(t)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{LastCommitID: "0000000000000000000000000000000000000001"},
+		TreePath:      "README.md",
+		Content:       "# repo15\n",
+	})
+	assert.True(t, models.IsErrCommitIDDoesNotMatch(err))
+
+	fileResponse, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "README.md",
+		Content:  "# repo15\n",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "README.md", fileResponse.Content.Path)
+	assert.EqualValues(t, "# repo15\n", getBranchFileContent(t, repo, "master", "README.md"))
+	assert.EqualValues(t, "1", getCommitsCount(t, repo, "master"))
+
+	repo = models.AssertExistsAndLoadBean(t, &models.Repository{ID: repo.ID}).(*models.Repository)
+	assert.False(t, repo.IsEmpty)
+	assert.EqualValues(t, "master", repo.DefaultBranch)
+
+	// The next commits are made on top of the first one
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "LICENSE",
+		Content:  "MIT",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "2", getCommitsCount(t, repo, "master"))
+}
+
+func TestCreateRepoFile_EmptyRepoNewBranch(t *testing.T) {
+	repo := prepareEmptyTestRepo(t)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		CommitOptions: CommitOptions{NewBranch: "develop", LastCommitID: git.EmptySHA},
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "README.md", Content: "# repo15\n"},
+			{Operation: "create", TreePath: "docs/index.md", Content: "docs"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "1", getCommitsCount(t, repo, "develop"))
+
+	// The first branch becomes the default one, in the database and for git
+	repo = models.AssertExistsAndLoadBean(t, &models.Repository{ID: repo.ID}).(*models.Repository)
+	assert.EqualValues(t, "develop", repo.DefaultBranch)
+	stdout, err := git.NewCommand("symbolic-ref", "HEAD").RunInDir(repo.RepoPath())
+	assert.NoError(t, err)
+	assert.EqualValues(t, "refs/heads/develop", strings.TrimSpace(stdout))
+}
+
+func TestCreateRepoFile_GitAttributes(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	pushTestFile(t, repo, doer, ".gitattributes", "*.txt text eol=lf\n")
+
+	_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "dir/crlf.txt", Content: "a\r\nb\r\n"},
+			{Operation: "create", TreePath: "crlf.bin", Content: "a\r\nb\r\n"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "a\nb\n", getBranchFileContent(t, repo, "master", "dir/crlf.txt"))
+	assert.EqualValues(t, "a\r\nb\r\n", getBranchFileContent(t, repo, "master", "crlf.bin"))
+}
+
+func TestCreateRepoFile_MaxFileSize(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	oldMaxFileSize := setting.Repository.MaxFileSize
+	setting.Repository.MaxFileSize = 16
+	defer func() {
+		setting.Repository.MaxFileSize = oldMaxFileSize
+	}()
+
+	commitsCount := getCommitsCount(t, repo, "master")
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "too-big.txt",
+		Content:  strings.Repeat("a", 17),
+	})
+	assert.EqualValues(t, models.ErrFileTooBig{Path: "too-big.txt", MaxSize: 16}, err)
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+
+	// The limit itself is allowed, whatever the way the content is given
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "limit.txt",
+		Content:  strings.Repeat("a", 16),
+	})
+	assert.NoError(t, err)
+	_, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		TreePath: "limit.txt",
+		Content:  base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("b"), 17)),
+		Encoding: "base64",
+	})
+	assert.True(t, models.IsErrFileTooBig(err))
+	_, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		TreePath:      "limit.txt",
+		ContentReader: bytes.NewReader(bytes.Repeat([]byte("b"), 17)),
+	})
+	assert.True(t, models.IsErrFileTooBig(err))
+	assert.EqualValues(t, strings.Repeat("a", 16), getBranchFileContent(t, repo, "master", "limit.txt"))
+
+	// The limit of the repository replaces the one of the instance
+	repo.MaxFileSize = 32
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "repo-limit.txt",
+		Content:  strings.Repeat("a", 32),
+	})
+	assert.NoError(t, err)
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "too-big.txt",
+		Content:  strings.Repeat("a", 33),
+	})
+	assert.EqualValues(t, models.ErrFileTooBig{Path: "too-big.txt", MaxSize: 32}, err)
+}
+
+func TestCreateRepoFile_RejectIgnored(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	pushTestFile(t, repo, doer, ".gitignore", "*.log\n/build/\n")
+	pushTestFile(t, repo, doer, "logs/.gitignore", "!keep.log\n")
+
+	for _, treePath := range []string{"debug.log", "logs/debug.log"} {
+		_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+			TreePath:      treePath,
+			Content:       "log",
+			RejectIgnored: true,
+		})
+		assert.EqualValues(t, models.ErrFileIgnored{Path: treePath, Pattern: "*.log"}, err)
+	}
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath:      "build/output.txt",
+		Content:       "output",
+		RejectIgnored: true,
+	})
+	assert.EqualValues(t, models.ErrFileIgnored{Path: "build/output.txt", Pattern: "/build/"}, err)
+
+	// Paths not ignored, or ignored but not rejected, are created
+	for _, opts := range []*CreateRepoFileOptions{
+		{TreePath: "logs/keep.log", Content: "log", RejectIgnored: true},
+		{TreePath: "docs/build/index.md", Content: "doc", RejectIgnored: true},
+		{TreePath: "readme.txt", Content: "readme", RejectIgnored: true},
+		{TreePath: "debug.log", Content: "log"},
+	} {
+		_, err := CreateRepoFile(repo, doer, opts)
+		assert.NoError(t, err, opts.TreePath)
+	}
+}
+
+func TestCreateRepoFile_ContentSHA(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	const contentSHA = "3b18e512dba79e4c8300dd08aeb37f8e728b8dad"
+	commitsCount := getCommitsCount(t, repo, "master")
+	for _, opts := range []*CreateRepoFileOptions{
+		{Content: "hello world\n", ContentSHA: "0123456789abcdef0123456789abcdef01234567"},
+		// A truncated upload hashes differently
+		{ContentReader: strings.NewReader("hello wor"), ContentSHA: contentSHA},
+	} {
+		opts.TreePath = "hello.txt"
+		_, err := CreateRepoFile(repo, doer, opts)
+		if assert.True(t, models.IsErrContentSHAMismatch(err), "%v", err) {
+			assert.EqualValues(t, opts.ContentSHA, err.(models.ErrContentSHAMismatch).GivenSHA)
+			assert.NotEqual(t, opts.ContentSHA, err.(models.ErrContentSHAMismatch).ContentSHA)
+		}
+	}
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+
+	fileResponse, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath:   "hello.txt",
+		Content:    "hello world\n",
+		ContentSHA: strings.ToUpper(contentSHA),
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, contentSHA, fileResponse.Content.SHA)
+
+	// It is distinct from the SHA of the content replaced
+	_, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		TreePath:   "hello.txt",
+		Content:    "hello again\n",
+		SHA:        contentSHA,
+		ContentSHA: contentSHA,
+	})
+	assert.True(t, models.IsErrContentSHAMismatch(err), "%v", err)
+}
+
+func TestCreateRepoFile_LastCommitID(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	expectedHeadID := getBranchCommit(t, repo, "master").ID.String()
+	pushTestFile(t, repo, doer, "concurrent.txt", "concurrent\n")
+	headID := getBranchCommit(t, repo, "master").ID.String()
+
+	// The file is only created on top of the head the client expects
+	commitsCount := getCommitsCount(t, repo, "master")
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{LastCommitID: expectedHeadID},
+		TreePath:      "new.txt",
+		Content:       "new\n",
+	})
+	if assert.True(t, models.IsErrCommitIDDoesNotMatch(err), "%v", err) {
+		assert.EqualValues(t, models.ErrCommitIDDoesNotMatch{GivenCommitID: expectedHeadID, CurrentCommitID: headID}, err)
+	}
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+
+	fileResponse, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{LastCommitID: headID},
+		TreePath:      "new.txt",
+		Content:       "new\n",
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, fileResponse.Commit.Parents, 1) {
+		assert.EqualValues(t, headID, fileResponse.Commit.Parents[0].SHA)
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2018 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/structs"
+)
+
+// DeleteRepoFileOptions holds the repository delete file options
+type DeleteRepoFileOptions struct {
+	CommitOptions
+	// TreePath of the file or directory to delete, when empty the file is looked up by SHA
+	TreePath string
+	// SHA of the blob currently at TreePath, checked against the branch when given
+	SHA string
+	// RemoveSubmodule lets TreePath be a submodule, see ChangeRepoFile
+	RemoveSubmodule bool
+}
+
+// getTreePathBySHA looks up the path of the only file having the given blob SHA in the commit the
+// changes of the given checked options are based on
+func getTreePathBySHA(repo *models.Repository, opts *ChangeRepoFilesOptions, sha string) (string, error) {
+	gitRepo, err := git.OpenRepository(repo.RepoPath())
+	if err != nil {
+		return "", err
+	}
+	commit, err := opts.getBaseCommit(gitRepo)
+	if err != nil {
+		return "", err
+	}
+	entries, err := commit.Tree.ListEntriesRecursive()
+	if err != nil {
+		return "", err
+	}
+
+	treePaths := make([]string, 0, 1)
+	for _, entry := range entries {
+		if !entry.IsDir() && entry.ID.String() == sha {
+			treePaths = append(treePaths, entry.Name())
+		}
+	}
+	switch len(treePaths) {
+	case 0:
+		return "", models.ErrSHANotFound{SHA: sha}
+	case 1:
+		return treePaths[0], nil
+	default:
+		return "", models.ErrSHAMatchesMultiplePaths{SHA: sha, Paths: treePaths}
+	}
+}
+
+// DeleteRepoFile deletes a file in the given repository. If TreePath is a directory,
+// all the files beneath it are deleted. The response describes the file as it was before, with
+// its mode and its content unless larger than setting.UI.MaxDisplayFileSize, e.g. to undo it.
+func DeleteRepoFile(repo *models.Repository, doer *models.User, opts *DeleteRepoFileOptions) (*structs.FileResponse, error) {
+	if repo.IsEmpty {
+		return nil, models.ErrRepoIsEmpty{RepoName: repo.FullName()}
+	}
+
+	file := &ChangeRepoFile{
+		Operation:       "delete",
+		TreePath:        opts.TreePath,
+		SHA:             opts.SHA,
+		RemoveSubmodule: opts.RemoveSubmodule,
+	}
+	changeOpts := &ChangeRepoFilesOptions{
+		CommitOptions: opts.CommitOptions,
+		Files:         []*ChangeRepoFile{file},
+	}
+
+	if file.TreePath == "" && file.SHA != "" {
+		if err := changeOpts.checkBranches(repo); err != nil {
+			return nil, err
+		}
+		treePath, err := getTreePathBySHA(repo, changeOpts, file.SHA)
+		if err != nil {
+			return nil, err
+		}
+		file.TreePath = treePath
+	}
+
+	filesResponse, err := changeRepoFiles(repo, doer, changeOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	// The file no longer exists in the new commit, so it is described from the commit it was deleted from
+	fileResponse := fileResponseFromFiles(filesResponse)
+	if fileResponse.Content.Type == "dir" {
+		fileResponse.DeletedPaths = file.deletedPaths
+	}
+	return fileResponse, nil
+}
+
+// DeleteRepoFilesOptions holds the repository delete files options
+type DeleteRepoFilesOptions struct {
+	CommitOptions
+	// TreePaths of the files to delete, directories are not deleted as a whole
+	TreePaths []string
+	// BestEffort deletes the files which can be and skips the others instead of deleting nothing
+	BestEffort bool
+}
+
+// DeleteRepoFiles deletes the given files of the given repository in a single commit. If any of them
+// is not a file of the branch, nothing is deleted and all those missing are reported by
+// ErrRepoFilesDoNotExist. The files of the response describe the deleted files as they were before.
+//
+// With BestEffort, the paths which are not files of the branch are skipped and those of files which
+// can't be deleted, e.g. submodules or invalid paths, fail on their own: the others are deleted,
+// unless there are none left, which fails with ErrRepoFilesDoNotExist. The response tells them apart.
+func DeleteRepoFiles(repo *models.Repository, doer *models.User, opts *DeleteRepoFilesOptions) (*structs.FilesResponse, error) {
+	if repo.IsEmpty {
+		return nil, models.ErrRepoIsEmpty{RepoName: repo.FullName()}
+	}
+
+	files := make([]*ChangeRepoFile, 0, len(opts.TreePaths))
+	for _, treePath := range opts.TreePaths {
+		files = append(files, &ChangeRepoFile{
+			Operation: "delete",
+			TreePath:  treePath,
+		})
+	}
+	changeOpts := &ChangeRepoFilesOptions{
+		CommitOptions: opts.CommitOptions,
+		Files:         files,
+		singleFiles:   true,
+	}
+
+	var skippedPaths []string
+	var failedPaths []*structs.FileErrorResponse
+	if opts.BestEffort {
+		if err := changeOpts.checkBranches(repo); err != nil {
+			return nil, err
+		}
+		var err error
+		if files, skippedPaths, failedPaths, err = selectDeletedFiles(repo, changeOpts, files); err != nil {
+			return nil, err
+		} else if len(files) == 0 {
+			return nil, models.ErrRepoFilesDoNotExist{FileNames: opts.TreePaths}
+		}
+		changeOpts.Files = files
+	}
+
+	filesResponse, err := changeRepoFiles(repo, doer, changeOpts)
+	if err != nil {
+		return nil, err
+	}
+	filesResponse.DeletedPaths = make([]string, 0, len(files))
+	for _, file := range files {
+		filesResponse.DeletedPaths = append(filesResponse.DeletedPaths, file.treePath)
+	}
+	filesResponse.SkippedPaths = skippedPaths
+	filesResponse.FailedPaths = failedPaths
+	return filesResponse, nil
+}
+
+// selectDeletedFiles splits the given files to delete into those which are files of the commit the
+// changes of the given checked options are based on, the paths of the others, duplicates included,
+// and the errors of those which can't be deleted
+func selectDeletedFiles(repo *models.Repository, opts *ChangeRepoFilesOptions, files []*ChangeRepoFile) ([]*ChangeRepoFile, []string, []*structs.FileErrorResponse, error) {
+	gitRepo, err := git.OpenRepository(repo.RepoPath())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	commit, err := opts.getBaseCommit(gitRepo)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	deletedFiles := make([]*ChangeRepoFile, 0, len(files))
+	skippedPaths := make([]string, 0)
+	failedPaths := make([]*structs.FileErrorResponse, 0)
+	selected := make(map[string]bool, len(files))
+	for _, file := range files {
+		if err := prepareChangeRepoFile(file); err != nil {
+			failedPaths = append(failedPaths, &structs.FileErrorResponse{Path: file.TreePath, Message: err.Error()})
+			continue
+		}
+		entry, err := commit.GetTreeEntryByPath(file.treePath)
+		if git.IsErrNotExist(err) || (err == nil && entry.IsDir()) || selected[file.treePath] {
+			skippedPaths = append(skippedPaths, file.TreePath)
+			continue
+		} else if err != nil {
+			return nil, nil, nil, err
+		} else if entry.IsSubModule() {
+			err := models.ErrEntryIsSubmodule{Path: file.treePath}
+			failedPaths = append(failedPaths, &structs.FileErrorResponse{Path: file.TreePath, Message: err.Error()})
+			continue
+		}
+		selected[file.treePath] = true
+		deletedFiles = append(deletedFiles, file)
+	}
+	return deletedFiles, skippedPaths, failedPaths, nil
+}
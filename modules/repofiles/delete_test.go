@@ -0,0 +1,641 @@
+// Copyright 2018 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/metrics"
+	"code.gitea.io/gitea/modules/setting"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteRepoFile_Committer(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	committer := models.AssertExistsAndLoadBean(t, &models.User{ID: 4}).(*models.User)
+
+	gitRepo, err := git.OpenRepository(repo.RepoPath())
+	assert.NoError(t, err)
+	lastCommit, err := gitRepo.GetBranchCommit("master")
+	assert.NoError(t, err)
+
+	_, err = DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{
+		CommitOptions: CommitOptions{
+			LastCommitID: lastCommit.ID.String(),
+			OldBranch:    "master",
+			NewBranch:    "master",
+			Message:      "Delete README.md",
+			Committer: &IdentityOptions{
+				Name:  committer.Name,
+				Email: committer.Email,
+			},
+		},
+		TreePath: "README.md",
+	})
+	assert.NoError(t, err)
+
+	commit, err := gitRepo.GetBranchCommit("master")
+	assert.NoError(t, err)
+	assert.EqualValues(t, committer.Email, commit.Committer.Email)
+	assert.EqualValues(t, committer.Email, commit.Author.Email)
+}
+
+func TestDeleteRepoFile_AuthorAndCommitter(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	author := models.AssertExistsAndLoadBean(t, &models.User{ID: 5}).(*models.User)
+	committer := models.AssertExistsAndLoadBean(t, &models.User{ID: 6}).(*models.User)
+
+	fileResponse, err := DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{
+		CommitOptions: CommitOptions{
+			Message:   "Delete README.md",
+			Author:    &IdentityOptions{Name: author.Name, Email: author.Email},
+			Committer: &IdentityOptions{Name: committer.Name, Email: committer.Email},
+		},
+		TreePath: "README.md",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "README.md", fileResponse.Content.Path)
+	assert.EqualValues(t, author.Email, fileResponse.Commit.Author.Email)
+	assert.EqualValues(t, committer.Email, fileResponse.Commit.Committer.Email)
+
+	// The content is described from before the delete, the commit is the delete itself
+	stdout, err := git.NewCommand("rev-parse", "master").RunInDir(repo.RepoPath())
+	assert.NoError(t, err)
+	assert.EqualValues(t, strings.TrimSpace(stdout), fileResponse.Commit.SHA)
+
+	stdout, err = git.NewCommand("log", "-1", "--format=%an %cn", "master").RunInDir(repo.RepoPath())
+	assert.NoError(t, err)
+	assert.EqualValues(t, author.GitName()+" "+committer.GitName(), strings.TrimSpace(stdout))
+
+	stdout, err = git.NewCommand("log", "-1", "--format=%ae %ce", "master").RunInDir(repo.RepoPath())
+	assert.NoError(t, err)
+	assert.EqualValues(t, author.Email+" "+committer.Email, strings.TrimSpace(stdout))
+}
+
+func TestDeleteRepoFile_UnknownCommitter(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{
+		CommitOptions: CommitOptions{
+			Message:   "Delete README.md",
+			Committer: &IdentityOptions{Name: "Nobody", Email: "nobody@example.com"},
+		},
+		TreePath: "README.md",
+	})
+	assert.NoError(t, err)
+
+	stdout, err := git.NewCommand("log", "-1", "--format=%ce", "master").RunInDir(repo.RepoPath())
+	assert.NoError(t, err)
+	assert.EqualValues(t, doer.Email, strings.TrimSpace(stdout))
+}
+
+func TestDeleteRepoFile_PreImage(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	oldMaxDisplayFileSize := setting.UI.MaxDisplayFileSize
+	setting.UI.MaxDisplayFileSize = 1024
+	defer func() {
+		setting.UI.MaxDisplayFileSize = oldMaxDisplayFileSize
+	}()
+
+	createResponse, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "script.sh",
+		Content:  "echo undo\n",
+		Mode:     "100755",
+	})
+	assert.NoError(t, err)
+
+	// The removed file is described well enough to create it again
+	fileResponse, err := DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{TreePath: "script.sh"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, createResponse.Content.SHA, fileResponse.Content.SHA)
+	assert.EqualValues(t, "100755", fileResponse.Content.Mode)
+	assert.EqualValues(t, "text", fileResponse.Content.Encoding)
+	assert.EqualValues(t, "echo undo\n", fileResponse.Content.Content)
+	undoResponse, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: fileResponse.Content.Path,
+		Content:  fileResponse.Content.Content,
+		Mode:     fileResponse.Content.Mode,
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, createResponse.Content.SHA, undoResponse.Content.SHA)
+	assert.EqualValues(t, "100755", getBranchFileMode(t, repo, "master", "script.sh"))
+
+	// Without the content of large files
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "large.txt",
+		Content:  strings.Repeat("a", 1025),
+	})
+	assert.NoError(t, err)
+	fileResponse, err = DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{TreePath: "large.txt"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1025, fileResponse.Content.Size)
+	assert.EqualValues(t, "100644", fileResponse.Content.Mode)
+	assert.Empty(t, fileResponse.Content.Content)
+}
+
+func TestDeleteRepoFile_FileDoesNotExist(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{
+		CommitOptions: CommitOptions{Message: "Delete does-not-exist.md"},
+		TreePath:      "does-not-exist.md",
+	})
+	assert.True(t, models.IsErrRepoFileDoesNotExist(err))
+}
+
+func TestDeleteRepoFile_BySHA(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	fileResponse, err := DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{
+		CommitOptions: CommitOptions{Message: "Delete README.md"},
+		SHA:           readmeSHA,
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "README.md", fileResponse.Content.Path)
+	assert.EqualValues(t, "D\tREADME.md", getLastCommitNameStatus(t, repo, "master"))
+
+	_, err = DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{
+		CommitOptions: CommitOptions{Message: "Delete README.md"},
+		SHA:           readmeSHA,
+	})
+	assert.True(t, models.IsErrSHANotFound(err))
+}
+
+func TestDeleteRepoFile_BySHAMatchesMultiplePaths(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{Message: "Add docs/README.md"},
+		TreePath:      "docs/README.md",
+		Content:       getBranchFileContent(t, repo, "master", "README.md"),
+	})
+	assert.NoError(t, err)
+
+	_, err = DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{
+		CommitOptions: CommitOptions{Message: "Delete README.md"},
+		SHA:           readmeSHA,
+	})
+	if assert.True(t, models.IsErrSHAMatchesMultiplePaths(err)) {
+		assert.EqualValues(t, []string{"README.md", "docs/README.md"}, err.(models.ErrSHAMatchesMultiplePaths).Paths)
+	}
+}
+
+func TestDeleteRepoFile_Directory(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "docs/a.md", Content: "a"},
+			{Operation: "create", TreePath: "docs/sub/b.md", Content: "b"},
+			{Operation: "create", TreePath: "docs.md", Content: "docs"},
+		},
+	})
+	assert.NoError(t, err)
+
+	fileResponse, err := DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{
+		TreePath: "docs",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "dir", fileResponse.Content.Type)
+	assert.EqualValues(t, []string{"docs/a.md", "docs/sub/b.md"}, fileResponse.DeletedPaths)
+
+	stdout, err := git.NewCommand("ls-tree", "-r", "--name-only", "master").RunInDir(repo.RepoPath())
+	assert.NoError(t, err)
+	assert.EqualValues(t, "README.md\ndocs.md\n", stdout)
+
+	// Git doesn't track empty directories, so there is nothing left to delete
+	_, err = DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{
+		TreePath: "docs",
+	})
+	assert.True(t, models.IsErrRepoFileDoesNotExist(err))
+}
+
+func TestDeleteRepoFile_SimilarPaths(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "foo", Content: "foo"},
+			{Operation: "create", TreePath: "foobar/x", Content: "x"},
+			{Operation: "create", TreePath: "[f]oo", Content: "pattern"},
+		},
+	})
+	assert.NoError(t, err)
+	listFiles := func() string {
+		stdout, err := git.NewCommand("ls-tree", "-r", "--name-only", "master").RunInDir(repo.RepoPath())
+		assert.NoError(t, err)
+		return stdout
+	}
+
+	// The paths are neither prefixes of others nor patterns
+	for _, treePath := range []string{"fo", "f*", "foob", "foobar/x/y"} {
+		_, err = DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{TreePath: treePath})
+		assert.True(t, models.IsErrRepoFileDoesNotExist(err), "%s: %v", treePath, err)
+	}
+	assert.EqualValues(t, "README.md\n[f]oo\nfoo\nfoobar/x\n", listFiles())
+
+	fileResponse, err := DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{TreePath: "[f]oo"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "[f]oo", fileResponse.Content.Path)
+	assert.EqualValues(t, "README.md\nfoo\nfoobar/x\n", listFiles())
+
+	fileResponse, err = DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{TreePath: "foo"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "file", fileResponse.Content.Type)
+	assert.Empty(t, fileResponse.DeletedPaths)
+	assert.EqualValues(t, "README.md\nfoobar/x\n", listFiles())
+
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{TreePath: "foo", Content: "foo"})
+	assert.NoError(t, err)
+	fileResponse, err = DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{TreePath: "foobar"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "dir", fileResponse.Content.Type)
+	assert.EqualValues(t, []string{"foobar/x"}, fileResponse.DeletedPaths)
+	assert.EqualValues(t, "README.md\nfoo\n", listFiles())
+}
+
+func TestDeleteRepoFile_DirectoryConflict(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "docs/a.md",
+		Content:  "a",
+	})
+	assert.NoError(t, err)
+
+	_, err = ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{
+			{Operation: "delete", TreePath: "docs"},
+			{Operation: "update", TreePath: "docs/a.md", Content: "updated a"},
+		},
+	})
+	assert.True(t, models.IsErrFilePathConflict(err))
+}
+
+func TestDeleteRepoFile_EmptyRepo(t *testing.T) {
+	repo := prepareEmptyTestRepo(t)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{
+		TreePath: "README.md",
+	})
+	assert.True(t, models.IsErrRepoIsEmpty(err))
+
+	_, err = DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{
+		SHA: readmeSHA,
+	})
+	assert.True(t, models.IsErrRepoIsEmpty(err))
+
+	_, err = ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "a.txt", Content: "a"},
+			{Operation: "update", TreePath: "README.md", Content: "readme"},
+		},
+	})
+	assert.True(t, models.IsErrRepoIsEmpty(err))
+}
+
+// getTemporaryUploadRepositories returns the paths of the temporary upload repositories left on disk
+func getTemporaryUploadRepositories(t *testing.T) []string {
+	paths, err := filepath.Glob(filepath.Join(TemporaryUploadRepositoriesPath(), "upload-*"))
+	assert.NoError(t, err)
+	return paths
+}
+
+func TestDeleteRepoFile_TemporaryRepositoryCleanup(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	var tmpRepo *TemporaryUploadRepository
+	assert.NotPanics(t, tmpRepo.Close)
+
+	// The temporary upload repository can't be created beneath a file
+	notADir, err := ioutil.TempFile("", "repofiles-not-a-dir")
+	assert.NoError(t, err)
+	notADir.Close()
+	defer os.Remove(notADir.Name())
+	oldLocalCopyPath := setting.Repository.Local.LocalCopyPath
+	setting.Repository.Local.LocalCopyPath = filepath.Join(notADir.Name(), "local-repo")
+	assert.NotPanics(t, func() {
+		_, err = DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{TreePath: "README.md"})
+	})
+	setting.Repository.Local.LocalCopyPath = oldLocalCopyPath
+	assert.Error(t, err)
+	assert.EqualValues(t, "# repo1\n\nDescription for repo1", getBranchFileContent(t, repo, "master", "README.md"))
+
+	// Nothing is left behind when the change fails once the repository is cloned
+	leftRepos := getTemporaryUploadRepositories(t)
+	_, err = DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{TreePath: "does-not-exist.md"})
+	assert.True(t, models.IsErrRepoFileDoesNotExist(err))
+	assert.EqualValues(t, leftRepos, getTemporaryUploadRepositories(t))
+}
+
+func TestDeleteRepoFile_NewBranchName(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	for _, test := range []struct {
+		name  string
+		valid bool
+	}{
+		{"feature-1", true},
+		{"release/v1.0", true},
+		{"user_2.fix", true},
+		{"HEAD", false},
+		{"-delete", false},
+		{"with space", false},
+		{"dots..dots", false},
+		{"control\x07char", false},
+		{"ends.lock", false},
+		{"dir.lock/branch", false},
+		{"/leading", false},
+		{"trailing/", false},
+		{"trailing.", false},
+		{"double//slash", false},
+		{".hidden", false},
+		{"star*", false},
+		{"tilde~1", false},
+		{"caret^", false},
+		{"colon:", false},
+		{"question?", false},
+		{"bracket[", false},
+		{"back\\slash", false},
+		{"at@{1}", false},
+	} {
+		_, err := DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{
+			CommitOptions: CommitOptions{
+				OldBranch:       "master",
+				NewBranch:       test.name,
+				CreateNewBranch: true,
+			},
+			TreePath: "README.md",
+		})
+		if test.valid {
+			assert.NoError(t, err, test.name)
+		} else if assert.True(t, models.IsErrBranchNameInvalid(err), test.name) {
+			assert.EqualValues(t, test.name, err.(models.ErrBranchNameInvalid).BranchName)
+		}
+	}
+}
+
+// pushTestSubmodules adds submodules at the given paths to the master branch, configured in .gitmodules
+func pushTestSubmodules(t *testing.T, repo *models.Repository, doer *models.User, treePaths ...string) {
+	tmpRepo, err := NewTemporaryUploadRepository(repo)
+	assert.NoError(t, err)
+	defer tmpRepo.Close()
+	assert.NoError(t, tmpRepo.Clone("master"))
+	assert.NoError(t, tmpRepo.SetDefaultIndex())
+	commitID, err := tmpRepo.GetLastCommit()
+	assert.NoError(t, err)
+	gitmodules := ""
+	for _, treePath := range treePaths {
+		assert.NoError(t, tmpRepo.AddObjectToIndex("160000", commitID, treePath))
+		gitmodules += "[submodule \"" + treePath + "\"]\n\tpath = " + treePath + "\n\turl = https://example.com/" + treePath + ".git\n"
+	}
+	objectHash, err := tmpRepo.HashObject(".gitmodules", strings.NewReader(gitmodules))
+	assert.NoError(t, err)
+	assert.NoError(t, tmpRepo.AddObjectToIndex("100644", objectHash, ".gitmodules"))
+	treeHash, err := tmpRepo.WriteTree()
+	assert.NoError(t, err)
+	commitHash, err := tmpRepo.CommitTree(doer.NewGitSig(), doer.NewGitSig(), treeHash, "Add submodules", "")
+	assert.NoError(t, err)
+	assert.NoError(t, tmpRepo.Push(doer, commitHash, "master"))
+}
+
+func TestDeleteRepoFile_Submodule(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	pushTestSubmodules(t, repo, doer, "lib/a", "lib/b")
+
+	// A submodule is no file
+	_, err := DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{
+		TreePath: "lib/a",
+	})
+	assert.EqualValues(t, models.ErrEntryIsSubmodule{Path: "lib/a"}, err)
+	_, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		TreePath: "lib/a",
+		Content:  "a",
+	})
+	assert.EqualValues(t, models.ErrEntryIsSubmodule{Path: "lib/a"}, err)
+	_, err = RenameRepoFile(repo, doer, &RenameRepoFileOptions{
+		FromTreePath: "lib/a",
+		TreePath:     "lib/c",
+	})
+	assert.EqualValues(t, models.ErrEntryIsSubmodule{Path: "lib/a"}, err)
+
+	// It is removed along with its configuration
+	_, err = DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{
+		TreePath:        "lib/a",
+		RemoveSubmodule: true,
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "[submodule \"lib/b\"]\n\tpath = lib/b\n\turl = https://example.com/lib/b.git\n",
+		getBranchFileContent(t, repo, "master", ".gitmodules"))
+	stdout, err := git.NewCommand("ls-tree", "-r", "--name-only", "master").RunInDir(repo.RepoPath())
+	assert.NoError(t, err)
+	assert.EqualValues(t, ".gitmodules\nREADME.md\nlib/b\n", stdout)
+
+	// The configuration is removed once it is empty
+	_, err = DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{
+		TreePath:        "lib/b",
+		RemoveSubmodule: true,
+	})
+	assert.NoError(t, err)
+	stdout, err = git.NewCommand("ls-tree", "-r", "--name-only", "master").RunInDir(repo.RepoPath())
+	assert.NoError(t, err)
+	assert.EqualValues(t, "README.md\n", stdout)
+}
+
+func TestDeleteRepoFile_DefaultBranch(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{
+			OldBranch:       "master",
+			NewBranch:       "main",
+			CreateNewBranch: true,
+		},
+		TreePath: "main.txt",
+		Content:  "main",
+	})
+	assert.NoError(t, err)
+	repo.DefaultBranch = "main"
+	assert.NoError(t, models.UpdateRepository(repo, false))
+
+	// The branch is the default one of the repository when none is given
+	fileResponse, err := DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{
+		TreePath: "main.txt",
+	})
+	assert.NoError(t, err)
+	stdout, err := git.NewCommand("rev-parse", "main").RunInDir(repo.RepoPath())
+	assert.NoError(t, err)
+	assert.EqualValues(t, fileResponse.Commit.SHA, strings.TrimSpace(stdout))
+	assert.EqualValues(t, "1", getCommitsCount(t, repo, "master"))
+
+	// master is only assumed when no default branch is recorded
+	repo.DefaultBranch = ""
+	_, err = DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{
+		TreePath: "README.md",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "2", getCommitsCount(t, repo, "master"))
+}
+
+func TestDeleteRepoFiles(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "a.txt", Content: "a"},
+			{Operation: "create", TreePath: "docs/b.txt", Content: "b"},
+			{Operation: "create", TreePath: "docs/c.txt", Content: "c"},
+		},
+	})
+	assert.NoError(t, err)
+	commitsCount := getCommitsCount(t, repo, "master")
+
+	// Nothing is deleted if any path is missing, a directory being no file
+	_, err = DeleteRepoFiles(repo, doer, &DeleteRepoFilesOptions{
+		TreePaths: []string{"a.txt", "missing.txt", "docs/b.txt", "docs", "docs/*"},
+	})
+	if assert.True(t, models.IsErrRepoFilesDoNotExist(err), "%v", err) {
+		assert.EqualValues(t, []string{"missing.txt", "docs", "docs/*"}, err.(models.ErrRepoFilesDoNotExist).FileNames)
+	}
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+	assert.EqualValues(t, "a", getBranchFileContent(t, repo, "master", "a.txt"))
+
+	// The files are deleted in a single commit
+	filesResponse, err := DeleteRepoFiles(repo, doer, &DeleteRepoFilesOptions{
+		CommitOptions: CommitOptions{Message: "Delete three files"},
+		TreePaths:     []string{"a.txt", "docs/b.txt", "README.md"},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, filesResponse.Files, 3) {
+		assert.EqualValues(t, "a.txt", filesResponse.Files[0].Path)
+		assert.EqualValues(t, "docs/b.txt", filesResponse.Files[1].Path)
+		assert.EqualValues(t, "README.md", filesResponse.Files[2].Path)
+	}
+	assert.EqualValues(t, "Delete three files\n", filesResponse.Commit.Message)
+	stdout, err := git.NewCommand("ls-tree", "-r", "--name-only", "master").RunInDir(repo.RepoPath())
+	assert.NoError(t, err)
+	assert.EqualValues(t, "docs/c.txt\n", stdout)
+	stdout, err = git.NewCommand("rev-list", "--count", filesResponse.Commit.SHA+"~1..master").RunInDir(repo.RepoPath())
+	assert.NoError(t, err)
+	assert.EqualValues(t, "1", strings.TrimSpace(stdout))
+	assert.NotEqual(t, commitsCount, getCommitsCount(t, repo, "master"))
+}
+
+func TestDeleteRepoFiles_BestEffort(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "a.txt", Content: "a"},
+			{Operation: "create", TreePath: "docs/b.txt", Content: "b"},
+		},
+	})
+	assert.NoError(t, err)
+
+	// The present files are deleted, the others skipped or failing on their own
+	filesResponse, err := DeleteRepoFiles(repo, doer, &DeleteRepoFilesOptions{
+		TreePaths:  []string{"a.txt", "missing.txt", "docs", "docs/b.txt", "a.txt", ".git/config"},
+		BestEffort: true,
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, []string{"a.txt", "docs/b.txt"}, filesResponse.DeletedPaths)
+	assert.EqualValues(t, []string{"missing.txt", "docs", "a.txt"}, filesResponse.SkippedPaths)
+	if assert.Len(t, filesResponse.FailedPaths, 1) {
+		assert.EqualValues(t, ".git/config", filesResponse.FailedPaths[0].Path)
+		assert.NotEmpty(t, filesResponse.FailedPaths[0].Message)
+	}
+	if assert.Len(t, filesResponse.Files, 2) {
+		assert.EqualValues(t, "a.txt", filesResponse.Files[0].Path)
+		assert.EqualValues(t, "docs/b.txt", filesResponse.Files[1].Path)
+	}
+	assert.EqualValues(t, "Change 'a.txt', 'docs/b.txt'\n", filesResponse.Commit.Message)
+	stdout, err := git.NewCommand("ls-tree", "-r", "--name-only", "master").RunInDir(repo.RepoPath())
+	assert.NoError(t, err)
+	assert.EqualValues(t, "README.md\n", stdout)
+
+	// Nothing is committed when there is nothing left to delete
+	commitsCount := getCommitsCount(t, repo, "master")
+	_, err = DeleteRepoFiles(repo, doer, &DeleteRepoFilesOptions{
+		TreePaths:  []string{"a.txt", "docs/b.txt"},
+		BestEffort: true,
+	})
+	if assert.True(t, models.IsErrRepoFilesDoNotExist(err), "%v", err) {
+		assert.EqualValues(t, []string{"a.txt", "docs/b.txt"}, err.(models.ErrRepoFilesDoNotExist).FileNames)
+	}
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+}
+
+func TestDeleteRepoFile_Metrics(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	defer func(enabled bool) {
+		setting.Metrics.Enabled = enabled
+	}(setting.Metrics.Enabled)
+
+	getValue := func(metric prometheus.Metric) (float64, uint64) {
+		m := &dto.Metric{}
+		assert.NoError(t, metric.Write(m))
+		if m.Histogram != nil {
+			return m.Histogram.GetSampleSum(), m.Histogram.GetSampleCount()
+		}
+		return m.Counter.GetValue(), 0
+	}
+	successes, _ := getValue(metrics.RepoFilesOperations.WithLabelValues("delete", "success"))
+	failures, _ := getValue(metrics.RepoFilesOperations.WithLabelValues("delete", "failure"))
+	phases := make(map[string]uint64)
+	for _, phase := range []string{"clone", "write-tree", "commit", "push"} {
+		_, phases[phase] = getValue(metrics.RepoFilesPhaseDuration.WithLabelValues(phase).(prometheus.Metric))
+	}
+
+	// Nothing is recorded unless metrics are enabled
+	setting.Metrics.Enabled = false
+	_, err := DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{TreePath: "README.md"})
+	assert.NoError(t, err)
+	value, _ := getValue(metrics.RepoFilesOperations.WithLabelValues("delete", "success"))
+	assert.EqualValues(t, successes, value)
+
+	setting.Metrics.Enabled = true
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{TreePath: "README.md", Content: "readme"})
+	assert.NoError(t, err)
+	_, err = DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{TreePath: "README.md"})
+	assert.NoError(t, err)
+	value, _ = getValue(metrics.RepoFilesOperations.WithLabelValues("delete", "success"))
+	assert.EqualValues(t, successes+1, value)
+	for phase, count := range phases {
+		_, newCount := getValue(metrics.RepoFilesPhaseDuration.WithLabelValues(phase).(prometheus.Metric))
+		assert.EqualValues(t, count+2, newCount, phase)
+	}
+
+	_, err = DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{TreePath: "README.md"})
+	assert.True(t, models.IsErrRepoFileDoesNotExist(err), "%v", err)
+	value, _ = getValue(metrics.RepoFilesOperations.WithLabelValues("delete", "failure"))
+	assert.EqualValues(t, failures+1, value)
+}
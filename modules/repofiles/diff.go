@@ -0,0 +1,188 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/setting"
+	"code.gitea.io/gitea/modules/structs"
+)
+
+// emptyTreeSHA is the hash of the tree without any entry, known to every git repository
+const emptyTreeSHA = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+var diffFileTypes = map[models.DiffFileType]string{
+	models.DiffFileAdd:    "add",
+	models.DiffFileChange: "change",
+	models.DiffFileDel:    "delete",
+	models.DiffFileRename: "rename",
+}
+
+var diffLineTypes = map[models.DiffLineType]string{
+	models.DiffLinePlain: "context",
+	models.DiffLineAdd:   "add",
+	models.DiffLineDel:   "delete",
+}
+
+// GetRepoFilesChanges lists the files the given file operations would add, change, delete or rename
+// on top of the base branch, without committing anything, as a dry run would. The file contents are
+// only hashed, neither read back nor diffed. Changes leaving the files as they are change no file.
+func GetRepoFilesChanges(repo *models.Repository, doer *models.User, opts *ChangeRepoFilesOptions) ([]*structs.FileChange, error) {
+	changesOpts := *opts
+	changesOpts.DryRun = true
+	changesOpts.AllowEmptyCommit = true
+	changesOpts.changesOnly = true
+	filesResponse, err := changeRepoFiles(repo, doer, &changesOpts)
+	if err != nil {
+		return nil, err
+	}
+	return filesResponse.Changes, nil
+}
+
+// getFilesChanges returns the files changed from the tree of the given parent commit, which is nil
+// for the first commit of a repository, to the given tree of the temporary upload repository
+func getFilesChanges(t *TemporaryUploadRepository, parentCommit *git.Commit, treeHash string) ([]*structs.FileChange, error) {
+	parentTreeHash := emptyTreeSHA
+	if parentCommit != nil {
+		parentTreeHash = parentCommit.Tree.ID.String()
+	}
+	stdout, stderr, err := t.execStdin("getFilesChanges (git diff-tree --name-status)", nil,
+		"diff-tree", "-r", "-M", "-z", "--name-status", parentTreeHash, treeHash)
+	if err != nil {
+		return nil, fmt.Errorf("getFilesChanges: %v %s", err, stderr)
+	}
+
+	// Each change is "<status> NUL <path> NUL", renames having the old path before the new one
+	fields := strings.Split(strings.TrimSuffix(stdout, "\x00"), "\x00")
+	changes := make([]*structs.FileChange, 0, len(fields)/2)
+	for i := 0; i+1 < len(fields); i += 2 {
+		change := &structs.FileChange{Path: fields[i+1]}
+		switch fields[i][0] {
+		case 'A':
+			change.Type = "add"
+		case 'D':
+			change.Type = "delete"
+		case 'R':
+			if i+2 >= len(fields) {
+				return nil, fmt.Errorf("getFilesChanges: unexpected output %q", stdout)
+			}
+			change.Type = "rename"
+			change.OldPath, change.Path = fields[i+1], fields[i+2]
+			i++
+		default:
+			// Changes of the content or of the type of the file alike
+			change.Type = "change"
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// getFilesStats returns the stats of the changes from the tree of the given parent commit, which
+// is nil for the first commit of a repository, to the given tree of the temporary upload repository
+func getFilesStats(t *TemporaryUploadRepository, parentCommit *git.Commit, treeHash string) (*structs.FilesStats, error) {
+	parentTreeHash := emptyTreeSHA
+	if parentCommit != nil {
+		parentTreeHash = parentCommit.Tree.ID.String()
+	}
+	stdout, stderr, err := t.execStdin("getFilesStats (git diff-tree --numstat)", nil,
+		"diff-tree", "-r", "-M", "--numstat", parentTreeHash, treeHash)
+	if err != nil {
+		return nil, fmt.Errorf("getFilesStats: %v %s", err, stderr)
+	}
+
+	// Each file is "<insertions> TAB <deletions> TAB <path>", binary files having "-" for both
+	stats := &structs.FilesStats{}
+	for _, line := range strings.Split(strings.TrimSuffix(stdout, "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("getFilesStats: unexpected output %q", stdout)
+		}
+		stats.FilesChanged++
+		if fields[0] == "-" {
+			continue
+		}
+		insertions, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("getFilesStats: unexpected output %q", stdout)
+		}
+		deletions, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("getFilesStats: unexpected output %q", stdout)
+		}
+		stats.Insertions += insertions
+		stats.Deletions += deletions
+	}
+	return stats, nil
+}
+
+// getFilesDiffs returns the diffs of the files changed from the tree of the given parent commit,
+// which is nil for the first commit of a repository, to the given tree of the temporary upload
+// repository. They are limited like the diffs shown by the web interface.
+func getFilesDiffs(t *TemporaryUploadRepository, parentCommit *git.Commit, treeHash string) ([]*structs.FileDiff, error) {
+	parentTreeHash := emptyTreeSHA
+	if parentCommit != nil {
+		parentTreeHash = parentCommit.Tree.ID.String()
+	}
+	patch, err := t.DiffTrees(parentTreeHash, treeHash)
+	if err != nil {
+		return nil, err
+	}
+	diff, err := models.ParsePatch(setting.Git.MaxGitDiffLines, setting.Git.MaxGitDiffLineCharacters,
+		setting.Git.MaxGitDiffFiles, strings.NewReader(patch))
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := make([]*structs.FileDiff, 0, len(diff.Files))
+	for _, diffFile := range diff.Files {
+		fileDiff := &structs.FileDiff{
+			Path:       diffFile.Name,
+			Type:       diffFileTypes[diffFile.Type],
+			Binary:     diffFile.IsBin,
+			Incomplete: diffFile.IsIncomplete,
+		}
+		if diffFile.IsRenamed {
+			fileDiff.OldPath = diffFile.OldName
+		}
+		// Binary files, including the ones stored in LFS, are reported without their lines
+		if !fileDiff.Binary {
+			fileDiff.Hunks = getFileDiffHunks(diffFile)
+		}
+		diffs = append(diffs, fileDiff)
+	}
+	return diffs, nil
+}
+
+// getFileDiffHunks returns the hunks of the given parsed diff file
+func getFileDiffHunks(diffFile *models.DiffFile) []*structs.FileDiffHunk {
+	hunks := make([]*structs.FileDiffHunk, 0, len(diffFile.Sections))
+	for _, section := range diffFile.Sections {
+		hunk := &structs.FileDiffHunk{Lines: make([]*structs.FileDiffLine, 0, len(section.Lines))}
+		for _, line := range section.Lines {
+			if line.Type == models.DiffLineSection {
+				hunk.Header = line.Content
+				continue
+			}
+			// The content is prefixed by the type of the line
+			hunk.Lines = append(hunk.Lines, &structs.FileDiffLine{
+				Type:    diffLineTypes[line.Type],
+				OldLine: line.LeftIdx,
+				NewLine: line.RightIdx,
+				Content: line.Content[1:],
+			})
+		}
+		hunks = append(hunks, hunk)
+	}
+	return hunks
+}
@@ -0,0 +1,173 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"testing"
+
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/structs"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeRepoFiles_IncludeDiff(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	fileResponse, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "a.txt",
+		Content:  "a\nb\n",
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, fileResponse.Diffs)
+
+	fileResponse, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		CommitOptions: CommitOptions{IncludeDiff: true},
+		TreePath:      "a.txt",
+		Content:       "a\nc\n",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, []*structs.FileDiff{{
+		Path: "a.txt",
+		Type: "change",
+		Hunks: []*structs.FileDiffHunk{{
+			Header: "@@ -1,2 +1,2 @@",
+			Lines: []*structs.FileDiffLine{
+				{Type: "context", OldLine: 1, NewLine: 1, Content: "a"},
+				{Type: "delete", OldLine: 2, Content: "b"},
+				{Type: "add", NewLine: 2, Content: "c"},
+			},
+		}},
+	}}, fileResponse.Diffs)
+
+	// The diff of a delete is the whole removed content
+	fileResponse, err = DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{
+		CommitOptions: CommitOptions{IncludeDiff: true},
+		TreePath:      "a.txt",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, []*structs.FileDiff{{
+		Path: "a.txt",
+		Type: "delete",
+		Hunks: []*structs.FileDiffHunk{{
+			Header: "@@ -1,2 +0,0 @@",
+			Lines: []*structs.FileDiffLine{
+				{Type: "delete", OldLine: 1, Content: "a"},
+				{Type: "delete", OldLine: 2, Content: "c"},
+			},
+		}},
+	}}, fileResponse.Diffs)
+
+	// Renames are detected and binary files have no lines
+	filesResponse, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		CommitOptions: CommitOptions{IncludeDiff: true},
+		Files: []*ChangeRepoFile{
+			{Operation: "rename", FromTreePath: "README.md", TreePath: "README"},
+			{Operation: "create", TreePath: "binary.bin", Content: "\x00\x01\x02"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, []*structs.FileDiff{
+		{Path: "README", OldPath: "README.md", Type: "rename", Hunks: []*structs.FileDiffHunk{}},
+		{Path: "binary.bin", Type: "add", Binary: true},
+	}, filesResponse.Diffs)
+}
+
+func TestChangeRepoFiles_IncludeDiffDryRun(t *testing.T) {
+	repo := prepareEmptyTestRepo(t)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: repo.OwnerID}).(*models.User)
+
+	fileResponse, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{DryRun: true, IncludeDiff: true},
+		TreePath:      "a.txt",
+		Content:       "a\n",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, []*structs.FileDiff{{
+		Path: "a.txt",
+		Type: "add",
+		Hunks: []*structs.FileDiffHunk{{
+			Header: "@@ -0,0 +1 @@",
+			Lines:  []*structs.FileDiffLine{{Type: "add", NewLine: 1, Content: "a"}},
+		}},
+	}}, fileResponse.Diffs)
+}
+
+func TestGetRepoFilesChanges(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "a.txt", Content: "a\n"},
+			{Operation: "create", TreePath: "b.txt", Content: "b\n"},
+			{Operation: "create", TreePath: "c.txt", Content: "a file long enough to be found renamed\n"},
+			{Operation: "create", TreePath: "dir/d.sh", Content: "echo d\n"},
+		},
+	})
+	assert.NoError(t, err)
+	commitsCount := getCommitsCount(t, repo, "master")
+
+	changes, err := GetRepoFilesChanges(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "new.txt", Content: "new\n"},
+			{Operation: "update", TreePath: "a.txt", Content: "a2\n"},
+			{Operation: "delete", TreePath: "b.txt"},
+			{Operation: "rename", FromTreePath: "c.txt", TreePath: "moved/c.txt"},
+			{Operation: "update", TreePath: "dir/d.sh", Content: "echo d\n", Mode: "100755"},
+			// No change is no changed file
+			{Operation: "update", TreePath: "README.md", Content: getBranchFileContent(t, repo, "master", "README.md")},
+		},
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, []*structs.FileChange{
+		{Path: "a.txt", Type: "change"},
+		{Path: "b.txt", Type: "delete"},
+		{Path: "dir/d.sh", Type: "change"},
+		{Path: "moved/c.txt", OldPath: "c.txt", Type: "rename"},
+		{Path: "new.txt", Type: "add"},
+	}, changes)
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+
+	// The operations are checked as they would be when committing them
+	_, err = GetRepoFilesChanges(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{{Operation: "create", TreePath: "a.txt", Content: "a\n"}},
+	})
+	assert.True(t, models.IsErrRepoFileAlreadyExist(err), "%v", err)
+}
+
+func TestChangeRepoFiles_Stats(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	opts := &ChangeRepoFilesOptions{
+		CommitOptions: CommitOptions{DryRun: true},
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "a.txt", Content: "1\n2\n3\n"},
+			{Operation: "update", TreePath: "README.md", Content: "# repo1\n\nDescription for repo1\nMore\n"},
+			{Operation: "create", TreePath: "data.bin", Content: "\x00\x01\x02"},
+		},
+	}
+	// The binary file only counts as changed, like the README.md line its newline was added to
+	expected := &structs.FilesStats{FilesChanged: 3, Insertions: 5, Deletions: 1}
+	filesResponse, err := ChangeRepoFiles(repo, doer, opts)
+	assert.NoError(t, err)
+	assert.EqualValues(t, expected, filesResponse.Stats)
+
+	opts.DryRun = false
+	filesResponse, err = ChangeRepoFiles(repo, doer, opts)
+	assert.NoError(t, err)
+	assert.EqualValues(t, expected, filesResponse.Stats)
+
+	filesResponse, err = ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{
+			{Operation: "rename", FromTreePath: "a.txt", TreePath: "b.txt"},
+			{Operation: "delete", TreePath: "data.bin"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, &structs.FilesStats{FilesChanged: 2}, filesResponse.Stats)
+}
@@ -0,0 +1,104 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"fmt"
+	"path"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/base"
+)
+
+// RepoDirectoryEntry is an entry of a directory of a repository at a given ref
+type RepoDirectoryEntry struct {
+	Name string
+	Path string
+	// Type is "file", "dir", "symlink" or "submodule"
+	Type string
+	SHA  string
+	// Size of the blob of a file or a symlink
+	Size int64
+	// LastCommit is the last commit of the ref changing the entry
+	LastCommit *git.Commit
+}
+
+// ListRepoDirectory returns the entries of the directory at the given path of the given ref, which may
+// be a branch, a tag or a commit, in the order of the web file browser. The last commits changing the
+// entries are all found by a single walk of the history, not by a search for each entry, and each of
+// these commits is read once.
+func ListRepoDirectory(repo *models.Repository, ref, treePath string) ([]*RepoDirectoryEntry, error) {
+	if repo.IsEmpty {
+		return nil, models.ErrRepoIsEmpty{RepoName: repo.FullName()}
+	}
+	gitRepo, err := git.OpenRepository(repo.RepoPath())
+	if err != nil {
+		return nil, err
+	}
+	commit, err := gitRepo.GetCommit(ref)
+	if err != nil {
+		return nil, fmt.Errorf("GetCommit [ref: %s]: %v", ref, err)
+	}
+
+	treePath = CleanUploadFileName(treePath)
+	tree := &commit.Tree
+	if treePath != "" {
+		if tree, err = commit.SubTree(treePath); err != nil {
+			if git.IsErrNotExist(err) {
+				return nil, models.ErrRepoFileDoesNotExist{FileName: treePath}
+			}
+			return nil, err
+		}
+	}
+	entries, err := tree.ListEntries()
+	if err != nil {
+		return nil, err
+	}
+	entries.CustomSort(base.NaturalSortLess)
+	commitsInfo, err := entries.GetCommitsInfo(commit, treePath)
+	if err != nil {
+		return nil, fmt.Errorf("GetCommitsInfo: %v", err)
+	}
+
+	// The commits found by the walk only have their ID, subject and committer date
+	lastCommits := make(map[string]*git.Commit)
+	directoryEntries := make([]*RepoDirectoryEntry, 0, len(commitsInfo))
+	for _, commitInfo := range commitsInfo {
+		entry := commitInfo[0].(*git.TreeEntry)
+		directoryEntry := &RepoDirectoryEntry{
+			Name: entry.Name(),
+			Path: path.Join(treePath, entry.Name()),
+			SHA:  entry.ID.String(),
+		}
+		var lastCommitID string
+		switch commitInfo := commitInfo[1].(type) {
+		case *git.SubModuleFile:
+			lastCommitID = commitInfo.ID.String()
+		case *git.Commit:
+			lastCommitID = commitInfo.ID.String()
+		}
+		if directoryEntry.LastCommit = lastCommits[lastCommitID]; directoryEntry.LastCommit == nil {
+			if directoryEntry.LastCommit, err = gitRepo.GetCommit(lastCommitID); err != nil {
+				return nil, err
+			}
+			lastCommits[lastCommitID] = directoryEntry.LastCommit
+		}
+		switch {
+		case entry.IsSubModule():
+			directoryEntry.Type = "submodule"
+		case entry.IsDir():
+			directoryEntry.Type = "dir"
+		case entry.IsLink():
+			directoryEntry.Type = "symlink"
+			directoryEntry.Size = entry.Size()
+		default:
+			directoryEntry.Type = "file"
+			directoryEntry.Size = entry.Size()
+		}
+		directoryEntries = append(directoryEntries, directoryEntry)
+	}
+	return directoryEntries, nil
+}
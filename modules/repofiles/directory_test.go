@@ -0,0 +1,91 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"fmt"
+	"testing"
+
+	"code.gitea.io/gitea/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListRepoDirectory(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	first, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		CommitOptions: CommitOptions{Message: "Add docs"},
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "docs/a.md", Content: "a"},
+			{Operation: "create", TreePath: "docs/b.md", Content: "b"},
+			{Operation: "create", TreePath: "docs/api/index.md", Content: "index"},
+			{Operation: "create", TreePath: "docs/link", Content: "a.md", Symlink: true},
+		},
+	})
+	assert.NoError(t, err)
+	second, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		CommitOptions: CommitOptions{Message: "Update docs"},
+		Files: []*ChangeRepoFile{
+			{Operation: "update", TreePath: "docs/b.md", Content: "updated b"},
+			{Operation: "create", TreePath: "docs/api/v2.md", Content: "v2"},
+		},
+	})
+	assert.NoError(t, err)
+
+	entries, err := ListRepoDirectory(repo, "master", "docs")
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 4) {
+		for i, expected := range []struct {
+			path, typ, commitID string
+		}{
+			{"docs/api", "dir", second.Commit.SHA},
+			{"docs/a.md", "file", first.Commit.SHA},
+			{"docs/b.md", "file", second.Commit.SHA},
+			{"docs/link", "symlink", first.Commit.SHA},
+		} {
+			assert.EqualValues(t, expected.path, entries[i].Path)
+			assert.EqualValues(t, expected.typ, entries[i].Type)
+			assert.EqualValues(t, expected.commitID, entries[i].LastCommit.ID.String())
+		}
+		assert.EqualValues(t, "a.md", entries[1].Name)
+		assert.EqualValues(t, 9, entries[2].Size)
+		assert.EqualValues(t, "Update docs", entries[2].LastCommit.Summary())
+		assert.EqualValues(t, doer.Email, entries[2].LastCommit.Author.Email)
+	}
+
+	// The root and the other refs are listed as well
+	entries, err = ListRepoDirectory(repo, "develop", "")
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.EqualValues(t, "README.md", entries[0].Path)
+		assert.EqualValues(t, "65f1bf27bc3bf70f64657658635e66094edbcb4d", entries[0].LastCommit.ID.String())
+	}
+
+	_, err = ListRepoDirectory(repo, "master", "missing")
+	assert.EqualValues(t, models.ErrRepoFileDoesNotExist{FileName: "missing"}, err)
+}
+
+func BenchmarkListRepoDirectory(b *testing.B) {
+	repo := prepareTestRepo(b, 1)
+	doer := models.AssertExistsAndLoadBean(b, &models.User{ID: 2}).(*models.User)
+
+	// Hundreds of files changed by a few commits each
+	for i := 0; i < 10; i++ {
+		files := make([]*ChangeRepoFile, 0, 50)
+		for j := 0; j < 50; j++ {
+			files = append(files, &ChangeRepoFile{Operation: "create", TreePath: fmt.Sprintf("dir/file%d-%d.txt", i, j), Content: "content"})
+		}
+		_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{Files: files})
+		assert.NoError(b, err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		entries, err := ListRepoDirectory(repo, "master", "dir")
+		assert.NoError(b, err)
+		assert.Len(b, entries, 500)
+	}
+}
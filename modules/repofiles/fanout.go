@@ -0,0 +1,140 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/structs"
+)
+
+// ChangeRepoFilesOnBranchesOptions holds the options to make the same file changes on several branches
+type ChangeRepoFilesOnBranchesOptions struct {
+	// TargetBranches are the branches the changes are committed to, in a commit of their own on each
+	TargetBranches []string
+	// ChangeRepoFilesOptions are the changes made on each branch, on top of its head: the branch
+	// options, LastCommitID and TemporaryRepository are ignored
+	ChangeRepoFilesOptions
+}
+
+// BranchFilesResponse is the outcome of the changes on one of the target branches: the response of
+// their commit, or the error they failed with
+type BranchFilesResponse struct {
+	Branch        string
+	FilesResponse *structs.FilesResponse
+	Err           error
+}
+
+// ChangeRepoFilesOnBranches commits the given file operations to each of the target branches in turn
+// as ChangeRepoFiles does, e.g. to apply a fix to several maintenance branches. The changes failing
+// on a branch, because it is protected or they conflict with it, are reported for that branch without
+// stopping the changes of the others. The responses are in the order of the branches, given once each.
+func ChangeRepoFilesOnBranches(repo *models.Repository, doer *models.User, opts *ChangeRepoFilesOnBranchesOptions) ([]*BranchFilesResponse, error) {
+	if len(opts.TargetBranches) == 0 {
+		return nil, fmt.Errorf("no target branch")
+	}
+
+	t, err := NewTemporaryUploadRepository(repo)
+	if err != nil {
+		return nil, err
+	}
+	defer t.Close()
+
+	// The content readers are read once, to a spool the content of each branch is read from. It is
+	// made beside the temporary upload repository, whose creation makes sure their root exists, so
+	// that the cleanup of stale temporary upload repositories removes it as well.
+	spoolDir, err := ioutil.TempDir(TemporaryUploadRepositoriesPath(), temporaryUploadRepositoryPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create dir in %s: %v", TemporaryUploadRepositoriesPath(), err)
+	}
+	defer os.RemoveAll(spoolDir)
+	spoolPaths, err := spoolContentReaders(spoolDir, opts.Files)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]*BranchFilesResponse, 0, len(opts.TargetBranches))
+	changed := make(map[string]bool, len(opts.TargetBranches))
+	for _, branch := range opts.TargetBranches {
+		if changed[branch] {
+			continue
+		}
+		changed[branch] = true
+
+		changeOpts := opts.ChangeRepoFilesOptions
+		changeOpts.OldBranch = branch
+		changeOpts.NewBranch = branch
+		changeOpts.CreateNewBranch = false
+		changeOpts.LastCommitID = ""
+		changeOpts.TemporaryRepository = t
+		response := &BranchFilesResponse{Branch: branch}
+		changeOpts.Files, err = copyChangeRepoFiles(opts.Files, spoolPaths)
+		if err == nil {
+			response.FilesResponse, response.Err = ChangeRepoFiles(repo, doer, &changeOpts)
+			closeChangeRepoFiles(changeOpts.Files)
+		} else {
+			response.Err = err
+		}
+		responses = append(responses, response)
+	}
+	return responses, nil
+}
+
+// spoolContentReaders writes the content of each of the given files given by a reader to a file
+// of the given directory, returning the paths of the files written for them
+func spoolContentReaders(spoolDir string, files []*ChangeRepoFile) (map[*ChangeRepoFile]string, error) {
+	spoolPaths := make(map[*ChangeRepoFile]string)
+	for i, file := range files {
+		if file.ContentReader == nil {
+			continue
+		}
+		spoolPath := filepath.Join(spoolDir, strconv.Itoa(i))
+		spool, err := os.Create(spoolPath)
+		if err != nil {
+			return nil, fmt.Errorf("spoolContentReaders: %v", err)
+		}
+		_, err = io.Copy(spool, file.ContentReader)
+		spool.Close()
+		if err != nil {
+			return nil, fmt.Errorf("spoolContentReaders: %v", err)
+		}
+		spoolPaths[file] = spoolPath
+	}
+	return spoolPaths, nil
+}
+
+// copyChangeRepoFiles returns copies of the given files to change, whose content readers read the
+// spooled content of the originals
+func copyChangeRepoFiles(files []*ChangeRepoFile, spoolPaths map[*ChangeRepoFile]string) ([]*ChangeRepoFile, error) {
+	copies := make([]*ChangeRepoFile, 0, len(files))
+	for _, file := range files {
+		copied := *file
+		if spoolPath, ok := spoolPaths[file]; ok {
+			spool, err := os.Open(spoolPath)
+			if err != nil {
+				closeChangeRepoFiles(copies)
+				return nil, fmt.Errorf("copyChangeRepoFiles: %v", err)
+			}
+			copied.ContentReader = spool
+		}
+		copies = append(copies, &copied)
+	}
+	return copies, nil
+}
+
+// closeChangeRepoFiles closes the spooled content the given copied files were reading
+func closeChangeRepoFiles(files []*ChangeRepoFile) {
+	for _, file := range files {
+		if spool, ok := file.ContentReader.(*os.File); ok {
+			spool.Close()
+		}
+	}
+}
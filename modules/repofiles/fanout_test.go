@@ -0,0 +1,104 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"code.gitea.io/gitea/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeRepoFilesOnBranches(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{
+			OldBranch:       "master",
+			NewBranch:       "release-1",
+			CreateNewBranch: true,
+		},
+		TreePath: "release.txt",
+		Content:  "1",
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, models.UpdateProtectBranch(repo, &models.ProtectedBranch{
+		RepoID:     repo.ID,
+		BranchName: "develop",
+	}, models.WhitelistOptions{}))
+	developCommitsCount := getCommitsCount(t, repo, "develop")
+
+	// The content read once is committed to each branch the doer may push to
+	responses, err := ChangeRepoFilesOnBranches(repo, doer, &ChangeRepoFilesOnBranchesOptions{
+		TargetBranches: []string{"master", "develop", "release-1", "master"},
+		ChangeRepoFilesOptions: ChangeRepoFilesOptions{
+			CommitOptions: CommitOptions{Message: "Fix the security issue"},
+			Files: []*ChangeRepoFile{
+				{Operation: "create", TreePath: "SECURITY.md", ContentReader: strings.NewReader("Report issues privately\n")},
+			},
+		},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, responses, 3) {
+		for i, branch := range []string{"master", "develop", "release-1"} {
+			assert.EqualValues(t, branch, responses[i].Branch)
+		}
+		for _, response := range []*BranchFilesResponse{responses[0], responses[2]} {
+			assert.NoError(t, response.Err, response.Branch)
+			if assert.NotNil(t, response.FilesResponse, response.Branch) {
+				assert.EqualValues(t, response.FilesResponse.Commit.SHA, getBranchCommit(t, repo, response.Branch).ID.String())
+			}
+			assert.EqualValues(t, "Report issues privately\n", getBranchFileContent(t, repo, response.Branch, "SECURITY.md"))
+		}
+		assert.Nil(t, responses[1].FilesResponse)
+		assert.True(t, models.IsErrNotAllowedToPush(responses[1].Err), "%v", responses[1].Err)
+	}
+	assert.EqualValues(t, developCommitsCount, getCommitsCount(t, repo, "develop"))
+	assert.EqualValues(t, "1", getBranchFileContent(t, repo, "release-1", "release.txt"))
+
+	// A branch the changes conflict with fails alone as well
+	responses, err = ChangeRepoFilesOnBranches(repo, doer, &ChangeRepoFilesOnBranchesOptions{
+		TargetBranches: []string{"release-1", "master"},
+		ChangeRepoFilesOptions: ChangeRepoFilesOptions{
+			Files: []*ChangeRepoFile{{Operation: "create", TreePath: "release.txt", Content: "2"}},
+		},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, responses, 2) {
+		assert.True(t, models.IsErrRepoFileAlreadyExist(responses[0].Err), "%v", responses[0].Err)
+		assert.NoError(t, responses[1].Err)
+	}
+	assert.EqualValues(t, "2", getBranchFileContent(t, repo, "master", "release.txt"))
+
+	_, err = ChangeRepoFilesOnBranches(repo, doer, &ChangeRepoFilesOnBranchesOptions{})
+	assert.Error(t, err)
+}
+
+func TestChangeRepoFilesOnBranches_NoUploadRoot(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	// The root of the temporary upload repositories is removed on startup
+	assert.NoError(t, os.RemoveAll(TemporaryUploadRepositoriesPath()))
+	responses, err := ChangeRepoFilesOnBranches(repo, doer, &ChangeRepoFilesOnBranchesOptions{
+		TargetBranches: []string{"master", "develop"},
+		ChangeRepoFilesOptions: ChangeRepoFilesOptions{
+			Files: []*ChangeRepoFile{
+				{Operation: "create", TreePath: "spooled.txt", ContentReader: strings.NewReader("spooled")},
+			},
+		},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, responses, 2) {
+		for _, response := range responses {
+			assert.NoError(t, response.Err, response.Branch)
+			assert.EqualValues(t, "spooled", getBranchFileContent(t, repo, response.Branch, "spooled.txt"))
+		}
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/setting"
+)
+
+// canFastImport checks if the given prepared files may be created through git fast-import, see
+// fastImportFiles: enough of them have to be created, and only created, and the pre-commit hooks
+// need the files staged in the index
+func canFastImport(files []*ChangeRepoFile) bool {
+	minFiles := setting.Repository.FastImportMinFiles
+	if minFiles <= 0 || len(files) < minFiles || len(getPreCommitHooks()) > 0 {
+		return false
+	}
+	for _, file := range files {
+		if file.Operation != "create" || file.RejectIgnored {
+			return false
+		}
+	}
+	return true
+}
+
+// fastImportFiles creates the given prepared files on top of the given commit, nil for an empty
+// repository, with a single git fast-import instead of staging the files one by one, and returns
+// the hash of the tree written. The files are checked and applied as applyChangeRepoFile does, the
+// content of each being read in memory to be hashed and streamed. An empty hash is returned if the
+// attributes of the repository could convert the content, the files then having to be staged.
+func fastImportFiles(t *TemporaryUploadRepository, commit *git.Commit, files []*ChangeRepoFile, progress *progressReporter) (string, error) {
+	// fast-import writes the content as it is, without the conversions hash-object would make
+	if _, err := os.Stat(path.Join(t.basePath, "info", "attributes")); err == nil {
+		return "", nil
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("fastImportFiles: %v", err)
+	}
+	if t.HasConfig("core.autocrlf") {
+		return "", nil
+	}
+	filesInIndex, err := t.LsFiles()
+	if err != nil {
+		return "", err
+	}
+
+	stream, streamWriter := io.Pipe()
+	written := make(chan error, 1)
+	go func() {
+		err := writeFastImportStream(streamWriter, t.repo, commit, files, filesInIndex, progress)
+		streamWriter.CloseWithError(err)
+		written <- err
+	}()
+	treeHash, err := t.FastImport(stream)
+	// fast-import may stop reading before the end of a stream it fails on
+	stream.CloseWithError(io.ErrClosedPipe)
+	if writeErr := <-written; writeErr != nil {
+		return "", writeErr
+	}
+	return treeHash, err
+}
+
+// writeFastImportStream writes the git fast-import stream of a commit creating the given prepared
+// files on top of the given commit to the given writer, checking the paths of the files against the
+// given files of the index and the files created before them. The content is formatted and limited
+// in size as for the given repository.
+func writeFastImportStream(w io.Writer, repo *models.Repository, commit *git.Commit, files []*ChangeRepoFile, filesInIndex []string, progress *progressReporter) error {
+	// The files at each path, and the first file beneath each directory
+	existingFiles := make(map[string]bool, len(filesInIndex)+len(files))
+	existingDirs := make(map[string]string)
+	addExisting := func(treePath string) {
+		existingFiles[treePath] = true
+		for dir := path.Dir(treePath); dir != "."; dir = path.Dir(dir) {
+			if entry, ok := existingDirs[dir]; !ok || treePath < entry {
+				existingDirs[dir] = treePath
+			}
+		}
+	}
+	for _, treePath := range filesInIndex {
+		addExisting(treePath)
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "commit %s\ncommitter Gitea <gitea@localhost> 0 +0000\ndata 0\n", fastImportRef)
+	if commit != nil {
+		fmt.Fprintf(bw, "from %s\n", commit.ID.String())
+	}
+	for _, file := range files {
+		if entry, ok := existingDirs[file.treePath]; ok {
+			return models.ErrFileDirectoryConflict{Path: file.treePath, Entry: entry}
+		}
+		for dir := path.Dir(file.treePath); dir != "."; dir = path.Dir(dir) {
+			if existingFiles[dir] {
+				return models.ErrFileDirectoryConflict{Path: file.treePath, Entry: dir}
+			}
+		}
+		if existingFiles[file.treePath] {
+			return models.ErrRepoFileAlreadyExist{FileName: file.treePath}
+		}
+
+		mode := file.mode("100644")
+		var content []byte
+		if mode == symlinkMode {
+			target, err := readSymlinkTarget(file)
+			if err != nil {
+				return err
+			}
+			content = []byte(target)
+		} else {
+			if err := formatContent(repo, file); err != nil {
+				return err
+			}
+			var err error
+			content, err = ioutil.ReadAll(&sizeLimitedReader{r: file.content, path: file.treePath, maxSize: maxFileSize(repo, false)})
+			if err != nil {
+				return err
+			}
+		}
+		objectHash := hashBlob(content)
+		if file.ContentSHA != "" && !strings.EqualFold(file.ContentSHA, objectHash) {
+			return models.ErrContentSHAMismatch{Path: file.treePath, GivenSHA: file.ContentSHA, ContentSHA: objectHash}
+		}
+		file.size = int64(len(content))
+		if err := setSizeDeltas(file, nil); err != nil {
+			return err
+		}
+		file.indexMode, file.indexHash = mode, objectHash
+
+		fmt.Fprintf(bw, "M %s inline %s\ndata %d\n", mode, quoteFastImportPath(file.treePath), len(content))
+		bw.Write(content)
+		bw.WriteString("\n")
+		addExisting(file.treePath)
+		progress.applied(file)
+	}
+	bw.WriteString("done\n")
+	return bw.Flush()
+}
+
+// hashBlob returns the hash git gives to a blob of the given content
+func hashBlob(content []byte) string {
+	hash := sha1.New()
+	fmt.Fprintf(hash, "blob %d\x00", len(content))
+	hash.Write(content)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// quoteFastImportPath quotes the given tree path in the C style of git fast-import if it has to be,
+// paths being read up to the end of the line unless they start with a quote
+func quoteFastImportPath(treePath string) string {
+	if !strings.HasPrefix(treePath, `"`) && !strings.ContainsRune(treePath, '\n') {
+		return treePath
+	}
+	quoted := new(strings.Builder)
+	quoted.WriteByte('"')
+	for i := 0; i < len(treePath); i++ {
+		switch c := treePath[i]; {
+		case c == '"' || c == '\\':
+			quoted.WriteByte('\\')
+			quoted.WriteByte(c)
+		case c == '\n':
+			quoted.WriteString(`\n`)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(quoted, "\\%03o", c)
+		default:
+			quoted.WriteByte(c)
+		}
+	}
+	quoted.WriteByte('"')
+	return quoted.String()
+}
@@ -0,0 +1,151 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"fmt"
+	"testing"
+
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/setting"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setFastImportMinFiles sets how many files are created through fast-import until the returned
+// function is called
+func setFastImportMinFiles(minFiles int) func() {
+	oldMinFiles := setting.Repository.FastImportMinFiles
+	setting.Repository.FastImportMinFiles = minFiles
+	return func() {
+		setting.Repository.FastImportMinFiles = oldMinFiles
+	}
+}
+
+func TestChangeRepoFiles_FastImport(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	defer setFastImportMinFiles(0)()
+
+	// Both ways of creating the files make the same commits
+	newFiles := func() []*ChangeRepoFile {
+		return []*ChangeRepoFile{
+			{Operation: "create", TreePath: "scaffold/main.go", Content: "package main\n"},
+			{Operation: "create", TreePath: "scaffold/run.sh", Content: "#!/bin/sh\n", Mode: "100755"},
+			{Operation: "create", TreePath: "scaffold/link", Content: "main.go", Symlink: true},
+			{Operation: "create", TreePath: "\"quoted\"\nname", Content: "quoted"},
+			{Operation: "create", TreePath: "docs/a/b.md", Content: "b", ContentSHA: "63d8dbd40c23542e740659a7168a0ce3138ea748"},
+		}
+	}
+	responses := make(map[string]*ChangeRepoFilesOptions)
+	for minFiles, branch := range map[int]string{0: "staged", 1: "imported"} {
+		setting.Repository.FastImportMinFiles = minFiles
+		opts := &ChangeRepoFilesOptions{
+			CommitOptions: CommitOptions{
+				OldBranch:       "master",
+				NewBranch:       branch,
+				CreateNewBranch: true,
+				Message:         "Scaffold",
+				AuthorDate:      "2019-01-01T00:00:00Z",
+				CommitterDate:   "2019-01-01T00:00:00Z",
+			},
+			Files: newFiles(),
+		}
+		filesResponse, err := ChangeRepoFiles(repo, doer, opts)
+		assert.NoError(t, err, branch)
+		if assert.NotNil(t, filesResponse, branch) {
+			assert.Len(t, filesResponse.Files, 5)
+			assert.EqualValues(t, getBranchCommit(t, repo, branch).ID.String(), filesResponse.Commit.SHA)
+		}
+		responses[branch] = opts
+	}
+	assert.EqualValues(t, getBranchCommit(t, repo, "staged").ID, getBranchCommit(t, repo, "imported").ID)
+	assert.EqualValues(t, "120000", getBranchFileMode(t, repo, "imported", "scaffold/link"))
+	assert.EqualValues(t, "100755", getBranchFileMode(t, repo, "imported", "scaffold/run.sh"))
+	assert.EqualValues(t, "quoted", getBranchFileContent(t, repo, "imported", "\"quoted\"\nname"))
+	for i, file := range responses["imported"].Files {
+		assert.EqualValues(t, responses["staged"].Files[i].indexHash, file.indexHash)
+		assert.EqualValues(t, responses["staged"].Files[i].sizeDelta, file.sizeDelta)
+	}
+	// The push is delivered as any other
+	models.AssertExistsAndLoadBean(t, &models.Action{
+		UserID:  doer.ID,
+		OpType:  models.ActionCommitRepo,
+		RepoID:  repo.ID,
+		RefName: "imported",
+	})
+
+	// The files are checked against the existing ones and each other
+	setting.Repository.FastImportMinFiles = 1
+	commitsCount := getCommitsCount(t, repo, "imported")
+	for _, test := range []struct {
+		files []*ChangeRepoFile
+		err   error
+	}{
+		{
+			[]*ChangeRepoFile{{Operation: "create", TreePath: "scaffold/main.go", Content: "again"}},
+			models.ErrRepoFileAlreadyExist{FileName: "scaffold/main.go"},
+		},
+		{
+			[]*ChangeRepoFile{{Operation: "create", TreePath: "docs", Content: "docs"}},
+			models.ErrFileDirectoryConflict{Path: "docs", Entry: "docs/a/b.md"},
+		},
+		{
+			[]*ChangeRepoFile{
+				{Operation: "create", TreePath: "new/a", Content: "a"},
+				{Operation: "create", TreePath: "new/a/b", Content: "b"},
+			},
+			models.ErrFileDirectoryConflict{Path: "new/a/b", Entry: "new/a"},
+		},
+		{
+			[]*ChangeRepoFile{{Operation: "create", TreePath: "c.txt", Content: "c", ContentSHA: "0123456789abcdef0123456789abcdef01234567"}},
+			models.ErrContentSHAMismatch{Path: "c.txt", GivenSHA: "0123456789abcdef0123456789abcdef01234567", ContentSHA: "3410062ba67c5ed59b854387a8bc0ec012479368"},
+		},
+	} {
+		_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+			CommitOptions: CommitOptions{OldBranch: "imported"},
+			Files:         test.files,
+		})
+		assert.EqualValues(t, test.err, err)
+	}
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "imported"))
+
+	// The attributes converting the content are applied by staging the files instead
+	pushTestFile(t, repo, doer, ".gitattributes", "*.txt text eol=crlf\n")
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "crlf.txt",
+		Content:  "a\r\nb\r\n",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "a\nb\n", getBranchFileContent(t, repo, "master", "crlf.txt"))
+}
+
+func benchmarkBulkCreate(b *testing.B, minFiles int) {
+	repo := prepareTestRepo(b, 1)
+	doer := models.AssertExistsAndLoadBean(b, &models.User{ID: 2}).(*models.User)
+	defer setFastImportMinFiles(minFiles)()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		files := make([]*ChangeRepoFile, 0, 5000)
+		for j := 0; j < 5000; j++ {
+			files = append(files, &ChangeRepoFile{
+				Operation: "create",
+				TreePath:  fmt.Sprintf("scaffold%d/dir%d/file%d.txt", i, j/100, j),
+				Content:   fmt.Sprintf("file %d\n", j),
+			})
+		}
+		_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{CommitOptions: CommitOptions{Message: "Scaffold"}, Files: files})
+		assert.NoError(b, err)
+	}
+}
+
+func BenchmarkBulkCreate_FastImport(b *testing.B) {
+	benchmarkBulkCreate(b, 1)
+}
+
+func BenchmarkBulkCreate_Index(b *testing.B) {
+	benchmarkBulkCreate(b, 0)
+}
@@ -0,0 +1,178 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/setting"
+)
+
+// contentURLMaxRedirects is the number of redirects followed when fetching a content URL
+const contentURLMaxRedirects = 10
+
+// privateNetworks are the unspecified, loopback, private, shared, link-local, protocol assignment,
+// benchmarking, multicast and reserved address ranges, and the NAT64 one translating to any IPv4
+// address, which the content URLs may not be fetched from unless allowed
+var privateNetworks = func() []*net.IPNet {
+	cidrs := []string{
+		"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12", "192.0.0.0/24",
+		"192.168.0.0/16", "198.18.0.0/15", "224.0.0.0/4", "240.0.0.0/4",
+		"::/128", "::1/128", "64:ff9b::/96", "fc00::/7", "fe80::/10", "ff00::/8",
+	}
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+// isPrivateIP checks if the given address is in one of the private networks
+func isPrivateIP(ip net.IP) bool {
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// errPrivateAddress is returned when dialing a private address while they are not allowed
+type errPrivateAddress struct {
+	address string
+}
+
+func (err errPrivateAddress) Error() string {
+	return fmt.Sprintf("%s is a private address", err.address)
+}
+
+// checkPublicAddress is the control of the connections to the content URLs. The resolved
+// address is checked, so a host can't resolve to a public address first and a private one next.
+func checkPublicAddress(network, address string, _ syscall.RawConn) error {
+	if setting.Repository.ContentURL.AllowPrivateNetworks {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || isPrivateIP(ip) {
+		return errPrivateAddress{address: address}
+	}
+	return nil
+}
+
+// containsFold checks if the given list contains the given value, ignoring case
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(strings.TrimSpace(item), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkContentURL makes sure the content of the file at the given tree path may be fetched from the given URL
+func checkContentURL(treePath string, u *url.URL) error {
+	allowed := setting.Repository.ContentURL
+	reason := ""
+	switch {
+	case len(allowed.AllowedHosts) == 0:
+		reason = "fetching contents is disabled"
+	case !containsFold(allowed.AllowedSchemes, u.Scheme) || (u.Scheme != "http" && u.Scheme != "https"):
+		reason = "scheme not allowed"
+	case u.Hostname() == "":
+		reason = "no host"
+	case !containsFold(allowed.AllowedHosts, "*") && !containsFold(allowed.AllowedHosts, u.Hostname()):
+		reason = "host not allowed"
+	default:
+		return nil
+	}
+	return models.ErrInvalidContentURL{Path: treePath, URL: u.String(), Reason: reason}
+}
+
+// newContentURLClient returns a client fetching the content of the file at the given tree path,
+// which only connects to public addresses unless allowed and checks the URLs it is redirected to
+func newContentURLClient(treePath string) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: setting.Repository.ContentURL.Timeout,
+		Control: checkPublicAddress,
+	}
+	return &http.Client{
+		Timeout: setting.Repository.ContentURL.Timeout,
+		// No proxy is used, it would connect to the addresses instead of the dialer
+		Transport: &http.Transport{
+			DialContext:       dialer.DialContext,
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= contentURLMaxRedirects {
+				return models.ErrInvalidContentURL{Path: treePath, URL: req.URL.String(), Reason: "too many redirects"}
+			}
+			return checkContentURL(treePath, req.URL)
+		},
+	}
+}
+
+// fetchContentURL starts fetching the content of the given prepared file from its ContentURL.
+// The returned reader is limited to the max size of the fetched contents, and the response
+// is kept to be closed by closeFetchedContents.
+func fetchContentURL(file *ChangeRepoFile) (io.Reader, error) {
+	u, err := url.Parse(file.ContentURL)
+	if err != nil {
+		return nil, models.ErrInvalidContentURL{Path: file.treePath, URL: file.ContentURL, Reason: "malformed URL"}
+	}
+	if err := checkContentURL(file.treePath, u); err != nil {
+		return nil, err
+	}
+
+	resp, err := newContentURLClient(file.treePath).Get(u.String())
+	if err != nil {
+		if urlErr, ok := err.(*url.Error); ok {
+			// The refused redirects are reported as they are
+			if invalidErr, ok := urlErr.Err.(models.ErrInvalidContentURL); ok {
+				return nil, invalidErr
+			}
+			if opErr, ok := urlErr.Err.(*net.OpError); ok {
+				if _, ok := opErr.Err.(errPrivateAddress); ok {
+					return nil, models.ErrInvalidContentURL{Path: file.treePath, URL: file.ContentURL, Reason: "private address not allowed"}
+				}
+			}
+		}
+		return nil, models.ErrInvalidContentURL{Path: file.treePath, URL: file.ContentURL, Reason: fmt.Sprintf("fetch failed: %v", err)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, models.ErrInvalidContentURL{Path: file.treePath, URL: file.ContentURL, Reason: "unexpected status: " + resp.Status}
+	}
+	maxSize := setting.Repository.ContentURL.MaxSize
+	if maxSize > 0 && resp.ContentLength > maxSize {
+		resp.Body.Close()
+		return nil, models.ErrFileTooBig{Path: file.treePath, MaxSize: maxSize}
+	}
+	file.fetchedContent = resp.Body
+	return &sizeLimitedReader{r: resp.Body, path: file.treePath, maxSize: maxSize}, nil
+}
+
+// closeFetchedContents closes the responses the contents of the given files are fetched from
+func closeFetchedContents(files []*ChangeRepoFile) {
+	for _, file := range files {
+		if file.fetchedContent != nil {
+			file.fetchedContent.Close()
+			file.fetchedContent = nil
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/setting"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// startContentServer starts a mock server of binary content, allowing it to be fetched
+func startContentServer(t *testing.T) (*httptest.Server, []byte, func()) {
+	content := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\xff")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/image.png":
+			w.Write(content)
+		case "/big.bin":
+			w.Write(make([]byte, 1024))
+		case "/redirect":
+			http.Redirect(w, r, r.URL.Query().Get("to"), http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	oldContentURL := setting.Repository.ContentURL
+	setting.Repository.ContentURL.AllowedSchemes = []string{"http"}
+	setting.Repository.ContentURL.AllowedHosts = []string{"127.0.0.1"}
+	setting.Repository.ContentURL.AllowPrivateNetworks = true
+	return server, content, func() {
+		setting.Repository.ContentURL = oldContentURL
+		server.Close()
+	}
+}
+
+func TestCreateRepoFile_ContentURL(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	server, content, stop := startContentServer(t)
+	defer stop()
+
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath:   "image.png",
+		ContentURL: server.URL + "/image.png",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, string(content), getBranchFileContent(t, repo, "master", "image.png"))
+
+	// Updates fetch the new content as well, redirects being followed
+	_, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		TreePath:   "README.md",
+		ContentURL: server.URL + "/redirect?to=/image.png",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, string(content), getBranchFileContent(t, repo, "master", "README.md"))
+}
+
+func TestCreateRepoFile_ContentURLErrors(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	server, _, stop := startContentServer(t)
+	defer stop()
+	serverURL, err := url.Parse(server.URL)
+	assert.NoError(t, err)
+	_, port, err := net.SplitHostPort(serverURL.Host)
+	assert.NoError(t, err)
+
+	commitsCount := getCommitsCount(t, repo, "master")
+	for _, test := range []struct {
+		contentURL           string
+		allowedHosts         []string
+		allowPrivateNetworks bool
+		reason               string
+	}{
+		{server.URL + "/image.png", nil, true, "fetching contents is disabled"},
+		{"file:///etc/passwd", []string{"*"}, true, "scheme not allowed"},
+		{"ftp://127.0.0.1/image.png", []string{"*"}, true, "scheme not allowed"},
+		{"http:///image.png", []string{"*"}, true, "no host"},
+		{"http://example.com/image.png", []string{"127.0.0.1"}, true, "host not allowed"},
+		{server.URL + "/missing", []string{"127.0.0.1"}, true, "unexpected status: 404 Not Found"},
+		// Private addresses are refused whatever the host resolves to, redirects included
+		{server.URL + "/image.png", []string{"127.0.0.1"}, false, "private address not allowed"},
+		{"http://localhost:" + port + "/image.png", []string{"*"}, false, "private address not allowed"},
+		{"http://169.254.169.254/latest/meta-data/", []string{"*"}, false, "private address not allowed"},
+		{"http://[::1]:" + port + "/image.png", []string{"*"}, false, "private address not allowed"},
+		{"http://[64:ff9b::7f00:1]:" + port + "/image.png", []string{"*"}, false, "private address not allowed"},
+		{"http://224.0.0.1:" + port + "/image.png", []string{"*"}, false, "private address not allowed"},
+		{server.URL + "/redirect?to=http://example.com/", []string{"127.0.0.1"}, true, "host not allowed"},
+	} {
+		setting.Repository.ContentURL.AllowedHosts = test.allowedHosts
+		setting.Repository.ContentURL.AllowPrivateNetworks = test.allowPrivateNetworks
+		_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+			TreePath:   "image.png",
+			ContentURL: test.contentURL,
+		})
+		if assert.True(t, models.IsErrInvalidContentURL(err), "%s: %v", test.contentURL, err) {
+			assert.EqualValues(t, test.reason, err.(models.ErrInvalidContentURL).Reason, test.contentURL)
+		}
+	}
+
+	// The fetched content is limited in size
+	setting.Repository.ContentURL.AllowedHosts = []string{"127.0.0.1"}
+	setting.Repository.ContentURL.AllowPrivateNetworks = true
+	setting.Repository.ContentURL.MaxSize = 512
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath:   "big.bin",
+		ContentURL: server.URL + "/big.bin",
+	})
+	assert.True(t, models.IsErrFileTooBig(err), "%v", err)
+
+	// And can't be given along with another content
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath:   "image.png",
+		Content:    "content",
+		ContentURL: server.URL + "/image.png",
+	})
+	assert.Error(t, err)
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+}
+
+func TestCheckPublicAddress(t *testing.T) {
+	oldContentURL := setting.Repository.ContentURL
+	defer func() {
+		setting.Repository.ContentURL = oldContentURL
+	}()
+	setting.Repository.ContentURL.AllowPrivateNetworks = false
+
+	for _, test := range []struct {
+		address string
+		public  bool
+	}{
+		{"93.184.216.34:80", true},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:80", true},
+		{"127.0.0.1:80", false},
+		{"[::ffff:127.0.0.1]:80", false},
+		{"192.0.0.170:80", false},
+		{"198.18.0.1:80", false},
+		{"198.19.255.255:80", false},
+		{"224.0.0.1:80", false},
+		{"239.255.255.250:80", false},
+		{"240.0.0.1:80", false},
+		{"255.255.255.255:80", false},
+		{"[ff02::1]:80", false},
+		{"[ff05::1:3]:80", false},
+		// NAT64 addresses translate to IPv4 ones, private or not
+		{"[64:ff9b::7f00:1]:80", false},
+		{"[64:ff9b::5db8:d822]:80", false},
+	} {
+		err := checkPublicAddress("tcp", test.address, nil)
+		if test.public {
+			assert.NoError(t, err, test.address)
+		} else {
+			assert.IsType(t, errPrivateAddress{}, err, test.address)
+		}
+	}
+
+	// The dialer refuses the addresses before connecting to them
+	dialer := &net.Dialer{Control: checkPublicAddress}
+	for _, address := range []string{"224.0.0.1:80", "[64:ff9b::7f00:1]:80"} {
+		_, err := dialer.Dial("tcp", address)
+		if assert.IsType(t, &net.OpError{}, err, address) {
+			assert.IsType(t, errPrivateAddress{}, err.(*net.OpError).Err, address)
+		}
+	}
+}
@@ -0,0 +1,409 @@
+// Copyright 2018 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/base"
+	"code.gitea.io/gitea/modules/log"
+	"code.gitea.io/gitea/modules/setting"
+	"code.gitea.io/gitea/modules/structs"
+	"code.gitea.io/gitea/modules/templates"
+	"code.gitea.io/sdk/gitea"
+)
+
+// IdentityOptions for a person's identity like an author or committer
+type IdentityOptions struct {
+	Name  string
+	Email string
+}
+
+// GetAuthorAndCommitterUsers resolves the given author and committer identities to users
+// by their email. When an identity is not given or no user owns its email, the committer
+// falls back to the doer and the author falls back to the committer.
+func GetAuthorAndCommitterUsers(author, committer *IdentityOptions, doer *models.User) (authorUser, committerUser *models.User) {
+	committerUser = doer
+	if committer != nil && committer.Email != "" {
+		if u, err := models.GetUserByEmail(committer.Email); err == nil {
+			committerUser = u
+		} else if !models.IsErrUserNotExist(err) {
+			log.Error(4, "GetUserByEmail [email: %s]: %v", committer.Email, err)
+		}
+	}
+
+	authorUser = committerUser
+	if author != nil && author.Email != "" {
+		if u, err := models.GetUserByEmail(author.Email); err == nil {
+			authorUser = u
+		} else if !models.IsErrUserNotExist(err) {
+			log.Error(4, "GetUserByEmail [email: %s]: %v", author.Email, err)
+		}
+	}
+	return authorUser, committerUser
+}
+
+// windowsReservedNames are the device names Windows doesn't allow as file names, whatever their extension
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// isWindowsReservedName checks if the given path component is a Windows device name
+func isWindowsReservedName(name string) bool {
+	name = strings.SplitN(name, ".", 2)[0]
+	return windowsReservedNames[strings.ToUpper(strings.TrimRight(name, " "))]
+}
+
+// isHFSIgnorable checks if the given code point is one of those HFS+ ignores in file names
+func isHFSIgnorable(r rune) bool {
+	return (r >= 0x200c && r <= 0x200f) || (r >= 0x202a && r <= 0x202e) || (r >= 0x206a && r <= 0x206f) || r == 0xfeff
+}
+
+// isGitDirName checks if the given path component names the git directory on some platform, as git
+// itself does when checking out: ".git" in any case, with the trailing dots and spaces Windows drops
+// or the code points HFS+ ignores, or its "git~1" short name on NTFS
+func isGitDirName(name string) bool {
+	name = strings.Map(func(r rune) rune {
+		if isHFSIgnorable(r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimRight(name, ". ")
+	return strings.EqualFold(name, ".git") || strings.EqualFold(name, "git~1")
+}
+
+// CleanUploadFileName returns a cleaned version of the given tree path, or an empty string
+// if it is invalid: nothing but the repository root is left, it is absolute, it contains a
+// git directory or a name which can't be checked out on all platforms.
+func CleanUploadFileName(name string) string {
+	// Backslashes are separators on Windows
+	name = strings.Replace(name, "\\", "/", -1)
+	// Colons are only valid for drive letters, which make the path absolute
+	if strings.HasPrefix(name, "/") || strings.Contains(name, ":") {
+		return ""
+	}
+
+	parts := make([]string, 0, strings.Count(name, "/")+1)
+	for _, part := range strings.Split(name, "/") {
+		switch {
+		case part == "" || part == "." || part == "..":
+			continue
+		case isGitDirName(part) || isWindowsReservedName(part):
+			return ""
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "/")
+}
+
+// getContentReader returns a reader of the raw content of the given file, fetching it
+// from its ContentURL if given, or decoding its Content as it is read when no ContentReader is given
+func getContentReader(file *ChangeRepoFile) (io.Reader, error) {
+	if file.ContentURL != "" {
+		if file.ContentReader != nil || file.Content != "" {
+			return nil, fmt.Errorf("content given along with a content URL: %s", file.TreePath)
+		}
+		return fetchContentURL(file)
+	}
+	if file.ContentReader != nil {
+		return file.ContentReader, nil
+	}
+	switch file.Encoding {
+	case "":
+		return strings.NewReader(file.Content), nil
+	case "base64":
+		// Malformed content is reported before anything is changed, without holding the decoded content
+		if _, err := io.Copy(ioutil.Discard, base64.NewDecoder(base64.StdEncoding, strings.NewReader(file.Content))); err != nil {
+			return nil, fmt.Errorf("DecodeString: %v", err)
+		}
+		return base64.NewDecoder(base64.StdEncoding, strings.NewReader(file.Content)), nil
+	default:
+		return nil, fmt.Errorf("unknown content encoding: %s", file.Encoding)
+	}
+}
+
+// sizeLimitedReader reads the content of a file, failing with ErrFileTooBig once more
+// than maxSize bytes are read. A maxSize of 0 means no limit. The error reading the
+// content failed with, if any, is kept to be reported as it is.
+type sizeLimitedReader struct {
+	r       io.Reader
+	path    string
+	maxSize int64
+	size    int64
+	err     error
+}
+
+func (r *sizeLimitedReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := r.r.Read(p)
+	r.size += int64(n)
+	if r.maxSize > 0 && r.size > r.maxSize {
+		r.err = models.ErrFileTooBig{Path: r.path, MaxSize: r.maxSize}
+		return n, r.err
+	} else if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// maxFileSize returns the max size of the files written to the given repository,
+// the LFS limit applying to the paths tracked by LFS
+func maxFileSize(repo *models.Repository, isLFS bool) int64 {
+	if isLFS {
+		return setting.LFS.MaxFileSize
+	}
+	if repo.MaxFileSize != 0 {
+		return repo.MaxFileSize
+	}
+	return setting.Repository.MaxFileSize
+}
+
+// GetFileResponseFromCommit constructs a FileResponse from a commit object
+func GetFileResponseFromCommit(repo *models.Repository, commit *git.Commit, branch, treePath string) (*structs.FileResponse, error) {
+	content, err := getFileContentResponse(repo, &commit.Tree, branch, treePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &structs.FileResponse{
+		Commit:       GetFileCommitResponse(repo, commit),
+		Verification: GetPayloadCommitVerification(commit),
+		Content:      content,
+	}, nil
+}
+
+// GetFileResponseFromBlob constructs a FileResponse for a file at the given path with the content of
+// a blob object of the repository, e.g. to preview a file before committing it. The blob being in no
+// commit nor branch, the commit, the verification and the URLs of the file are left empty.
+func GetFileResponseFromBlob(repo *models.Repository, treePath, blobSHA string) (*structs.FileResponse, error) {
+	gitRepo, err := git.OpenRepository(repo.RepoPath())
+	if err != nil {
+		return nil, err
+	}
+	blob, err := gitRepo.GetBlob(blobSHA)
+	if git.IsErrNotExist(err) {
+		return nil, models.ErrSHANotFound{SHA: blobSHA}
+	} else if err != nil {
+		return nil, err
+	}
+
+	content, err := getBlobContentResponse(blob.TreeEntry, treePath)
+	if err != nil {
+		return nil, err
+	}
+	return &structs.FileResponse{Content: content}, nil
+}
+
+// getFileContentResponse constructs a FileContentResponse for the file at the given path of a tree object
+func getFileContentResponse(repo *models.Repository, tree *git.Tree, branch, treePath string) (*structs.FileContentResponse, error) {
+	entry, err := tree.GetTreeEntryByPath(treePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.IsDir() {
+		return &structs.FileContentResponse{
+			Name:    entry.Name(),
+			Path:    treePath,
+			SHA:     entry.ID.String(),
+			HTMLURL: repo.HTMLURL() + "/src/branch/" + branch + "/" + treePath,
+			Type:    "dir",
+		}, nil
+	}
+
+	content, err := getBlobContentResponse(entry, treePath)
+	if err != nil {
+		return nil, err
+	}
+	content.URL = repo.APIURL() + "/raw/" + branch + "/" + treePath
+	content.HTMLURL = repo.HTMLURL() + "/src/branch/" + branch + "/" + treePath
+	content.DownloadURL = repo.HTMLURL() + "/raw/branch/" + branch + "/" + treePath
+	return content, nil
+}
+
+// getBlobContentResponse constructs a FileContentResponse for the file at the given path with the blob
+// of the given entry, without the URLs depending on the branch of the file. Entries without a mode,
+// like those of blobs looked up by their SHA, are files of an unknown mode.
+func getBlobContentResponse(entry *git.TreeEntry, treePath string) (*structs.FileContentResponse, error) {
+	content := &structs.FileContentResponse{
+		Name: path.Base(treePath),
+		Path: treePath,
+		SHA:  entry.ID.String(),
+		Size: entry.Size(),
+		Type: "file",
+	}
+	if entry.Mode() != 0 {
+		content.Mode = fmt.Sprintf("%x", entry.Mode())
+	}
+	if err := setFileContentResponseContent(content, entry); err != nil {
+		return nil, err
+	}
+	// The blob of a symlink is its target as it is
+	if entry.IsLink() {
+		target, err := entry.Blob().Data()
+		if err != nil {
+			return nil, err
+		}
+		d, err := ioutil.ReadAll(target)
+		if err != nil {
+			return nil, err
+		}
+		content.Type = "symlink"
+		content.Target = string(d)
+		return content, nil
+	}
+	// The blob of a file stored in LFS is only a pointer to its real content
+	if setting.LFS.StartServer {
+		meta, err := getLFSPointerOfEntry(entry)
+		if err != nil {
+			return nil, err
+		} else if meta != nil {
+			content.LFSOid = meta.Oid
+			content.LFSSize = meta.Size
+		}
+	}
+	return content, nil
+}
+
+// setFileContentResponseContent sets the content of the given file response to the blob of the given
+// tree entry, as text converted to UTF-8 from its detected charset or in base64 for binary files. Like
+// in the file view, the content of files larger than setting.UI.MaxDisplayFileSize is omitted, the
+// response telling so, so that responses stay small whatever the size of the files.
+func setFileContentResponseContent(content *structs.FileContentResponse, entry *git.TreeEntry) error {
+	dataRc, err := entry.Blob().DataAsync()
+	if err != nil {
+		return err
+	}
+	defer dataRc.Close()
+
+	buf := make([]byte, 1024)
+	n, err := io.ReadFull(dataRc, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	buf = buf[:n]
+	content.Encoding = "text"
+	if !base.IsTextFile(buf) {
+		content.Encoding = "base64"
+	}
+	if entry.Size() > setting.UI.MaxDisplayFileSize {
+		content.TooLarge = true
+		return nil
+	}
+	d, err := ioutil.ReadAll(dataRc)
+	if err != nil {
+		return err
+	}
+	buf = append(buf, d...)
+
+	if content.Encoding == "text" {
+		if charset, err := base.DetectEncoding(buf); err == nil {
+			if text, err := templates.ToUTF8WithErr(buf); err == nil {
+				content.Charset = charset
+				content.Content = text
+				return nil
+			}
+		}
+		// Text which can't be converted is given as it is
+		content.Encoding = "base64"
+	}
+	content.Content = base64.StdEncoding.EncodeToString(buf)
+	return nil
+}
+
+// GetFileCommitResponse constructs a FileCommitResponse from a commit object
+func GetFileCommitResponse(repo *models.Repository, commit *git.Commit) *structs.FileCommitResponse {
+	// Only the parents beyond the count of the commit are missing
+	parentIDs, _ := getParentIDs(commit)
+	return &structs.FileCommitResponse{
+		SHA:       commit.ID.String(),
+		HTMLURL:   repo.HTMLURL() + "/commit/" + commit.ID.String(),
+		Author:    getCommitUser(commit.Author),
+		Committer: getCommitUser(commit.Committer),
+		Message:   commit.Message(),
+		Tree: &structs.CommitMeta{
+			URL: repo.APIURL() + "/git/trees/" + commit.Tree.ID.String(),
+			SHA: commit.Tree.ID.String(),
+		},
+		Parents: getParentsResponse(repo, parentIDs),
+	}
+}
+
+// getParentsResponse constructs the CommitMetas of the parent commits of the given IDs
+func getParentsResponse(repo *models.Repository, parentIDs []string) []*structs.CommitMeta {
+	parents := make([]*structs.CommitMeta, 0, len(parentIDs))
+	for _, parentID := range parentIDs {
+		parents = append(parents, &structs.CommitMeta{
+			URL: repo.APIURL() + "/git/commits/" + parentID,
+			SHA: parentID,
+		})
+	}
+	return parents
+}
+
+// getCommitUser constructs a CommitUser from a commit signature
+func getCommitUser(sig *git.Signature) *structs.CommitUser {
+	return &structs.CommitUser{
+		Name:  sig.Name,
+		Email: sig.Email,
+		Date:  sig.When.UTC().Format(time.RFC3339),
+	}
+}
+
+// GetPayloadCommitVerification returns the GPG verification of a commit object
+func GetPayloadCommitVerification(commit *git.Commit) *gitea.PayloadCommitVerification {
+	verification := models.ParseCommitWithSignature(commit)
+	payloadVerification := &gitea.PayloadCommitVerification{
+		Verified: verification.Verified,
+		Reason:   verification.Reason,
+	}
+	if commit.Signature != nil {
+		payloadVerification.Signature = commit.Signature.Signature
+		payloadVerification.Payload = commit.Signature.Payload
+	}
+	return payloadVerification
+}
+
+// pushUpdate simulates the push event for a commit pushed from a temporary upload repository,
+// oldCommitID being git.EmptySHA if the branch was created by the push. It goes through the
+// same update as the post-receive hook of a real push: the activity of the watchers, the push
+// webhooks, the create webhooks of a new branch, the issue references and the indexer.
+func pushUpdate(repo *models.Repository, doer *models.User, branch, oldCommitID, commitHash string) error {
+	// PushUpdate would list the commits of the push from a wrong base without the old commit
+	if oldCommitID == "" || commitHash == "" {
+		return fmt.Errorf("pushUpdate: missing commit ID [old: %q, new: %q]", oldCommitID, commitHash)
+	}
+	if err := repo.GetOwner(); err != nil {
+		return fmt.Errorf("GetOwner: %v", err)
+	}
+	if err := models.PushUpdate(
+		branch,
+		models.PushUpdateOptions{
+			PusherID:     doer.ID,
+			PusherName:   doer.Name,
+			RepoUserName: repo.Owner.Name,
+			RepoName:     repo.Name,
+			RefFullName:  git.BranchPrefix + branch,
+			OldCommitID:  oldCommitID,
+			NewCommitID:  commitHash,
+		},
+	); err != nil {
+		return fmt.Errorf("PushUpdate: %v", err)
+	}
+	return nil
+}
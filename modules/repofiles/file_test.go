@@ -0,0 +1,192 @@
+// Copyright 2018 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/setting"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanUploadFileName(t *testing.T) {
+	var kases = map[string]string{
+		"./../../abc":     "abc",
+		"a/../../../abc":  "a/abc",
+		"../../../acd":    "acd",
+		"a\\b.c":          "a/b.c",
+		"a/b.c":           "a/b.c",
+		"a//b/./c":        "a/b/c",
+		".gitattributes":  ".gitattributes",
+		"docs/.gitignore": "docs/.gitignore",
+		".github/a.yml":   ".github/a.yml",
+		"a.git/b":         "a.git/b",
+		"git/b":           "git/b",
+		"git~2":           "git~2",
+		"..git":           "..git",
+		"CONFIG":          "CONFIG",
+		"console.log":     "console.log",
+		"a/COM10":         "a/COM10",
+		"nul_file":        "nul_file",
+		"":                "",
+		"./":              "",
+	}
+	for k, v := range kases {
+		assert.EqualValues(t, v, CleanUploadFileName(k), k)
+	}
+}
+
+func TestCleanUploadFileName_Rejected(t *testing.T) {
+	for _, name := range []string{
+		// Absolute paths
+		"/root/abc",
+		"\\root\\abc",
+		"\\\\server\\share\\abc",
+		"C:/abc",
+		"c:\\abc",
+		// Colons
+		"C:abc",
+		"a/b:c",
+		"abc:",
+		// Git directories
+		".git",
+		".git/refs/master",
+		".GIT/config",
+		"a/.git/config",
+		"../../.git/abc",
+		"..\\..\\.git/abc",
+		"a/../.git/config",
+		"dir/.Git",
+		".git\\hooks\\post-receive",
+		// Git directories as named by Windows, which drops trailing dots and spaces
+		".git./config",
+		".git /config",
+		".git. . /hooks/update",
+		"git~1/config",
+		"a/GIT~1/HEAD",
+		// Git directories as named by HFS+, which ignores some code points
+		".g\u200cit/config",
+		"\ufeff.git/config",
+		".gi\u206at/HEAD",
+		".git\u200d/config",
+		// Git directories as NTFS streams
+		".git::$INDEX_ALLOCATION/config",
+		"git~1:stream",
+		// Windows reserved names
+		"CON",
+		"nul",
+		"Aux.txt",
+		"con.tar.gz",
+		"a/PRN",
+		"a/COM1/b",
+		"lpt9",
+		"NUL ",
+	} {
+		assert.Empty(t, CleanUploadFileName(name), name)
+	}
+}
+
+func benchmarkContentReader(b *testing.B, newFile func(content []byte) *ChangeRepoFile) {
+	content := bytes.Repeat([]byte{0, 1, 2, 3, 4, 5, 6, 7}, 1<<17)
+	b.SetBytes(int64(len(content)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		reader, err := getContentReader(newFile(content))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := io.Copy(ioutil.Discard, reader); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkContentReader_Raw(b *testing.B) {
+	benchmarkContentReader(b, func(content []byte) *ChangeRepoFile {
+		return &ChangeRepoFile{ContentReader: bytes.NewReader(content)}
+	})
+}
+
+func BenchmarkContentReader_Base64(b *testing.B) {
+	benchmarkContentReader(b, func(content []byte) *ChangeRepoFile {
+		return &ChangeRepoFile{Content: base64.StdEncoding.EncodeToString(content), Encoding: "base64"}
+	})
+}
+
+func TestGetFileResponseFromCommit_Content(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	oldMaxDisplayFileSize := setting.UI.MaxDisplayFileSize
+	setting.UI.MaxDisplayFileSize = 1024
+	defer func() {
+		setting.UI.MaxDisplayFileSize = oldMaxDisplayFileSize
+	}()
+
+	for _, test := range []struct {
+		treePath string
+		content  []byte
+		encoding string
+		charset  string
+		expected string
+		tooLarge bool
+	}{
+		{"text.txt", []byte("héllo\n"), "text", "UTF-8", "héllo\n", false},
+		{"latin1.txt", []byte(strings.Repeat("d\xe9j\xe0 vu, caf\xe9 cr\xe8me\n", 10)), "text", "ISO-8859-1", strings.Repeat("déjà vu, café crème\n", 10), false},
+		{"binary.bin", []byte{0, 1, 2, 3}, "base64", "", "AAECAw==", false},
+		{"empty.txt", []byte{}, "text", "UTF-8", "", false},
+		{"limit.txt", bytes.Repeat([]byte("a"), 1024), "text", "UTF-8", strings.Repeat("a", 1024), false},
+		// Large files are described without their content, to be downloaded instead
+		{"large.txt", bytes.Repeat([]byte("a"), 1025), "text", "", "", true},
+		{"large.bin", bytes.Repeat([]byte{0}, 1025), "base64", "", "", true},
+	} {
+		fileResponse, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+			TreePath:      test.treePath,
+			ContentReader: bytes.NewReader(test.content),
+		})
+		assert.NoError(t, err)
+		assert.EqualValues(t, test.encoding, fileResponse.Content.Encoding, test.treePath)
+		assert.EqualValues(t, test.charset, fileResponse.Content.Charset, test.treePath)
+		assert.EqualValues(t, test.expected, fileResponse.Content.Content, test.treePath)
+		assert.EqualValues(t, test.tooLarge, fileResponse.Content.TooLarge, test.treePath)
+		assert.EqualValues(t, len(test.content), fileResponse.Content.Size, test.treePath)
+		assert.EqualValues(t, repo.HTMLURL()+"/raw/branch/master/"+test.treePath, fileResponse.Content.DownloadURL, test.treePath)
+	}
+}
+
+func TestGetFileResponseFromBlob(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "docs/notes.txt",
+		Content:  "héllo\n",
+	})
+	assert.NoError(t, err)
+	commit := getBranchCommit(t, repo, "master")
+	committed, err := GetFileResponseFromCommit(repo, commit, "master", "docs/notes.txt")
+	assert.NoError(t, err)
+
+	// The file is described the same way, but for what depends on the commit and the branch, and
+	// for the mode of the file which is only known to the tree
+	preview, err := GetFileResponseFromBlob(repo, "docs/notes.txt", committed.Content.SHA)
+	assert.NoError(t, err)
+	expected := *committed.Content
+	assert.EqualValues(t, "100644", expected.Mode)
+	expected.URL, expected.HTMLURL, expected.DownloadURL, expected.Mode = "", "", "", ""
+	assert.EqualValues(t, &expected, preview.Content)
+	assert.Nil(t, preview.Commit)
+	assert.Nil(t, preview.Verification)
+
+	_, err = GetFileResponseFromBlob(repo, "docs/notes.txt", "0123456789abcdef0123456789abcdef01234567")
+	assert.True(t, models.IsErrSHANotFound(err), "%v", err)
+}
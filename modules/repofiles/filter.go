@@ -0,0 +1,23 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"code.gitea.io/gitea/models"
+)
+
+// checkFilterDriver makes sure the driver of the given filter, which the attributes set for the
+// given path, is configured so that git hashes the content of the path cleaned by it. Git would
+// otherwise hash the content as it is without a word. The lfs filter is left to the LFS support.
+func checkFilterDriver(t *TemporaryUploadRepository, treePath, filter string) error {
+	switch filter {
+	case "unspecified", "unset", "set", "lfs":
+		return nil
+	}
+	if t.HasConfig("filter."+filter+".clean") || t.HasConfig("filter."+filter+".process") {
+		return nil
+	}
+	return models.ErrFilterUnavailable{Path: treePath, Filter: filter}
+}
@@ -0,0 +1,68 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"os"
+	"testing"
+
+	"code.gitea.io/gitea/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setGitConfigEnv configures git with the given variable through the environment until the returned
+// function is called
+func setGitConfigEnv(name, value string) func() {
+	vars := map[string]string{"GIT_CONFIG_COUNT": "1", "GIT_CONFIG_KEY_0": name, "GIT_CONFIG_VALUE_0": value}
+	oldVars := make(map[string]*string, len(vars))
+	for key, value := range vars {
+		if oldValue, ok := os.LookupEnv(key); ok {
+			oldVars[key] = &oldValue
+		} else {
+			oldVars[key] = nil
+		}
+		os.Setenv(key, value)
+	}
+	return func() {
+		for key, value := range oldVars {
+			if value != nil {
+				os.Setenv(key, *value)
+			} else {
+				os.Unsetenv(key)
+			}
+		}
+	}
+}
+
+func TestChangeRepoFiles_FilterDriver(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	defer setGitConfigEnv("filter.upper.clean", "tr a-z A-Z")()
+
+	pushTestFile(t, repo, doer, ".gitattributes", "*.up filter=upper\n*.none filter=missing\n*.set filter\n")
+	_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "shout.up", Content: "hello\n"},
+			{Operation: "create", TreePath: "plain.txt", Content: "hello\n"},
+			{Operation: "create", TreePath: "any.set", Content: "hello\n"},
+		},
+	})
+	assert.NoError(t, err)
+	// The content is committed as the clean filter leaves it
+	assert.EqualValues(t, "HELLO\n", getBranchFileContent(t, repo, "master", "shout.up"))
+	assert.EqualValues(t, "hello\n", getBranchFileContent(t, repo, "master", "plain.txt"))
+	assert.EqualValues(t, "hello\n", getBranchFileContent(t, repo, "master", "any.set"))
+
+	// Rather than as it is when the filter has no driver
+	commitsCount := getCommitsCount(t, repo, "master")
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{TreePath: "docs/file.none", Content: "hello\n"})
+	if assert.True(t, models.IsErrFilterUnavailable(err), "%v", err) {
+		assert.EqualValues(t, models.ErrFilterUnavailable{Path: "docs/file.none", Filter: "missing"}, err)
+	}
+	_, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{FromTreePath: "plain.txt", TreePath: "plain.none", Content: "hello\n"})
+	assert.True(t, models.IsErrFilterUnavailable(err), "%v", err)
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+)
+
+// checkForce makes sure the given doer may force-update the branch of the changes of the given
+// options, and has them committed on top of their LastCommitID rather than on top of the head of
+// the branch
+func checkForce(repo *models.Repository, doer *models.User, opts *ChangeRepoFilesOptions) error {
+	reason := ""
+	switch {
+	case repo.IsEmpty:
+		reason = "no branch to update"
+	case opts.CreateNewBranch:
+		reason = "new branch"
+	case opts.bulkChange != nil:
+		reason = "bulk change"
+	}
+	if reason == "" {
+		// Rewriting the history of a protected branch is never allowed
+		protectBranch, err := models.GetProtectedBranchBy(repo.ID, opts.NewBranch)
+		if err != nil {
+			return err
+		} else if protectBranch != nil {
+			reason = "protected branch"
+		}
+	}
+	if reason == "" {
+		// Discarding the commits pushed by others is up to the admins of the repository
+		perm, err := models.GetUserRepoPermission(repo, doer)
+		if err != nil {
+			return err
+		} else if !perm.IsAdmin() {
+			reason = "not a repository admin"
+		}
+	}
+	if reason != "" {
+		return models.ErrForceNotAllowed{BranchName: opts.NewBranch, Reason: reason}
+	}
+
+	// An amended commit only replaces the head commit it is made from
+	if opts.Amend || opts.LastCommitID == "" {
+		return nil
+	}
+	commitID, err := resolveCommitID(repo, opts.LastCommitID)
+	if err != nil {
+		return err
+	}
+	opts.LastCommitID = commitID
+	opts.baseCommitID = commitID
+	return nil
+}
+
+// forcePushBranch pushes the given commit of the temporary upload repository to the given branch in
+// place of its current head, returning the ID of the head it replaced
+func forcePushBranch(repo *models.Repository, t *TemporaryUploadRepository, doer *models.User, commitHash, branch string) (string, error) {
+	gitRepo, err := git.OpenRepository(repo.RepoPath())
+	if err != nil {
+		return "", err
+	}
+	headCommitID, err := gitRepo.GetBranchCommitID(branch)
+	if err != nil {
+		return "", err
+	}
+	// A head moving while pushing is not replaced unseen
+	return headCommitID, t.ForcePush(doer, commitHash, branch, headCommitID)
+}
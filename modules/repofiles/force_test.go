@@ -0,0 +1,105 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"testing"
+
+	"code.gitea.io/gitea/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemporaryUploadRepository_PushNotFastForward(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	treeID := getBranchCommit(t, repo, "master").Tree.ID.String()
+	developCommitID := getBranchCommit(t, repo, "develop").ID.String()
+
+	tmp, err := NewTemporaryUploadRepository(repo)
+	assert.NoError(t, err)
+	defer tmp.Close()
+	assert.NoError(t, tmp.Checkout("develop"))
+	sig := doer.NewGitSig()
+	commitHash, err := tmp.CommitTreeWithParents(sig, sig, treeID, "Not on top of develop", "", nil)
+	assert.NoError(t, err)
+
+	// The head of the branch isn't replaced by a commit not descending from it
+	err = tmp.Push(doer, commitHash, "develop")
+	if assert.True(t, models.IsErrNotFastForward(err), "%v", err) {
+		assert.EqualValues(t, models.ErrNotFastForward{BranchName: "develop"}, err)
+	}
+	assert.EqualValues(t, developCommitID, getBranchCommit(t, repo, "develop").ID.String())
+
+	assert.NoError(t, tmp.ForcePush(doer, commitHash, "develop", developCommitID))
+	assert.EqualValues(t, commitHash, getBranchCommit(t, repo, "develop").ID.String())
+}
+
+func TestChangeRepoFiles_Force(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	lastCommitID := getBranchCommit(t, repo, "master").ID.String()
+	pushTestFile(t, repo, doer, "concurrent.txt", "concurrent\n")
+	opts := &ChangeRepoFilesOptions{
+		CommitOptions: CommitOptions{LastCommitID: lastCommitID},
+		Files:         []*ChangeRepoFile{{Operation: "create", TreePath: "forced.txt", Content: "forced\n"}},
+	}
+
+	// The concurrent commit isn't discarded unless forced
+	_, err := ChangeRepoFiles(repo, doer, opts)
+	assert.True(t, models.IsErrCommitIDDoesNotMatch(err), "%v", err)
+
+	opts.Force = true
+	filesResponse, err := ChangeRepoFiles(repo, doer, opts)
+	assert.NoError(t, err)
+	headCommit := getBranchCommit(t, repo, "master")
+	assert.EqualValues(t, headCommit.ID.String(), filesResponse.Commit.SHA)
+	parentID, err := headCommit.ParentID(0)
+	assert.NoError(t, err)
+	assert.EqualValues(t, lastCommitID, parentID.String())
+	assert.EqualValues(t, "forced\n", getBranchFileContent(t, repo, "master", "forced.txt"))
+	_, err = GetRepoFileContent(repo, "master", "concurrent.txt", false)
+	assert.True(t, models.IsErrRepoFileDoesNotExist(err), "%v", err)
+
+	// Protected branches are never forced
+	assert.NoError(t, models.UpdateProtectBranch(repo, &models.ProtectedBranch{
+		RepoID:     repo.ID,
+		BranchName: "develop",
+		CanPush:    true,
+	}, models.WhitelistOptions{}))
+	commitsCount := getCommitsCount(t, repo, "develop")
+	_, err = ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		CommitOptions: CommitOptions{OldBranch: "develop", Force: true},
+		Files:         []*ChangeRepoFile{{Operation: "create", TreePath: "forced.txt", Content: "forced\n"}},
+	})
+	if assert.True(t, models.IsErrForceNotAllowed(err), "%v", err) {
+		assert.EqualValues(t, models.ErrForceNotAllowed{BranchName: "develop", Reason: "protected branch"}, err)
+	}
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "develop"))
+}
+
+func TestChangeRepoFiles_ForceNotAdmin(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	writer := models.AssertExistsAndLoadBean(t, &models.User{ID: 4}).(*models.User)
+	assert.NoError(t, repo.GetOwner())
+	assert.NoError(t, repo.AddCollaborator(writer))
+
+	headCommitID := getBranchCommit(t, repo, "master").ID.String()
+	_, err := ChangeRepoFiles(repo, writer, &ChangeRepoFilesOptions{
+		CommitOptions: CommitOptions{Force: true},
+		Files:         []*ChangeRepoFile{{Operation: "create", TreePath: "forced.txt", Content: "forced\n"}},
+	})
+	if assert.True(t, models.IsErrForceNotAllowed(err), "%v", err) {
+		assert.EqualValues(t, models.ErrForceNotAllowed{BranchName: "master", Reason: "not a repository admin"}, err)
+	}
+	assert.EqualValues(t, headCommitID, getBranchCommit(t, repo, "master").ID.String())
+
+	// The writer may still push on top of the branch
+	_, err = ChangeRepoFiles(repo, writer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{{Operation: "create", TreePath: "forced.txt", Content: "forced\n"}},
+	})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,116 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/process"
+	"code.gitea.io/gitea/modules/structs"
+)
+
+// ChangeRepoFilesOnForkOptions holds the options to commit file changes of a repository to a fork of it
+type ChangeRepoFilesOnForkOptions struct {
+	// Fork is the fork of the repository, owned by the doer, the changes are committed to
+	Fork *models.Repository
+	// ChangeRepoFilesOptions are the changes, made on top of OldBranch of the repository, its default
+	// branch when empty, which LastCommitID is checked against. They are committed to NewBranch of the
+	// fork, a new branch which is "<doer>-patch-<n>" when empty. CreatePullRequest opens a pull request
+	// of that branch into OldBranch at once; CreateNewBranch and TemporaryRepository are ignored.
+	ChangeRepoFilesOptions
+}
+
+// ChangeRepoFilesOnFork commits the given file operations on a branch of the repository to a new
+// branch of the fork of the doer, as ChangeRepoFiles does, for a doer who may not write to the
+// repository to propose the changes from the fork. The commit of the branch is fetched into the
+// fork first, so that the changes are made on top of it even if the fork is behind.
+func ChangeRepoFilesOnFork(repo *models.Repository, doer *models.User, opts *ChangeRepoFilesOnForkOptions) (*structs.FilesResponse, error) {
+	fork := opts.Fork
+	if fork == nil {
+		return nil, fmt.Errorf("no fork")
+	} else if !fork.IsFork || fork.ForkID != repo.ID {
+		return nil, models.ErrForkNotAllowed{ForkName: fork.FullName(), UserName: doer.Name, Reason: "not a fork of " + repo.FullName()}
+	} else if fork.OwnerID != doer.ID {
+		return nil, models.ErrForkNotAllowed{ForkName: fork.FullName(), UserName: doer.Name, Reason: "not owned by the user"}
+	}
+	// The commits of the repository are fetched into the fork and proposed to it, which the doer has
+	// to be able to read and propose pull requests to
+	perm, err := models.GetUserRepoPermission(repo, doer)
+	if err != nil {
+		return nil, err
+	} else if !perm.CanRead(models.UnitTypeCode) {
+		return nil, models.ErrUserDoesNotHaveAccessToRepo{UserID: doer.ID, RepoName: repo.LowerName}
+	} else if opts.CreatePullRequest && !perm.CanRead(models.UnitTypePullRequests) {
+		return nil, models.ErrForkNotAllowed{ForkName: fork.FullName(), UserName: doer.Name, Reason: "pull requests not allowed to " + repo.FullName()}
+	}
+	if repo.IsEmpty {
+		return nil, models.ErrRepoIsEmpty{RepoName: repo.FullName()}
+	}
+
+	changeOpts := opts.ChangeRepoFilesOptions
+	baseBranch := changeOpts.OldBranch
+	if baseBranch == "" {
+		baseBranch = repo.DefaultBranch
+	}
+	gitRepo, err := git.OpenRepository(repo.RepoPath())
+	if err != nil {
+		return nil, err
+	}
+	baseCommitID, err := gitRepo.GetBranchCommitID(baseBranch)
+	if git.IsErrNotExist(err) {
+		return nil, models.ErrBranchNotExist{Name: baseBranch}
+	} else if err != nil {
+		return nil, err
+	}
+	if err := fetchCommit(fork, repo, baseCommitID); err != nil {
+		return nil, err
+	}
+
+	if changeOpts.NewBranch == "" {
+		if changeOpts.NewBranch, err = getUniquePatchBranchName(fork, doer); err != nil {
+			return nil, err
+		}
+	}
+	// The new branch of the fork starts from the commit rather than from a branch of the fork
+	changeOpts.OldBranch = baseCommitID
+	changeOpts.CreateNewBranch = true
+	changeOpts.CreatePullRequest = false
+	changeOpts.TemporaryRepository = nil
+	filesResponse, err := ChangeRepoFiles(fork, doer, &changeOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.CreatePullRequest && !opts.DryRun {
+		message := strings.TrimSpace(filesResponse.Commit.Message)
+		if filesResponse.PullRequestNumber, err = createPullRequest(repo, fork, doer, baseBranch, changeOpts.NewBranch, baseCommitID, message); err != nil {
+			return nil, err
+		}
+	}
+	return filesResponse, nil
+}
+
+// fetchCommit fetches the given commit of the given repository into the given fork, without any
+// ref pointing to it there, unless the fork already has it
+func fetchCommit(fork, repo *models.Repository, commitID string) error {
+	if _, err := resolveCommitID(fork, commitID); err == nil {
+		return nil
+	} else if !models.IsErrCommitNotExist(err) {
+		return err
+	}
+	// The commit may no longer be the head of a branch, once fetched by the ID it was resolved to
+	if _, stderr, err := process.GetManager().ExecDir(5*time.Minute,
+		fork.RepoPath(),
+		fmt.Sprintf("fetchCommit (git fetch %s %s): %s", repo.RepoPath(), commitID, fork.RepoPath()),
+		"git", "fetch", "--no-tags", "--quiet", "--upload-pack=git -c uploadpack.allowAnySHA1InWant=true upload-pack",
+		repo.RepoPath(), commitID); err != nil {
+		return fmt.Errorf("fetchCommit: %v %s", err, stderr)
+	}
+	return nil
+}
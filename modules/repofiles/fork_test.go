@@ -0,0 +1,143 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeRepoFilesOnFork(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	owner := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 4}).(*models.User)
+	fork, err := models.ForkRepository(doer, doer, repo, repo.Name, "")
+	assert.NoError(t, err)
+	assert.NoError(t, os.RemoveAll(filepath.Join(fork.RepoPath(), "hooks")))
+
+	// The fork is behind the repository, whose branch the changes are made on top of
+	pushTestFile(t, repo, owner, "since-fork.txt", "new")
+	masterCommit := getBranchCommit(t, repo, "master")
+	filesResponse, err := ChangeRepoFilesOnFork(repo, doer, &ChangeRepoFilesOnForkOptions{
+		Fork: fork,
+		ChangeRepoFilesOptions: ChangeRepoFilesOptions{
+			CommitOptions: CommitOptions{
+				LastCommitID:      masterCommit.ID.String(),
+				Message:           "Fix the README\n\nFrom my fork.",
+				CreatePullRequest: true,
+			},
+			Files: []*ChangeRepoFile{{Operation: "update", TreePath: "README.md", Content: "# repo1\n\nFixed\n"}},
+		},
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, filesResponse.Commit.SHA, getBranchCommit(t, fork, "user4-patch-1").ID.String())
+	assert.EqualValues(t, "# repo1\n\nFixed\n", getBranchFileContent(t, fork, "user4-patch-1", "README.md"))
+	assert.EqualValues(t, "new", getBranchFileContent(t, fork, "user4-patch-1", "since-fork.txt"))
+	if assert.Len(t, filesResponse.Commit.Parents, 1) {
+		assert.EqualValues(t, masterCommit.ID.String(), filesResponse.Commit.Parents[0].SHA)
+	}
+	// Nothing is committed to the repository itself
+	gitRepo, err := git.OpenRepository(repo.RepoPath())
+	assert.NoError(t, err)
+	assert.False(t, gitRepo.IsBranchExist("user4-patch-1"))
+	assert.EqualValues(t, masterCommit.ID, getBranchCommit(t, repo, "master").ID)
+
+	pr, err := models.GetPullRequestByIndex(repo.ID, filesResponse.PullRequestNumber)
+	assert.NoError(t, err)
+	assert.NoError(t, pr.LoadIssue())
+	assert.EqualValues(t, fork.ID, pr.HeadRepoID)
+	assert.EqualValues(t, "user4", pr.HeadUserName)
+	assert.EqualValues(t, "user4-patch-1", pr.HeadBranch)
+	assert.EqualValues(t, "master", pr.BaseBranch)
+	assert.EqualValues(t, "Fix the README", pr.Issue.Title)
+	assert.EqualValues(t, "From my fork.", pr.Issue.Content)
+	headCommitID, err := gitRepo.GetRefCommitID(pr.GetGitRefName())
+	assert.NoError(t, err)
+	assert.EqualValues(t, filesResponse.Commit.SHA, headCommitID)
+
+	// A named branch of the fork is committed to without a pull request
+	_, err = ChangeRepoFilesOnFork(repo, doer, &ChangeRepoFilesOnForkOptions{
+		Fork: fork,
+		ChangeRepoFilesOptions: ChangeRepoFilesOptions{
+			CommitOptions: CommitOptions{OldBranch: "develop", NewBranch: "from-develop"},
+			Files:         []*ChangeRepoFile{{Operation: "create", TreePath: "develop.txt", Content: "develop"}},
+		},
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "develop", getBranchFileContent(t, fork, "from-develop", "develop.txt"))
+
+	// Only the forks of the repository owned by the doer are committed to
+	for _, test := range []struct {
+		doer *models.User
+		fork *models.Repository
+	}{
+		{owner, fork},
+		{doer, repo},
+	} {
+		_, err = ChangeRepoFilesOnFork(repo, test.doer, &ChangeRepoFilesOnForkOptions{
+			Fork: test.fork,
+			ChangeRepoFilesOptions: ChangeRepoFilesOptions{
+				CommitOptions: CommitOptions{NewBranch: "not-allowed"},
+				Files:         []*ChangeRepoFile{{Operation: "create", TreePath: "no.txt", Content: "no"}},
+			},
+		})
+		assert.True(t, models.IsErrForkNotAllowed(err), "%v", err)
+	}
+	forkRepo, err := git.OpenRepository(fork.RepoPath())
+	assert.NoError(t, err)
+	assert.False(t, forkRepo.IsBranchExist("not-allowed"))
+}
+
+func TestChangeRepoFilesOnFork_NoAccess(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 4}).(*models.User)
+	fork, err := models.ForkRepository(doer, doer, repo, repo.Name, "")
+	assert.NoError(t, err)
+	assert.NoError(t, os.RemoveAll(filepath.Join(fork.RepoPath(), "hooks")))
+	forkRepo, err := git.OpenRepository(fork.RepoPath())
+	assert.NoError(t, err)
+
+	changeOnFork := func(newBranch string, createPullRequest bool) error {
+		_, err := ChangeRepoFilesOnFork(repo, doer, &ChangeRepoFilesOnForkOptions{
+			Fork: fork,
+			ChangeRepoFilesOptions: ChangeRepoFilesOptions{
+				CommitOptions: CommitOptions{
+					NewBranch:         newBranch,
+					CreatePullRequest: createPullRequest,
+				},
+				Files: []*ChangeRepoFile{{Operation: "create", TreePath: "no.txt", Content: "no"}},
+			},
+		})
+		return err
+	}
+
+	// Pull requests are only proposed to a repository accepting them
+	var units []models.RepoUnit
+	for _, unit := range repo.Units {
+		if unit.Type != models.UnitTypePullRequests {
+			units = append(units, *unit)
+		}
+	}
+	assert.NoError(t, models.UpdateRepositoryUnits(repo, units))
+	repo = models.AssertExistsAndLoadBean(t, &models.Repository{ID: repo.ID}).(*models.Repository)
+	err = changeOnFork("no-pulls", true)
+	if assert.True(t, models.IsErrForkNotAllowed(err), "%v", err) {
+		assert.EqualValues(t, "pull requests not allowed to user2/repo1", err.(models.ErrForkNotAllowed).Reason)
+	}
+	assert.False(t, forkRepo.IsBranchExist("no-pulls"))
+
+	// Nothing is fetched from a repository the doer can no longer read
+	repo.IsPrivate = true
+	assert.NoError(t, models.UpdateRepository(repo, true))
+	err = changeOnFork("no-access", false)
+	assert.True(t, models.IsErrUserDoesNotHaveAccessToRepo(err), "%v", err)
+	assert.False(t, forkRepo.IsBranchExist("no-access"))
+}
@@ -0,0 +1,121 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"path"
+	"sync"
+
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/base"
+)
+
+// Formatter returns the given content of the file at the given tree path formatted, or the error
+// explaining why it can't be, such as a syntax error
+type Formatter func(treePath string, content []byte) ([]byte, error)
+
+var (
+	formattersLock sync.RWMutex
+	formatters     = map[string]Formatter{
+		"gofmt": formatGo,
+	}
+)
+
+// RegisterFormatter makes a formatter available to the repositories under the given name, in
+// place of any formatter registered under that name before. It may be called at any time.
+func RegisterFormatter(name string, formatter Formatter) {
+	if formatter == nil {
+		panic("repofiles: RegisterFormatter formatter is nil")
+	}
+	formattersLock.Lock()
+	defer formattersLock.Unlock()
+	formatters[name] = formatter
+}
+
+// getFormatter returns the formatter registered under the given name, if any
+func getFormatter(name string) (Formatter, bool) {
+	formattersLock.RLock()
+	defer formattersLock.RUnlock()
+	formatter, ok := formatters[name]
+	return formatter, ok
+}
+
+// formatGo formats Go source code as gofmt does
+func formatGo(treePath string, content []byte) ([]byte, error) {
+	return format.Source(content)
+}
+
+// formatContent formats the content of the given prepared file with the formatter the given
+// repository has for the extension of its path, if any, then normalizes its trailing whitespace
+// as the policy of the repository requires, so that it is committed formatted. The content is
+// read in memory to be formatted, and checked to parse when the repository validates data files.
+func formatContent(repo *models.Repository, file *ChangeRepoFile) error {
+	name, hasFormatter := repo.Formatters[path.Ext(file.treePath)]
+	validate := repo.ValidateDataFiles && dataFileFormat(file.treePath) != ""
+	if !hasFormatter && repo.TrailingWhitespacePolicy == models.TrailingWhitespaceKeep && !validate {
+		return nil
+	}
+	formatter, ok := getFormatter(name)
+	if hasFormatter && !ok {
+		return fmt.Errorf("unknown formatter: %s", name)
+	}
+
+	content, err := ioutil.ReadAll(&sizeLimitedReader{r: file.content, path: file.treePath, maxSize: maxFileSize(repo, false)})
+	if err != nil {
+		return err
+	}
+	if hasFormatter {
+		if content, err = formatter(file.treePath, content); err != nil {
+			return models.ErrFormatFailed{Path: file.treePath, Formatter: name, Output: err.Error()}
+		}
+	}
+	content = normalizeTrailingWhitespace(repo.TrailingWhitespacePolicy, content)
+	if validate {
+		if err := validateDataFile(file.treePath, content); err != nil {
+			return err
+		}
+	}
+	file.content = bytes.NewReader(content)
+	return nil
+}
+
+// normalizeTrailingWhitespace returns the given content normalized as the given policy requires,
+// binary content being returned as it is. The line endings of the content are kept.
+func normalizeTrailingWhitespace(policy models.TrailingWhitespacePolicy, content []byte) []byte {
+	if policy == models.TrailingWhitespaceKeep || !base.IsTextFile(content) {
+		return content
+	}
+	switch policy {
+	case models.TrailingWhitespaceSingleNewline:
+		if len(content) == 0 {
+			return content
+		}
+		newline := "\n"
+		if i := bytes.IndexByte(content, '\n'); i > 0 && content[i-1] == '\r' {
+			newline = "\r\n"
+		}
+		trimmed := bytes.TrimRight(content, "\r\n")
+		return append(trimmed[:len(trimmed):len(trimmed)], newline...)
+	case models.TrailingWhitespaceStrip:
+		normalized := bytes.NewBuffer(make([]byte, 0, len(content)))
+		for _, line := range bytes.SplitAfter(content, []byte("\n")) {
+			end := len(line)
+			if end > 0 && line[end-1] == '\n' {
+				end--
+				if end > 0 && line[end-1] == '\r' {
+					end--
+				}
+			}
+			normalized.Write(bytes.TrimRight(line[:end], " \t"))
+			normalized.Write(line[end:])
+		}
+		return normalized.Bytes()
+	}
+	return content
+}
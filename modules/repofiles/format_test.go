@@ -0,0 +1,122 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"strings"
+	"testing"
+
+	"code.gitea.io/gitea/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeRepoFiles_Formatters(t *testing.T) {
+	// A nil formatter is refused when registered rather than when changes are committed
+	assert.Panics(t, func() { RegisterFormatter("nil", nil) })
+
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	RegisterFormatter("upper", func(treePath string, content []byte) ([]byte, error) {
+		return []byte(strings.ToUpper(string(content))), nil
+	})
+	defer delete(formatters, "upper")
+
+	// The files are committed as they are until the repository has formatters
+	badlyIndented := "package main\nfunc main() {\nprintln( \"hello\" )\n}\n"
+	pushTestFile(t, repo, doer, "as-is.go", badlyIndented)
+	assert.EqualValues(t, badlyIndented, getBranchFileContent(t, repo, "master", "as-is.go"))
+
+	repo.Formatters = map[string]string{".go": "gofmt", ".txt": "upper"}
+	assert.NoError(t, models.UpdateRepository(repo, false))
+	_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "cmd/main.go", Content: badlyIndented},
+			{Operation: "update", TreePath: "as-is.go", Content: badlyIndented + "\n\n"},
+			{Operation: "create", TreePath: "notes.txt", Content: "shout\n"},
+			{Operation: "create", TreePath: "notes.md", Content: "plain\n"},
+		},
+	})
+	assert.NoError(t, err)
+	formatted := "package main\n\nfunc main() {\n\tprintln(\"hello\")\n}\n"
+	assert.EqualValues(t, formatted, getBranchFileContent(t, repo, "master", "cmd/main.go"))
+	assert.EqualValues(t, formatted, getBranchFileContent(t, repo, "master", "as-is.go"))
+	assert.EqualValues(t, "SHOUT\n", getBranchFileContent(t, repo, "master", "notes.txt"))
+	assert.EqualValues(t, "plain\n", getBranchFileContent(t, repo, "master", "notes.md"))
+
+	// Content the formatter fails on is not committed
+	commitsCount := getCommitsCount(t, repo, "master")
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "broken.go",
+		Content:  "package main\nfunc main() {\n",
+	})
+	if assert.True(t, models.IsErrFormatFailed(err), "%v", err) {
+		formatErr := err.(models.ErrFormatFailed)
+		assert.EqualValues(t, "broken.go", formatErr.Path)
+		assert.EqualValues(t, "gofmt", formatErr.Formatter)
+		assert.Contains(t, formatErr.Output, "expected '}'")
+	}
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+}
+
+func TestChangeRepoFiles_TrailingWhitespacePolicy(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	binary := "\x00\x01binary  \n\n"
+	for _, test := range []struct {
+		policy  models.TrailingWhitespacePolicy
+		content map[string]string
+	}{
+		{
+			policy: models.TrailingWhitespaceSingleNewline,
+			content: map[string]string{
+				"compliant.txt": "line  \nend\n",
+				"missing.txt":   "line\nend",
+				"extra.txt":     "line\nend\n\n\r\n",
+				"crlf.txt":      "line\r\nend",
+				"empty.txt":     "",
+				"binary.bin":    binary,
+			},
+		},
+		{
+			policy: models.TrailingWhitespaceStrip,
+			content: map[string]string{
+				"compliant.txt": "line\nend\n\n",
+				"missing.txt":   "line \t\nend  ",
+				"extra.txt":     "line  \n \nend\n",
+				"crlf.txt":      "line \r\nend\t\r\n",
+				"empty.txt":     "",
+				"binary.bin":    binary,
+			},
+		},
+	} {
+		repo.TrailingWhitespacePolicy = test.policy
+		assert.NoError(t, models.UpdateRepository(repo, false))
+		branch := string(test.policy)
+		files := make([]*ChangeRepoFile, 0, len(test.content))
+		for treePath, content := range test.content {
+			files = append(files, &ChangeRepoFile{Operation: "create", TreePath: treePath, Content: content})
+		}
+		_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+			CommitOptions: CommitOptions{
+				OldBranch:       "master",
+				NewBranch:       branch,
+				CreateNewBranch: true,
+			},
+			Files: files,
+		})
+		assert.NoError(t, err, branch)
+		assert.EqualValues(t, test.content["compliant.txt"], getBranchFileContent(t, repo, branch, "compliant.txt"), branch)
+		assert.EqualValues(t, "", getBranchFileContent(t, repo, branch, "empty.txt"), branch)
+		assert.EqualValues(t, binary, getBranchFileContent(t, repo, branch, "binary.bin"), branch)
+	}
+	assert.EqualValues(t, "line\nend\n", getBranchFileContent(t, repo, "single-newline", "missing.txt"))
+	assert.EqualValues(t, "line\nend\n", getBranchFileContent(t, repo, "single-newline", "extra.txt"))
+	assert.EqualValues(t, "line\r\nend\r\n", getBranchFileContent(t, repo, "single-newline", "crlf.txt"))
+	assert.EqualValues(t, "line\nend", getBranchFileContent(t, repo, "strip", "missing.txt"))
+	assert.EqualValues(t, "line\n\nend\n", getBranchFileContent(t, repo, "strip", "extra.txt"))
+	assert.EqualValues(t, "line\r\nend\r\n", getBranchFileContent(t, repo, "strip", "crlf.txt"))
+}
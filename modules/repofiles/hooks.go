@@ -0,0 +1,59 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"fmt"
+	"sync"
+
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/log"
+)
+
+// PreCommitHook is called with the temporary upload repository once the file operations are
+// staged in its index, before the tree is written. It may inspect and modify the index, an
+// error aborts the operation.
+type PreCommitHook func(repo *models.Repository, doer *models.User, t *TemporaryUploadRepository, opts *ChangeRepoFilesOptions) error
+
+var (
+	preCommitHooksLock sync.RWMutex
+	preCommitHooks     []PreCommitHook
+)
+
+// RegisterPreCommitHook adds a hook called before every change made through ChangeRepoFiles.
+// Hooks are called in the order they are registered, which may be at any time.
+func RegisterPreCommitHook(hook PreCommitHook) {
+	if hook == nil {
+		panic("repofiles: RegisterPreCommitHook hook is nil")
+	}
+	preCommitHooksLock.Lock()
+	defer preCommitHooksLock.Unlock()
+	preCommitHooks = append(preCommitHooks, hook)
+}
+
+// getPreCommitHooks returns the hooks registered so far
+func getPreCommitHooks() []PreCommitHook {
+	preCommitHooksLock.RLock()
+	defer preCommitHooksLock.RUnlock()
+	return preCommitHooks
+}
+
+// runPreCommitHooks calls the registered hooks, turning a panic into an error so the
+// operation is aborted like any other failure of a hook
+func runPreCommitHooks(repo *models.Repository, doer *models.User, t *TemporaryUploadRepository, opts *ChangeRepoFilesOptions) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error(4, "PreCommitHook panicked for %s: %v", repo.FullName(), r)
+			err = fmt.Errorf("pre-commit hook panicked: %v", r)
+		}
+	}()
+
+	for _, hook := range getPreCommitHooks() {
+		if err := hook(repo, doer, t, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
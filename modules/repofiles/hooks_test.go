@@ -0,0 +1,92 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setPreCommitHooks(hooks ...PreCommitHook) func() {
+	oldHooks := preCommitHooks
+	preCommitHooks = nil
+	for _, hook := range hooks {
+		RegisterPreCommitHook(hook)
+	}
+	return func() {
+		preCommitHooks = oldHooks
+	}
+}
+
+func TestChangeRepoFiles_PreCommitHook(t *testing.T) {
+	// A nil hook is refused when registered rather than when changes are committed
+	assert.Panics(t, func() { RegisterPreCommitHook(nil) })
+
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	// The hook sees the staged files and may stage more
+	var stagedFiles []string
+	defer setPreCommitHooks(func(repo *models.Repository, doer *models.User, t *TemporaryUploadRepository, opts *ChangeRepoFilesOptions) error {
+		var err error
+		if stagedFiles, err = t.LsFiles(); err != nil {
+			return err
+		}
+		objectHash, err := t.HashObject("", bytes.NewReader([]byte("checked")))
+		if err != nil {
+			return err
+		}
+		return t.AddObjectToIndex("100644", objectHash, "CHECKED")
+	})()
+
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "a.txt",
+		Content:  "a",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, []string{"README.md", "a.txt"}, stagedFiles)
+	assert.EqualValues(t, "checked", getBranchFileContent(t, repo, "master", "CHECKED"))
+}
+
+func TestChangeRepoFiles_PreCommitHookAborts(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	var basePath string
+	for _, hook := range []PreCommitHook{
+		func(repo *models.Repository, doer *models.User, t *TemporaryUploadRepository, opts *ChangeRepoFilesOptions) error {
+			basePath = t.BasePath()
+			return fmt.Errorf("lint failed")
+		},
+		func(repo *models.Repository, doer *models.User, t *TemporaryUploadRepository, opts *ChangeRepoFilesOptions) error {
+			basePath = t.BasePath()
+			panic("lint crashed")
+		},
+	} {
+		restore := setPreCommitHooks(hook)
+		_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+			TreePath: "a.txt",
+			Content:  "a",
+		})
+		restore()
+		assert.Error(t, err)
+
+		// The temporary upload repository is cleaned up all the same
+		assert.NotEmpty(t, basePath)
+		_, err = os.Stat(basePath)
+		assert.True(t, os.IsNotExist(err))
+	}
+
+	stdout, err := git.NewCommand("ls-tree", "--name-only", "master").RunInDir(repo.RepoPath())
+	assert.NoError(t, err)
+	assert.EqualValues(t, "README.md\n", stdout)
+}
@@ -0,0 +1,286 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/log"
+	"code.gitea.io/gitea/modules/setting"
+	"code.gitea.io/gitea/modules/structs"
+	"code.gitea.io/gitea/modules/sync"
+)
+
+// idempotencyKeyMaxLength is the length of the longest idempotency key accepted
+const idempotencyKeyMaxLength = 255
+
+// idempotencyKeysPool makes the changes given the same idempotency key one after the other,
+// so that a retry made while the first changes are still being committed waits for their response
+var idempotencyKeysPool = sync.NewExclusivePool()
+
+// idempotencyRequest is what the hash of the changes given an idempotency key is computed from
+type idempotencyRequest struct {
+	LastCommitID      string
+	OldBranch         string
+	NewBranch         string
+	CreateNewBranch   bool
+	Message           string
+	Files             []*idempotencyRequestFile
+	Author            *IdentityOptions
+	Committer         *IdentityOptions
+	PathPrefix        string
+	AuthorDate        string
+	CommitterDate     string
+	CreatePullRequest bool
+	IncludeDiff       bool
+	AdditionalParents []string
+	AllowEmptyCommit  bool
+	Amend             bool
+	Force             bool
+	AuthorTrailer     string
+	CoAuthors         []IdentityOptions
+	Signoff           bool
+	SigningKeyID      string
+}
+
+// idempotencyRequestFile is a file operation of an idempotencyRequest, the content given by a
+// reader being hashed as ContentReaderSHA256
+type idempotencyRequestFile struct {
+	Operation           string
+	TreePath            string
+	FromTreePath        string
+	ContentReaderSHA256 string
+	Content             string
+	Encoding            string
+	Charset             string
+	BOM                 bool
+	ContentURL          string
+	ContentSourceRepo   int64
+	ContentSourceRef    string
+	ContentSourcePath   string
+	Patch               string
+	SHA                 string
+	ContentSHA          string
+	Overwrite           bool
+	Mode                string
+	Symlink             bool
+	RejectIgnored       bool
+	RemoveSubmodule     bool
+}
+
+// newIdempotencyRequest returns the request of the given options, as they are before their changes
+// are committed, without the hashes of the content readers
+func newIdempotencyRequest(opts *ChangeRepoFilesOptions) *idempotencyRequest {
+	request := &idempotencyRequest{
+		LastCommitID:      opts.LastCommitID,
+		OldBranch:         opts.OldBranch,
+		NewBranch:         opts.NewBranch,
+		CreateNewBranch:   opts.CreateNewBranch,
+		Message:           opts.Message,
+		Files:             make([]*idempotencyRequestFile, 0, len(opts.Files)),
+		Author:            opts.Author,
+		Committer:         opts.Committer,
+		PathPrefix:        opts.PathPrefix,
+		AuthorDate:        opts.AuthorDate,
+		CommitterDate:     opts.CommitterDate,
+		CreatePullRequest: opts.CreatePullRequest,
+		IncludeDiff:       opts.IncludeDiff,
+		AdditionalParents: opts.AdditionalParents,
+		AllowEmptyCommit:  opts.AllowEmptyCommit,
+		Amend:             opts.Amend,
+		Force:             opts.Force,
+		AuthorTrailer:     opts.AuthorTrailer,
+		CoAuthors:         opts.CoAuthors,
+		Signoff:           opts.Signoff,
+		SigningKeyID:      opts.SigningKeyID,
+	}
+	for _, file := range opts.Files {
+		requestFile := &idempotencyRequestFile{
+			Operation:       file.Operation,
+			TreePath:        file.TreePath,
+			FromTreePath:    file.FromTreePath,
+			Content:         file.Content,
+			Encoding:        file.Encoding,
+			Charset:         file.Charset,
+			BOM:             file.BOM,
+			ContentURL:      file.ContentURL,
+			Patch:           file.Patch,
+			SHA:             file.SHA,
+			ContentSHA:      file.ContentSHA,
+			Overwrite:       file.Overwrite,
+			Mode:            file.Mode,
+			Symlink:         file.Symlink,
+			RejectIgnored:   file.RejectIgnored,
+			RemoveSubmodule: file.RemoveSubmodule,
+		}
+		if file.ContentSource != nil {
+			if file.ContentSource.Repo != nil {
+				requestFile.ContentSourceRepo = file.ContentSource.Repo.ID
+			}
+			requestFile.ContentSourceRef = file.ContentSource.Ref
+			requestFile.ContentSourcePath = file.ContentSource.TreePath
+		}
+		request.Files = append(request.Files, requestFile)
+	}
+	return request
+}
+
+// hash returns the hash of the request, once the hashes of its content readers are set
+func (request *idempotencyRequest) hash() (string, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return "", fmt.Errorf("Marshal: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// hashingReader is a content reader of a file to change, hashing the content as it is read
+type hashingReader struct {
+	r    io.Reader
+	hash hash.Hash
+}
+
+func (r *hashingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.hash.Write(p[:n])
+	return n, err
+}
+
+// sum reads what is left of the content and returns the hash of all of it
+func (r *hashingReader) sum() (string, error) {
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(r.hash.Sum(nil)), nil
+}
+
+// hashContentReaders makes the content readers of the given files hash their content as the changes
+// read it. The returned function puts the readers given back in place once the changes are made and,
+// if asked to, sets the hashes of the whole content of each in the given request, reading what the
+// changes left of it.
+func hashContentReaders(request *idempotencyRequest, files []*ChangeRepoFile) func(sum bool) error {
+	readers := make(map[int]*hashingReader, len(files))
+	originals := make(map[int]io.Reader, len(files))
+	for i, file := range files {
+		if file.ContentReader != nil {
+			originals[i] = file.ContentReader
+			readers[i] = &hashingReader{r: file.ContentReader, hash: sha256.New()}
+			file.ContentReader = readers[i]
+		}
+	}
+	return func(sum bool) error {
+		for i, reader := range readers {
+			files[i].ContentReader = originals[i]
+			if !sum {
+				continue
+			}
+			contentSHA, err := reader.sum()
+			if err != nil {
+				return fmt.Errorf("hashContentReaders: %v", err)
+			}
+			request.Files[i].ContentReaderSHA256 = contentSHA
+		}
+		return nil
+	}
+}
+
+// changeRepoFilesOnce commits the changes of the given options, unless the doer already had the
+// same changes with the same idempotency key committed to the new branch: their response is returned
+// then. The key given to other changes fails with ErrIdempotencyKeyConflict. The keys are forgotten
+// once older than the configured max age.
+func changeRepoFilesOnce(repo *models.Repository, doer *models.User, opts *ChangeRepoFilesOptions) (*structs.FilesResponse, error) {
+	if len(opts.IdempotencyKey) > idempotencyKeyMaxLength {
+		return nil, fmt.Errorf("idempotency key is longer than %d characters", idempotencyKeyMaxLength)
+	}
+	if err := opts.setDefaultBranches(repo); err != nil {
+		return nil, err
+	}
+	branch := opts.NewBranch
+	poolKey := fmt.Sprintf("%d/%d/%s/%s", repo.ID, doer.ID, branch, opts.IdempotencyKey)
+	idempotencyKeysPool.CheckIn(poolKey)
+	defer idempotencyKeysPool.CheckOut(poolKey)
+
+	request := newIdempotencyRequest(opts)
+	idempotencyKey, err := models.GetIdempotencyKey(repo.ID, doer.ID, branch, opts.IdempotencyKey)
+	if err == nil && isIdempotencyKeyExpired(idempotencyKey) {
+		if err := models.DeleteIdempotencyKey(idempotencyKey); err != nil {
+			return nil, err
+		}
+		err = models.ErrIdempotencyKeyNotExist{RepoID: repo.ID, DoerID: doer.ID, Branch: branch, Key: opts.IdempotencyKey}
+	}
+	if err == nil {
+		// The content readers are only read to be compared with the content first given
+		if err := hashContentReaders(request, opts.Files)(true); err != nil {
+			return nil, err
+		}
+		if requestHash, err := request.hash(); err != nil {
+			return nil, err
+		} else if requestHash != idempotencyKey.RequestHash {
+			return nil, models.ErrIdempotencyKeyConflict{Branch: branch, Key: opts.IdempotencyKey}
+		}
+		filesResponse := &structs.FilesResponse{}
+		if err := json.Unmarshal([]byte(idempotencyKey.Response), filesResponse); err != nil {
+			return nil, fmt.Errorf("Unmarshal: %v", err)
+		}
+		return filesResponse, nil
+	} else if !models.IsErrIdempotencyKeyNotExist(err) {
+		return nil, err
+	}
+
+	hashed := hashContentReaders(request, opts.Files)
+	filesResponse, err := commitRepoFiles(repo, doer, opts)
+	if err != nil {
+		// Failed changes don't record their key, their content is not to be read any further
+		hashed(false)
+		return nil, err
+	}
+	if err := hashed(true); err != nil {
+		log.Error(4, "Failed to hash the content of changes [repo_id: %d, branch: %s]: %v", repo.ID, branch, err)
+		return filesResponse, nil
+	}
+	response, err := json.Marshal(filesResponse)
+	if err != nil {
+		return nil, fmt.Errorf("Marshal: %v", err)
+	}
+	requestHash, err := request.hash()
+	if err != nil {
+		return nil, err
+	}
+	// The changes are committed whether the key is recorded or not
+	if err := models.NewIdempotencyKey(&models.IdempotencyKey{
+		RepoID:      repo.ID,
+		DoerID:      doer.ID,
+		Branch:      branch,
+		Key:         opts.IdempotencyKey,
+		RequestHash: requestHash,
+		Response:    string(response),
+	}); err != nil {
+		log.Error(4, "NewIdempotencyKey [repo_id: %d, branch: %s]: %v", repo.ID, branch, err)
+	}
+	return filesResponse, nil
+}
+
+// isIdempotencyKeyExpired returns whether the given idempotency key is older than the configured
+// max age, the keys never expiring when it is 0
+func isIdempotencyKeyExpired(idempotencyKey *models.IdempotencyKey) bool {
+	return setting.Repository.IdempotencyKeyMaxAge > 0 && idempotencyKey.IsOlderThan(setting.Repository.IdempotencyKeyMaxAge)
+}
+
+// CleanupIdempotencyKeys deletes the idempotency keys older than the configured max age, which
+// are otherwise only deleted when they are given again
+func CleanupIdempotencyKeys() error {
+	if setting.Repository.IdempotencyKeyMaxAge <= 0 {
+		return nil
+	}
+	return models.DeleteIdempotencyKeysOlderThan(setting.Repository.IdempotencyKeyMaxAge)
+}
@@ -0,0 +1,161 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/setting"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeRepoFiles_IdempotencyKey(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	commitsCount := getCommitsCount(t, repo, "master")
+	createFile := func(content string) []byte {
+		fileResponse, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+			CommitOptions: CommitOptions{IdempotencyKey: "create-new-file"},
+			TreePath:      "new_file.txt",
+			Content:       content,
+		})
+		assert.NoError(t, err)
+		response, err := json.Marshal(fileResponse)
+		assert.NoError(t, err)
+		return response
+	}
+	response := createFile("first\n")
+	assert.EqualValues(t, "first\n", getBranchFileContent(t, repo, "master", "new_file.txt"))
+
+	// A retry returns the response of the first commit without committing again, even if the
+	// file exists now
+	assert.Equal(t, string(response), string(createFile("first\n")))
+	assert.EqualValues(t, "first\n", getBranchFileContent(t, repo, "master", "new_file.txt"))
+
+	// The key given to other changes conflicts
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{IdempotencyKey: "create-new-file"},
+		TreePath:      "new_file.txt",
+		Content:       "second\n",
+	})
+	assert.True(t, models.IsErrIdempotencyKeyConflict(err), "%v", err)
+	assert.EqualValues(t, "first\n", getBranchFileContent(t, repo, "master", "new_file.txt"))
+	assert.NotEqual(t, commitsCount, getCommitsCount(t, repo, "master"))
+	commitsCount = getCommitsCount(t, repo, "master")
+
+	// The response of a delete describes the file as it was before again
+	deleteOpts := &DeleteRepoFileOptions{
+		CommitOptions: CommitOptions{IdempotencyKey: "delete-new-file"},
+		TreePath:      "new_file.txt",
+	}
+	deleteResponse, err := DeleteRepoFile(repo, doer, deleteOpts)
+	assert.NoError(t, err)
+	retryResponse, err := DeleteRepoFile(repo, doer, deleteOpts)
+	assert.NoError(t, err)
+	assert.EqualValues(t, deleteResponse.Commit.SHA, retryResponse.Commit.SHA)
+	assert.EqualValues(t, deleteResponse.Content.SHA, retryResponse.Content.SHA)
+	assert.NotEqual(t, commitsCount, getCommitsCount(t, repo, "master"))
+	commitsCount = getCommitsCount(t, repo, "master")
+
+	// The keys are scoped to the branch
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{OldBranch: "develop", IdempotencyKey: "create-new-file"},
+		TreePath:      "new_file.txt",
+		Content:       "develop\n",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "develop\n", getBranchFileContent(t, repo, "develop", "new_file.txt"))
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+
+	// The keys are scoped to the doer
+	otherDoer := models.AssertExistsAndLoadBean(t, &models.User{ID: 1}).(*models.User)
+	_, err = CreateRepoFile(repo, otherDoer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{IdempotencyKey: "create-new-file"},
+		TreePath:      "new_file.txt",
+		Content:       "other doer\n",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "other doer\n", getBranchFileContent(t, repo, "master", "new_file.txt"))
+	assert.NotEqual(t, commitsCount, getCommitsCount(t, repo, "master"))
+
+	// Failed changes don't record their key
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{IdempotencyKey: "create-readme"},
+		TreePath:      "README.md",
+		Content:       "exists\n",
+	})
+	assert.True(t, models.IsErrRepoFileAlreadyExist(err), "%v", err)
+	_, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		CommitOptions: CommitOptions{IdempotencyKey: "create-readme"},
+		TreePath:      "README.md",
+		Content:       "updated\n",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "updated\n", getBranchFileContent(t, repo, "master", "README.md"))
+}
+
+func TestChangeRepoFiles_IdempotencyKeyExpired(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	defer func(maxAge time.Duration) {
+		setting.Repository.IdempotencyKeyMaxAge = maxAge
+	}(setting.Repository.IdempotencyKeyMaxAge)
+	setting.Repository.IdempotencyKeyMaxAge = time.Nanosecond
+
+	createFile := func(content string) error {
+		_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+			CommitOptions: CommitOptions{IdempotencyKey: "create-new-file"},
+			TreePath:      "new_file.txt",
+			Content:       content,
+		})
+		return err
+	}
+	assert.NoError(t, createFile("first\n"))
+	assert.EqualValues(t, "first\n", getBranchFileContent(t, repo, "master", "new_file.txt"))
+
+	// The expired key is forgotten, the same key making the change again
+	err := createFile("first\n")
+	assert.True(t, models.IsErrRepoFileAlreadyExist(err), "%v", err)
+	assert.NoError(t, CleanupIdempotencyKeys())
+	models.AssertNotExistsBean(t, &models.IdempotencyKey{RepoID: repo.ID, DoerID: doer.ID})
+}
+
+// countingReader counts the bytes read of its content
+type countingReader struct {
+	r     io.Reader
+	count int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.count += n
+	return n, err
+}
+
+func TestChangeRepoFiles_IdempotencyKeyFailed(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	// The content left by failed changes is not read to be hashed
+	reader := &countingReader{r: strings.NewReader(strings.Repeat("a", 1<<20))}
+	_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		CommitOptions: CommitOptions{IdempotencyKey: "create-large"},
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "README.md", Content: "exists\n"},
+			{Operation: "create", TreePath: "large.txt", ContentReader: reader},
+		},
+	})
+	assert.True(t, models.IsErrRepoFileAlreadyExist(err), "%v", err)
+	assert.Zero(t, reader.count)
+	models.AssertNotExistsBean(t, &models.IdempotencyKey{RepoID: repo.ID, Key: "create-large"})
+}
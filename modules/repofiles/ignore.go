@@ -0,0 +1,51 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"code.gitea.io/gitea/models"
+)
+
+// checkNotIgnored makes sure the given tree path is not ignored by the .gitignore files of its
+// parent directories in the index of the temporary upload repository
+func checkNotIgnored(t *TemporaryUploadRepository, treePath string) error {
+	workDir, err := ioutil.TempDir(t.basePath, "ignore-")
+	if err != nil {
+		return fmt.Errorf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	// Only the .gitignore files which may apply to the path are checked out
+	for dir := path.Dir(treePath); ; dir = path.Dir(dir) {
+		gitignorePath := path.Join(dir, ".gitignore")
+		content, _, err := t.execStdin("checkNotIgnored (git cat-file)", nil, "cat-file", "blob", ":"+gitignorePath)
+		if err == nil {
+			contentPath := filepath.Join(workDir, filepath.FromSlash(gitignorePath))
+			if err := os.MkdirAll(filepath.Dir(contentPath), os.ModePerm); err != nil {
+				return fmt.Errorf("checkNotIgnored: %v", err)
+			}
+			if err := ioutil.WriteFile(contentPath, []byte(content), 0644); err != nil {
+				return fmt.Errorf("checkNotIgnored: %v", err)
+			}
+		}
+		if dir == "." {
+			break
+		}
+	}
+
+	pattern, err := t.CheckIgnore(workDir, treePath)
+	if err != nil {
+		return err
+	} else if pattern != "" {
+		return models.ErrFileIgnored{Path: treePath, Pattern: pattern}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/modules/process"
+)
+
+// getIndexEntries returns the mode and the blob of each file in the index of the temporary
+// upload repository, as "<mode> <hash>" by path
+func getIndexEntries(t *TemporaryUploadRepository) (map[string]string, error) {
+	stdout, stderr, err := process.GetManager().ExecDir(5*time.Minute,
+		t.basePath,
+		fmt.Sprintf("getIndexEntries (git ls-files -s): %s", t.basePath),
+		"git", "ls-files", "-s", "-z")
+	if err != nil {
+		return nil, fmt.Errorf("getIndexEntries: %v %s", err, stderr)
+	}
+
+	entries := make(map[string]string)
+	for _, line := range strings.Split(stdout, "\x00") {
+		// <mode> SP <hash> SP <stage> TAB <path>
+		tab := strings.IndexByte(line, '\t')
+		if tab < 0 {
+			continue
+		}
+		fields := strings.Fields(line[:tab])
+		if len(fields) != 3 {
+			continue
+		}
+		entries[line[tab+1:]] = fields[0] + " " + fields[1]
+	}
+	return entries, nil
+}
+
+// verifyIndex makes sure the index of the temporary upload repository holds what the given applied
+// files were meant to leave in it on top of the given commit: the files removed or moved away are
+// gone, and the files added are there with the mode and blob they were hashed as
+func verifyIndex(t *TemporaryUploadRepository, commit *git.Commit, files []*ChangeRepoFile) error {
+	// Later operations override what the earlier ones left at the same path, an empty entry
+	// meaning no file
+	expected := make(map[string]string)
+	for _, file := range files {
+		switch {
+		case file.Operation == "delete":
+			for _, treePath := range file.deletedPaths {
+				expected[treePath] = ""
+			}
+		case file.Operation == "rename" && file.isDir:
+			for _, treePath := range file.deletedPaths {
+				expected[treePath] = ""
+			}
+			for _, treePath := range file.deletedPaths {
+				entry, err := commit.GetTreeEntryByPath(treePath)
+				if err != nil {
+					return err
+				}
+				expected[file.treePath+strings.TrimPrefix(treePath, file.fromTreePath)] = fmt.Sprintf("%x %s", entry.Mode(), entry.ID)
+			}
+		default:
+			if file.fromTreePath != "" && file.fromTreePath != file.treePath {
+				expected[file.fromTreePath] = ""
+			}
+			expected[file.treePath] = file.indexMode + " " + file.indexHash
+		}
+	}
+
+	entries, err := getIndexEntries(t)
+	if err != nil {
+		return err
+	}
+	for treePath, entry := range expected {
+		if entries[treePath] != entry {
+			return fmt.Errorf("index inconsistent with the changes at %s: expected %q, found %q", treePath, entry, entries[treePath])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"strings"
+	"testing"
+
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/setting"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeRepoFiles_VerifyIndex(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	defer func(verifyIndex bool) {
+		setting.Repository.VerifyIndex = verifyIndex
+	}(setting.Repository.VerifyIndex)
+	setting.Repository.VerifyIndex = true
+
+	_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "docs/a.md", Content: "a"},
+			{Operation: "create", TreePath: "docs/[b].md", Content: "b", Mode: "100755"},
+			{Operation: "create", TreePath: "link", Content: "docs/a.md", Symlink: true},
+			{Operation: "create", TreePath: "c.txt", Content: "c"},
+		},
+	})
+	assert.NoError(t, err)
+	_, err = ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{
+			{Operation: "rename", FromTreePath: "docs", TreePath: "manual"},
+			{Operation: "update", FromTreePath: "README.md", TreePath: "README.txt", Content: "readme"},
+			{Operation: "update", TreePath: "link", Content: "a link no more", Mode: "100644"},
+			{Operation: "delete", TreePath: "c.txt"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "b", getBranchFileContent(t, repo, "master", "manual/[b].md"))
+	assert.EqualValues(t, "a link no more", getBranchFileContent(t, repo, "master", "link"))
+}
+
+func TestVerifyIndex_Inconsistent(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	tmp, err := NewTemporaryUploadRepository(repo)
+	assert.NoError(t, err)
+	defer tmp.Close()
+	commit, err := prepareTemporaryUploadRepository(tmp, repo, "master", "", nil)
+	assert.NoError(t, err)
+
+	objectHash, err := tmp.HashObject("a.txt", strings.NewReader("a"))
+	assert.NoError(t, err)
+	otherHash, err := tmp.HashObject("a.txt", strings.NewReader("b"))
+	assert.NoError(t, err)
+	file := &ChangeRepoFile{Operation: "create", treePath: "a.txt", indexMode: "100644", indexHash: objectHash}
+
+	// The file is staged as another blob
+	assert.NoError(t, tmp.AddObjectToIndex("100644", otherHash, "a.txt"))
+	err = verifyIndex(tmp, commit, []*ChangeRepoFile{file})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "index inconsistent with the changes at a.txt")
+	}
+
+	// Or with another mode
+	assert.NoError(t, tmp.AddObjectToIndex("100755", objectHash, "a.txt"))
+	assert.Error(t, verifyIndex(tmp, commit, []*ChangeRepoFile{file}))
+
+	// A deleted file is still there
+	assert.NoError(t, tmp.AddObjectToIndex("100644", objectHash, "a.txt"))
+	assert.NoError(t, verifyIndex(tmp, commit, []*ChangeRepoFile{file}))
+	deleted := &ChangeRepoFile{Operation: "delete", treePath: "README.md", deletedPaths: []string{"README.md"}}
+	err = verifyIndex(tmp, commit, []*ChangeRepoFile{file, deleted})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "index inconsistent with the changes at README.md")
+	}
+	assert.NoError(t, tmp.RemoveFilesFromIndex("README.md"))
+	assert.NoError(t, verifyIndex(tmp, commit, []*ChangeRepoFile{file, deleted}))
+}
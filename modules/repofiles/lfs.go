@@ -0,0 +1,168 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/lfs"
+	"code.gitea.io/gitea/modules/setting"
+)
+
+// lfsPointerMaxSize is larger than any LFS pointer file
+const lfsPointerMaxSize = 1024
+
+// lfsPointer returns the content of the LFS pointer file for the given LFS meta object
+func lfsPointer(meta *models.LFSMetaObject) string {
+	return fmt.Sprintf("%s\n%s%s\nsize %d\n", models.LFSMetaFileIdentifier, models.LFSMetaFileOidPrefix, meta.Oid, meta.Size)
+}
+
+// parseLFSPointer returns the LFS meta object the given content points to, or nil if it is no LFS pointer file
+func parseLFSPointer(content string) *models.LFSMetaObject {
+	if !strings.HasPrefix(content, models.LFSMetaFileIdentifier) {
+		return nil
+	}
+	splitLines := strings.Split(content, "\n")
+	if len(splitLines) < 3 {
+		return nil
+	}
+	oid := strings.TrimPrefix(splitLines[1], models.LFSMetaFileOidPrefix)
+	size, err := strconv.ParseInt(strings.TrimPrefix(splitLines[2], "size "), 10, 64)
+	if len(oid) != 64 || err != nil {
+		return nil
+	}
+	return &models.LFSMetaObject{Oid: oid, Size: size}
+}
+
+// getLFSPointerOfEntry returns the LFS meta object the file of the given tree entry points to, if any
+func getLFSPointerOfEntry(entry *git.TreeEntry) (*models.LFSMetaObject, error) {
+	if entry.Size() > lfsPointerMaxSize {
+		return nil, nil
+	}
+	dataRc, err := entry.Blob().DataAsync()
+	if err != nil {
+		return nil, err
+	}
+	defer dataRc.Close()
+	content, err := ioutil.ReadAll(io.LimitReader(dataRc, lfsPointerMaxSize))
+	if err != nil {
+		return nil, err
+	}
+	return parseLFSPointer(string(content)), nil
+}
+
+// hashFileContent writes the content of the given prepared file to the object db of the temporary
+// upload repository and returns its hash. Content of paths tracked by LFS is replaced by a pointer
+// to the LFS object it will be stored as, the content of other paths being cleaned by their filter
+// driver. Content larger than the max file size of the repository is refused with ErrFileTooBig.
+func hashFileContent(t *TemporaryUploadRepository, file *ChangeRepoFile) (string, error) {
+	filter, err := t.CheckAttribute("filter", file.treePath)
+	if err != nil {
+		return "", err
+	}
+	isLFS := setting.LFS.StartServer && filter == "lfs"
+	if !isLFS {
+		if err := checkFilterDriver(t, file.treePath, filter); err != nil {
+			return "", err
+		}
+		// The LFS objects are stored as they are
+		if err := formatContent(t.repo, file); err != nil {
+			return "", err
+		}
+	}
+	content := &sizeLimitedReader{r: file.content, path: file.treePath, maxSize: maxFileSize(t.repo, isLFS)}
+
+	if isLFS {
+		if err := spoolLFSContent(t, file, content); content.err != nil {
+			return "", content.err
+		} else if err != nil {
+			return "", err
+		}
+		// The pointer is stored as it is, without the attributes of the path
+		if file.lfsMetaObject.Size > 0 {
+			return t.HashObject("", strings.NewReader(lfsPointer(file.lfsMetaObject)))
+		}
+		// Like git lfs does, an empty file is committed as the empty blob rather than as a pointer
+		file.lfsMetaObject = nil
+		return t.HashObject("", strings.NewReader(""))
+	}
+	objectHash, err := t.HashObject(file.treePath, content)
+	if content.err != nil {
+		// git hash-object only sees the end of its input, the truncated blob is left unused
+		return "", content.err
+	}
+	file.size = content.size
+	return objectHash, err
+}
+
+// spoolLFSContent keeps the given content of the file tracked by LFS in the temporary upload
+// repository until it is stored, describing it by the LFS meta object of the file
+func spoolLFSContent(t *TemporaryUploadRepository, file *ChangeRepoFile, content io.Reader) error {
+	spool, err := ioutil.TempFile(t.basePath, "lfs-")
+	if err != nil {
+		return fmt.Errorf("TempFile: %v", err)
+	}
+	defer spool.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(spool, hash), content)
+	if models.IsErrFileTooBig(err) {
+		return err
+	} else if err != nil {
+		return fmt.Errorf("spoolLFSContent: %v", err)
+	}
+	file.lfsContentPath = spool.Name()
+	file.lfsMetaObject = &models.LFSMetaObject{
+		Oid:          hex.EncodeToString(hash.Sum(nil)),
+		Size:         size,
+		RepositoryID: t.repo.ID,
+	}
+	return nil
+}
+
+// storeLFSObjects stores the content of the given applied files tracked by LFS in the LFS content store
+func storeLFSObjects(repo *models.Repository, files []*ChangeRepoFile) error {
+	contentStore := &lfs.ContentStore{BasePath: setting.LFS.ContentPath}
+	for _, file := range files {
+		if file.lfsMetaObject == nil {
+			continue
+		}
+		meta, err := models.NewLFSMetaObject(file.lfsMetaObject)
+		if err != nil {
+			return err
+		}
+		if contentStore.Exists(meta) {
+			continue
+		}
+		if err := putLFSContent(contentStore, meta, file.lfsContentPath); err != nil {
+			if !meta.Existing {
+				if err := repo.RemoveLFSMetaObjectByOid(meta.Oid); err != nil {
+					return err
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// putLFSContent puts the content kept in the given file into the LFS content store
+func putLFSContent(contentStore *lfs.ContentStore, meta *models.LFSMetaObject, contentPath string) error {
+	content, err := os.Open(contentPath)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	return contentStore.Put(meta, content)
+}
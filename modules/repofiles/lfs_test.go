@@ -0,0 +1,165 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/lfs"
+	"code.gitea.io/gitea/modules/setting"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateRepoFile_LFS(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	contentPath, err := ioutil.TempDir("", "repofiles-lfs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(contentPath)
+	oldLFS := setting.LFS
+	setting.LFS.StartServer = true
+	setting.LFS.ContentPath = contentPath
+	defer func() {
+		setting.LFS = oldLFS
+	}()
+
+	pushTestFile(t, repo, doer, ".gitattributes", "*.bin filter=lfs diff=lfs merge=lfs -text\n")
+
+	content := strings.Repeat("large binary\n", 100)
+	hash := sha256.Sum256([]byte(content))
+	oid := hex.EncodeToString(hash[:])
+
+	fileResponse, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "large.bin",
+		Content:  content,
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, oid, fileResponse.Content.LFSOid)
+	assert.EqualValues(t, len(content), fileResponse.Content.LFSSize)
+
+	// The committed blob is a pointer to the LFS object
+	pointer := getBranchFileContent(t, repo, "master", "large.bin")
+	assert.EqualValues(t, "version https://git-lfs.github.com/spec/v1\noid sha256:"+oid+"\nsize 1300\n", pointer)
+	assert.EqualValues(t, len(pointer), fileResponse.Content.Size)
+
+	meta, err := repo.GetLFSMetaObjectByOid(oid)
+	assert.NoError(t, err)
+	assert.EqualValues(t, len(content), meta.Size)
+	contentStore := &lfs.ContentStore{BasePath: contentPath}
+	assert.True(t, contentStore.Exists(meta))
+	valid, err := contentStore.Verify(meta)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	// Empty files are committed as they are, as git lfs does
+	fileResponse, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{TreePath: "empty.bin"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391", fileResponse.Content.SHA)
+	assert.Empty(t, fileResponse.Content.LFSOid)
+	assert.EqualValues(t, "", getBranchFileContent(t, repo, "master", "empty.bin"))
+
+	// Paths not tracked by LFS are committed as they are
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "small.txt",
+		Content:  "small",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "small", getBranchFileContent(t, repo, "master", "small.txt"))
+}
+
+func TestGetRepoFileContent_LFS(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	contentPath, err := ioutil.TempDir("", "repofiles-lfs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(contentPath)
+	oldLFS := setting.LFS
+	setting.LFS.StartServer = true
+	setting.LFS.ContentPath = contentPath
+	defer func() {
+		setting.LFS = oldLFS
+	}()
+
+	pushTestFile(t, repo, doer, ".gitattributes", "*.bin filter=lfs diff=lfs merge=lfs -text\n")
+	content := strings.Repeat("large binary\n", 100)
+	fileResponse, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "large.bin",
+		Content:  content,
+	})
+	assert.NoError(t, err)
+
+	// The pointer itself
+	fileContent, err := GetRepoFileContent(repo, "master", "large.bin", false)
+	assert.NoError(t, err)
+	assert.EqualValues(t, fileResponse.Content.SHA, fileContent.SHA)
+	assert.EqualValues(t, fileResponse.Content.Size, fileContent.Size)
+	assert.EqualValues(t, fileResponse.Content.LFSOid, fileContent.LFSMetaObject.Oid)
+	assert.EqualValues(t, getBranchFileContent(t, repo, "master", "large.bin"), readRepoFileContent(t, fileContent))
+
+	// The object it points to
+	fileContent, err = GetRepoFileContent(repo, "master", "large.bin", true)
+	assert.NoError(t, err)
+	assert.EqualValues(t, fileResponse.Content.SHA, fileContent.SHA)
+	assert.EqualValues(t, len(content), fileContent.Size)
+	assert.EqualValues(t, content, readRepoFileContent(t, fileContent))
+
+	// The pointer is returned when the object isn't stored on this server
+	setting.LFS.ContentPath = filepath.Join(contentPath, "missing")
+	fileContent, err = GetRepoFileContent(repo, "master", "large.bin", true)
+	assert.NoError(t, err)
+	assert.EqualValues(t, fileResponse.Content.Size, fileContent.Size)
+	assert.EqualValues(t, getBranchFileContent(t, repo, "master", "large.bin"), readRepoFileContent(t, fileContent))
+}
+
+func TestCreateRepoFile_LFSMaxFileSize(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	contentPath, err := ioutil.TempDir("", "repofiles-lfs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(contentPath)
+	oldLFS := setting.LFS
+	oldMaxFileSize := setting.Repository.MaxFileSize
+	setting.LFS.StartServer = true
+	setting.LFS.ContentPath = contentPath
+	setting.LFS.MaxFileSize = 1024
+	setting.Repository.MaxFileSize = 16
+	defer func() {
+		setting.LFS = oldLFS
+		setting.Repository.MaxFileSize = oldMaxFileSize
+	}()
+
+	pushTestFile(t, repo, doer, ".gitattributes", "*.bin filter=lfs diff=lfs merge=lfs -text\n")
+
+	// Paths tracked by LFS only honor the LFS limit
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "limit.bin",
+		Content:  strings.Repeat("a", 1024),
+	})
+	assert.NoError(t, err)
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "too-big.bin",
+		Content:  strings.Repeat("a", 1025),
+	})
+	assert.EqualValues(t, models.ErrFileTooBig{Path: "too-big.bin", MaxSize: 1024}, err)
+	hash := sha256.Sum256([]byte(strings.Repeat("a", 1025)))
+	models.AssertNotExistsBean(t, &models.LFSMetaObject{Oid: hex.EncodeToString(hash[:])})
+
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "too-big.txt",
+		Content:  strings.Repeat("a", 17),
+	})
+	assert.EqualValues(t, models.ErrFileTooBig{Path: "too-big.txt", MaxSize: 16}, err)
+}
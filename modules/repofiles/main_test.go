@@ -0,0 +1,38 @@
+// Copyright 2018 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	models.MainTest(m, filepath.Join("..", ".."))
+}
+
+// prepareTestRepo resets the test environment and returns the given repository
+// with its hooks removed, as the fixture hooks call out to a gitea binary.
+func prepareTestRepo(t testing.TB, repoID int64) *models.Repository {
+	models.PrepareTestEnv(t)
+	repo := models.AssertExistsAndLoadBean(t, &models.Repository{ID: repoID}).(*models.Repository)
+	assert.NoError(t, os.RemoveAll(filepath.Join(repo.RepoPath(), "hooks")))
+	return repo
+}
+
+// prepareEmptyTestRepo resets the test environment and returns a repository without any commit
+func prepareEmptyTestRepo(t *testing.T) *models.Repository {
+	repo := prepareTestRepo(t, 15)
+	assert.True(t, repo.IsEmpty)
+	assert.NoError(t, os.RemoveAll(repo.RepoPath()))
+	assert.NoError(t, git.InitRepository(repo.RepoPath(), true))
+	return repo
+}
@@ -0,0 +1,97 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"code.gitea.io/gitea/models"
+)
+
+// checkCommitMessage makes sure the given message of a commit of the given repository, default
+// message included, follows the commit message rules of the repository, if any. The rule broken
+// first is named by ErrCommitMessageRejected.
+func checkCommitMessage(repo *models.Repository, message string) error {
+	lines := strings.Split(message, "\n")
+	if max := repo.CommitMessageMaxSubjectLength; max > 0 {
+		if length := utf8.RuneCountInString(lines[0]); length > max {
+			return models.ErrCommitMessageRejected{
+				RepoName: repo.FullName(),
+				Rule:     "subject-length",
+				Reason:   fmt.Sprintf("subject of %d characters longer than %d", length, max),
+			}
+		}
+	}
+	if repo.CommitMessageRequireBlankLine && len(lines) > 1 && strings.TrimSpace(lines[1]) != "" {
+		return models.ErrCommitMessageRejected{
+			RepoName: repo.FullName(),
+			Rule:     "blank-line",
+			Reason:   "no blank line between the subject and the body",
+		}
+	}
+	if repo.CommitMessagePattern != "" {
+		pattern, err := regexp.Compile(repo.CommitMessagePattern)
+		if err != nil {
+			return fmt.Errorf("invalid commit message pattern of %s: %v", repo.FullName(), err)
+		}
+		if !pattern.MatchString(message) {
+			return models.ErrCommitMessageRejected{
+				RepoName: repo.FullName(),
+				Rule:     "pattern",
+				Reason:   fmt.Sprintf("message not matching %s", repo.CommitMessagePattern),
+			}
+		}
+	}
+	return nil
+}
+
+// authorTrailerValueRegexp matches the "Name <email>" value of an author trailer
+var authorTrailerValueRegexp = regexp.MustCompile(`^(.*?)\s*<([^<>]*)>$`)
+
+// parseAuthorTrailer returns the given message without the first trailer of its trailers paragraph
+// having the given key, case-insensitively, and the author that trailer gives. The message is
+// returned as it is with no author if it has no such trailer.
+func parseAuthorTrailer(message, key string) (string, *IdentityOptions, error) {
+	// The subject is not a trailer
+	paragraphs := strings.Split(message, "\n\n")
+	if len(paragraphs) < 2 {
+		return message, nil, nil
+	}
+	lines := strings.Split(paragraphs[len(paragraphs)-1], "\n")
+	for _, line := range lines {
+		if !trailerRegexp.MatchString(line) {
+			return message, nil, nil
+		}
+	}
+	for i, line := range lines {
+		parts := strings.SplitN(line, ":", 2)
+		if !strings.EqualFold(parts[0], key) {
+			continue
+		}
+
+		value := strings.TrimSpace(parts[1])
+		author := &IdentityOptions{}
+		reason := "not a \"Name <email>\" value"
+		if match := authorTrailerValueRegexp.FindStringSubmatch(value); match != nil {
+			author.Name, author.Email = strings.TrimSpace(match[1]), strings.TrimSpace(match[2])
+			reason = getIdentityProblem(*author)
+		}
+		if reason != "" {
+			return "", nil, models.ErrInvalidAuthorTrailer{Trailer: parts[0], Value: value, Reason: reason}
+		}
+
+		lines = append(lines[:i], lines[i+1:]...)
+		if len(lines) > 0 {
+			paragraphs[len(paragraphs)-1] = strings.Join(lines, "\n")
+		} else {
+			paragraphs = paragraphs[:len(paragraphs)-1]
+		}
+		return strings.Join(paragraphs, "\n\n"), author, nil
+	}
+	return message, nil, nil
+}
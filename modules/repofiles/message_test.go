@@ -0,0 +1,118 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"testing"
+
+	"code.gitea.io/gitea/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeRepoFiles_CommitMessageRules(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	commit := func(message, treePath string) error {
+		_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+			CommitOptions: CommitOptions{Message: message},
+			Files:         []*ChangeRepoFile{{Operation: "create", TreePath: treePath, Content: "content"}},
+		})
+		return err
+	}
+	checkRejected := func(err error, rule string) {
+		if assert.True(t, models.IsErrCommitMessageRejected(err), "%v", err) {
+			assert.EqualValues(t, rule, err.(models.ErrCommitMessageRejected).Rule)
+		}
+	}
+
+	// No rule applies unless the repository has some
+	assert.NoError(t, commit("A subject much longer than what the rules of most projects would allow\nbody", "a.txt"))
+
+	repo.CommitMessageMaxSubjectLength = 20
+	repo.CommitMessageRequireBlankLine = true
+	commitsCount := getCommitsCount(t, repo, "master")
+	checkRejected(commit("Add a file with a long subject", "b.txt"), "subject-length")
+	checkRejected(commit("Add a file\nwith a body", "b.txt"), "blank-line")
+	// The default messages are checked the same way
+	checkRejected(commit("", "a_file_with_a_long_name.txt"), "subject-length")
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+
+	assert.NoError(t, commit("Add a file\n\nwith a body", "b.txt"))
+	assert.NoError(t, commit("Add a file of 20 chä", "c.txt"))
+	assert.NoError(t, commit("", "d.txt"))
+
+	repo.CommitMessagePattern = `^(feat|fix|docs)(\([a-z]+\))?: `
+	commitsCount = getCommitsCount(t, repo, "master")
+	checkRejected(commit("Add a file", "e.txt"), "pattern")
+	checkRejected(commit("", "e.txt"), "pattern")
+	checkRejected(commit("docs: add a long documentation file", "e.txt"), "subject-length")
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+	assert.NoError(t, commit("docs(readme): add", "e.txt"))
+
+	repo.CommitMessagePattern = `(`
+	assert.Error(t, commit("fix: add", "f.txt"))
+}
+
+func TestChangeRepoFiles_AuthorTrailer(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	// The author given by the trailer needs no account
+	filesResponse, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		CommitOptions: CommitOptions{
+			Message:       "Fix the typo\n\nFound while reading.\n\nfrom: Jane Doe <jane@example.com>\nReviewed-by: Someone <someone@example.com>",
+			AuthorTrailer: "From",
+			Author:        &IdentityOptions{Name: "Ignored", Email: "ignored@example.com"},
+		},
+		Files: []*ChangeRepoFile{{Operation: "create", TreePath: "typo.txt", Content: "typo\n"}},
+	})
+	assert.NoError(t, err)
+	commit := getBranchCommit(t, repo, "master")
+	assert.EqualValues(t, commit.ID.String(), filesResponse.Commit.SHA)
+	assert.EqualValues(t, "Jane Doe", commit.Author.Name)
+	assert.EqualValues(t, "jane@example.com", commit.Author.Email)
+	assert.EqualValues(t, doer.NewGitSig().Name, commit.Committer.Name)
+	assert.EqualValues(t, doer.Email, commit.Committer.Email)
+	assert.EqualValues(t, "Fix the typo\n\nFound while reading.\n\nReviewed-by: Someone <someone@example.com>\n", commit.Message())
+
+	// The message is committed as it is without the trailer, the last paragraph only holding trailers
+	_, err = ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		CommitOptions: CommitOptions{
+			Message:       "Fix another typo\n\nFrom: Jane Doe <jane@example.com>\nas written in the patch",
+			AuthorTrailer: "From",
+		},
+		Files: []*ChangeRepoFile{{Operation: "create", TreePath: "typo2.txt", Content: "typo\n"}},
+	})
+	assert.NoError(t, err)
+	commit = getBranchCommit(t, repo, "master")
+	assert.EqualValues(t, doer.Email, commit.Author.Email)
+	assert.EqualValues(t, "Fix another typo\n\nFrom: Jane Doe <jane@example.com>\nas written in the patch\n", commit.Message())
+
+	for value, reason := range map[string]string{
+		"jane@example.com":        "not a \"Name <email>\" value",
+		"<jane@example.com>":      "no name",
+		"Jane Doe <jane>":         "invalid email",
+		"Jane Doe <jane@example>": "",
+	} {
+		commitsCount := getCommitsCount(t, repo, "master")
+		_, err = ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+			CommitOptions: CommitOptions{
+				Message:       "Fix a typo\n\nFrom: " + value,
+				AuthorTrailer: "From",
+			},
+			Files: []*ChangeRepoFile{{Operation: "create", TreePath: "typo3.txt", Content: "typo\n"}},
+		})
+		if reason == "" {
+			assert.NoError(t, err, value)
+			continue
+		}
+		if assert.True(t, models.IsErrInvalidAuthorTrailer(err), "%s: %v", value, err) {
+			assert.EqualValues(t, models.ErrInvalidAuthorTrailer{Trailer: "From", Value: value, Reason: reason}, err)
+		}
+		assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"time"
+
+	"code.gitea.io/gitea/modules/metrics"
+	"code.gitea.io/gitea/modules/setting"
+)
+
+// observePhase records how long the given phase of a change took since the given start, if metrics are enabled
+func observePhase(phase string, start time.Time) {
+	if !setting.Metrics.Enabled {
+		return
+	}
+	metrics.RepoFilesPhaseDuration.WithLabelValues(phase).Observe(time.Since(start).Seconds())
+}
+
+// countOperation counts the change of the given files, by the operation they all share or as
+// "multiple" otherwise, and by whether it failed with the given error, if metrics are enabled
+func countOperation(files []*ChangeRepoFile, err error) {
+	if !setting.Metrics.Enabled {
+		return
+	}
+	operation := "multiple"
+	for i, file := range files {
+		if i == 0 {
+			operation = file.Operation
+		} else if file.Operation != operation {
+			operation = "multiple"
+			break
+		}
+	}
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	metrics.RepoFilesOperations.WithLabelValues(operation, result).Inc()
+}
@@ -0,0 +1,127 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/structs"
+)
+
+// ApplyPatchToRepoFileOptions holds the repository patch file options
+type ApplyPatchToRepoFileOptions struct {
+	CommitOptions
+	TreePath string
+	// Patch is a unified diff of the file at TreePath, as made by git diff
+	Patch string
+	// SHA of the blob currently at TreePath, checked against the branch when given
+	SHA string
+}
+
+// ApplyPatchToRepoFile updates a file in the given repository by applying a patch to its content.
+// If any of the hunks doesn't apply, nothing is committed and the rejected hunks are returned.
+func ApplyPatchToRepoFile(repo *models.Repository, doer *models.User, opts *ApplyPatchToRepoFileOptions) (*structs.FileResponse, error) {
+	changeOpts := &ChangeRepoFilesOptions{
+		CommitOptions: opts.CommitOptions,
+		Files: []*ChangeRepoFile{{
+			Operation: "patch",
+			TreePath:  opts.TreePath,
+			Patch:     opts.Patch,
+			SHA:       opts.SHA,
+		}},
+	}
+	filesResponse, err := ChangeRepoFiles(repo, doer, changeOpts)
+	if err != nil {
+		return nil, err
+	}
+	return fileResponseFromFiles(filesResponse), nil
+}
+
+// applyPatch applies the patch of the given file to the content of the given entry in a work
+// directory of the temporary upload repository and opens the patched content
+func applyPatch(t *TemporaryUploadRepository, entry *git.TreeEntry, file *ChangeRepoFile) (io.ReadCloser, error) {
+	// The patch would be applied to the pointer instead of the content
+	if meta, err := getLFSPointerOfEntry(entry); err != nil {
+		return nil, err
+	} else if meta != nil {
+		return nil, fmt.Errorf("patching a file stored in LFS is not supported [path: %s]", file.fromTreePath)
+	}
+
+	workDir, err := ioutil.TempDir(t.basePath, "patch-")
+	if err != nil {
+		return nil, fmt.Errorf("TempDir: %v", err)
+	}
+
+	// A patch made on another file can't be applied, even if the hunks would apply
+	treePaths, err := t.PatchedFiles(workDir, strings.NewReader(file.Patch))
+	if err != nil {
+		return nil, err
+	}
+	for _, treePath := range treePaths {
+		if treePath != file.fromTreePath {
+			return nil, fmt.Errorf("patch changes another file than %s: %s", file.fromTreePath, treePath)
+		}
+	}
+	if len(treePaths) == 0 {
+		return nil, fmt.Errorf("patch changes no file")
+	}
+
+	contentPath := filepath.Join(workDir, filepath.FromSlash(file.fromTreePath))
+	if err := writeBlob(entry, contentPath); err != nil {
+		return nil, err
+	}
+	if err := t.ApplyPatch(workDir, strings.NewReader(file.Patch)); err != nil {
+		rejected, rejErr := ioutil.ReadFile(contentPath + ".rej")
+		if os.IsNotExist(rejErr) {
+			return nil, err
+		} else if rejErr != nil {
+			return nil, rejErr
+		}
+		return nil, models.ErrPatchConflict{
+			Path:          file.fromTreePath,
+			RejectedHunks: parseRejectedHunks(string(rejected)),
+		}
+	}
+	return os.Open(contentPath)
+}
+
+// writeBlob writes the content of the blob of the given entry to the given path
+func writeBlob(entry *git.TreeEntry, contentPath string) error {
+	if err := os.MkdirAll(filepath.Dir(contentPath), os.ModePerm); err != nil {
+		return fmt.Errorf("MkdirAll: %v", err)
+	}
+	dataRc, err := entry.Blob().DataAsync()
+	if err != nil {
+		return err
+	}
+	defer dataRc.Close()
+	content, err := os.Create(contentPath)
+	if err != nil {
+		return fmt.Errorf("Create: %v", err)
+	}
+	defer content.Close()
+	_, err = io.Copy(content, dataRc)
+	return err
+}
+
+// parseRejectedHunks splits the content of a .rej file of git apply into its hunks
+func parseRejectedHunks(rejected string) []string {
+	hunks := make([]string, 0, 1)
+	for _, line := range strings.SplitAfter(rejected, "\n") {
+		if strings.HasPrefix(line, "@@") {
+			hunks = append(hunks, line)
+		} else if len(hunks) > 0 {
+			hunks[len(hunks)-1] += line
+		}
+	}
+	return hunks
+}
@@ -0,0 +1,101 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"testing"
+
+	"code.gitea.io/gitea/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const patchTestContent = "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n"
+
+const patchTestPatch = `diff --git a/numbers.txt b/numbers.txt
+--- a/numbers.txt
++++ b/numbers.txt
+@@ -1,4 +1,4 @@
+-one
++ONE
+ two
+ three
+ four
+@@ -7,4 +7,4 @@ six
+ seven
+ eight
+ nine
+-ten
++TEN
+`
+
+func TestApplyPatchToRepoFile(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "numbers.txt",
+		Content:  patchTestContent,
+	})
+	assert.NoError(t, err)
+
+	fileResponse, err := ApplyPatchToRepoFile(repo, doer, &ApplyPatchToRepoFileOptions{
+		TreePath: "numbers.txt",
+		Patch:    patchTestPatch,
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "numbers.txt", fileResponse.Content.Path)
+	assert.EqualValues(t, "Update 'numbers.txt'\n", fileResponse.Commit.Message)
+	assert.EqualValues(t, "ONE\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nTEN\n",
+		getBranchFileContent(t, repo, "master", "numbers.txt"))
+	assert.EqualValues(t, "M\tnumbers.txt", getLastCommitNameStatus(t, repo, "master"))
+}
+
+func TestApplyPatchToRepoFile_Conflict(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	// The last hunk no longer applies
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "numbers.txt",
+		Content:  "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\n10\n",
+	})
+	assert.NoError(t, err)
+
+	_, err = ApplyPatchToRepoFile(repo, doer, &ApplyPatchToRepoFileOptions{
+		TreePath: "numbers.txt",
+		Patch:    patchTestPatch,
+	})
+	assert.EqualValues(t, models.ErrPatchConflict{
+		Path:          "numbers.txt",
+		RejectedHunks: []string{"@@ -7,4 +7,4 @@ six\n seven\n eight\n nine\n-ten\n+TEN\n"},
+	}, err)
+	assert.EqualValues(t, "2", getCommitsCount(t, repo, "master"))
+}
+
+func TestApplyPatchToRepoFile_Errors(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := ApplyPatchToRepoFile(repo, doer, &ApplyPatchToRepoFileOptions{
+		TreePath: "numbers.txt",
+		Patch:    patchTestPatch,
+	})
+	assert.True(t, models.IsErrRepoFileDoesNotExist(err))
+
+	// The patch is for another file
+	_, err = ApplyPatchToRepoFile(repo, doer, &ApplyPatchToRepoFileOptions{
+		TreePath: "README.md",
+		Patch:    patchTestPatch,
+	})
+	assert.Error(t, err)
+
+	_, err = ApplyPatchToRepoFile(repo, doer, &ApplyPatchToRepoFileOptions{
+		TreePath: "README.md",
+		Patch:    "not a patch",
+	})
+	assert.Error(t, err)
+	assert.EqualValues(t, "1", getCommitsCount(t, repo, "master"))
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"fmt"
+	"sync"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/structs"
+)
+
+// CommitPolicyRequest describes the changes a commit policy is asked to approve
+type CommitPolicyRequest struct {
+	Repo *models.Repository
+	Doer *models.User
+	// Branch is the branch the changes are pushed to, created from OldBranch if CreateNewBranch is set
+	Branch          string
+	OldBranch       string
+	CreateNewBranch bool
+	Amend           bool
+	Force           bool
+	Message         string
+	// TreeID is the tree the changes are committed with
+	TreeID string
+	// Changes are the files changed from the tree of the commit the changes are made on top of
+	Changes []*structs.FileChange
+}
+
+// CommitPolicyDecision is the answer of a commit policy: the changes are committed if allowed,
+// otherwise the reason is given to the doer
+type CommitPolicyDecision struct {
+	Allowed bool
+	Reason  string
+}
+
+// CommitPolicy approves or denies the changes made through ChangeRepoFiles once their tree is
+// written, before they are committed and pushed, e.g. by asking an external policy service.
+// An error aborts the operation as a failure of the policy rather than a denial.
+type CommitPolicy interface {
+	CheckCommit(request *CommitPolicyRequest) (*CommitPolicyDecision, error)
+}
+
+var (
+	commitPoliciesLock sync.RWMutex
+	commitPolicies     []CommitPolicy
+)
+
+// RegisterCommitPolicy adds a policy every change made through ChangeRepoFiles must be approved
+// by. Policies are asked in the order they are registered, which may be at any time.
+func RegisterCommitPolicy(policy CommitPolicy) {
+	if policy == nil {
+		panic("repofiles: RegisterCommitPolicy policy is nil")
+	}
+	commitPoliciesLock.Lock()
+	defer commitPoliciesLock.Unlock()
+	commitPolicies = append(commitPolicies, policy)
+}
+
+// getCommitPolicies returns the policies registered so far
+func getCommitPolicies() []CommitPolicy {
+	commitPoliciesLock.RLock()
+	defer commitPoliciesLock.RUnlock()
+	return commitPolicies
+}
+
+// checkCommitPolicies asks the registered policies to approve the changes of the given tree,
+// returning ErrCommitPolicyDenied with the reason of the first one denying them
+func checkCommitPolicies(repo *models.Repository, doer *models.User, t *TemporaryUploadRepository, parentCommit *git.Commit, treeHash, message string, opts *ChangeRepoFilesOptions) error {
+	policies := getCommitPolicies()
+	if len(policies) == 0 {
+		return nil
+	}
+	changes, err := getFilesChanges(t, parentCommit, treeHash)
+	if err != nil {
+		return err
+	}
+	request := &CommitPolicyRequest{
+		Repo:            repo,
+		Doer:            doer,
+		Branch:          opts.NewBranch,
+		OldBranch:       opts.OldBranch,
+		CreateNewBranch: opts.CreateNewBranch,
+		Amend:           opts.Amend,
+		Force:           opts.Force,
+		Message:         message,
+		TreeID:          treeHash,
+		Changes:         changes,
+	}
+	for _, policy := range policies {
+		decision, err := policy.CheckCommit(request)
+		if err != nil {
+			return fmt.Errorf("CheckCommit: %v", err)
+		} else if decision == nil || !decision.Allowed {
+			reason := ""
+			if decision != nil {
+				reason = decision.Reason
+			}
+			return models.ErrCommitPolicyDenied{BranchName: opts.NewBranch, Reason: reason}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"strings"
+	"testing"
+
+	"code.gitea.io/gitea/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// secretsPolicy denies the changes touching the files of the secrets directory
+type secretsPolicy struct {
+	requests []*CommitPolicyRequest
+}
+
+func (policy *secretsPolicy) CheckCommit(request *CommitPolicyRequest) (*CommitPolicyDecision, error) {
+	policy.requests = append(policy.requests, request)
+	for _, change := range request.Changes {
+		for _, path := range []string{change.Path, change.OldPath} {
+			if strings.HasPrefix(path, "secrets/") {
+				return &CommitPolicyDecision{Reason: path + " is managed by the security team"}, nil
+			}
+		}
+	}
+	return &CommitPolicyDecision{Allowed: true}, nil
+}
+
+func setCommitPolicies(policies ...CommitPolicy) func() {
+	oldPolicies := commitPolicies
+	commitPolicies = nil
+	for _, policy := range policies {
+		RegisterCommitPolicy(policy)
+	}
+	return func() {
+		commitPolicies = oldPolicies
+	}
+}
+
+func TestChangeRepoFiles_CommitPolicy(t *testing.T) {
+	// A nil policy is refused when registered rather than when changes are committed
+	assert.Panics(t, func() { RegisterCommitPolicy(nil) })
+
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	pushTestFile(t, repo, doer, "secrets/token", "secret")
+	policy := &secretsPolicy{}
+	defer setCommitPolicies(policy)()
+
+	// The policy is given the changes to approve
+	_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		CommitOptions: CommitOptions{Message: "Add the docs"},
+		Files:         []*ChangeRepoFile{{Operation: "create", TreePath: "docs/a.txt", Content: "a"}},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, policy.requests, 1) {
+		request := policy.requests[0]
+		assert.EqualValues(t, repo.ID, request.Repo.ID)
+		assert.EqualValues(t, doer.ID, request.Doer.ID)
+		assert.EqualValues(t, "master", request.Branch)
+		assert.EqualValues(t, "Add the docs", request.Message)
+		assert.EqualValues(t, getBranchCommit(t, repo, "master").Tree.ID.String(), request.TreeID)
+		if assert.Len(t, request.Changes, 1) {
+			assert.EqualValues(t, "docs/a.txt", request.Changes[0].Path)
+			assert.EqualValues(t, "add", request.Changes[0].Type)
+		}
+	}
+
+	// Changes it denies are not committed, dry runs included
+	commitsCount := getCommitsCount(t, repo, "master")
+	for _, opts := range []*ChangeRepoFilesOptions{
+		{Files: []*ChangeRepoFile{{Operation: "update", TreePath: "secrets/token", Content: "leaked"}}},
+		{Files: []*ChangeRepoFile{{Operation: "rename", FromTreePath: "secrets/token", TreePath: "token"}}},
+		{DryRun: true, Files: []*ChangeRepoFile{{Operation: "delete", TreePath: "secrets/token"}}},
+	} {
+		_, err = ChangeRepoFiles(repo, doer, opts)
+		if assert.True(t, models.IsErrCommitPolicyDenied(err), "%v", err) {
+			assert.EqualValues(t, models.ErrCommitPolicyDenied{
+				BranchName: "master",
+				Reason:     "secrets/token is managed by the security team",
+			}, err)
+		}
+	}
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+	assert.EqualValues(t, "secret", getBranchFileContent(t, repo, "master", "secrets/token"))
+}
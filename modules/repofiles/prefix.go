@@ -0,0 +1,58 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"strings"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+)
+
+// checkPathPrefix makes sure the path prefix of the given options is a clean path, without empty,
+// "." or ".." components, of a directory of the commit the changes are made on top of
+func checkPathPrefix(repo *models.Repository, opts *ChangeRepoFilesOptions) error {
+	if CleanUploadFileName(opts.PathPrefix) != opts.PathPrefix {
+		return models.ErrFilenameInvalid{Path: opts.PathPrefix}
+	}
+	if repo.IsEmpty {
+		return models.ErrRepoFileDoesNotExist{FileName: opts.PathPrefix}
+	}
+
+	gitRepo, err := git.OpenRepository(repo.RepoPath())
+	if err != nil {
+		return err
+	}
+	commit, err := opts.getBaseCommit(gitRepo)
+	if err != nil {
+		return err
+	}
+	entry, err := commit.GetTreeEntryByPath(opts.PathPrefix)
+	if git.IsErrNotExist(err) {
+		return models.ErrRepoFileDoesNotExist{FileName: opts.PathPrefix}
+	} else if err != nil {
+		return err
+	} else if !entry.IsDir() {
+		return models.ErrFilePathConflict{Path: opts.PathPrefix}
+	}
+	return nil
+}
+
+// prefixTreePaths moves the paths of the given prepared files beneath the given checked prefix.
+// The paths given may not climb out of it with ".." components.
+func prefixTreePaths(prefix string, files []*ChangeRepoFile) error {
+	for _, file := range files {
+		for _, treePath := range []string{file.TreePath, file.FromTreePath} {
+			for _, part := range strings.Split(strings.Replace(treePath, "\\", "/", -1), "/") {
+				if part == ".." {
+					return models.ErrFilenameInvalid{Path: treePath}
+				}
+			}
+		}
+		file.treePath = prefix + "/" + file.treePath
+		file.fromTreePath = prefix + "/" + file.fromTreePath
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"testing"
+
+	"code.gitea.io/gitea/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeRepoFiles_PathPrefix(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	pushTestFile(t, repo, doer, "apps/web/index.html", "<html></html>\n")
+
+	filesResponse, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		PathPrefix: "apps/web",
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "src/main.js", Content: "main()\n"},
+			{Operation: "rename", FromTreePath: "index.html", TreePath: "public/index.html"},
+		},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, filesResponse.Files, 2) {
+		assert.EqualValues(t, "apps/web/src/main.js", filesResponse.Files[0].Path)
+		assert.EqualValues(t, "apps/web/public/index.html", filesResponse.Files[1].Path)
+	}
+	assert.EqualValues(t, "main()\n", getBranchFileContent(t, repo, "master", "apps/web/src/main.js"))
+	assert.EqualValues(t, "<html></html>\n", getBranchFileContent(t, repo, "master", "apps/web/public/index.html"))
+	assert.EqualValues(t, "Change 'apps/web/src/main.js', 'apps/web/public/index.html'\n", getBranchCommit(t, repo, "master").Message())
+
+	// The paths may not leave the prefix
+	commitsCount := getCommitsCount(t, repo, "master")
+	for _, file := range []*ChangeRepoFile{
+		{Operation: "create", TreePath: "../api/secret.txt", Content: "secret"},
+		{Operation: "create", TreePath: "src/..\\..\\..\\README.md", Content: "secret"},
+		{Operation: "rename", FromTreePath: "../../README.md", TreePath: "README.md"},
+	} {
+		_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+			PathPrefix: "apps/web",
+			Files:      []*ChangeRepoFile{file},
+		})
+		assert.True(t, models.IsErrFilenameInvalid(err), "%s: %v", file.TreePath, err)
+	}
+
+	// The prefix has to be a clean path of a directory
+	for prefix, isErr := range map[string]func(error) bool{
+		"apps/../apps/web":           models.IsErrFilenameInvalid,
+		"/apps/web":                  models.IsErrFilenameInvalid,
+		"apps/web/":                  models.IsErrFilenameInvalid,
+		"apps/api":                   models.IsErrRepoFileDoesNotExist,
+		"apps/web/public/index.html": models.IsErrFilePathConflict,
+	} {
+		_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+			PathPrefix: prefix,
+			Files:      []*ChangeRepoFile{{Operation: "create", TreePath: "new.txt", Content: "new"}},
+		})
+		assert.True(t, isErr(err), "%s: %v", prefix, err)
+	}
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+}
@@ -0,0 +1,53 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+// ChangeRepoFilesProgress tells how many of the file operations of a change are applied
+type ChangeRepoFilesProgress struct {
+	Files      int
+	TotalFiles int
+	// Bytes is the size of the contents written by the applied operations, the content of the
+	// files stored in LFS included
+	Bytes int64
+}
+
+// ProgressFunc is given the progress of a change as its file operations are applied. It is called
+// on the path of the change, so it should return quickly, e.g. by only recording the progress.
+type ProgressFunc func(progress ChangeRepoFilesProgress)
+
+// progressReporter calls the ProgressFunc of a change every interval applied files and after the last one
+type progressReporter struct {
+	progress ChangeRepoFilesProgress
+	report   ProgressFunc
+	interval int
+}
+
+func newProgressReporter(opts *ChangeRepoFilesOptions) *progressReporter {
+	interval := opts.ProgressInterval
+	if interval <= 0 {
+		interval = 1
+	}
+	return &progressReporter{
+		progress: ChangeRepoFilesProgress{TotalFiles: len(opts.Files)},
+		report:   opts.Progress,
+		interval: interval,
+	}
+}
+
+// applied records the given applied file
+func (p *progressReporter) applied(file *ChangeRepoFile) {
+	if p.report == nil {
+		return
+	}
+	p.progress.Files++
+	if file.lfsMetaObject != nil {
+		p.progress.Bytes += file.lfsMetaObject.Size
+	} else {
+		p.progress.Bytes += file.size
+	}
+	if p.progress.Files%p.interval == 0 || p.progress.Files == p.progress.TotalFiles {
+		p.report(p.progress)
+	}
+}
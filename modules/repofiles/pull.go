@@ -0,0 +1,98 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"fmt"
+	"strings"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/notification"
+)
+
+// getUniquePatchBranchName returns the first "<doer>-patch-<n>" branch name not used in the given repository
+func getUniquePatchBranchName(repo *models.Repository, doer *models.User) (string, error) {
+	gitRepo, err := git.OpenRepository(repo.RepoPath())
+	if err != nil {
+		return "", err
+	}
+	for i := 1; ; i++ {
+		branchName := fmt.Sprintf("%s-patch-%d", doer.LowerName, i)
+		if !gitRepo.IsBranchExist(branchName) {
+			return branchName, nil
+		}
+	}
+}
+
+// proposeOnPatchBranch makes the given options commit the changes on a new patch branch
+// created from the branch they target, returning that branch for the pull request to target
+func proposeOnPatchBranch(repo *models.Repository, doer *models.User, opts *ChangeRepoFilesOptions) (string, error) {
+	baseBranch := opts.NewBranch
+	patchBranch, err := getUniquePatchBranchName(repo, doer)
+	if err != nil {
+		return "", err
+	}
+	opts.OldBranch = baseBranch
+	opts.NewBranch = patchBranch
+	opts.CreateNewBranch = true
+	return baseBranch, nil
+}
+
+// createPullRequest opens a pull request of the given doer merging headBranch of the given head
+// repository, the repository itself or a fork of it, into baseBranch of the repository. Its title and
+// description are the subject and the body of the given message. The index of the new pull request
+// is returned.
+func createPullRequest(repo, headRepo *models.Repository, doer *models.User, baseBranch, headBranch, mergeBase, message string) (int64, error) {
+	// The next index is computed from the counts of issues, which the given repository may not be up to date with
+	repo, err := models.GetRepositoryByID(repo.ID)
+	if err != nil {
+		return 0, err
+	}
+	if headRepo.ID == repo.ID {
+		headRepo = repo
+	}
+	gitRepo, err := git.OpenRepository(headRepo.RepoPath())
+	if err != nil {
+		return 0, err
+	}
+	patch, err := gitRepo.GetPatch(mergeBase, headBranch)
+	if err != nil {
+		return 0, fmt.Errorf("GetPatch: %v", err)
+	}
+
+	title, content := message, ""
+	if i := strings.Index(message, "\n"); i != -1 {
+		title, content = message[:i], strings.TrimSpace(message[i+1:])
+	}
+	pullIssue := &models.Issue{
+		RepoID:   repo.ID,
+		Index:    repo.NextIssueIndex(),
+		Title:    title,
+		PosterID: doer.ID,
+		Poster:   doer,
+		IsPull:   true,
+		Content:  content,
+	}
+	pullRequest := &models.PullRequest{
+		HeadRepoID:   headRepo.ID,
+		BaseRepoID:   repo.ID,
+		HeadUserName: headRepo.MustOwner().Name,
+		HeadBranch:   headBranch,
+		BaseBranch:   baseBranch,
+		HeadRepo:     headRepo,
+		BaseRepo:     repo,
+		MergeBase:    mergeBase,
+		Type:         models.PullRequestGitea,
+	}
+	if err := models.NewPullRequest(repo, pullIssue, nil, nil, pullRequest, patch, nil); err != nil {
+		return 0, fmt.Errorf("NewPullRequest: %v", err)
+	} else if err := pullRequest.PushToBaseRepo(); err != nil {
+		return 0, fmt.Errorf("PushToBaseRepo: %v", err)
+	}
+
+	notification.NotifyNewPullRequest(pullRequest)
+	return pullIssue.Index, nil
+}
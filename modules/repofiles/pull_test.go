@@ -0,0 +1,81 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"testing"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeRepoFiles_CreatePullRequest(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	assert.NoError(t, models.UpdateProtectBranch(repo, &models.ProtectedBranch{
+		RepoID:     repo.ID,
+		BranchName: "master",
+	}, models.WhitelistOptions{}))
+
+	masterCommitsCount := getCommitsCount(t, repo, "master")
+	fileResponse, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{
+			Message:           "Propose a file\n\nIt is needed.",
+			CreatePullRequest: true,
+		},
+		TreePath: "proposed.txt",
+		Content:  "proposed",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, masterCommitsCount, getCommitsCount(t, repo, "master"))
+	assert.EqualValues(t, "proposed", getBranchFileContent(t, repo, "user2-patch-1", "proposed.txt"))
+
+	pr, err := models.GetPullRequestByIndex(repo.ID, fileResponse.PullRequestNumber)
+	assert.NoError(t, err)
+	assert.NoError(t, pr.LoadIssue())
+	assert.EqualValues(t, "master", pr.BaseBranch)
+	assert.EqualValues(t, "user2-patch-1", pr.HeadBranch)
+	assert.EqualValues(t, repo.ID, pr.HeadRepoID)
+	assert.EqualValues(t, "Propose a file", pr.Issue.Title)
+	assert.EqualValues(t, "It is needed.", pr.Issue.Content)
+	assert.EqualValues(t, doer.ID, pr.Issue.PosterID)
+
+	// The head of the pull request is the proposed commit
+	gitRepo, err := git.OpenRepository(repo.RepoPath())
+	assert.NoError(t, err)
+	headCommitID, err := gitRepo.GetRefCommitID(pr.GetGitRefName())
+	assert.NoError(t, err)
+	assert.EqualValues(t, fileResponse.Commit.SHA, headCommitID)
+
+	// Each proposal gets its own branch
+	fileResponse, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{CreatePullRequest: true},
+		TreePath:      "other.txt",
+		Content:       "other",
+	})
+	assert.NoError(t, err)
+	pr, err = models.GetPullRequestByIndex(repo.ID, fileResponse.PullRequestNumber)
+	assert.NoError(t, err)
+	assert.EqualValues(t, "user2-patch-2", pr.HeadBranch)
+	assert.NoError(t, pr.LoadIssue())
+	assert.EqualValues(t, "Add 'other.txt'", pr.Issue.Title)
+}
+
+func TestChangeRepoFiles_CreatePullRequestNotNeeded(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	// Unprotected branches are committed to directly
+	fileResponse, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{CreatePullRequest: true},
+		TreePath:      "direct.txt",
+		Content:       "direct",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, fileResponse.PullRequestNumber)
+	assert.EqualValues(t, "direct", getBranchFileContent(t, repo, "master", "direct.txt"))
+}
@@ -0,0 +1,68 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/setting"
+)
+
+// setSizeDeltas records how much the given hashed file grows the repository and its LFS objects,
+// its content replacing the one of the given entry unless it is nil
+func setSizeDeltas(file *ChangeRepoFile, fromEntry *git.TreeEntry) error {
+	file.sizeDelta = file.size
+	if file.lfsMetaObject != nil {
+		// The repository only grows by the pointer
+		file.sizeDelta = int64(len(lfsPointer(file.lfsMetaObject)))
+		file.lfsSizeDelta = file.lfsMetaObject.Size
+	}
+	if fromEntry == nil {
+		return nil
+	}
+
+	file.sizeDelta -= fromEntry.Size()
+	if file.lfsMetaObject != nil {
+		fromMeta, err := getLFSPointerOfEntry(fromEntry)
+		if err != nil {
+			return err
+		} else if fromMeta != nil {
+			file.lfsSizeDelta -= fromMeta.Size
+		}
+	}
+	return nil
+}
+
+// checkSizeQuotas makes sure the given applied files don't grow the given repository beyond its
+// size quota, nor its LFS objects beyond the LFS one. Changes which don't grow them are allowed
+// even if a quota is already exceeded.
+func checkSizeQuotas(repo *models.Repository, files []*ChangeRepoFile) error {
+	var sizeDelta, lfsSizeDelta int64
+	for _, file := range files {
+		sizeDelta += file.sizeDelta
+		lfsSizeDelta += file.lfsSizeDelta
+	}
+
+	if quota := setting.Repository.SizeQuota; quota > 0 && sizeDelta > 0 {
+		// The size is updated by each push, which the given repository may not be up to date with
+		current, err := models.GetRepositoryByID(repo.ID)
+		if err != nil {
+			return err
+		}
+		if current.Size+sizeDelta > quota {
+			return models.ErrQuotaExceeded{RepoName: repo.FullName(), Quota: quota}
+		}
+	}
+	if quota := setting.LFS.SizeQuota; quota > 0 && lfsSizeDelta > 0 {
+		lfsSize, err := repo.GetLFSSize()
+		if err != nil {
+			return err
+		}
+		if lfsSize+lfsSizeDelta > quota {
+			return models.ErrQuotaExceeded{RepoName: repo.FullName(), Quota: quota, LFS: true}
+		}
+	}
+	return nil
+}
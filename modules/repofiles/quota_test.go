@@ -0,0 +1,128 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/setting"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setSizeQuota sets the size quota to the current size of the given repository plus the given room
+func setSizeQuota(t *testing.T, repo *models.Repository, room int64) {
+	current, err := models.GetRepositoryByID(repo.ID)
+	assert.NoError(t, err)
+	setting.Repository.SizeQuota = current.Size + room
+}
+
+func TestChangeRepoFiles_SizeQuota(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	oldSizeQuota := setting.Repository.SizeQuota
+	defer func() {
+		setting.Repository.SizeQuota = oldSizeQuota
+	}()
+
+	setSizeQuota(t, repo, 9)
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "a.txt",
+		Content:  strings.Repeat("a", 10),
+	})
+	assert.EqualValues(t, models.ErrQuotaExceeded{RepoName: repo.FullName(), Quota: setting.Repository.SizeQuota}, err)
+	setSizeQuota(t, repo, 10)
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "a.txt",
+		Content:  strings.Repeat("a", 10),
+	})
+	assert.NoError(t, err)
+
+	// Only the growth of the replaced file counts
+	setSizeQuota(t, repo, 4)
+	_, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		TreePath: "a.txt",
+		Content:  strings.Repeat("a", 15),
+	})
+	assert.True(t, models.IsErrQuotaExceeded(err))
+	setSizeQuota(t, repo, 5)
+	_, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		TreePath: "a.txt",
+		Content:  strings.Repeat("a", 15),
+	})
+	assert.NoError(t, err)
+
+	// A repository over its quota can still shrink
+	setSizeQuota(t, repo, -100)
+	_, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		TreePath: "a.txt",
+		Content:  "a",
+	})
+	assert.NoError(t, err)
+	_, err = DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{
+		TreePath: "a.txt",
+	})
+	assert.NoError(t, err)
+}
+
+func TestChangeRepoFiles_LFSSizeQuota(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	contentPath, err := ioutil.TempDir("", "repofiles-lfs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(contentPath)
+	oldLFS := setting.LFS
+	oldSizeQuota := setting.Repository.SizeQuota
+	setting.LFS.StartServer = true
+	setting.LFS.ContentPath = contentPath
+	defer func() {
+		setting.LFS = oldLFS
+		setting.Repository.SizeQuota = oldSizeQuota
+	}()
+
+	pushTestFile(t, repo, doer, ".gitattributes", "*.bin filter=lfs diff=lfs merge=lfs -text\n")
+	// The LFS objects of the repository are not part of the fixtures, other tests may have left some
+	lfsSize, err := repo.GetLFSSize()
+	assert.NoError(t, err)
+	setting.LFS.SizeQuota = lfsSize + 1024
+
+	// The LFS objects count against their own quota, the repository only grows by their pointers
+	setSizeQuota(t, repo, 200)
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "a.bin",
+		Content:  strings.Repeat("a", 1000),
+	})
+	assert.NoError(t, err)
+	setSizeQuota(t, repo, 200)
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "b.bin",
+		Content:  strings.Repeat("b", 25),
+	})
+	assert.EqualValues(t, models.ErrQuotaExceeded{RepoName: repo.FullName(), Quota: setting.LFS.SizeQuota, LFS: true}, err)
+	setting.Repository.SizeQuota = 0
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "b.bin",
+		Content:  strings.Repeat("b", 24),
+	})
+	assert.NoError(t, err)
+
+	// Only the growth of the replaced object counts
+	_, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		TreePath: "b.bin",
+		Content:  strings.Repeat("b", 25),
+	})
+	assert.True(t, models.IsErrQuotaExceeded(err))
+	_, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		TreePath: "a.bin",
+		Content:  strings.Repeat("c", 1000),
+	})
+	assert.NoError(t, err)
+}
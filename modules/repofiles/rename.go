@@ -0,0 +1,85 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/structs"
+)
+
+// RenameRepoFileOptions holds the repository rename file options
+type RenameRepoFileOptions struct {
+	CommitOptions
+	// FromTreePath is the current path of the file or directory, TreePath the one it is moved to
+	FromTreePath string
+	TreePath     string
+	// SHA of the blob or tree currently at FromTreePath, checked against the branch when given
+	SHA string
+	// Overwrite replaces the files already existing at the destination
+	Overwrite bool
+}
+
+// RenameRepoFile moves a file in the given repository without changing its content. If
+// FromTreePath is a directory, all the files beneath it are moved.
+func RenameRepoFile(repo *models.Repository, doer *models.User, opts *RenameRepoFileOptions) (*structs.FileResponse, error) {
+	changeOpts := &ChangeRepoFilesOptions{
+		CommitOptions: opts.CommitOptions,
+		Files: []*ChangeRepoFile{{
+			Operation:    "rename",
+			TreePath:     opts.TreePath,
+			FromTreePath: opts.FromTreePath,
+			SHA:          opts.SHA,
+			Overwrite:    opts.Overwrite,
+		}},
+	}
+	filesResponse, err := ChangeRepoFiles(repo, doer, changeOpts)
+	if err != nil {
+		return nil, err
+	}
+	return fileResponseFromFiles(filesResponse), nil
+}
+
+// RenameRepoDirectory moves the directory of the given repository at FromTreePath to TreePath in a
+// single commit, as RenameRepoFile does, all the files beneath it keeping their blobs so that git
+// records them as renamed. Unless Overwrite is set, none of the files moved may land on an existing
+// one. It fails with ErrFilePathConflict if FromTreePath is not a directory of the branch.
+func RenameRepoDirectory(repo *models.Repository, doer *models.User, opts *RenameRepoFileOptions) (*structs.FileResponse, error) {
+	if repo.IsEmpty {
+		return nil, models.ErrRepoIsEmpty{RepoName: repo.FullName()}
+	}
+	fromTreePath := CleanUploadFileName(opts.FromTreePath)
+	if fromTreePath == "" {
+		return nil, models.ErrFilenameInvalid{Path: opts.FromTreePath}
+	}
+
+	branchOpts := &ChangeRepoFilesOptions{
+		CommitOptions: CommitOptions{
+			OldBranch:       opts.OldBranch,
+			NewBranch:       opts.NewBranch,
+			CreateNewBranch: opts.CreateNewBranch,
+		},
+	}
+	if err := branchOpts.checkBranches(repo); err != nil {
+		return nil, err
+	}
+	gitRepo, err := git.OpenRepository(repo.RepoPath())
+	if err != nil {
+		return nil, err
+	}
+	commit, err := branchOpts.getBaseCommit(gitRepo)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := commit.GetTreeEntryByPath(fromTreePath)
+	if git.IsErrNotExist(err) {
+		return nil, models.ErrRepoFileDoesNotExist{FileName: fromTreePath}
+	} else if err != nil {
+		return nil, err
+	} else if !entry.IsDir() {
+		return nil, models.ErrFilePathConflict{Path: fromTreePath}
+	}
+	return RenameRepoFile(repo, doer, opts)
+}
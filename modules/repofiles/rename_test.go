@@ -0,0 +1,189 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"strings"
+	"testing"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getFileHistoryNameStatus(t *testing.T, repo *models.Repository, branch, treePath string) string {
+	stdout, err := git.NewCommand("log", "--follow", "--name-status", "--format=", branch, "--", treePath).RunInDir(repo.RepoPath())
+	assert.NoError(t, err)
+	return strings.TrimSpace(stdout)
+}
+
+func TestRenameRepoFile(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	fileResponse, err := RenameRepoFile(repo, doer, &RenameRepoFileOptions{
+		FromTreePath: "README.md",
+		TreePath:     "docs/README.md",
+		SHA:          readmeSHA,
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "docs/README.md", fileResponse.Content.Path)
+	assert.EqualValues(t, readmeSHA, fileResponse.Content.SHA)
+	assert.EqualValues(t, "Rename 'README.md' to 'docs/README.md'\n", fileResponse.Commit.Message)
+	assert.EqualValues(t, "R100\tREADME.md\tdocs/README.md\nA\tREADME.md",
+		getFileHistoryNameStatus(t, repo, "master", "docs/README.md"))
+}
+
+func TestRenameRepoFile_Errors(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := RenameRepoFile(repo, doer, &RenameRepoFileOptions{
+		TreePath: "docs/README.md",
+	})
+	assert.True(t, models.IsErrFilenameInvalid(err))
+
+	_, err = RenameRepoFile(repo, doer, &RenameRepoFileOptions{
+		FromTreePath: "missing.md",
+		TreePath:     "docs/missing.md",
+	})
+	assert.True(t, models.IsErrRepoFileDoesNotExist(err))
+
+	_, err = RenameRepoFile(repo, doer, &RenameRepoFileOptions{
+		FromTreePath: "README.md",
+		TreePath:     "docs/README.md",
+		SHA:          "0000000000000000000000000000000000000000",
+	})
+	assert.True(t, models.IsErrSHADoesNotMatch(err))
+	assert.EqualValues(t, "1", getCommitsCount(t, repo, "master"))
+}
+
+func TestRenameRepoFile_Overwrite(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	content := getBranchFileContent(t, repo, "master", "README.md")
+
+	_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "old/README.md", Content: "old"},
+			{Operation: "create", TreePath: "dir/a.md", Content: "a"},
+		},
+	})
+	assert.NoError(t, err)
+
+	_, err = RenameRepoFile(repo, doer, &RenameRepoFileOptions{
+		FromTreePath: "README.md",
+		TreePath:     "old/README.md",
+	})
+	assert.True(t, models.IsErrRepoFileAlreadyExist(err))
+
+	// A directory is never replaced, even when overwriting
+	_, err = RenameRepoFile(repo, doer, &RenameRepoFileOptions{
+		FromTreePath: "README.md",
+		TreePath:     "dir",
+		Overwrite:    true,
+	})
+	assert.True(t, models.IsErrFileDirectoryConflict(err))
+
+	_, err = RenameRepoFile(repo, doer, &RenameRepoFileOptions{
+		FromTreePath: "README.md",
+		TreePath:     "old/README.md",
+		Overwrite:    true,
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, content, getBranchFileContent(t, repo, "master", "old/README.md"))
+	assert.EqualValues(t, "D\tREADME.md\nM\told/README.md", getLastCommitNameStatus(t, repo, "master"))
+}
+
+func TestRenameRepoFile_Directory(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "docs/a.md", Content: "a"},
+			{Operation: "create", TreePath: "docs/sub/b.md", Content: "b"},
+			{Operation: "create", TreePath: "docs.md", Content: "docs"},
+		},
+	})
+	assert.NoError(t, err)
+
+	// A directory can't be moved into itself nor onto a file
+	for _, treePath := range []string{"docs/sub/docs", "docs.md"} {
+		_, err = RenameRepoFile(repo, doer, &RenameRepoFileOptions{
+			FromTreePath: "docs",
+			TreePath:     treePath,
+		})
+		assert.Error(t, err, treePath)
+	}
+
+	fileResponse, err := RenameRepoFile(repo, doer, &RenameRepoFileOptions{
+		FromTreePath: "docs",
+		TreePath:     "manual/docs",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "dir", fileResponse.Content.Type)
+	assert.EqualValues(t, "Rename 'docs' to 'manual/docs'\n", fileResponse.Commit.Message)
+	assert.EqualValues(t, "R100\tdocs/a.md\tmanual/docs/a.md\nR100\tdocs/sub/b.md\tmanual/docs/sub/b.md",
+		getLastCommitNameStatus(t, repo, "master"))
+	assert.True(t, strings.HasPrefix(getFileHistoryNameStatus(t, repo, "master", "manual/docs/sub/b.md"),
+		"R100\tdocs/sub/b.md\tmanual/docs/sub/b.md"))
+
+	// Other operations can't touch the files being moved
+	_, err = ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{
+			{Operation: "rename", FromTreePath: "manual/docs", TreePath: "docs"},
+			{Operation: "update", TreePath: "manual/docs/a.md", Content: "updated a"},
+		},
+	})
+	assert.True(t, models.IsErrFilePathConflict(err))
+}
+
+func TestRenameRepoDirectory(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "src/main.go", Content: "package main\n"},
+			{Operation: "create", TreePath: "src/util.go", Content: "package main\n\nfunc util() {}\n"},
+			{Operation: "create", TreePath: "src/lib/lib.go", Content: "package lib\n"},
+			{Operation: "create", TreePath: "cmd/util.go", Content: "package cmd\n"},
+		},
+	})
+	assert.NoError(t, err)
+	commitsCount := getCommitsCount(t, repo, "master")
+
+	// Only directories are moved
+	_, err = RenameRepoDirectory(repo, doer, &RenameRepoFileOptions{FromTreePath: "README.md", TreePath: "docs"})
+	assert.True(t, models.IsErrFilePathConflict(err), "%v", err)
+	_, err = RenameRepoDirectory(repo, doer, &RenameRepoFileOptions{FromTreePath: "missing", TreePath: "docs"})
+	assert.True(t, models.IsErrRepoFileDoesNotExist(err), "%v", err)
+
+	// Nor onto the files already there, unless they are overwritten
+	_, err = RenameRepoDirectory(repo, doer, &RenameRepoFileOptions{FromTreePath: "src", TreePath: "cmd"})
+	assert.True(t, models.IsErrRepoFileAlreadyExist(err), "%v", err)
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+
+	fileResponse, err := RenameRepoDirectory(repo, doer, &RenameRepoFileOptions{
+		FromTreePath: "src",
+		TreePath:     "cmd",
+		Overwrite:    true,
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "dir", fileResponse.Content.Type)
+	assert.EqualValues(t, fileResponse.Commit.SHA, getBranchCommit(t, repo, "master").ID.String())
+	assert.EqualValues(t, "package main\n\nfunc util() {}\n", getBranchFileContent(t, repo, "master", "cmd/util.go"))
+	// The history of each file moved follows it, that of the file overwritten being its own
+	for _, name := range []string{"main.go", "lib/lib.go"} {
+		assert.True(t, strings.HasPrefix(getFileHistoryNameStatus(t, repo, "master", "cmd/"+name),
+			"R100\tsrc/"+name+"\tcmd/"+name), name)
+		assert.True(t, strings.HasSuffix(getFileHistoryNameStatus(t, repo, "master", "cmd/"+name),
+			"A\tsrc/"+name), name)
+	}
+	_, err = GetRepoFileContent(repo, "master", "src", false)
+	assert.True(t, models.IsErrRepoFileDoesNotExist(err), "%v", err)
+}
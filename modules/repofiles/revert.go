@@ -0,0 +1,115 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/base"
+	"code.gitea.io/gitea/modules/setting"
+	"code.gitea.io/gitea/modules/structs"
+)
+
+// RevertRepoFileOptions holds the repository revert file options
+type RevertRepoFileOptions struct {
+	CommitOptions
+	TreePath string
+	// FromCommitID is the commit whose version of the file is restored
+	FromCommitID string
+}
+
+// RevertRepoFile restores the file of the given repository at TreePath to its content and mode in
+// FromCommitID, creating it again if it was deleted since. If there was no file at TreePath in that
+// commit, the file is deleted, the response then describing it before.
+func RevertRepoFile(repo *models.Repository, doer *models.User, opts *RevertRepoFileOptions) (*structs.FileResponse, error) {
+	if repo.IsEmpty {
+		return nil, models.ErrRepoIsEmpty{RepoName: repo.FullName()}
+	}
+	treePath := CleanUploadFileName(opts.TreePath)
+	if treePath == "" {
+		return nil, models.ErrFilenameInvalid{Path: opts.TreePath}
+	}
+	gitRepo, err := git.OpenRepository(repo.RepoPath())
+	if err != nil {
+		return nil, err
+	}
+	fromCommitID, err := resolveCommitID(repo, opts.FromCommitID)
+	if err != nil {
+		return nil, err
+	}
+	fromCommit, err := gitRepo.GetCommit(fromCommitID)
+	if err != nil {
+		return nil, err
+	}
+
+	message := opts.Message
+	if strings.TrimSpace(message) == "" {
+		message = fmt.Sprintf("Revert '%s' to %s", treePath, base.ShortSha(fromCommitID))
+	}
+	changeOpts := &ChangeRepoFilesOptions{CommitOptions: opts.CommitOptions}
+	changeOpts.Message = message
+	if err := changeOpts.checkBranches(repo); err != nil {
+		return nil, err
+	}
+
+	file := &ChangeRepoFile{TreePath: opts.TreePath}
+	entry, err := getExistingEntry(fromCommit, treePath, "")
+	if models.IsErrRepoFileDoesNotExist(err) {
+		file.Operation = "delete"
+	} else if err != nil {
+		return nil, err
+	} else if entry.IsSubModule() {
+		return nil, models.ErrEntryIsSubmodule{Path: treePath}
+	} else if entry.IsDir() {
+		return nil, models.ErrFilePathConflict{Path: treePath}
+	} else {
+		content, err := openEntryContent(repo, entry)
+		if err != nil {
+			return nil, err
+		}
+		defer content.Close()
+		file.ContentReader = content
+		if entry.IsLink() {
+			file.Symlink = true
+		} else {
+			file.Mode = fmt.Sprintf("%x", entry.Mode())
+		}
+
+		// The file is updated if it is still there, the branch being checked again when committing
+		file.Operation = "create"
+		if headCommit, err := changeOpts.getBaseCommit(gitRepo); err == nil {
+			if _, err := headCommit.GetTreeEntryByPath(treePath); err == nil {
+				file.Operation = "update"
+			}
+		}
+	}
+	changeOpts.Files = []*ChangeRepoFile{file}
+
+	filesResponse, err := changeRepoFiles(repo, doer, changeOpts)
+	if err != nil {
+		return nil, err
+	}
+	return fileResponseFromFiles(filesResponse), nil
+}
+
+// openEntryContent opens the content of the file of the given tree entry of the repository, which
+// is the content of the LFS object it points to if that object is stored on this server
+func openEntryContent(repo *models.Repository, entry *git.TreeEntry) (io.ReadCloser, error) {
+	if !entry.IsLink() && setting.LFS.StartServer {
+		pointer, err := getLFSPointerOfEntry(entry)
+		if err != nil {
+			return nil, err
+		} else if pointer != nil {
+			if dataRc, err := openLFSContent(repo, pointer); err != nil || dataRc != nil {
+				return dataRc, err
+			}
+		}
+	}
+	return entry.Blob().DataAsync()
+}
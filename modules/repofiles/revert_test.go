@@ -0,0 +1,97 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"testing"
+
+	"code.gitea.io/gitea/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRevertRepoFile(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	baseCommitID := getBranchCommit(t, repo, "master").ID.String()
+	fileResponse, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "script.sh",
+		Content:  "echo first\n",
+		Mode:     "100755",
+	})
+	assert.NoError(t, err)
+	firstCommitID := fileResponse.Commit.SHA
+	_, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		TreePath: "script.sh",
+		Content:  "echo second\n",
+		Mode:     "100644",
+	})
+	assert.NoError(t, err)
+
+	// The older content and mode are restored, the commit being given abbreviated
+	fileResponse, err = RevertRepoFile(repo, doer, &RevertRepoFileOptions{
+		TreePath:     "script.sh",
+		FromCommitID: firstCommitID[:10],
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "script.sh", fileResponse.Content.Path)
+	assert.EqualValues(t, "Revert 'script.sh' to "+firstCommitID[:10]+"\n", fileResponse.Commit.Message)
+	assert.EqualValues(t, "echo first\n", getBranchFileContent(t, repo, "master", "script.sh"))
+	assert.EqualValues(t, "100755", getBranchFileMode(t, repo, "master", "script.sh"))
+
+	// Restoring it as it is changes nothing
+	_, err = RevertRepoFile(repo, doer, &RevertRepoFileOptions{
+		TreePath:     "script.sh",
+		FromCommitID: firstCommitID,
+	})
+	assert.True(t, models.IsErrEmptyCommit(err), "%v", err)
+
+	// A file that didn't exist yet is deleted
+	fileResponse, err = RevertRepoFile(repo, doer, &RevertRepoFileOptions{
+		CommitOptions: CommitOptions{Message: "Remove the script"},
+		TreePath:      "script.sh",
+		FromCommitID:  baseCommitID,
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "script.sh", fileResponse.Content.Path)
+	assert.EqualValues(t, "Remove the script\n", fileResponse.Commit.Message)
+	_, err = GetRepoFileContent(repo, "master", "script.sh", false)
+	assert.True(t, models.IsErrRepoFileDoesNotExist(err), "%v", err)
+}
+
+func TestRevertRepoFile_Deleted(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	readmeCommitID := getBranchCommit(t, repo, "master").ID.String()
+	readme := getBranchFileContent(t, repo, "master", "README.md")
+	_, err := DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{TreePath: "README.md"})
+	assert.NoError(t, err)
+
+	// A file deleted since is created again, on a new branch here
+	_, err = RevertRepoFile(repo, doer, &RevertRepoFileOptions{
+		CommitOptions: CommitOptions{NewBranch: "restore-readme", CreateNewBranch: true},
+		TreePath:      "README.md",
+		FromCommitID:  readmeCommitID,
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, readme, getBranchFileContent(t, repo, "restore-readme", "README.md"))
+	assert.EqualValues(t, "100644", getBranchFileMode(t, repo, "restore-readme", "README.md"))
+
+	commitsCount := getCommitsCount(t, repo, "master")
+	for _, commitID := range []string{"0123456789abcdef0123456789abcdef01234567", "--all", "", "develop:README.md"} {
+		_, err = RevertRepoFile(repo, doer, &RevertRepoFileOptions{
+			TreePath:     "README.md",
+			FromCommitID: commitID,
+		})
+		if assert.True(t, models.IsErrCommitNotExist(err), "%s: %v", commitID, err) {
+			assert.EqualValues(t, commitID, err.(models.ErrCommitNotExist).ID)
+		}
+	}
+	_, err = RevertRepoFile(repo, doer, &RevertRepoFileOptions{TreePath: ".git/config", FromCommitID: readmeCommitID})
+	assert.True(t, models.IsErrFilenameInvalid(err), "%v", err)
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+}
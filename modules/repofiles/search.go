@@ -0,0 +1,128 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/process"
+)
+
+// FindRepoFilesMaxPageSize is the largest number of matches FindRepoFiles returns at once
+const FindRepoFilesMaxPageSize = 100
+
+// FileMatch is a line of a file of a repository matching a search
+type FileMatch struct {
+	Path string
+	// Line is the number of the matching line, starting at 1
+	Line    int
+	Content string
+}
+
+// FindRepoFiles returns the lines of the text files at the given ref of the given repository, which may be
+// a branch, a tag or a commit, containing the given string. The matches are sorted by path and line and
+// paginated, page starting at 1 and pageSize being at most FindRepoFilesMaxPageSize.
+func FindRepoFiles(repo *models.Repository, ref, pattern string, page, pageSize int) ([]*FileMatch, error) {
+	if repo.IsEmpty {
+		return nil, models.ErrRepoIsEmpty{RepoName: repo.FullName()}
+	}
+	if pattern == "" {
+		return nil, fmt.Errorf("empty search pattern")
+	}
+	if page < 1 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > FindRepoFilesMaxPageSize {
+		pageSize = FindRepoFilesMaxPageSize
+	}
+
+	gitRepo, err := git.OpenRepository(repo.RepoPath())
+	if err != nil {
+		return nil, err
+	}
+	commit, err := gitRepo.GetCommit(ref)
+	if err != nil {
+		return nil, fmt.Errorf("GetCommit [ref: %s]: %v", ref, err)
+	}
+	commitID := commit.ID.String()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	stdErr := new(bytes.Buffer)
+	cmd := exec.CommandContext(ctx, "git", "grep", "--null", "--line-number", "-I", "--fixed-strings", "-e", pattern, commitID, "--")
+	cmd.Dir = repo.RepoPath()
+	cmd.Stderr = stdErr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	pid := process.GetManager().Add(fmt.Sprintf("FindRepoFiles (git grep): %s", repo.RepoPath()), cmd)
+	defer process.GetManager().Remove(pid)
+
+	// Only the matches up to the requested page are read, git is stopped once it is full
+	matches, err := readFileMatches(stdout, commitID+":", (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == pageSize {
+		cancel()
+		cmd.Wait()
+		return matches, nil
+	}
+	if err := cmd.Wait(); err != nil {
+		// No stderr but exit status 1 means nothing matches
+		if stdErr.Len() > 0 || err.Error() != "exit status 1" {
+			return nil, fmt.Errorf("FindRepoFiles: %v %s", err, stdErr)
+		}
+	}
+	return matches, nil
+}
+
+// readFileMatches parses the matches output by git grep --null --line-number, their paths starting
+// with the given prefix, skipping the given number of them and reading up to limit ones
+func readFileMatches(r io.Reader, prefix string, skip, limit int) ([]*FileMatch, error) {
+	matches := make([]*FileMatch, 0, limit)
+	reader := bufio.NewReader(r)
+	for len(matches) < limit {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF && line == "" {
+			break
+		} else if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+
+		fields := strings.SplitN(strings.TrimSuffix(line, "\n"), "\x00", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("FindRepoFiles: unexpected output %q", line)
+		}
+		lineNumber, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("FindRepoFiles: unexpected line number %q", fields[1])
+		}
+		matches = append(matches, &FileMatch{
+			Path:    strings.TrimPrefix(fields[0], prefix),
+			Line:    lineNumber,
+			Content: fields[2],
+		})
+	}
+	return matches, nil
+}
@@ -0,0 +1,59 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"testing"
+
+	"code.gitea.io/gitea/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindRepoFiles(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "a.txt", Content: "needle\nhay\nmore needles\n"},
+			{Operation: "create", TreePath: "dir/b.txt", Content: "hay\nneedle [not a regexp]\n"},
+			{Operation: "create", TreePath: "hay.txt", Content: "hay\n"},
+			{Operation: "create", TreePath: "binary.bin", Content: "needle\x00"},
+		},
+	})
+	assert.NoError(t, err)
+
+	matches, err := FindRepoFiles(repo, "master", "needle", 1, 0)
+	assert.NoError(t, err)
+	assert.EqualValues(t, []*FileMatch{
+		{Path: "a.txt", Line: 1, Content: "needle"},
+		{Path: "a.txt", Line: 3, Content: "more needles"},
+		{Path: "dir/b.txt", Line: 2, Content: "needle [not a regexp]"},
+	}, matches)
+
+	// The pattern is no regular expression
+	matches, err = FindRepoFiles(repo, "master", "[not a regexp]", 1, 0)
+	assert.NoError(t, err)
+	assert.EqualValues(t, []*FileMatch{{Path: "dir/b.txt", Line: 2, Content: "needle [not a regexp]"}}, matches)
+
+	matches, err = FindRepoFiles(repo, "master", "needle", 1, 2)
+	assert.NoError(t, err)
+	assert.Len(t, matches, 2)
+	matches, err = FindRepoFiles(repo, "master", "needle", 2, 2)
+	assert.NoError(t, err)
+	assert.EqualValues(t, []*FileMatch{{Path: "dir/b.txt", Line: 2, Content: "needle [not a regexp]"}}, matches)
+	matches, err = FindRepoFiles(repo, "master", "needle", 3, 2)
+	assert.NoError(t, err)
+	assert.Empty(t, matches)
+
+	// Other refs are searched as they are
+	matches, err = FindRepoFiles(repo, "develop", "needle", 1, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, matches)
+
+	_, err = FindRepoFiles(repo, "missing", "needle", 1, 0)
+	assert.Error(t, err)
+}
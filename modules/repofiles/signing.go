@@ -0,0 +1,144 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"strings"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/setting"
+)
+
+// signingKeyID returns the ID of the GPG key configured to sign commits with,
+// or an empty string if commits are not to be signed
+func signingKeyID() string {
+	switch setting.Repository.Signing.SigningKey {
+	case "", "none":
+		return ""
+	case "default":
+		// Git fails when the key isn't set, which just means there is nothing to sign with
+		stdout, err := git.NewCommand("config", "--get", "user.signingkey").Run()
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(stdout)
+	default:
+		return setting.Repository.Signing.SigningKey
+	}
+}
+
+// shouldSignCommit checks the CRUD_ACTIONS signing rules for a commit by the doer on top of the parent commit
+func shouldSignCommit(doer *models.User, parentCommit *git.Commit) (bool, error) {
+	for _, rule := range setting.Repository.Signing.CRUDActions {
+		switch strings.TrimSpace(rule) {
+		case "never":
+			return false, nil
+		case "pubkey":
+			keys, err := models.ListGPGKeys(doer.ID)
+			if err != nil {
+				return false, err
+			} else if len(keys) == 0 {
+				return false, nil
+			}
+		case "parentsigned":
+			// The first commit of a repository has no parent to follow
+			if parentCommit != nil && !models.ParseCommitWithSignature(parentCommit).Verified {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// normalizeKeyID returns the given GPG key ID or fingerprint in upper case, without spaces or 0x prefix
+func normalizeKeyID(keyID string) string {
+	keyID = strings.ToUpper(strings.Replace(strings.TrimSpace(keyID), " ", "", -1))
+	return strings.TrimPrefix(keyID, "0X")
+}
+
+// keyIDMatches checks whether the given normalized key IDs or fingerprints designate the same key,
+// long key IDs being the end of the fingerprints. Short key IDs are too easily forged to match.
+func keyIDMatches(keyID, otherKeyID string) bool {
+	if len(keyID) < 16 || len(otherKeyID) < 16 {
+		return false
+	}
+	return strings.HasSuffix(keyID, otherKeyID) || strings.HasSuffix(otherKeyID, keyID)
+}
+
+// isSigningKeyAllowed checks whether the doer may sign a commit of the given repository with the key
+// of the given normalized ID: the signing key of the instance, a signing key registered by the doer
+// or one registered by the organization owning the repository for its members
+func isSigningKeyAllowed(repo *models.Repository, doer *models.User, keyID string) (bool, error) {
+	if keyIDMatches(keyID, normalizeKeyID(signingKeyID())) {
+		return true, nil
+	}
+
+	ownerIDs := []int64{doer.ID}
+	if err := repo.GetOwner(); err != nil {
+		return false, err
+	} else if repo.Owner.IsOrganization() {
+		isMember, err := repo.Owner.IsOrgMember(doer.ID)
+		if err != nil {
+			return false, err
+		} else if isMember {
+			ownerIDs = append(ownerIDs, repo.Owner.ID)
+		}
+	}
+	for _, ownerID := range ownerIDs {
+		keys, err := models.ListGPGKeys(ownerID)
+		if err != nil {
+			return false, err
+		}
+		for _, key := range keys {
+			for _, signingKey := range append([]*models.GPGKey{key}, key.SubsKey...) {
+				if signingKey.CanSign && keyIDMatches(keyID, signingKey.KeyID) {
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+// getCommitSigningKey returns the ID of the key to sign a commit by the doer on top of the
+// parent commit in the given branch with, or an empty string if it is not to be signed.
+// The key given, if any, is always used when allowed, even by the signing rules, and refused
+// with ErrSigningKeyNotAllowed otherwise, as it is when signing is disabled.
+// Branches protected to require signed commits are refused an unsigned commit.
+func getCommitSigningKey(repo *models.Repository, doer *models.User, branch string, parentCommit *git.Commit, requestedKeyID string) (string, error) {
+	keyID := signingKeyID()
+	if requestedKeyID != "" {
+		normalizedKeyID := normalizeKeyID(requestedKeyID)
+		allowed := false
+		if keyID != "" {
+			var err error
+			if allowed, err = isSigningKeyAllowed(repo, doer, normalizedKeyID); err != nil {
+				return "", err
+			}
+		}
+		if !allowed {
+			return "", models.ErrSigningKeyNotAllowed{KeyID: requestedKeyID, UserName: doer.Name}
+		}
+		return normalizedKeyID, nil
+	}
+
+	if keyID != "" {
+		sign, err := shouldSignCommit(doer, parentCommit)
+		if err != nil {
+			return "", err
+		} else if sign {
+			return keyID, nil
+		}
+	}
+
+	protectBranch, err := models.GetProtectedBranchBy(repo.ID, branch)
+	if err != nil {
+		return "", err
+	} else if protectBranch != nil && protectBranch.RequireSignedCommits {
+		return "", models.ErrSignedCommitRequired{BranchName: branch}
+	}
+	return "", nil
+}
@@ -0,0 +1,190 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/setting"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setupSigningKey generates a GPG key without passphrase in a temporary GNUPGHOME and
+// configures it as the signing key, returning its fingerprint and a function restoring the setup
+func setupSigningKey(t *testing.T) (string, func()) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg is not available")
+	}
+
+	gnupgHome, err := ioutil.TempDir("", "repofiles-gnupg")
+	assert.NoError(t, err)
+	oldGnupgHome := os.Getenv("GNUPGHOME")
+	oldSigning := setting.Repository.Signing
+	cleanup := func() {
+		setting.Repository.Signing = oldSigning
+		os.Setenv("GNUPGHOME", oldGnupgHome)
+		os.RemoveAll(gnupgHome)
+	}
+	os.Setenv("GNUPGHOME", gnupgHome)
+
+	fingerprint := generateSigningKey(t, "Gitea Signing <signing@example.com>")
+	assert.NotEmpty(t, fingerprint)
+
+	setting.Repository.Signing.SigningKey = fingerprint
+	setting.Repository.Signing.CRUDActions = []string{"always"}
+	return fingerprint, cleanup
+}
+
+// generateSigningKey generates a GPG key without passphrase for the given user ID in the current
+// GNUPGHOME, returning its fingerprint
+func generateSigningKey(t *testing.T, userID string) string {
+	assert.NoError(t, exec.Command("gpg", "--batch", "--passphrase", "", "--quick-gen-key",
+		userID, "ed25519", "sign", "never").Run())
+	stdout, err := exec.Command("gpg", "--list-secret-keys", "--with-colons", "="+userID).Output()
+	assert.NoError(t, err)
+	for _, line := range strings.Split(string(stdout), "\n") {
+		if strings.HasPrefix(line, "fpr:") {
+			return strings.Trim(line, "fpr:")
+		}
+	}
+	return ""
+}
+
+func getLastCommitSignature(t *testing.T, repo *models.Repository, branch string) string {
+	stdout, err := git.NewCommand("log", "-1", "--format=%G? %GF", branch).RunInDir(repo.RepoPath())
+	assert.NoError(t, err)
+	return strings.TrimSpace(stdout)
+}
+
+func TestChangeRepoFiles_Signed(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	fingerprint, cleanup := setupSigningKey(t)
+	defer cleanup()
+
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{Message: "Add signed.txt"},
+		TreePath:      "signed.txt",
+		Content:       "signed",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "G "+fingerprint, getLastCommitSignature(t, repo, "master"))
+}
+
+func TestChangeRepoFiles_SigningRules(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	_, cleanup := setupSigningKey(t)
+	defer cleanup()
+
+	// The doer has no GPG key registered and the parent commit is unsigned
+	for _, rule := range []string{"never", "pubkey", "parentsigned"} {
+		setting.Repository.Signing.CRUDActions = []string{rule}
+		_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+			CommitOptions: CommitOptions{Message: "Add " + rule + ".txt"},
+			TreePath:      rule + ".txt",
+			Content:       rule,
+		})
+		assert.NoError(t, err)
+		assert.EqualValues(t, "N", getLastCommitSignature(t, repo, "master"), rule)
+	}
+}
+
+func TestChangeRepoFiles_SignedCommitRequired(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	oldSigningKey := setting.Repository.Signing.SigningKey
+	setting.Repository.Signing.SigningKey = "none"
+	defer func() {
+		setting.Repository.Signing.SigningKey = oldSigningKey
+	}()
+
+	assert.NoError(t, models.UpdateProtectBranch(repo, &models.ProtectedBranch{
+		RepoID:               repo.ID,
+		BranchName:           "master",
+		EnableWhitelist:      true,
+		RequireSignedCommits: true,
+	}, models.WhitelistOptions{UserIDs: []int64{doer.ID}}))
+
+	commitsCount := getCommitsCount(t, repo, "master")
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{Message: "Add unsigned.txt"},
+		TreePath:      "unsigned.txt",
+		Content:       "unsigned",
+	})
+	assert.True(t, models.IsErrSignedCommitRequired(err))
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+
+	// Other branches are not affected
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{
+			OldBranch:       "master",
+			NewBranch:       "unprotected",
+			CreateNewBranch: true,
+			Message:         "Add unsigned.txt",
+		},
+		TreePath: "unsigned.txt",
+		Content:  "unsigned",
+	})
+	assert.NoError(t, err)
+}
+
+func TestChangeRepoFiles_SigningKeyID(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	_, cleanup := setupSigningKey(t)
+	defer cleanup()
+
+	doerFingerprint := generateSigningKey(t, "User Two <user2@example.com>")
+	otherFingerprint := generateSigningKey(t, "Someone Else <else@example.com>")
+	armored, err := exec.Command("gpg", "--armor", "--export", doerFingerprint).Output()
+	assert.NoError(t, err)
+	_, err = models.AddGPGKey(doer.ID, string(armored))
+	assert.NoError(t, err)
+
+	// A key of the doer is used even when the rules wouldn't sign, given by its long ID here
+	setting.Repository.Signing.CRUDActions = []string{"never"}
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{
+			Message:      "Add signed.txt",
+			SigningKeyID: strings.ToLower(doerFingerprint[24:]),
+		},
+		TreePath: "signed.txt",
+		Content:  "signed",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "G "+doerFingerprint, getLastCommitSignature(t, repo, "master"))
+
+	// Keys the doer may not use are refused rather than replaced
+	commitsCount := getCommitsCount(t, repo, "master")
+	for _, keyID := range []string{otherFingerprint, doerFingerprint[32:]} {
+		_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+			CommitOptions: CommitOptions{Message: "Add unsigned.txt", SigningKeyID: keyID},
+			TreePath:      "unsigned.txt",
+			Content:       "unsigned",
+		})
+		if assert.True(t, models.IsErrSigningKeyNotAllowed(err), "%s: %v", keyID, err) {
+			assert.EqualValues(t, keyID, err.(models.ErrSigningKeyNotAllowed).KeyID)
+		}
+	}
+	setting.Repository.Signing.SigningKey = "none"
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{
+			Message:      "Add unsigned.txt",
+			SigningKeyID: doerFingerprint,
+		},
+		TreePath: "unsigned.txt",
+		Content:  "unsigned",
+	})
+	assert.True(t, models.IsErrSigningKeyNotAllowed(err), "%v", err)
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+}
@@ -0,0 +1,97 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"fmt"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+)
+
+// ContentSource is a file of a repository, e.g. another one, the content of a file is copied from
+// by the server. The doer must be able to read the code of Repo. The mode of the file is copied
+// along, unless Mode or Symlink is given for the file to create or update.
+type ContentSource struct {
+	Repo *models.Repository
+	// Ref is the branch, tag or commit the file is read at, the default branch of Repo if empty
+	Ref      string
+	TreePath string
+}
+
+// openContentSources opens the content of the given files copied from a content source, checking
+// the given doer may read their source. It is kept to be closed by closeFetchedContents.
+func openContentSources(doer *models.User, files []*ChangeRepoFile) error {
+	for _, file := range files {
+		if file.ContentSource == nil {
+			continue
+		}
+		if file.ContentReader != nil || file.Content != "" || file.ContentURL != "" {
+			return fmt.Errorf("content given along with a content source: %s", file.TreePath)
+		}
+		if file.Operation != "create" && file.Operation != "update" {
+			return fmt.Errorf("content source given for a %s: %s", file.Operation, file.TreePath)
+		}
+		if err := openContentSource(doer, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openContentSource opens the content of the content source of the given file as its content reader
+func openContentSource(doer *models.User, file *ChangeRepoFile) error {
+	source := file.ContentSource
+	perm, err := models.GetUserRepoPermission(source.Repo, doer)
+	if err != nil {
+		return err
+	} else if !perm.CanRead(models.UnitTypeCode) {
+		return models.ErrUserDoesNotHaveAccessToRepo{UserID: doer.ID, RepoName: source.Repo.FullName()}
+	}
+
+	treePath := CleanUploadFileName(source.TreePath)
+	if treePath == "" {
+		return models.ErrFilenameInvalid{Path: source.TreePath}
+	}
+	ref := source.Ref
+	if ref == "" {
+		ref = source.Repo.DefaultBranch
+	}
+	commitID, err := resolveCommitID(source.Repo, ref)
+	if err != nil {
+		return err
+	}
+	gitRepo, err := git.OpenRepository(source.Repo.RepoPath())
+	if err != nil {
+		return err
+	}
+	commit, err := gitRepo.GetCommit(commitID)
+	if err != nil {
+		return err
+	}
+	entry, err := getExistingEntry(commit, treePath, "")
+	if err != nil {
+		return err
+	} else if entry.IsSubModule() {
+		return models.ErrEntryIsSubmodule{Path: treePath}
+	} else if entry.IsDir() {
+		return models.ErrRepoFileDoesNotExist{FileName: treePath}
+	}
+
+	content, err := openEntryContent(source.Repo, entry)
+	if err != nil {
+		return err
+	}
+	file.fetchedContent = content
+	file.ContentReader = content
+	if file.Mode == "" && !file.Symlink {
+		if entry.IsLink() {
+			file.Symlink = true
+		} else {
+			file.Mode = fmt.Sprintf("%x", entry.Mode())
+		}
+	}
+	return nil
+}
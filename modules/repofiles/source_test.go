@@ -0,0 +1,84 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"testing"
+
+	"code.gitea.io/gitea/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeRepoFiles_ContentSource(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	sourceRepo := models.AssertExistsAndLoadBean(t, &models.Repository{ID: 16}).(*models.Repository)
+	sourceContent := getBranchFileContent(t, sourceRepo, "master", "readme.md")
+
+	// The file is copied from the other repository, the doer may read
+	_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{{
+			Operation:     "create",
+			TreePath:      "docs/copied.md",
+			ContentSource: &ContentSource{Repo: sourceRepo, TreePath: "readme.md"},
+		}},
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, sourceContent, getBranchFileContent(t, repo, "master", "docs/copied.md"))
+	assert.EqualValues(t, "100644", getBranchFileMode(t, repo, "master", "docs/copied.md"))
+
+	// Or from this one, keeping the mode of the source
+	pushTestFile(t, repo, doer, "run.sh", "#!/bin/sh\n")
+	_, err = ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{
+			{Operation: "update", TreePath: "run.sh", Content: "#!/bin/sh\necho\n", Mode: "100755"},
+		},
+	})
+	assert.NoError(t, err)
+	_, err = ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{{
+			Operation:     "update",
+			TreePath:      "docs/copied.md",
+			ContentSource: &ContentSource{Repo: repo, Ref: "master", TreePath: "run.sh"},
+		}},
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "#!/bin/sh\necho\n", getBranchFileContent(t, repo, "master", "docs/copied.md"))
+	assert.EqualValues(t, "100755", getBranchFileMode(t, repo, "master", "docs/copied.md"))
+
+	// The doer must be able to read the source
+	commitsCount := getCommitsCount(t, repo, "master")
+	privateRepo := models.AssertExistsAndLoadBean(t, &models.Repository{ID: 7}).(*models.Repository)
+	_, err = ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{{
+			Operation:     "create",
+			TreePath:      "stolen.md",
+			ContentSource: &ContentSource{Repo: privateRepo, TreePath: "README.md"},
+		}},
+	})
+	assert.EqualValues(t, models.ErrUserDoesNotHaveAccessToRepo{UserID: doer.ID, RepoName: privateRepo.FullName()}, err)
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+
+	// And the source to exist
+	_, err = ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{{
+			Operation:     "create",
+			TreePath:      "missing.md",
+			ContentSource: &ContentSource{Repo: sourceRepo, TreePath: "missing.md"},
+		}},
+	})
+	assert.True(t, models.IsErrRepoFileDoesNotExist(err), "%v", err)
+	_, err = ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{{
+			Operation:     "create",
+			TreePath:      "missing.md",
+			Content:       "content",
+			ContentSource: &ContentSource{Repo: sourceRepo, TreePath: "readme.md"},
+		}},
+	})
+	assert.Error(t, err)
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+}
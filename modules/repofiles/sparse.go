@@ -0,0 +1,55 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"path"
+	"strings"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/modules/setting"
+)
+
+// sparseIndexPaths returns the paths changed by the given prepared files when the changes can be
+// staged in a sparse index, see TemporaryUploadRepository.SetSparseIndex, or nil if the whole tree
+// has to be: checking ignored files and removing submodules read files at the root, and the
+// pre-commit hooks may look at any staged file.
+func sparseIndexPaths(files []*ChangeRepoFile) []string {
+	if !setting.Repository.SparseIndex || len(getPreCommitHooks()) > 0 {
+		return nil
+	}
+	treePaths := make([]string, 0, len(files))
+	for _, file := range files {
+		if file.RejectIgnored || file.RemoveSubmodule {
+			return nil
+		}
+		treePaths = append(treePaths, file.treePath)
+		if file.fromTreePath != "" {
+			treePaths = append(treePaths, file.fromTreePath)
+		}
+	}
+	return treePaths
+}
+
+// getSparseIndexDirectory returns the deepest directory of the tree of the given commit holding
+// all the given paths, or an empty string if it is the root or there is no path
+func getSparseIndexDirectory(commit *git.Commit, treePaths []string) string {
+	if len(treePaths) == 0 {
+		return ""
+	}
+	dir := path.Dir(treePaths[0])
+	for _, treePath := range treePaths[1:] {
+		for dir != "." && !strings.HasPrefix(treePath, dir+"/") {
+			dir = path.Dir(dir)
+		}
+	}
+	// The directory of new files may not exist yet, or be a file they conflict with
+	for ; dir != "."; dir = path.Dir(dir) {
+		if entry, err := commit.GetTreeEntryByPath(dir); err == nil && entry.IsDir() {
+			return dir
+		}
+	}
+	return ""
+}
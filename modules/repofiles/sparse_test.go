@@ -0,0 +1,123 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"testing"
+
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/setting"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setSparseIndex enables or disables the sparse index until the returned function is called
+func setSparseIndex(enabled bool) func() {
+	oldSparseIndex := setting.Repository.SparseIndex
+	setting.Repository.SparseIndex = enabled
+	return func() {
+		setting.Repository.SparseIndex = oldSparseIndex
+	}
+}
+
+func TestChangeRepoFiles_SparseIndex(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	defer setSparseIndex(false)()
+
+	for _, branch := range []string{"full", "sparse"} {
+		_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+			CommitOptions: CommitOptions{
+				OldBranch:       "master",
+				NewBranch:       branch,
+				CreateNewBranch: true,
+			},
+			Files: []*ChangeRepoFile{
+				{Operation: "create", TreePath: "docs/a/x.txt", Content: "x"},
+				{Operation: "create", TreePath: "docs/a/y.txt", Content: "y"},
+				{Operation: "create", TreePath: "docs/b/z.txt", Content: "z"},
+				{Operation: "create", TreePath: "docs/c.txt", Content: "c"},
+			},
+		})
+		assert.NoError(t, err)
+	}
+
+	// Both ways of staging the changes make the same trees
+	for i, files := range [][]*ChangeRepoFile{
+		{{Operation: "update", TreePath: "docs/a/x.txt", Content: "x2"}},
+		{{Operation: "create", TreePath: "docs/a/new/w.txt", Content: "w"}},
+		{{Operation: "rename", FromTreePath: "docs/a/y.txt", TreePath: "docs/b/y.txt"}},
+		{{Operation: "delete", TreePath: "docs/b/z.txt"}, {Operation: "delete", TreePath: "docs/b/y.txt"}},
+		{{Operation: "delete", TreePath: "docs/a"}},
+		{{Operation: "delete", TreePath: "docs/c.txt"}},
+		{{Operation: "create", TreePath: "other/d.txt", Content: "d"}},
+	} {
+		for _, branch := range []string{"full", "sparse"} {
+			setting.Repository.SparseIndex = branch == "sparse"
+			changed := make([]*ChangeRepoFile, 0, len(files))
+			for _, file := range files {
+				copied := *file
+				changed = append(changed, &copied)
+			}
+			_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+				CommitOptions: CommitOptions{OldBranch: branch, NewBranch: branch},
+				Files:         changed,
+			})
+			assert.NoError(t, err, "%d: %s", i, branch)
+		}
+		assert.EqualValues(t, getBranchCommit(t, repo, "full").Tree.ID, getBranchCommit(t, repo, "sparse").Tree.ID, "%d", i)
+	}
+	assert.EqualValues(t, "d", getBranchFileContent(t, repo, "sparse", "other/d.txt"))
+	_, err := GetRepoFileContent(repo, "sparse", "docs", false)
+	assert.True(t, models.IsErrRepoFileDoesNotExist(err), "%v", err)
+
+	// The files outside of the sparse directory are still checked against
+	_, err = ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		CommitOptions: CommitOptions{OldBranch: "sparse", NewBranch: "sparse"},
+		Files:         []*ChangeRepoFile{{Operation: "create", TreePath: "other/d.txt/e.txt", Content: "e"}},
+	})
+	assert.True(t, models.IsErrFilePathConflict(err) || models.IsErrFileDirectoryConflict(err), "%v", err)
+}
+
+func benchmarkSparseIndex(b *testing.B, sparse bool) {
+	repo := prepareTestRepo(b, 1)
+	doer := models.AssertExistsAndLoadBean(b, &models.User{ID: 2}).(*models.User)
+	defer setSparseIndex(sparse)()
+
+	// Tens of thousands of files in hundreds of directories, imported at once
+	stream := new(bytes.Buffer)
+	fmt.Fprintf(stream, "commit refs/heads/master\ncommitter Gitea <gitea@example.com> 1546300800 +0000\ndata 6\nImport\nfrom refs/heads/master^0\n")
+	for i := 0; i < 200; i++ {
+		for j := 0; j < 100; j++ {
+			content := fmt.Sprintf("file %d of dir %d\n", j, i)
+			fmt.Fprintf(stream, "M 100644 inline dir%d/sub/file%d.txt\ndata %d\n%s\n", i, j, len(content), content)
+		}
+	}
+	cmd := exec.Command("git", "fast-import", "--quiet")
+	cmd.Dir = repo.RepoPath()
+	cmd.Stdin = stream
+	output, err := cmd.CombinedOutput()
+	assert.NoError(b, err, "%s", output)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+			TreePath: "dir100/sub/file50.txt",
+			Content:  fmt.Sprintf("edit %d\n", i),
+		})
+		assert.NoError(b, err)
+	}
+}
+
+func BenchmarkSingleFileEdit_FullIndex(b *testing.B) {
+	benchmarkSparseIndex(b, false)
+}
+
+func BenchmarkSingleFileEdit_SparseIndex(b *testing.B) {
+	benchmarkSparseIndex(b, true)
+}
@@ -0,0 +1,77 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// gitmodulesPath is the path of the file configuring the submodules of a repository
+const gitmodulesPath = ".gitmodules"
+
+// removeSubmoduleConfig removes the section of the submodule at the given path from the .gitmodules
+// file in the index of the temporary upload repository, and the file itself once no section is left
+func removeSubmoduleConfig(t *TemporaryUploadRepository, treePath string) error {
+	content, _, err := t.execStdin("removeSubmoduleConfig (git cat-file)", nil, "cat-file", "blob", ":"+gitmodulesPath)
+	if err != nil {
+		// The submodule was never configured, there is nothing more to remove
+		return nil
+	}
+
+	// git config edits the sections in a working copy of the file
+	config, err := ioutil.TempFile(t.basePath, "gitmodules-")
+	if err != nil {
+		return fmt.Errorf("TempFile: %v", err)
+	}
+	defer os.Remove(config.Name())
+	_, err = config.WriteString(content)
+	config.Close()
+	if err != nil {
+		return err
+	}
+
+	stdout, stderr, err := t.execStdin("removeSubmoduleConfig (git config --get-regexp)", nil,
+		"config", "-f", config.Name(), "-z", "--get-regexp", `^submodule\..*\.path$`)
+	if err != nil {
+		// No stderr means no submodule is configured
+		if stderr == "" {
+			return nil
+		}
+		return fmt.Errorf("removeSubmoduleConfig: %v %s", err, stderr)
+	}
+	for _, entry := range strings.Split(stdout, "\x00") {
+		// Each entry is the key and its value on the next line
+		fields := strings.SplitN(entry, "\n", 2)
+		if len(fields) != 2 || fields[1] != treePath {
+			continue
+		}
+		section := strings.TrimSuffix(fields[0], ".path")
+		if _, stderr, err := t.execStdin("removeSubmoduleConfig (git config --remove-section)", nil,
+			"config", "-f", config.Name(), "--remove-section", section); err != nil {
+			return fmt.Errorf("removeSubmoduleConfig: %v %s", err, stderr)
+		}
+	}
+
+	remaining, stderr, err := t.execStdin("removeSubmoduleConfig (git config --list)", nil,
+		"config", "-f", config.Name(), "--list")
+	if err != nil {
+		return fmt.Errorf("removeSubmoduleConfig: %v %s", err, stderr)
+	} else if remaining == "" {
+		return t.RemoveFilesFromIndex(gitmodulesPath)
+	}
+	updated, err := os.Open(config.Name())
+	if err != nil {
+		return err
+	}
+	defer updated.Close()
+	objectHash, err := t.HashObject(gitmodulesPath, updated)
+	if err != nil {
+		return err
+	}
+	return t.AddObjectToIndex("100644", objectHash, gitmodulesPath)
+}
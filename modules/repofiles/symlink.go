@@ -0,0 +1,58 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/setting"
+)
+
+// symlinkMode is the git mode of symlink entries
+const symlinkMode = "120000"
+
+// symlinkTargetMaxSize is the length of the longest symlink target accepted, as PATH_MAX
+const symlinkTargetMaxSize = 4096
+
+// readSymlinkTarget reads the target of the given prepared symlink from its content
+func readSymlinkTarget(file *ChangeRepoFile) (string, error) {
+	content, err := ioutil.ReadAll(io.LimitReader(file.content, symlinkTargetMaxSize+1))
+	if err != nil {
+		return "", err
+	}
+	target := string(content)
+	switch {
+	case target == "":
+		return "", models.ErrInvalidSymlinkTarget{Path: file.treePath, Target: target, Reason: "empty target"}
+	case len(target) > symlinkTargetMaxSize:
+		return "", models.ErrInvalidSymlinkTarget{Path: file.treePath, Target: target[:64] + "...", Reason: "target too long"}
+	case strings.ContainsRune(target, 0):
+		return "", models.ErrInvalidSymlinkTarget{Path: file.treePath, Target: target, Reason: "NUL in target"}
+	}
+
+	if setting.Repository.RestrictSymlinkTargets {
+		// The target is resolved from the directory of the symlink
+		resolved := path.Join(path.Dir(file.treePath), target)
+		if path.IsAbs(target) || resolved == ".." || strings.HasPrefix(resolved, "../") {
+			return "", models.ErrInvalidSymlinkTarget{Path: file.treePath, Target: target, Reason: "target outside of the repository"}
+		}
+	}
+	return target, nil
+}
+
+// hashSymlinkTarget writes the target of the given prepared symlink to the object db of the
+// temporary upload repository and returns its hash. It is stored as it is, as git does.
+func hashSymlinkTarget(t *TemporaryUploadRepository, file *ChangeRepoFile) (string, error) {
+	target, err := readSymlinkTarget(file)
+	if err != nil {
+		return "", err
+	}
+	file.size = int64(len(target))
+	return t.HashObject("", strings.NewReader(target))
+}
@@ -0,0 +1,111 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"fmt"
+	"testing"
+
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/setting"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateRepoFile_Symlink(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	fileResponse, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "docs/readme",
+		Content:  "../README.md",
+		Symlink:  true,
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "symlink", fileResponse.Content.Type)
+	assert.EqualValues(t, "../README.md", fileResponse.Content.Target)
+	assert.EqualValues(t, "120000", getBranchFileMode(t, repo, "master", "docs/readme"))
+	assert.EqualValues(t, "../README.md", getBranchFileContent(t, repo, "master", "docs/readme"))
+
+	// Updating a symlink changes its target
+	fileResponse, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		TreePath: "docs/readme",
+		Content:  "dir/../README.md",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "dir/../README.md", fileResponse.Content.Target)
+	assert.EqualValues(t, "120000", getBranchFileMode(t, repo, "master", "docs/readme"))
+
+	// Until it is made a regular file again
+	fileResponse, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		TreePath: "docs/readme",
+		Content:  "readme\n",
+		Mode:     "100644",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "file", fileResponse.Content.Type)
+	assert.EqualValues(t, "", fileResponse.Content.Target)
+	assert.EqualValues(t, "100644", getBranchFileMode(t, repo, "master", "docs/readme"))
+	assert.EqualValues(t, "readme\n", getBranchFileContent(t, repo, "master", "docs/readme"))
+
+	_, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		TreePath: "README.md",
+		Content:  "/etc/passwd",
+		Symlink:  true,
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "120000", getBranchFileMode(t, repo, "master", "README.md"))
+}
+
+func TestCreateRepoFile_SymlinkErrors(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	oldRestrictSymlinkTargets := setting.Repository.RestrictSymlinkTargets
+	setting.Repository.RestrictSymlinkTargets = true
+	defer func() {
+		setting.Repository.RestrictSymlinkTargets = oldRestrictSymlinkTargets
+	}()
+
+	commitsCount := getCommitsCount(t, repo, "master")
+	for _, test := range []struct {
+		treePath string
+		target   string
+		reason   string
+	}{
+		{"link", "", "empty target"},
+		{"link", "a\x00b", "NUL in target"},
+		{"link", "/etc/passwd", "target outside of the repository"},
+		{"link", "..", "target outside of the repository"},
+		{"dir/link", "../../README.md", "target outside of the repository"},
+		{"dir/link", "../dir/../../README.md", "target outside of the repository"},
+	} {
+		_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+			TreePath: test.treePath,
+			Content:  test.target,
+			Symlink:  true,
+		})
+		assert.EqualValues(t, models.ErrInvalidSymlinkTarget{Path: test.treePath, Target: test.target, Reason: test.reason}, err)
+	}
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "link",
+		Content:  "README.md",
+		Symlink:  true,
+		Mode:     "100755",
+	})
+	assert.EqualError(t, err, "invalid file mode for a symlink: 100755")
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+
+	// Targets inside the repository are fine, even if they don't exist
+	for i, target := range []string{"../README.md", "./sub/../missing", "."} {
+		treePath := fmt.Sprintf("dir/link%d", i)
+		_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+			TreePath: treePath,
+			Content:  target,
+			Symlink:  true,
+		})
+		assert.NoError(t, err)
+		assert.EqualValues(t, target, getBranchFileContent(t, repo, "master", treePath))
+	}
+}
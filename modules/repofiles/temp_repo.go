@@ -0,0 +1,873 @@
+// Copyright 2018 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/log"
+	"code.gitea.io/gitea/modules/process"
+	"code.gitea.io/gitea/modules/setting"
+)
+
+// TemporaryUploadRepository is a type to wrap our upload repositories as a bare shared clone
+type TemporaryUploadRepository struct {
+	repo     *models.Repository
+	gitRepo  *git.Repository
+	basePath string
+	// empty is set when the repository has no commit yet, so the first one has no parent
+	empty bool
+	// sparseDir is the directory of HEAD the index is limited to, see SetSparseIndex
+	sparseDir string
+	// counted is set while the repository counts against setting.Repository.MaxTemporaryRepositories
+	counted bool
+}
+
+// temporaryRepositoriesRetryAfter is how long to wait before retrying to get a temporary upload
+// repository when all of them are in use
+const temporaryRepositoriesRetryAfter = time.Second
+
+// temporaryRepositories counts the temporary upload repositories in use
+var temporaryRepositories struct {
+	sync.Mutex
+	count int
+}
+
+// temporaryUploadRepositoryPrefix starts the names of the temporary upload repositories
+const temporaryUploadRepositoryPrefix = "upload-"
+
+// TemporaryUploadRepositoriesPath returns the directory the temporary upload repositories are created in
+func TemporaryUploadRepositoriesPath() string {
+	return path.Join(models.LocalCopyPath(), "upload")
+}
+
+// NewTemporaryUploadRepository creates a new temporary upload repository
+func NewTemporaryUploadRepository(repo *models.Repository) (*TemporaryUploadRepository, error) {
+	t := &TemporaryUploadRepository{repo: repo}
+	if err := t.countIn(); err != nil {
+		return nil, err
+	}
+	rootPath := TemporaryUploadRepositoriesPath()
+	if err := os.MkdirAll(rootPath, os.ModePerm); err != nil {
+		t.countOut()
+		return nil, fmt.Errorf("Failed to create dir %s: %v", rootPath, err)
+	}
+	basePath, err := ioutil.TempDir(rootPath, temporaryUploadRepositoryPrefix)
+	if err != nil {
+		t.countOut()
+		return nil, fmt.Errorf("Failed to create dir in %s: %v", rootPath, err)
+	}
+	t.basePath = basePath
+	return t, nil
+}
+
+// countIn counts the repository among the temporary upload repositories in use, failing with
+// ErrTemporarilyUnavailable when as many as allowed already are
+func (t *TemporaryUploadRepository) countIn() error {
+	temporaryRepositories.Lock()
+	defer temporaryRepositories.Unlock()
+	if maxCount := setting.Repository.MaxTemporaryRepositories; maxCount > 0 && temporaryRepositories.count >= maxCount {
+		return models.ErrTemporarilyUnavailable{
+			Reason:     "too many file operations in progress",
+			RetryAfter: temporaryRepositoriesRetryAfter,
+		}
+	}
+	temporaryRepositories.count++
+	t.counted = true
+	return nil
+}
+
+// countOut stops counting the repository among the temporary upload repositories in use
+func (t *TemporaryUploadRepository) countOut() {
+	temporaryRepositories.Lock()
+	defer temporaryRepositories.Unlock()
+	if t.counted {
+		temporaryRepositories.count--
+		t.counted = false
+	}
+}
+
+// CleanupTemporaryUploadRepositories removes the temporary upload repositories not modified for
+// longer than maxAge, which are left behind by operations interrupted before they could close them
+func CleanupTemporaryUploadRepositories(maxAge time.Duration) error {
+	rootPath := TemporaryUploadRepositoriesPath()
+	entries, err := ioutil.ReadDir(rootPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("ReadDir: %v", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), temporaryUploadRepositoryPrefix) ||
+			time.Since(entry.ModTime()) < maxAge {
+			continue
+		}
+		basePath := path.Join(rootPath, entry.Name())
+		log.Trace("Removing stale temporary upload repository %s", basePath)
+		if err := os.RemoveAll(basePath); err != nil {
+			return fmt.Errorf("RemoveAll: %v", err)
+		}
+	}
+	return nil
+}
+
+// BasePath returns the path of the bare clone, whose default index holds the staged changes
+func (t *TemporaryUploadRepository) BasePath() string {
+	return t.basePath
+}
+
+// Close the repository cleaning up all files, it does nothing on a nil repository
+func (t *TemporaryUploadRepository) Close() {
+	if t == nil {
+		return
+	}
+	if err := os.RemoveAll(t.basePath); err != nil {
+		log.Error(4, "Failed to remove temporary upload repository %s: %v", t.basePath, err)
+	}
+	t.countOut()
+}
+
+// Clone the base repository to our path and set branch as the HEAD
+func (t *TemporaryUploadRepository) Clone(branch string) error {
+	if _, stderr, err := process.GetManager().ExecTimeout(5*time.Minute,
+		fmt.Sprintf("Clone (git clone -s --bare): %s", t.basePath),
+		"git", "clone", "-s", "--bare", "-b", branch, t.repo.RepoPath(), t.basePath); err != nil {
+		if strings.Contains(stderr, "not found in upstream origin") {
+			return models.ErrBranchNotExist{Name: branch}
+		}
+		return fmt.Errorf("Clone: %v %s", err, stderr)
+	}
+	gitRepo, err := git.OpenRepository(t.basePath)
+	if err != nil {
+		return err
+	}
+	t.gitRepo = gitRepo
+	return nil
+}
+
+// Checkout sets branch as the HEAD, cloning the base repository the first time. Once cloned, or
+// initialized for an empty repository, the repository is reused: it shares the objects of the base
+// repository, so only the branch has to be brought up to date with it.
+func (t *TemporaryUploadRepository) Checkout(branch string) error {
+	if t.gitRepo == nil {
+		return t.Clone(branch)
+	}
+	if err := t.shareBaseObjects(); err != nil {
+		return err
+	}
+
+	baseRepo, err := git.OpenRepository(t.repo.RepoPath())
+	if err != nil {
+		return err
+	}
+	commitID, err := baseRepo.GetBranchCommitID(branch)
+	if err != nil {
+		if git.IsErrNotExist(err) {
+			return models.ErrBranchNotExist{Name: branch}
+		}
+		return err
+	}
+	return t.setHead(branch, commitID)
+}
+
+// CheckoutCommit sets branch, pointing to the given commit of the base repository, as the HEAD,
+// for a branch which doesn't exist in the base repository yet
+func (t *TemporaryUploadRepository) CheckoutCommit(branch, commitID string) error {
+	if t.gitRepo == nil {
+		if _, stderr, err := process.GetManager().ExecTimeout(5*time.Minute,
+			fmt.Sprintf("CheckoutCommit (git clone -s --bare): %s", t.basePath),
+			"git", "clone", "-s", "--bare", t.repo.RepoPath(), t.basePath); err != nil {
+			return fmt.Errorf("CheckoutCommit: %v %s", err, stderr)
+		}
+		gitRepo, err := git.OpenRepository(t.basePath)
+		if err != nil {
+			return err
+		}
+		t.gitRepo = gitRepo
+	} else if err := t.shareBaseObjects(); err != nil {
+		return err
+	}
+	return t.setHead(branch, commitID)
+}
+
+// shareBaseObjects shares the objects of the base repository as by git clone -s, if the base
+// repository got its first commit since our path was initialized
+func (t *TemporaryUploadRepository) shareBaseObjects() error {
+	if !t.empty {
+		return nil
+	}
+	alternates := path.Join(t.basePath, "objects", "info", "alternates")
+	if err := ioutil.WriteFile(alternates, []byte(path.Join(t.repo.RepoPath(), "objects")+"\n"), 0644); err != nil {
+		return fmt.Errorf("Checkout: %v", err)
+	}
+	t.empty = false
+	return nil
+}
+
+// setHead points branch to the given commit and sets it as the HEAD
+func (t *TemporaryUploadRepository) setHead(branch, commitID string) error {
+	if _, stderr, err := process.GetManager().ExecDir(5*time.Minute,
+		t.basePath,
+		fmt.Sprintf("Checkout (git update-ref): %s", t.basePath),
+		"git", "update-ref", git.BranchPrefix+branch, commitID); err != nil {
+		return fmt.Errorf("Checkout: %v %s", err, stderr)
+	}
+	if _, stderr, err := process.GetManager().ExecDir(5*time.Minute,
+		t.basePath,
+		fmt.Sprintf("Checkout (git symbolic-ref): %s", t.basePath),
+		"git", "symbolic-ref", "HEAD", git.BranchPrefix+branch); err != nil {
+		return fmt.Errorf("Checkout: %v %s", err, stderr)
+	}
+	return nil
+}
+
+// Init initializes our path as an empty bare repository, for the first commit of the repository
+func (t *TemporaryUploadRepository) Init() error {
+	if err := git.InitRepository(t.basePath, true); err != nil {
+		return fmt.Errorf("Init: %v", err)
+	}
+	gitRepo, err := git.OpenRepository(t.basePath)
+	if err != nil {
+		return err
+	}
+	t.gitRepo = gitRepo
+	t.empty = true
+	return nil
+}
+
+// SetDefaultIndex sets the git index to our HEAD
+func (t *TemporaryUploadRepository) SetDefaultIndex() error {
+	if _, stderr, err := process.GetManager().ExecDir(5*time.Minute,
+		t.basePath,
+		fmt.Sprintf("SetDefaultIndex (git read-tree HEAD): %s", t.basePath),
+		"git", "read-tree", "HEAD"); err != nil {
+		return fmt.Errorf("SetDefaultIndex: %v %s", err, stderr)
+	}
+	t.sparseDir = ""
+	return nil
+}
+
+// SetSparseIndex sets the git index to the files of the given directory of our HEAD only, which
+// is much faster than the whole tree of a large repository. The trees written from it are still
+// complete, keeping the rest of HEAD as it is, so changes must only be staged beneath dir.
+func (t *TemporaryUploadRepository) SetSparseIndex(dir string) error {
+	// The index is read from a tree holding the directory alone, in its parent directories
+	stdout, stderr, err := t.execStdin("SetSparseIndex (git rev-parse)", nil, "rev-parse", "--verify", "HEAD:"+dir)
+	if err != nil {
+		return fmt.Errorf("SetSparseIndex: %v %s", err, stderr)
+	}
+	treeHash := strings.TrimSpace(stdout)
+	for subDir := dir; subDir != "."; subDir = path.Dir(subDir) {
+		entry := strings.NewReader("040000 tree " + treeHash + "\t" + path.Base(subDir) + "\x00")
+		stdout, stderr, err := t.execStdin("SetSparseIndex (git mktree)", entry, "mktree", "-z")
+		if err != nil {
+			return fmt.Errorf("SetSparseIndex: %v %s", err, stderr)
+		}
+		treeHash = strings.TrimSpace(stdout)
+	}
+	if _, stderr, err := process.GetManager().ExecDir(5*time.Minute,
+		t.basePath,
+		fmt.Sprintf("SetSparseIndex (git read-tree): %s", t.basePath),
+		"git", "read-tree", treeHash); err != nil {
+		return fmt.Errorf("SetSparseIndex: %v %s", err, stderr)
+	}
+	t.sparseDir = dir
+	return nil
+}
+
+// LsFiles checks if the given filenames are in the index, listing the files at those paths and
+// beneath them when they are directories. The paths are matched as they are, not as patterns.
+func (t *TemporaryUploadRepository) LsFiles(filenames ...string) ([]string, error) {
+	cmdArgs := []string{"--literal-pathspecs", "ls-files", "-z", "--"}
+	for _, arg := range filenames {
+		if arg != "" {
+			cmdArgs = append(cmdArgs, arg)
+		}
+	}
+
+	stdout, stderr, err := process.GetManager().ExecDir(5*time.Minute,
+		t.basePath,
+		fmt.Sprintf("LsFiles (git ls-files): %s", t.basePath),
+		"git", cmdArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("LsFiles: %v %s", err, stderr)
+	}
+
+	filelist := make([]string, 0, len(filenames))
+	for _, line := range strings.Split(stdout, "\x00") {
+		if line != "" {
+			filelist = append(filelist, line)
+		}
+	}
+	return filelist, nil
+}
+
+// RemoveFilesFromIndex removes the given files from the index
+func (t *TemporaryUploadRepository) RemoveFilesFromIndex(filenames ...string) error {
+	stdIn := new(bytes.Buffer)
+	for _, file := range filenames {
+		if file != "" {
+			stdIn.WriteString("0 0000000000000000000000000000000000000000\t")
+			stdIn.WriteString(file)
+			stdIn.WriteByte('\000')
+		}
+	}
+
+	if _, stderr, err := t.execStdin("RemoveFilesFromIndex (git update-index --remove)", stdIn,
+		"update-index", "--remove", "-z", "--index-info"); err != nil {
+		return fmt.Errorf("RemoveFilesFromIndex: %v %s", err, stderr)
+	}
+	return nil
+}
+
+// UseGitAttributes makes the attributes of the .gitattributes file at the root of the given commit
+// apply to the temporary repository. Being bare, it otherwise only reads them from info/attributes.
+func (t *TemporaryUploadRepository) UseGitAttributes(commit *git.Commit) error {
+	// Attributes of another commit may be left by a previous use of the repository
+	infoPath := path.Join(t.basePath, "info")
+	if err := os.Remove(path.Join(infoPath, "attributes")); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("UseGitAttributes: %v", err)
+	}
+
+	entry, err := commit.GetTreeEntryByPath(".gitattributes")
+	if err != nil {
+		if git.IsErrNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if entry.IsDir() {
+		return nil
+	}
+	dataRc, err := entry.Blob().DataAsync()
+	if err != nil {
+		return err
+	}
+	defer dataRc.Close()
+
+	if err := os.MkdirAll(infoPath, os.ModePerm); err != nil {
+		return fmt.Errorf("UseGitAttributes: %v", err)
+	}
+	attributes, err := os.Create(path.Join(infoPath, "attributes"))
+	if err != nil {
+		return fmt.Errorf("UseGitAttributes: %v", err)
+	}
+	defer attributes.Close()
+	if _, err := io.Copy(attributes, dataRc); err != nil {
+		return fmt.Errorf("UseGitAttributes: %v", err)
+	}
+	return nil
+}
+
+// CheckAttribute returns the value of the given git attribute for the given tree path
+func (t *TemporaryUploadRepository) CheckAttribute(attribute, treePath string) (string, error) {
+	stdout, stderr, err := process.GetManager().ExecDir(5*time.Minute,
+		t.basePath,
+		fmt.Sprintf("CheckAttribute (git check-attr): %s", t.basePath),
+		"git", "check-attr", "-z", attribute, "--", treePath)
+	if err != nil {
+		return "", fmt.Errorf("CheckAttribute: %v %s", err, stderr)
+	}
+
+	// The output is "<path> NUL <attribute> NUL <value> NUL"
+	fields := strings.Split(stdout, "\x00")
+	if len(fields) < 3 {
+		return "", fmt.Errorf("CheckAttribute: unexpected output %q", stdout)
+	}
+	return fields[2], nil
+}
+
+// HasConfig checks if the given git config variable is set for the temporary repository
+func (t *TemporaryUploadRepository) HasConfig(name string) bool {
+	// Git fails when the variable isn't set
+	_, _, err := t.execStdin("HasConfig (git config --get)", nil, "config", "--get", name)
+	return err == nil
+}
+
+// CheckIgnore returns the pattern of the ignore rules making git ignore the given tree path, or an empty
+// string if it is not ignored. The .gitignore files are read from the given directory beneath our path.
+func (t *TemporaryUploadRepository) CheckIgnore(workDir, treePath string) (string, error) {
+	// Each line of the output is "<source> : <line> : <pattern> TAB <path>", for the last matching pattern
+	stdout, stderr, err := process.GetManager().ExecDir(5*time.Minute,
+		t.basePath,
+		fmt.Sprintf("CheckIgnore (git check-ignore): %s", t.basePath),
+		"git", "-c", "core.excludesFile=", "--work-tree="+workDir, "check-ignore", "--no-index", "--verbose", "--", treePath)
+	if err != nil {
+		// No stderr means nothing matches
+		if stderr == "" {
+			return "", nil
+		}
+		return "", fmt.Errorf("CheckIgnore: %v %s", err, stderr)
+	}
+
+	fields := strings.SplitN(strings.SplitN(stdout, "\t", 2)[0], ":", 3)
+	if len(fields) < 3 {
+		return "", fmt.Errorf("CheckIgnore: unexpected output %q", stdout)
+	}
+	// A negated pattern matches paths which are not ignored
+	if strings.HasPrefix(fields[2], "!") {
+		return "", nil
+	}
+	return fields[2], nil
+}
+
+// HashObject writes the provided content to the object db and returns its hash. If a tree path is
+// given, the content is written as if it was checked in at that path, applying its attributes.
+// The content is streamed to git as it is read, so it is never held in memory as a whole.
+func (t *TemporaryUploadRepository) HashObject(treePath string, content io.Reader) (string, error) {
+	args := []string{"hash-object", "-w", "--stdin"}
+	if treePath != "" {
+		args = append(args, "--path="+treePath)
+	}
+	objectHash, stderr, err := t.execStdin("HashObject (git hash-object -w --stdin)", content, args...)
+	if err != nil {
+		return "", fmt.Errorf("HashObject: %v %s", err, stderr)
+	}
+	return strings.TrimSpace(objectHash), nil
+}
+
+// AddObjectToIndex adds the provided object hash to the index with the provided mode and path
+func (t *TemporaryUploadRepository) AddObjectToIndex(mode, objectHash, objectPath string) error {
+	if _, stderr, err := process.GetManager().ExecDir(5*time.Minute,
+		t.basePath,
+		fmt.Sprintf("AddObjectToIndex (git update-index): %s", t.basePath),
+		"git", "update-index", "--add", "--replace", "--cacheinfo", mode, objectHash, objectPath); err != nil {
+		return fmt.Errorf("AddObjectToIndex: %v %s", err, stderr)
+	}
+	return nil
+}
+
+// WriteTree writes the current index as a tree to the object db and returns its hash
+func (t *TemporaryUploadRepository) WriteTree() (string, error) {
+	treeHash, stderr, err := process.GetManager().ExecDir(5*time.Minute,
+		t.basePath,
+		fmt.Sprintf("WriteTree (git write-tree): %s", t.basePath),
+		"git", "write-tree")
+	if err != nil {
+		return "", fmt.Errorf("WriteTree: %v %s", err, stderr)
+	}
+	treeHash = strings.TrimSpace(treeHash)
+	if t.sparseDir == "" {
+		return treeHash, nil
+	}
+
+	// Only the sparse directory is taken from the index, which has nothing there if all its files were deleted
+	dirTreeHash, _, err := process.GetManager().ExecDir(5*time.Minute,
+		t.basePath,
+		fmt.Sprintf("WriteTree (git rev-parse): %s", t.basePath),
+		"git", "rev-parse", "--verify", "-q", treeHash+":"+t.sparseDir)
+	if err != nil {
+		dirTreeHash = ""
+	}
+	return t.writeSparseTree(strings.TrimSpace(dirTreeHash))
+}
+
+// fastImportRef is the ref the commits written by FastImport are imported to
+const fastImportRef = "refs/fast-import/tree"
+
+// FastImport writes the objects of the given git fast-import stream, committing to fastImportRef,
+// to the object db and returns the hash of the tree of that commit. The ref is removed afterwards.
+func (t *TemporaryUploadRepository) FastImport(stream io.Reader) (string, error) {
+	if _, stderr, err := t.execStdin("FastImport (git fast-import)", stream, "fast-import", "--quiet", "--done"); err != nil {
+		return "", fmt.Errorf("FastImport: %v %s", err, stderr)
+	}
+	treeHash, stderr, err := t.execStdin("FastImport (git rev-parse)", nil, "rev-parse", "--verify", fastImportRef+"^{tree}")
+	if err != nil {
+		return "", fmt.Errorf("FastImport: %v %s", err, stderr)
+	}
+	if _, stderr, err := t.execStdin("FastImport (git update-ref -d)", nil, "update-ref", "-d", fastImportRef); err != nil {
+		return "", fmt.Errorf("FastImport: %v %s", err, stderr)
+	}
+	return strings.TrimSpace(treeHash), nil
+}
+
+// writeSparseTree writes the tree of HEAD with the given tree at the sparse directory, or without
+// any tree there for an empty hash, and returns its hash. The parent directories left empty are
+// removed as well, as git doesn't track empty directories.
+func (t *TemporaryUploadRepository) writeSparseTree(dirTreeHash string) (string, error) {
+	treeHash := dirTreeHash
+	for dir := t.sparseDir; dir != "."; dir = path.Dir(dir) {
+		parent, name := path.Dir(dir), path.Base(dir)
+		treeish := "HEAD^{tree}"
+		if parent != "." {
+			treeish = "HEAD:" + parent
+		}
+		stdout, stderr, err := t.execStdin("writeSparseTree (git ls-tree)", nil, "ls-tree", "-z", treeish)
+		if err != nil {
+			return "", fmt.Errorf("writeSparseTree: %v %s", err, stderr)
+		}
+		entries := new(bytes.Buffer)
+		for _, entry := range strings.Split(stdout, "\x00") {
+			if tab := strings.IndexByte(entry, '\t'); tab >= 0 && entry[tab+1:] != name {
+				entries.WriteString(entry + "\x00")
+			}
+		}
+		if treeHash != "" {
+			entries.WriteString("040000 tree " + treeHash + "\t" + name + "\x00")
+		} else if entries.Len() == 0 && parent != "." {
+			continue
+		}
+		// The entries are sorted by mktree
+		stdout, stderr, err = t.execStdin("writeSparseTree (git mktree)", entries, "mktree", "-z")
+		if err != nil {
+			return "", fmt.Errorf("writeSparseTree: %v %s", err, stderr)
+		}
+		treeHash = strings.TrimSpace(stdout)
+	}
+	return treeHash, nil
+}
+
+// DiffTrees returns the diff between the given trees of the repo, detecting renames
+func (t *TemporaryUploadRepository) DiffTrees(oldTreeHash, newTreeHash string) (string, error) {
+	stdout, stderr, err := process.GetManager().ExecDir(5*time.Minute,
+		t.basePath,
+		fmt.Sprintf("DiffTrees (git diff): %s", t.basePath),
+		"git", "diff", "--no-color", "--no-ext-diff", "-M", oldTreeHash, newTreeHash)
+	if err != nil {
+		return "", fmt.Errorf("DiffTrees: %v %s", err, stderr)
+	}
+	return stdout, nil
+}
+
+// GetLastCommit gets the last commit ID SHA of the repo
+func (t *TemporaryUploadRepository) GetLastCommit() (string, error) {
+	return t.GetLastCommitByRef("HEAD")
+}
+
+// GetLastCommitByRef gets the last commit ID SHA of the repo by ref, failing if the ref doesn't point to a commit
+func (t *TemporaryUploadRepository) GetLastCommitByRef(ref string) (string, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	commitID, stderr, err := process.GetManager().ExecDir(5*time.Minute,
+		t.basePath,
+		fmt.Sprintf("GetLastCommit (git rev-parse %s): %s", ref, t.basePath),
+		"git", "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		if stderr == "" {
+			return "", fmt.Errorf("GetLastCommit: %s does not point to a commit", ref)
+		}
+		return "", fmt.Errorf("GetLastCommit: %v %s", err, stderr)
+	}
+	return strings.TrimSpace(commitID), nil
+}
+
+// CommitTree creates a commit from a given tree with the author and committer signatures and the given
+// message, signed with the given GPG key unless it is empty. Its parents are HEAD, if any, followed by
+// the given additional parents, which must be commits of the repository.
+func (t *TemporaryUploadRepository) CommitTree(authorSig, committerSig *git.Signature, treeHash string, message string, signingKey string, additionalParents ...string) (string, error) {
+	parents := make([]string, 0, len(additionalParents)+1)
+	if !t.empty {
+		parents = append(parents, "HEAD")
+	}
+	for _, parent := range additionalParents {
+		commitID, err := t.resolveCommit(parent)
+		if err != nil {
+			return "", err
+		}
+		parents = append(parents, commitID)
+	}
+	return t.CommitTreeWithParents(authorSig, committerSig, treeHash, message, signingKey, parents)
+}
+
+// CommitTreeWithParents creates a commit from a given tree as CommitTree does, but with the given
+// parents in place of HEAD and the additional ones. A commit without parents is a root commit.
+func (t *TemporaryUploadRepository) CommitTreeWithParents(authorSig, committerSig *git.Signature, treeHash string, message string, signingKey string, parents []string) (string, error) {
+	// Because this may call hooks we should pass in the environment
+	env := append(os.Environ(),
+		"GIT_AUTHOR_NAME="+authorSig.Name,
+		"GIT_AUTHOR_EMAIL="+authorSig.Email,
+		"GIT_AUTHOR_DATE="+authorSig.When.Format(time.RFC3339),
+		"GIT_COMMITTER_NAME="+committerSig.Name,
+		"GIT_COMMITTER_EMAIL="+committerSig.Email,
+		"GIT_COMMITTER_DATE="+committerSig.When.Format(time.RFC3339),
+	)
+
+	// The message is given as UTF-8 on stdin, whatever the locale and however long it is
+	args := []string{"-c", "i18n.commitEncoding=UTF-8", "commit-tree", treeHash}
+	for _, parent := range parents {
+		args = append(args, "-p", parent)
+	}
+	if signingKey != "" {
+		args = append(args, "-S"+signingKey)
+	} else {
+		args = append(args, "--no-gpg-sign")
+	}
+	// Like with -m, the message ends with a newline
+	if message != "" && !strings.HasSuffix(message, "\n") {
+		message += "\n"
+	}
+
+	commitHash, stderr, err := t.execStdinDirEnv("CommitTree (git commit-tree)", t.basePath, env, strings.NewReader(message), args...)
+	if err != nil {
+		return "", fmt.Errorf("CommitTree: %v %s", err, stderr)
+	}
+	return strings.TrimSpace(commitHash), nil
+}
+
+// CommitTreeOptions holds the options of a commit made by CommitTreeWithOptions
+type CommitTreeOptions struct {
+	// TreeHash is the tree of the commit
+	TreeHash string
+	// Parents are the commits the commit descends from, in order, a commit without parents being a
+	// root commit. They may be given by any name the repository resolves to a commit.
+	Parents []string
+	Author  *git.Signature
+	// Committer defaults to Author
+	Committer *git.Signature
+	// AuthorDate and CommitterDate are the dates of the commit in place of those of the signatures,
+	// when they are not zero
+	AuthorDate    time.Time
+	CommitterDate time.Time
+	Message       string
+	// SigningKey is the ID of the GPG key to sign the commit with, the commit isn't signed when empty
+	SigningKey string
+}
+
+// CommitTreeWithOptions creates a commit of a prepared tree as the given options describe and
+// returns its hash, for callers building their trees themselves, e.g. by FastImport or from the
+// objects of the repository. Nothing has to be checked out nor staged: the repository only needs to
+// have the objects of the tree and of the parents, which are checked to exist.
+func (t *TemporaryUploadRepository) CommitTreeWithOptions(opts *CommitTreeOptions) (string, error) {
+	if opts.Author == nil {
+		return "", fmt.Errorf("CommitTreeWithOptions: no author")
+	}
+	authorSig, committerSig := *opts.Author, *opts.Author
+	if opts.Committer != nil {
+		committerSig = *opts.Committer
+	}
+	if !opts.AuthorDate.IsZero() {
+		authorSig.When = opts.AuthorDate
+	}
+	if !opts.CommitterDate.IsZero() {
+		committerSig.When = opts.CommitterDate
+	}
+
+	if _, err := t.GetTree(opts.TreeHash); err != nil {
+		return "", fmt.Errorf("CommitTreeWithOptions: tree %s: %v", opts.TreeHash, err)
+	}
+	parents := make([]string, 0, len(opts.Parents))
+	for _, parent := range opts.Parents {
+		commitID, err := t.resolveCommit(parent)
+		if err != nil {
+			return "", err
+		}
+		parents = append(parents, commitID)
+	}
+	return t.CommitTreeWithParents(&authorSig, &committerSig, opts.TreeHash, opts.Message, opts.SigningKey, parents)
+}
+
+// resolveCommit returns the full ID of the given commit, which the repository must have
+func (t *TemporaryUploadRepository) resolveCommit(commitID string) (string, error) {
+	// The objects of the repository are visible through the alternates, even when nothing is checked out
+	stdout, stderr, err := process.GetManager().ExecDir(5*time.Minute,
+		t.basePath,
+		fmt.Sprintf("resolveCommit (git rev-parse --verify %s): %s", commitID, t.basePath),
+		"git", "rev-parse", "--verify", "--quiet", "--end-of-options", commitID+"^{commit}")
+	if err != nil {
+		if stderr == "" {
+			return "", models.ErrParentCommitNotExist{ID: commitID}
+		}
+		return "", fmt.Errorf("resolveCommit: %v %s", err, stderr)
+	}
+	return strings.TrimSpace(stdout), nil
+}
+
+// Push the provided commitHash to the repository branch by the provided user. The branch is only
+// fast-forwarded, the push failing with ErrNotFastForward if the commit doesn't descend from its head.
+func (t *TemporaryUploadRepository) Push(doer *models.User, commitHash string, branch string) error {
+	return t.push(commitHash, branch)
+}
+
+// ForcePush pushes the provided commitHash to the repository branch by the provided user in place of
+// its head, as long as that head is still the given expected commit
+func (t *TemporaryUploadRepository) ForcePush(doer *models.User, commitHash, branch, expectedCommitID string) error {
+	return t.push(commitHash, branch, "--force-with-lease="+git.BranchPrefix+strings.TrimSpace(branch)+":"+expectedCommitID)
+}
+
+// pushWithoutHooks pushes like Push, but without running the git hooks of the repository
+func (t *TemporaryUploadRepository) pushWithoutHooks(doer *models.User, commitHash string, branch string) error {
+	return t.push(commitHash, branch, "--receive-pack=git -c core.hooksPath=/dev/null receive-pack")
+}
+
+// push pushes the provided commitHash to the repository branch, retrying with a growing backoff as
+// long as the push fails on a lock held by a concurrent update
+func (t *TemporaryUploadRepository) push(commitHash string, branch string, args ...string) error {
+	args = append([]string{"push"}, args...)
+	args = append(args, t.repo.RepoPath(), strings.TrimSpace(commitHash)+":"+git.BranchPrefix+strings.TrimSpace(branch))
+	backoff := setting.Repository.PushRetryBackoff
+	for retry := 0; ; retry++ {
+		_, stderr, err := process.GetManager().ExecDir(5*time.Minute,
+			t.basePath,
+			fmt.Sprintf("Push (git push): %s", t.basePath),
+			"git", args...)
+		if err == nil {
+			return nil
+		}
+		if rejectedErr := getPushRejectedError(branch, stderr); rejectedErr != nil {
+			return rejectedErr
+		}
+		if nonFastForwardRegexp.MatchString(stderr) {
+			return models.ErrNotFastForward{BranchName: branch}
+		}
+		if !isTransientPushError(stderr) {
+			return fmt.Errorf("Push: %v %s", err, stderr)
+		} else if retry >= setting.Repository.PushRetries {
+			log.Warn("Push to %s of %s failed on a lock after %d retries: %s", branch, t.repo.FullName(), retry, stderr)
+			return models.ErrTemporarilyUnavailable{
+				Reason:     fmt.Sprintf("branch %s is locked by a concurrent update", branch),
+				RetryAfter: backoff,
+			}
+		}
+		log.Warn("Push to %s of %s failed on a lock, retrying in %v", branch, t.repo.FullName(), backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// nonFastForwardRegexp matches the status git gives to a ref a push without force would not fast-forward
+var nonFastForwardRegexp = regexp.MustCompile(`\[rejected\] .* \((?:non-fast-forward|fetch first)\)`)
+
+// transientPushErrorRegexp matches the errors of git failing to take a lock held by another process
+var transientPushErrorRegexp = regexp.MustCompile(`cannot lock ref|Unable to create '[^']*\.lock': File exists`)
+
+// isTransientPushError returns if the push with the given output failed on a lock of the repository,
+// and not because the repository refused it, the branch having moved for instance
+func isTransientPushError(stderr string) bool {
+	for _, permanent := range []string{"non-fast-forward", "fetch first", "stale info", "but expected"} {
+		if strings.Contains(stderr, permanent) {
+			return false
+		}
+	}
+	return transientPushErrorRegexp.MatchString(stderr)
+}
+
+// hookDeclinedRegexp matches the status git gives to a ref refused by a hook, the update hook being unnamed
+var hookDeclinedRegexp = regexp.MustCompile(`\[remote rejected\] .* \((?:([a-z-]+) )?hook declined\)`)
+
+// getPushRejectedError returns the error of a push to the given branch refused by a hook with the given
+// output, reporting what the hook wrote to explain why, or nil if no hook refused the push
+func getPushRejectedError(branch, stderr string) error {
+	match := hookDeclinedRegexp.FindStringSubmatch(stderr)
+	if match == nil {
+		return nil
+	}
+	hook := match[1]
+	if hook == "" {
+		hook = "update"
+	}
+
+	// The output of the hooks is relayed line by line with a prefix
+	lines := make([]string, 0)
+	for _, line := range strings.Split(stderr, "\n") {
+		if !strings.HasPrefix(line, "remote:") {
+			continue
+		}
+		// git clears the end of the relayed lines when writing to a terminal
+		line = strings.TrimSuffix(strings.TrimRight(line, "\r"), "\x1b[K")
+		line = strings.TrimRight(strings.TrimPrefix(strings.TrimPrefix(line, "remote:"), " "), " \t")
+		// receive-pack reports the refs the update hook refused on its own
+		if !strings.HasPrefix(line, "error: hook declined to update ") {
+			lines = append(lines, line)
+		}
+	}
+	return models.ErrPushRejected{
+		BranchName: branch,
+		Hook:       hook,
+		Message:    strings.TrimSpace(strings.Join(lines, "\n")),
+	}
+}
+
+// GetCommit returns the commit with the given ID from the temporary repository
+func (t *TemporaryUploadRepository) GetCommit(commitID string) (*git.Commit, error) {
+	return t.gitRepo.GetCommit(commitID)
+}
+
+// GetTree returns the tree with the given ID from the temporary repository
+func (t *TemporaryUploadRepository) GetTree(treeID string) (*git.Tree, error) {
+	return t.gitRepo.GetTree(treeID)
+}
+
+// ApplyPatch applies the given unified diff to the files in the given directory beneath our
+// path, which is no repository itself. The hunks which don't apply are left in .rej files.
+func (t *TemporaryUploadRepository) ApplyPatch(workDir string, patch io.Reader) error {
+	if _, stderr, err := t.execStdinDirEnv("ApplyPatch (git apply --reject)", workDir, t.workDirEnv(), patch,
+		"apply", "--reject", "--whitespace=nowarn", "-"); err != nil {
+		return fmt.Errorf("ApplyPatch: %v %s", err, stderr)
+	}
+	return nil
+}
+
+// PatchedFiles returns the paths changed by the given unified diff, as it would be applied in
+// the given directory beneath our path
+func (t *TemporaryUploadRepository) PatchedFiles(workDir string, patch io.Reader) ([]string, error) {
+	stdout, stderr, err := t.execStdinDirEnv("PatchedFiles (git apply --numstat)", workDir, t.workDirEnv(), patch,
+		"apply", "--numstat", "-z", "-")
+	if err != nil {
+		return nil, fmt.Errorf("PatchedFiles: %v %s", err, stderr)
+	}
+	// Each file is described by its numbers of added and deleted lines and its path,
+	// or, for a rename, an empty path followed by both of its paths
+	var treePaths []string
+	for _, field := range strings.Split(stdout, "\x00") {
+		if i := strings.LastIndex(field, "\t"); i >= 0 {
+			field = field[i+1:]
+		}
+		if field != "" {
+			treePaths = append(treePaths, field)
+		}
+	}
+	return treePaths, nil
+}
+
+// workDirEnv returns the environment to run git in a directory beneath our path with,
+// keeping git from taking our path as the repository the directory belongs to
+func (t *TemporaryUploadRepository) workDirEnv() []string {
+	return append(os.Environ(), "GIT_CEILING_DIRECTORIES="+t.basePath)
+}
+
+// execStdin runs git with the given arguments in the temporary repository, feeding it stdin
+func (t *TemporaryUploadRepository) execStdin(desc string, stdin io.Reader, args ...string) (string, string, error) {
+	return t.execStdinDirEnv(desc, t.basePath, nil, stdin, args...)
+}
+
+// execStdinDirEnv runs git with the given arguments and environment in the given directory, feeding it stdin
+func (t *TemporaryUploadRepository) execStdinDirEnv(desc, dir string, env []string, stdin io.Reader, args ...string) (string, string, error) {
+	stdOut := new(bytes.Buffer)
+	stdErr := new(bytes.Buffer)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stdin = stdin
+	cmd.Stdout = stdOut
+	cmd.Stderr = stdErr
+	if err := cmd.Start(); err != nil {
+		return "", "", err
+	}
+
+	pid := process.GetManager().Add(fmt.Sprintf("%s: %s", desc, t.basePath), cmd)
+	err := cmd.Wait()
+	process.GetManager().Remove(pid)
+
+	return stdOut.String(), stdErr.String(), err
+}
@@ -0,0 +1,439 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/setting"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// zeroReader is an endless reader of zero bytes, taking no memory whatever is read from it
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func TestTemporaryUploadRepository_HashObjectLarge(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping large object in short mode")
+	}
+	repo := prepareTestRepo(t, 1)
+	tmp, err := NewTemporaryUploadRepository(repo)
+	assert.NoError(t, err)
+	defer tmp.Close()
+	assert.NoError(t, tmp.Clone("master"))
+
+	const size = 200 << 20
+	blobHash := sha1.New()
+	fmt.Fprintf(blobHash, "blob %d\x00", size)
+	_, err = io.Copy(blobHash, io.LimitReader(zeroReader{}, size))
+	assert.NoError(t, err)
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	objectHash, err := tmp.HashObject("large.bin", io.LimitReader(zeroReader{}, size))
+	runtime.ReadMemStats(&after)
+	assert.NoError(t, err)
+	assert.EqualValues(t, hex.EncodeToString(blobHash.Sum(nil)), objectHash)
+
+	// The content is streamed to git, never held in memory as a whole
+	assert.True(t, after.TotalAlloc-before.TotalAlloc < 16<<20, "allocated %d bytes", after.TotalAlloc-before.TotalAlloc)
+}
+
+func TestTemporaryUploadRepository_GetLastCommitNoCommit(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	tmp, err := NewTemporaryUploadRepository(repo)
+	assert.NoError(t, err)
+	defer tmp.Close()
+	assert.NoError(t, tmp.Init())
+
+	commitID, err := tmp.GetLastCommit()
+	assert.EqualError(t, err, "GetLastCommit: HEAD does not point to a commit")
+	assert.Empty(t, commitID)
+}
+
+func TestTemporaryUploadRepository_PushRejected(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	hooksPath := filepath.Join(repo.RepoPath(), "hooks")
+	assert.NoError(t, os.MkdirAll(hooksPath, os.ModePerm))
+
+	commitsCount := getCommitsCount(t, repo, "master")
+	for _, hook := range []string{"pre-receive", "update"} {
+		hookPath := filepath.Join(hooksPath, hook)
+		assert.NoError(t, ioutil.WriteFile(hookPath,
+			[]byte("#!/usr/bin/env bash\necho \"Rejected:\" >&2\necho \"  commit message must reference an issue\" >&2\nexit 1\n"), 0755))
+
+		_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+			TreePath: "new_file.txt",
+			Content:  "content\n",
+		})
+		if assert.True(t, models.IsErrPushRejected(err), "%v", err) {
+			assert.EqualValues(t, models.ErrPushRejected{
+				BranchName: "master",
+				Hook:       hook,
+				Message:    "Rejected:\n  commit message must reference an issue",
+			}, err)
+		}
+		assert.NoError(t, os.Remove(hookPath))
+	}
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+}
+
+func TestTemporaryUploadRepository_PushRetries(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	oldPushRetries, oldPushRetryBackoff := setting.Repository.PushRetries, setting.Repository.PushRetryBackoff
+	defer func() {
+		setting.Repository.PushRetries, setting.Repository.PushRetryBackoff = oldPushRetries, oldPushRetryBackoff
+	}()
+	setting.Repository.PushRetryBackoff = 50 * time.Millisecond
+
+	// A concurrent update holds the lock of the branch for a while
+	lockPath := filepath.Join(repo.RepoPath(), "refs", "heads", "master.lock")
+	assert.NoError(t, ioutil.WriteFile(lockPath, nil, 0644))
+	released := make(chan struct{})
+	go func() {
+		time.Sleep(120 * time.Millisecond)
+		assert.NoError(t, os.Remove(lockPath))
+		close(released)
+	}()
+	setting.Repository.PushRetries = 5
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{TreePath: "a.txt", Content: "a"})
+	<-released
+	assert.NoError(t, err)
+	assert.EqualValues(t, "a", getBranchFileContent(t, repo, "master", "a.txt"))
+
+	// Unless it holds it longer than the retries
+	commitsCount := getCommitsCount(t, repo, "master")
+	assert.NoError(t, ioutil.WriteFile(lockPath, nil, 0644))
+	setting.Repository.PushRetries = 1
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{TreePath: "b.txt", Content: "b"})
+	if assert.True(t, models.IsErrTemporarilyUnavailable(err), "%v", err) {
+		// The hint is the wait of the next retry
+		assert.EqualValues(t, 100*time.Millisecond, err.(models.ErrTemporarilyUnavailable).RetryAfter)
+	}
+	assert.NoError(t, os.Remove(lockPath))
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+
+	assert.True(t, isTransientPushError("remote: error: cannot lock ref 'refs/heads/master': Unable to create "+
+		"'/data/repo.git/./refs/heads/master.lock': File exists.\n ! [remote rejected] HEAD -> master (failed to update ref)"))
+	assert.False(t, isTransientPushError(" ! [rejected]        HEAD -> master (non-fast-forward)"))
+	assert.False(t, isTransientPushError(" ! [rejected]        HEAD -> master (stale info)"))
+	assert.False(t, isTransientPushError("remote: error: cannot lock ref 'refs/heads/master': is at "+
+		"2a47ca4b614a9f5a43abbd5ad851a54a616ffee6 but expected 65f1bf27bc3bf70f64657658635e66094edbcb4d"))
+}
+
+func TestChangeRepoFiles_TemporaryRepository(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	tmpRepo, err := NewTemporaryUploadRepository(repo)
+	assert.NoError(t, err)
+	defer tmpRepo.Close()
+
+	// Each change is made on top of the previous one
+	commitsCount, err := strconv.Atoi(getCommitsCount(t, repo, "master"))
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+			CommitOptions: CommitOptions{TemporaryRepository: tmpRepo},
+			TreePath:      fmt.Sprintf("file%d.txt", i),
+			Content:       fmt.Sprintf("content %d", i),
+		})
+		assert.NoError(t, err)
+	}
+	assert.EqualValues(t, strconv.Itoa(commitsCount+3), getCommitsCount(t, repo, "master"))
+	_, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		CommitOptions: CommitOptions{TemporaryRepository: tmpRepo},
+		TreePath:      "file0.txt",
+		Content:       "updated",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "updated", getBranchFileContent(t, repo, "master", "file0.txt"))
+	assert.EqualValues(t, "content 2", getBranchFileContent(t, repo, "master", "file2.txt"))
+
+	// Changes made meanwhile without it are taken into account, as are other branches
+	pushTestFile(t, repo, doer, ".gitattributes", "*.txt eol=crlf\n")
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{
+			OldBranch:           "master",
+			NewBranch:           "reused",
+			CreateNewBranch:     true,
+			TemporaryRepository: tmpRepo,
+		},
+		TreePath: "crlf.txt",
+		Content:  "crlf\n",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "crlf\n", getBranchFileContent(t, repo, "reused", "crlf.txt"))
+	_, err = DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{
+		CommitOptions: CommitOptions{OldBranch: "develop", TemporaryRepository: tmpRepo},
+		TreePath:      "README.md",
+	})
+	assert.NoError(t, err)
+	_, err = DeleteRepoFile(repo, doer, &DeleteRepoFileOptions{
+		CommitOptions: CommitOptions{
+			OldBranch:           "does-not-exist",
+			TemporaryRepository: tmpRepo,
+		},
+		TreePath: "README.md",
+	})
+	assert.True(t, models.IsErrBranchNotExist(err))
+
+	otherRepo := models.AssertExistsAndLoadBean(t, &models.Repository{ID: 3}).(*models.Repository)
+	_, err = CreateRepoFile(otherRepo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{TemporaryRepository: tmpRepo},
+		TreePath:      "file.txt",
+		Content:       "content",
+	})
+	assert.Error(t, err)
+}
+
+func TestChangeRepoFiles_TemporaryRepositoryEmptyRepo(t *testing.T) {
+	repo := prepareEmptyTestRepo(t)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: repo.OwnerID}).(*models.User)
+
+	tmpRepo, err := NewTemporaryUploadRepository(repo)
+	assert.NoError(t, err)
+	defer tmpRepo.Close()
+	for i := 0; i < 2; i++ {
+		_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+			CommitOptions: CommitOptions{TemporaryRepository: tmpRepo},
+			TreePath:      fmt.Sprintf("file%d.txt", i),
+			Content:       fmt.Sprintf("content %d", i),
+		})
+		assert.NoError(t, err)
+	}
+	assert.EqualValues(t, "2", getCommitsCount(t, repo, "master"))
+}
+
+func benchmarkSequentialEdits(b *testing.B, reuse bool) {
+	repo := prepareTestRepo(b, 1)
+	doer := models.AssertExistsAndLoadBean(b, &models.User{ID: 2}).(*models.User)
+
+	var tmpRepo *TemporaryUploadRepository
+	if reuse {
+		var err error
+		tmpRepo, err = NewTemporaryUploadRepository(repo)
+		assert.NoError(b, err)
+		defer tmpRepo.Close()
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+			CommitOptions: CommitOptions{TemporaryRepository: tmpRepo},
+			TreePath:      fmt.Sprintf("file%d.txt", i),
+			Content:       "content",
+		})
+		assert.NoError(b, err)
+	}
+}
+
+func BenchmarkSequentialEdits(b *testing.B) {
+	benchmarkSequentialEdits(b, false)
+}
+
+func BenchmarkSequentialEdits_TemporaryRepository(b *testing.B) {
+	benchmarkSequentialEdits(b, true)
+}
+
+func TestCleanupTemporaryUploadRepositories(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+
+	stale, err := NewTemporaryUploadRepository(repo)
+	assert.NoError(t, err)
+	assert.NoError(t, stale.Init())
+	staleTime := time.Now().Add(-25 * time.Hour)
+	assert.NoError(t, os.Chtimes(stale.BasePath(), staleTime, staleTime))
+	fresh, err := NewTemporaryUploadRepository(repo)
+	assert.NoError(t, err)
+	defer fresh.Close()
+	assert.NoError(t, fresh.Init())
+	// Other files of the directory are none of its business
+	other := filepath.Join(TemporaryUploadRepositoriesPath(), "other")
+	assert.NoError(t, os.MkdirAll(other, os.ModePerm))
+	assert.NoError(t, os.Chtimes(other, staleTime, staleTime))
+	defer os.RemoveAll(other)
+
+	assert.NoError(t, CleanupTemporaryUploadRepositories(24*time.Hour))
+	_, err = os.Stat(stale.BasePath())
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(fresh.BasePath())
+	assert.NoError(t, err)
+	_, err = os.Stat(other)
+	assert.NoError(t, err)
+}
+
+func TestNewTemporaryUploadRepository_Exhausted(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	oldMaxTemporaryRepositories := setting.Repository.MaxTemporaryRepositories
+	defer func() {
+		setting.Repository.MaxTemporaryRepositories = oldMaxTemporaryRepositories
+	}()
+	// Other tests may leave repositories unclosed
+	temporaryRepositories.Lock()
+	setting.Repository.MaxTemporaryRepositories = temporaryRepositories.count + 2
+	temporaryRepositories.Unlock()
+
+	// The operations beyond the limit fail until a repository is released
+	first, err := NewTemporaryUploadRepository(repo)
+	assert.NoError(t, err)
+	second, err := NewTemporaryUploadRepository(repo)
+	assert.NoError(t, err)
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{TreePath: "a.txt", Content: "a"})
+	assert.EqualValues(t, models.ErrTemporarilyUnavailable{
+		Reason:     "too many file operations in progress",
+		RetryAfter: time.Second,
+	}, err)
+	_, err = NewTemporaryUploadRepository(repo)
+	assert.True(t, models.IsErrTemporarilyUnavailable(err), "%v", err)
+
+	// Closing a repository twice releases it once
+	first.Close()
+	first.Close()
+	_, err = CreateRepoFile(repo, doer, &CreateRepoFileOptions{TreePath: "a.txt", Content: "a"})
+	assert.NoError(t, err)
+	third, err := NewTemporaryUploadRepository(repo)
+	assert.NoError(t, err)
+	_, err = NewTemporaryUploadRepository(repo)
+	assert.True(t, models.IsErrTemporarilyUnavailable(err), "%v", err)
+	second.Close()
+	third.Close()
+}
+
+func TestTemporaryUploadRepository_CommitTreeUnicodeMessage(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	// Not even the locale is UTF-8
+	for _, name := range []string{"LC_ALL", "LANG"} {
+		if oldValue, ok := os.LookupEnv(name); ok {
+			defer os.Setenv(name, oldValue)
+		} else {
+			defer os.Unsetenv(name)
+		}
+		os.Setenv(name, "C")
+	}
+
+	message := "Celebrate 🎉 the release\n\n" + strings.Repeat("Célébrer la sortie, 発売を祝う, отметить выпуск 🚀✨\n", 300)
+	assert.True(t, len(message) > 16<<10)
+	filesResponse, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		CommitOptions: CommitOptions{Message: message},
+		Files:         []*ChangeRepoFile{{Operation: "create", TreePath: "release.txt", Content: "🎉\n"}},
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, message, filesResponse.Commit.Message)
+	commit := getBranchCommit(t, repo, "master")
+	assert.EqualValues(t, message, commit.Message())
+	assert.EqualValues(t, "Celebrate 🎉 the release", commit.Summary())
+}
+
+func TestTemporaryUploadRepository_CommitTreeWithOptions(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	master := getBranchCommit(t, repo, "master")
+	temp, err := NewTemporaryUploadRepository(repo)
+	assert.NoError(t, err)
+	defer temp.Close()
+	assert.NoError(t, temp.Clone("master"))
+
+	author := &git.Signature{Name: "Author", Email: "author@example.com", When: time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)}
+	committer := &git.Signature{Name: "Committer", Email: "committer@example.com", When: time.Date(2019, 2, 3, 4, 5, 6, 0, time.UTC)}
+
+	// The committer and the dates default to those of the author
+	commitHash, err := temp.CommitTreeWithOptions(&CommitTreeOptions{
+		TreeHash: master.Tree.ID.String(),
+		Author:   author,
+		Message:  "Root",
+	})
+	assert.NoError(t, err)
+	root, err := temp.GetCommit(commitHash)
+	assert.NoError(t, err)
+	commit := root
+	assert.EqualValues(t, master.Tree.ID, commit.Tree.ID)
+	assert.EqualValues(t, 0, commit.ParentCount())
+	assert.EqualValues(t, "Root\n", commit.Message())
+	for _, sig := range []*git.Signature{commit.Author, commit.Committer} {
+		assert.EqualValues(t, "Author <author@example.com>", sig.Name+" <"+sig.Email+">")
+		assert.EqualValues(t, author.When.Unix(), sig.When.Unix())
+	}
+
+	// The parents are resolved in order and the dates replace those of the signatures
+	authorDate := time.Date(2019, 3, 4, 5, 6, 7, 0, time.UTC)
+	committerDate := time.Date(2019, 4, 5, 6, 7, 8, 0, time.UTC)
+	commitHash, err = temp.CommitTreeWithOptions(&CommitTreeOptions{
+		TreeHash:      master.Tree.ID.String()[:10],
+		Parents:       []string{"HEAD", root.ID.String()[:10]},
+		Author:        author,
+		Committer:     committer,
+		AuthorDate:    authorDate,
+		CommitterDate: committerDate,
+		Message:       "Merge the root\n\nKeep master",
+	})
+	assert.NoError(t, err)
+	commit, err = temp.GetCommit(commitHash)
+	assert.NoError(t, err)
+	assert.EqualValues(t, master.Tree.ID, commit.Tree.ID)
+	if assert.EqualValues(t, 2, commit.ParentCount()) {
+		for i, parent := range []*git.Commit{master, root} {
+			parentID, err := commit.ParentID(i)
+			assert.NoError(t, err)
+			assert.EqualValues(t, parent.ID, parentID)
+		}
+	}
+	assert.EqualValues(t, "Merge the root\n\nKeep master\n", commit.Message())
+	assert.EqualValues(t, "Author", commit.Author.Name)
+	assert.EqualValues(t, authorDate.Unix(), commit.Author.When.Unix())
+	assert.EqualValues(t, "committer@example.com", commit.Committer.Email)
+	assert.EqualValues(t, committerDate.Unix(), commit.Committer.When.Unix())
+	assert.Nil(t, commit.Signature)
+
+	// Nothing is committed without an author nor with missing objects
+	_, err = temp.CommitTreeWithOptions(&CommitTreeOptions{TreeHash: master.Tree.ID.String()})
+	assert.Error(t, err)
+	_, err = temp.CommitTreeWithOptions(&CommitTreeOptions{TreeHash: master.ID.String(), Author: author})
+	assert.Error(t, err)
+	_, err = temp.CommitTreeWithOptions(&CommitTreeOptions{TreeHash: master.Tree.ID.String(), Parents: []string{"missing"}, Author: author})
+	assert.True(t, models.IsErrParentCommitNotExist(err), "%v", err)
+
+	t.Run("SigningKey", func(t *testing.T) {
+		fingerprint, cleanup := setupSigningKey(t)
+		defer cleanup()
+
+		commitHash, err := temp.CommitTreeWithOptions(&CommitTreeOptions{
+			TreeHash:   master.Tree.ID.String(),
+			Parents:    []string{master.ID.String()},
+			Author:     author,
+			Message:    "Signed",
+			SigningKey: fingerprint,
+		})
+		assert.NoError(t, err)
+		commit, err := temp.GetCommit(commitHash)
+		assert.NoError(t, err)
+		assert.NotNil(t, commit.Signature)
+		assert.EqualValues(t, "Signed\n", commit.Message())
+	})
+}
@@ -0,0 +1,174 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/setting"
+	"code.gitea.io/gitea/modules/structs"
+)
+
+// CreateRepoFileFromTemplateOptions holds the options to create a file from a file template
+type CreateRepoFileFromTemplateOptions struct {
+	// Template is the path of the template on the default branch of the file templates repository
+	// of the owner organization, or else of the instance
+	Template string
+	// Variables are given to the template along with Year, Owner and Repo, which they may override
+	Variables map[string]string
+	// CreateRepoFileOptions are the options of the created file, whose content is the expanded
+	// template and whose TreePath defaults to Template
+	CreateRepoFileOptions
+}
+
+// CreateRepoFileFromTemplate adds a new file to the given repository with the content of the given
+// file template expanded with its variables
+func CreateRepoFileFromTemplate(repo *models.Repository, doer *models.User, opts *CreateRepoFileFromTemplateOptions) (*structs.FileResponse, error) {
+	if opts.ContentReader != nil || opts.Content != "" || opts.ContentURL != "" {
+		return nil, fmt.Errorf("content given with the file template %s", opts.Template)
+	}
+	name := CleanUploadFileName(opts.Template)
+	if name == "" {
+		return nil, models.ErrFileTemplateNotExist{Name: opts.Template}
+	}
+	if err := repo.GetOwner(); err != nil {
+		return nil, err
+	}
+	content, err := getFileTemplate(repo, doer, name)
+	if err != nil {
+		return nil, err
+	}
+
+	variables := map[string]string{
+		"Year":  strconv.Itoa(time.Now().Year()),
+		"Owner": repo.Owner.DisplayName(),
+		"Repo":  repo.Name,
+	}
+	for key, value := range opts.Variables {
+		variables[key] = value
+	}
+	createOpts := opts.CreateRepoFileOptions
+	if createOpts.Content, err = expandFileTemplate(name, content, variables); err != nil {
+		return nil, err
+	}
+	createOpts.Encoding = ""
+	if createOpts.TreePath == "" {
+		createOpts.TreePath = name
+	}
+	return CreateRepoFile(repo, doer, &createOpts)
+}
+
+// getFileTemplate returns the content of the given file template for the given repository, looked up
+// in the file templates repository of its owner organization first and then in the one of the instance
+func getFileTemplate(repo *models.Repository, doer *models.User, name string) (string, error) {
+	templateRepos, err := getFileTemplateRepositories(repo, doer)
+	if err != nil {
+		return "", err
+	}
+	for _, templateRepo := range templateRepos {
+		content, found, err := readFileTemplate(templateRepo, name)
+		if err != nil {
+			return "", err
+		} else if found {
+			return content, nil
+		}
+	}
+	return "", models.ErrFileTemplateNotExist{Name: name}
+}
+
+// getFileTemplateRepositories returns the configured file templates repositories of the given
+// repository, whose owner is loaded, leaving out the one of its owner organization when the doer
+// may not read it
+func getFileTemplateRepositories(repo *models.Repository, doer *models.User) ([]*models.Repository, error) {
+	templateRepos := make([]*models.Repository, 0, 2)
+	if setting.Repository.FileTemplates.OrgRepository != "" && repo.Owner.IsOrganization() {
+		templateRepo, err := models.GetRepositoryByName(repo.OwnerID, setting.Repository.FileTemplates.OrgRepository)
+		if err != nil && !models.IsErrRepoNotExist(err) {
+			return nil, err
+		} else if err == nil {
+			canRead, err := models.HasAccessUnit(doer, templateRepo, models.UnitTypeCode, models.AccessModeRead)
+			if err != nil {
+				return nil, err
+			} else if canRead {
+				templateRepos = append(templateRepos, templateRepo)
+			}
+		}
+	}
+	if fullName := setting.Repository.FileTemplates.Repository; fullName != "" {
+		parts := strings.SplitN(fullName, "/", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid file templates repository: %s", fullName)
+		}
+		templateRepo, err := models.GetRepositoryByOwnerAndName(parts[0], parts[1])
+		if err != nil && !models.IsErrRepoNotExist(err) {
+			return nil, err
+		} else if err == nil {
+			templateRepos = append(templateRepos, templateRepo)
+		}
+	}
+	return templateRepos, nil
+}
+
+// readFileTemplate returns the content of the regular file at the given path on the default branch of
+// the given file templates repository, and whether there is such a file
+func readFileTemplate(templateRepo *models.Repository, name string) (string, bool, error) {
+	if templateRepo.IsEmpty {
+		return "", false, nil
+	}
+	gitRepo, err := git.OpenRepository(templateRepo.RepoPath())
+	if err != nil {
+		return "", false, err
+	}
+	commit, err := gitRepo.GetBranchCommit(templateRepo.DefaultBranch)
+	if err != nil {
+		return "", false, err
+	}
+	entry, err := commit.GetTreeEntryByPath(name)
+	if git.IsErrNotExist(err) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	if entry.IsDir() || entry.IsLink() || entry.IsSubModule() {
+		return "", false, nil
+	}
+
+	reader, err := entry.Blob().DataAsync()
+	if err != nil {
+		return "", false, err
+	}
+	defer reader.Close()
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", false, err
+	}
+	return string(content), true, nil
+}
+
+// expandFileTemplate executes the given file template with the given variables, those it uses that
+// are not given failing it in strict mode and being left empty otherwise
+func expandFileTemplate(name, content string, variables map[string]string) (string, error) {
+	missingKey := "missingkey=zero"
+	if setting.Repository.FileTemplates.Strict {
+		missingKey = "missingkey=error"
+	}
+	tmpl, err := template.New(name).Option(missingKey).Parse(content)
+	if err != nil {
+		return "", models.ErrInvalidFileTemplate{Name: name, Reason: err.Error()}
+	}
+	var expanded bytes.Buffer
+	if err := tmpl.Execute(&expanded, variables); err != nil {
+		return "", models.ErrInvalidFileTemplate{Name: name, Reason: err.Error()}
+	}
+	return expanded.String(), nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/setting"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setFileTemplatesSettings configures the file templates repositories until the returned function is called
+func setFileTemplatesSettings(repository, orgRepository string, strict bool) func() {
+	oldFileTemplates := setting.Repository.FileTemplates
+	setting.Repository.FileTemplates.Repository = repository
+	setting.Repository.FileTemplates.OrgRepository = orgRepository
+	setting.Repository.FileTemplates.Strict = strict
+	return func() {
+		setting.Repository.FileTemplates = oldFileTemplates
+	}
+}
+
+// loadTemplateRepo returns the given repository with its hooks removed, to add templates to it
+func loadTemplateRepo(t *testing.T, repoID int64) *models.Repository {
+	repo := models.AssertExistsAndLoadBean(t, &models.Repository{ID: repoID}).(*models.Repository)
+	assert.NoError(t, os.RemoveAll(filepath.Join(repo.RepoPath(), "hooks")))
+	return repo
+}
+
+func TestCreateRepoFileFromTemplate(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	templateRepo := loadTemplateRepo(t, 16)
+	defer setFileTemplatesSettings("user2/repo16", "", true)()
+
+	_, err := CreateRepoFile(templateRepo, doer, &CreateRepoFileOptions{
+		TreePath: "LICENSE",
+		Content:  "Copyright (c) {{.Year}} {{.Owner}}\n",
+	})
+	assert.NoError(t, err)
+
+	fileResponse, err := CreateRepoFileFromTemplate(repo, doer, &CreateRepoFileFromTemplateOptions{
+		Template: "LICENSE",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "LICENSE", fileResponse.Content.Path)
+	expected := "Copyright (c) " + strconv.Itoa(time.Now().Year()) + " " + doer.DisplayName() + "\n"
+	assert.EqualValues(t, expected, getBranchFileContent(t, repo, "master", "LICENSE"))
+
+	// The variables given override the default ones and the file may be created elsewhere
+	_, err = CreateRepoFileFromTemplate(repo, doer, &CreateRepoFileFromTemplateOptions{
+		Template:  "LICENSE",
+		Variables: map[string]string{"Year": "2000-2019"},
+		CreateRepoFileOptions: CreateRepoFileOptions{
+			CommitOptions: CommitOptions{NewBranch: "license", CreateNewBranch: true},
+			TreePath:      "docs/LICENSE",
+		},
+	})
+	assert.NoError(t, err)
+	expected = "Copyright (c) 2000-2019 " + doer.DisplayName() + "\n"
+	assert.EqualValues(t, expected, getBranchFileContent(t, repo, "license", "docs/LICENSE"))
+
+	commitsCount := getCommitsCount(t, repo, "master")
+	for _, name := range []string{"UNKNOWN", "readme.md/LICENSE", "", ".git/config"} {
+		_, err = CreateRepoFileFromTemplate(repo, doer, &CreateRepoFileFromTemplateOptions{
+			Template:              name,
+			CreateRepoFileOptions: CreateRepoFileOptions{TreePath: "new_file.txt"},
+		})
+		assert.True(t, models.IsErrFileTemplateNotExist(err), "%s: %v", name, err)
+	}
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+}
+
+func TestCreateRepoFileFromTemplate_Variables(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	templateRepo := loadTemplateRepo(t, 16)
+	restoreSettings := setFileTemplatesSettings("user2/repo16", "", true)
+	defer restoreSettings()
+
+	for treePath, content := range map[string]string{
+		"ISSUE_TEMPLATE.md": "# {{.Project}} issue in {{.Repo}}\n",
+		"INVALID":           "{{.Project\n",
+	} {
+		_, err := CreateRepoFile(templateRepo, doer, &CreateRepoFileOptions{TreePath: treePath, Content: content})
+		assert.NoError(t, err)
+	}
+
+	// Unresolved variables are refused in strict mode
+	commitsCount := getCommitsCount(t, repo, "master")
+	for _, name := range []string{"ISSUE_TEMPLATE.md", "INVALID"} {
+		_, err := CreateRepoFileFromTemplate(repo, doer, &CreateRepoFileFromTemplateOptions{Template: name})
+		if assert.True(t, models.IsErrInvalidFileTemplate(err), "%s: %v", name, err) {
+			assert.EqualValues(t, name, err.(models.ErrInvalidFileTemplate).Name)
+		}
+	}
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+
+	_, err := CreateRepoFileFromTemplate(repo, doer, &CreateRepoFileFromTemplateOptions{
+		Template:  "ISSUE_TEMPLATE.md",
+		Variables: map[string]string{"Project": "Gitea"},
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "# Gitea issue in repo1\n", getBranchFileContent(t, repo, "master", "ISSUE_TEMPLATE.md"))
+
+	// And left empty otherwise
+	restoreSettings()
+	defer setFileTemplatesSettings("user2/repo16", "", false)()
+	_, err = CreateRepoFileFromTemplate(repo, doer, &CreateRepoFileFromTemplateOptions{
+		Template:              "ISSUE_TEMPLATE.md",
+		CreateRepoFileOptions: CreateRepoFileOptions{TreePath: "ISSUE_TEMPLATE/bug.md"},
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "#  issue in repo1\n", getBranchFileContent(t, repo, "master", "ISSUE_TEMPLATE/bug.md"))
+}
+
+func TestCreateRepoFileFromTemplate_Organization(t *testing.T) {
+	repo := prepareTestRepo(t, 3)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	outsider := models.AssertExistsAndLoadBean(t, &models.User{ID: 10}).(*models.User)
+	instanceTemplateRepo := loadTemplateRepo(t, 16)
+	defer setFileTemplatesSettings("user2/repo16", "repo3", true)()
+
+	for templateRepo, content := range map[*models.Repository]string{
+		instanceTemplateRepo: "Instance license of {{.Owner}}\n",
+		repo:                 "Organization license of {{.Owner}}\n",
+	} {
+		_, err := CreateRepoFile(templateRepo, doer, &CreateRepoFileOptions{TreePath: "LICENSE.tmpl", Content: content})
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, repo.GetOwner())
+
+	// The templates of the organization take precedence over those of the instance
+	_, err := CreateRepoFileFromTemplate(repo, doer, &CreateRepoFileFromTemplateOptions{
+		Template:              "LICENSE.tmpl",
+		CreateRepoFileOptions: CreateRepoFileOptions{TreePath: "LICENSE"},
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "Organization license of "+repo.Owner.DisplayName()+"\n", getBranchFileContent(t, repo, "master", "LICENSE"))
+
+	// Unless the doer may not read them
+	_, err = CreateRepoFileFromTemplate(repo, outsider, &CreateRepoFileFromTemplateOptions{
+		Template:              "LICENSE.tmpl",
+		CreateRepoFileOptions: CreateRepoFileOptions{TreePath: "COPYING"},
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "Instance license of "+repo.Owner.DisplayName()+"\n", getBranchFileContent(t, repo, "master", "COPYING"))
+}
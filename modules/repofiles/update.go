@@ -0,0 +1,66 @@
+// Copyright 2018 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"io"
+
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/structs"
+)
+
+// UpdateRepoFileOptions holds the repository update file options
+type UpdateRepoFileOptions struct {
+	CommitOptions
+	TreePath string
+	// FromTreePath is the current path of the file, when empty it is the same as TreePath
+	FromTreePath string
+	// ContentReader streams the raw content, Content given in Encoding is used when it is nil
+	ContentReader io.Reader
+	Content       string
+	// Encoding of Content, either "base64" or empty for raw content
+	Encoding string
+	// ContentURL is fetched as the raw content in place of ContentReader and Content, see ChangeRepoFile
+	ContentURL string
+	// Charset and BOM encode the content given in UTF-8, see ChangeRepoFile
+	Charset string
+	BOM     bool
+	// ContentSHA is checked against the blob the content is written as, see ChangeRepoFile
+	ContentSHA string
+	// Mode of the file, the current one when empty, see ChangeRepoFile
+	Mode string
+	// Symlink makes the file a symlink to the path given as content
+	Symlink bool
+	// SHA of the blob currently at FromTreePath, checked against the branch when given
+	SHA string
+}
+
+// UpdateRepoFile updates the content of a file in the given repository and moves it
+// to TreePath when FromTreePath is a different path
+func UpdateRepoFile(repo *models.Repository, doer *models.User, opts *UpdateRepoFileOptions) (*structs.FileResponse, error) {
+	changeOpts := &ChangeRepoFilesOptions{
+		CommitOptions: opts.CommitOptions,
+		Files: []*ChangeRepoFile{{
+			Operation:     "update",
+			TreePath:      opts.TreePath,
+			FromTreePath:  opts.FromTreePath,
+			ContentReader: opts.ContentReader,
+			Content:       opts.Content,
+			Encoding:      opts.Encoding,
+			ContentURL:    opts.ContentURL,
+			Charset:       opts.Charset,
+			BOM:           opts.BOM,
+			ContentSHA:    opts.ContentSHA,
+			Mode:          opts.Mode,
+			Symlink:       opts.Symlink,
+			SHA:           opts.SHA,
+		}},
+	}
+	filesResponse, err := ChangeRepoFiles(repo, doer, changeOpts)
+	if err != nil {
+		return nil, err
+	}
+	return fileResponseFromFiles(filesResponse), nil
+}
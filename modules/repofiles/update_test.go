@@ -0,0 +1,199 @@
+// Copyright 2018 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"strings"
+	"testing"
+
+	"code.gitea.io/git"
+	"code.gitea.io/gitea/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const readmeSHA = "4b4851ad51df6a7d9f25c979345979eaeb5b349f"
+
+func getBranchFileContent(t *testing.T, repo *models.Repository, branch, treePath string) string {
+	stdout, err := git.NewCommand("show", branch+":"+treePath).RunInDir(repo.RepoPath())
+	assert.NoError(t, err)
+	return stdout
+}
+
+// getBranchFileMode returns the mode of the file at the given path of the branch, as shown by git ls-tree
+func getBranchFileMode(t *testing.T, repo *models.Repository, branch, treePath string) string {
+	stdout, err := git.NewCommand("ls-tree", branch, "--", treePath).RunInDir(repo.RepoPath())
+	assert.NoError(t, err)
+	return strings.Fields(stdout)[0]
+}
+
+func getLastCommitNameStatus(t *testing.T, repo *models.Repository, branch string) string {
+	stdout, err := git.NewCommand("diff", "--name-status", "-M", branch+"~1", branch).RunInDir(repo.RepoPath())
+	assert.NoError(t, err)
+	return strings.TrimSpace(stdout)
+}
+
+func TestUpdateRepoFile(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	fileResponse, err := UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		CommitOptions: CommitOptions{Message: "Update README.md"},
+		TreePath:      "README.md",
+		Content:       "# repo1\n\nUpdated\n",
+		SHA:           readmeSHA,
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "README.md", fileResponse.Content.Path)
+	assert.EqualValues(t, "# repo1\n\nUpdated\n", getBranchFileContent(t, repo, "master", "README.md"))
+	assert.EqualValues(t, "M\tREADME.md", getLastCommitNameStatus(t, repo, "master"))
+}
+
+func TestUpdateRepoFile_Rename(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	content := getBranchFileContent(t, repo, "master", "README.md")
+
+	fileResponse, err := UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		CommitOptions: CommitOptions{Message: "Move README.md"},
+		TreePath:      "docs/README.md",
+		FromTreePath:  "README.md",
+		Content:       content,
+		SHA:           readmeSHA,
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "docs/README.md", fileResponse.Content.Path)
+	assert.EqualValues(t, readmeSHA, fileResponse.Content.SHA)
+	assert.EqualValues(t, "R100\tREADME.md\tdocs/README.md", getLastCommitNameStatus(t, repo, "master"))
+}
+
+func TestUpdateRepoFile_RenameAndEdit(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+	content := strings.Repeat("A line which stays the same\n", 10)
+
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		CommitOptions: CommitOptions{Message: "Add lines.txt"},
+		TreePath:      "lines.txt",
+		Content:       content,
+	})
+	assert.NoError(t, err)
+
+	_, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		CommitOptions: CommitOptions{Message: "Move and update lines.txt"},
+		TreePath:      "docs/lines.txt",
+		FromTreePath:  "lines.txt",
+		Content:       content + "A new line\n",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, content+"A new line\n", getBranchFileContent(t, repo, "master", "docs/lines.txt"))
+	assert.True(t, strings.HasPrefix(getLastCommitNameStatus(t, repo, "master"), "R"))
+	assert.True(t, strings.HasSuffix(getLastCommitNameStatus(t, repo, "master"), "\tlines.txt\tdocs/lines.txt"))
+}
+
+func TestUpdateRepoFile_Errors(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		CommitOptions: CommitOptions{Message: "Update README.md"},
+		TreePath:      "README.md",
+		Content:       "content",
+		SHA:           "0000000000000000000000000000000000000000",
+	})
+	assert.True(t, models.IsErrSHADoesNotMatch(err))
+
+	_, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		CommitOptions: CommitOptions{Message: "Update does-not-exist.md"},
+		TreePath:      "does-not-exist.md",
+		Content:       "content",
+	})
+	assert.True(t, models.IsErrRepoFileDoesNotExist(err))
+}
+
+func TestUpdateRepoFile_Mode(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{
+		TreePath: "script.sh",
+		Content:  "#!/bin/sh\n",
+		Mode:     "100755",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "100755", getBranchFileMode(t, repo, "master", "script.sh"))
+
+	// The executable bit is kept by updates, including when moving the file
+	_, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		TreePath: "script.sh",
+		Content:  "#!/bin/sh\necho updated\n",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "100755", getBranchFileMode(t, repo, "master", "script.sh"))
+	_, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		FromTreePath: "script.sh",
+		TreePath:     "bin/script.sh",
+		Content:      "#!/bin/sh\necho moved\n",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "100755", getBranchFileMode(t, repo, "master", "bin/script.sh"))
+
+	// Unless another mode is requested
+	_, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		TreePath: "bin/script.sh",
+		Content:  "not a script anymore\n",
+		Mode:     "100644",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "100644", getBranchFileMode(t, repo, "master", "bin/script.sh"))
+	_, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		TreePath: "README.md",
+		Content:  "#!/bin/sh\n",
+		Mode:     "100755",
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "100755", getBranchFileMode(t, repo, "master", "README.md"))
+
+	commitsCount := getCommitsCount(t, repo, "master")
+	for _, mode := range []string{"755", "120000", "040000"} {
+		_, err = UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+			TreePath: "README.md",
+			Content:  "invalid mode",
+			Mode:     mode,
+		})
+		assert.EqualError(t, err, "invalid file mode: "+mode)
+	}
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+}
+
+func TestUpdateRepoFile_EmptyCommit(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	content := getBranchFileContent(t, repo, "master", "README.md")
+	commitsCount := getCommitsCount(t, repo, "master")
+	for _, dryRun := range []bool{true, false} {
+		_, err := UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+			CommitOptions: CommitOptions{DryRun: dryRun},
+			TreePath:      "README.md",
+			Content:       content,
+		})
+		assert.EqualValues(t, models.ErrEmptyCommit{BranchName: "master"}, err)
+	}
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+
+	fileResponse, err := UpdateRepoFile(repo, doer, &UpdateRepoFileOptions{
+		CommitOptions: CommitOptions{Message: "Trigger CI", AllowEmptyCommit: true},
+		TreePath:      "README.md",
+		Content:       content,
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "2", getCommitsCount(t, repo, "master"))
+	stdout, err := git.NewCommand("rev-parse", "master^{tree}", "master^^{tree}").RunInDir(repo.RepoPath())
+	assert.NoError(t, err)
+	trees := strings.Fields(stdout)
+	assert.EqualValues(t, trees[1], trees[0])
+	assert.EqualValues(t, trees[0], fileResponse.Commit.Tree.SHA)
+}
@@ -0,0 +1,118 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"bytes"
+	"encoding/json"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"code.gitea.io/gitea/models"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	// yamlErrorLineRegexp matches the line yaml reports its errors on, counted from 0
+	yamlErrorLineRegexp = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+)
+
+// dataFileFormat returns the format of the data files validated by the extension of the given
+// tree path, or "" if the path is not one of them
+func dataFileFormat(treePath string) string {
+	switch strings.ToLower(path.Ext(treePath)) {
+	case ".json":
+		return "JSON"
+	case ".yaml", ".yml":
+		return "YAML"
+	}
+	return ""
+}
+
+// validateDataFile checks the given content of the data file at the given tree path parses in the
+// format of its extension, failing with ErrInvalidDataFile locating the error otherwise
+func validateDataFile(treePath string, content []byte) error {
+	format := dataFileFormat(treePath)
+	switch format {
+	case "JSON":
+		var value interface{}
+		err := json.Unmarshal(content, &value)
+		if syntaxErr, ok := err.(*json.SyntaxError); ok {
+			line, column := locateOffset(content, int(syntaxErr.Offset)-1)
+			return models.ErrInvalidDataFile{Path: treePath, Format: format, Line: line, Column: column, Reason: syntaxErr.Error()}
+		} else if err != nil {
+			return models.ErrInvalidDataFile{Path: treePath, Format: format, Line: 1, Reason: err.Error()}
+		}
+	case "YAML":
+		// yaml only parses the first document of a stream, each one is parsed on its own
+		for _, document := range splitYAMLDocuments(content) {
+			var value interface{}
+			if err := yaml.Unmarshal(document.content, &value); err != nil {
+				line, reason := document.line, err.Error()
+				if match := yamlErrorLineRegexp.FindStringSubmatch(reason); match != nil {
+					offset, _ := strconv.Atoi(match[1])
+					line, reason = document.line+offset, match[2]
+				} else {
+					reason = strings.TrimPrefix(reason, "yaml: ")
+				}
+				return models.ErrInvalidDataFile{Path: treePath, Format: format, Line: line, Reason: reason}
+			}
+		}
+	}
+	return nil
+}
+
+// locateOffset returns the line and column, counted from 1 in characters, of the byte of the given
+// content at the given offset
+func locateOffset(content []byte, offset int) (int, int) {
+	if offset > len(content) {
+		offset = len(content)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	lineStart := bytes.LastIndexByte(content[:offset], '\n') + 1
+	line := bytes.Count(content[:lineStart], []byte("\n")) + 1
+	return line, utf8.RuneCount(content[lineStart:offset]) + 1
+}
+
+// yamlDocument is a document of a YAML stream and the line it starts on, counted from 1
+type yamlDocument struct {
+	content []byte
+	line    int
+}
+
+// splitYAMLDocuments splits the given YAML stream into its documents at the "---" markers starting
+// them, which can't be part of the content of a document. The directives before a marker stay with
+// the document it starts.
+func splitYAMLDocuments(content []byte) []yamlDocument {
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	documents := make([]yamlDocument, 0, 1)
+	start, hasContent := 0, false
+	for i, line := range lines {
+		if isYAMLDocumentMarker(line) && hasContent {
+			documents = append(documents, yamlDocument{content: bytes.Join(lines[start:i], nil), line: start + 1})
+			start, hasContent = i, false
+		}
+		trimmed := bytes.TrimSpace(line)
+		if len(trimmed) > 0 && trimmed[0] != '#' && trimmed[0] != '%' {
+			hasContent = true
+		}
+	}
+	return append(documents, yamlDocument{content: bytes.Join(lines[start:], nil), line: start + 1})
+}
+
+// isYAMLDocumentMarker returns whether the given line starts a YAML document
+func isYAMLDocumentMarker(line []byte) bool {
+	if !bytes.HasPrefix(line, []byte("---")) {
+		return false
+	}
+	rest := line[3:]
+	return len(rest) == 0 || rest[0] == ' ' || rest[0] == '\t' || rest[0] == '\n' || rest[0] == '\r'
+}
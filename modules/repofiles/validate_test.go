@@ -0,0 +1,67 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repofiles
+
+import (
+	"testing"
+
+	"code.gitea.io/gitea/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeRepoFiles_ValidateDataFiles(t *testing.T) {
+	repo := prepareTestRepo(t, 1)
+	doer := models.AssertExistsAndLoadBean(t, &models.User{ID: 2}).(*models.User)
+
+	// Broken data files are committed as they are unless the repository validates them
+	_, err := CreateRepoFile(repo, doer, &CreateRepoFileOptions{TreePath: "broken.json", Content: "{"})
+	assert.NoError(t, err)
+
+	repo.ValidateDataFiles = true
+	assert.NoError(t, models.UpdateRepository(repo, false))
+	_, err = ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+		Files: []*ChangeRepoFile{
+			{Operation: "create", TreePath: "config.json", Content: "{\"name\": \"gitea\", \"tags\": [\"é\", 2]}\n"},
+			{Operation: "create", TreePath: "config.yml", Content: "name: gitea\n---\ntags:\n  - a\n"},
+			{Operation: "create", TreePath: "notes.txt", Content: "{"},
+		},
+	})
+	assert.NoError(t, err)
+	commitsCount := getCommitsCount(t, repo, "master")
+
+	for _, test := range []struct {
+		treePath string
+		content  string
+		err      models.ErrInvalidDataFile
+	}{
+		{
+			treePath: "settings.json",
+			content:  "{\n  \"tags\": [\"é\" 2]\n}\n",
+			err:      models.ErrInvalidDataFile{Format: "JSON", Line: 2, Column: 16, Reason: "invalid character '2' after array element"},
+		},
+		{
+			treePath: "empty.json",
+			err:      models.ErrInvalidDataFile{Format: "JSON", Line: 1, Column: 1, Reason: "unexpected end of JSON input"},
+		},
+		{
+			treePath: "settings.yml",
+			content:  "name: gitea\ntags:\n\t- a\n",
+			err:      models.ErrInvalidDataFile{Format: "YAML", Line: 3, Reason: "found character that cannot start any token"},
+		},
+		{
+			treePath: "docs/second.YAML",
+			content:  "name: gitea\n---\n# tags\ntags: a: b\n",
+			err:      models.ErrInvalidDataFile{Format: "YAML", Line: 4, Reason: "mapping values are not allowed in this context"},
+		},
+	} {
+		_, err := ChangeRepoFiles(repo, doer, &ChangeRepoFilesOptions{
+			Files: []*ChangeRepoFile{{Operation: "create", TreePath: test.treePath, Content: test.content}},
+		})
+		test.err.Path = test.treePath
+		assert.EqualValues(t, test.err, err, test.treePath)
+	}
+	assert.EqualValues(t, commitsCount, getCommitsCount(t, repo, "master"))
+}
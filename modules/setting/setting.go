@@ -154,6 +154,8 @@ var (
 		JWTSecretBase64 string        `ini:"LFS_JWT_SECRET"`
 		JWTSecretBytes  []byte        `ini:"-"`
 		HTTPAuthExpiry  time.Duration `ini:"LFS_HTTP_AUTH_EXPIRY"`
+		MaxFileSize     int64         `ini:"LFS_MAX_FILE_SIZE"`
+		SizeQuota       int64         `ini:"LFS_SIZE_QUOTA"`
 	}
 
 	// Security settings
@@ -213,6 +215,19 @@ var (
 		DisableHTTPGit           bool
 		AccessControlAllowOrigin string
 		UseCompatSSHURI          bool
+		MaxCommitDateSkew        time.Duration
+		MaxFileSize              int64
+		SizeQuota                int64
+		RestrictSymlinkTargets   bool
+		AllowAmendOthersCommits  bool
+		AdminsBypassProtection   bool
+		PushRetries              int
+		PushRetryBackoff         time.Duration
+		VerifyIndex              bool
+		SparseIndex              bool
+		FastImportMinFiles       int
+		MaxTemporaryRepositories int
+		IdempotencyKeyMaxAge     time.Duration
 
 		// Repository editor settings
 		Editor struct {
@@ -231,14 +246,37 @@ var (
 
 		// Repository local settings
 		Local struct {
-			LocalCopyPath string
-			LocalWikiPath string
+			LocalCopyPath          string
+			LocalWikiPath          string
+			UploadRepositoryMaxAge time.Duration
 		} `ini:"-"`
 
 		// Pull request settings
 		PullRequest struct {
 			WorkInProgressPrefixes []string
 		} `ini:"repository.pull-request"`
+
+		// Repository signing settings
+		Signing struct {
+			SigningKey  string
+			CRUDActions []string `ini:"CRUD_ACTIONS"`
+		} `ini:"-"`
+
+		// Repository content URL settings
+		ContentURL struct {
+			AllowedSchemes       []string
+			AllowedHosts         []string
+			AllowPrivateNetworks bool
+			Timeout              time.Duration
+			MaxSize              int64
+		} `ini:"-"`
+
+		// Repository file templates settings
+		FileTemplates struct {
+			Repository    string
+			OrgRepository string
+			Strict        bool
+		} `ini:"-"`
 	}{
 		AnsiCharset:              "",
 		ForcePrivate:             false,
@@ -250,6 +288,19 @@ var (
 		DisableHTTPGit:           false,
 		AccessControlAllowOrigin: "",
 		UseCompatSSHURI:          false,
+		MaxCommitDateSkew:        5 * time.Minute,
+		MaxFileSize:              0,
+		SizeQuota:                0,
+		RestrictSymlinkTargets:   false,
+		AllowAmendOthersCommits:  false,
+		AdminsBypassProtection:   false,
+		PushRetries:              3,
+		PushRetryBackoff:         100 * time.Millisecond,
+		VerifyIndex:              false,
+		SparseIndex:              false,
+		FastImportMinFiles:       0,
+		MaxTemporaryRepositories: 0,
+		IdempotencyKeyMaxAge:     24 * time.Hour,
 
 		// Repository editor settings
 		Editor: struct {
@@ -277,11 +328,13 @@ var (
 
 		// Repository local settings
 		Local: struct {
-			LocalCopyPath string
-			LocalWikiPath string
+			LocalCopyPath          string
+			LocalWikiPath          string
+			UploadRepositoryMaxAge time.Duration
 		}{
-			LocalCopyPath: "tmp/local-repo",
-			LocalWikiPath: "tmp/local-wiki",
+			LocalCopyPath:          "tmp/local-repo",
+			LocalWikiPath:          "tmp/local-wiki",
+			UploadRepositoryMaxAge: 24 * time.Hour,
 		},
 
 		// Pull request settings
@@ -290,6 +343,41 @@ var (
 		}{
 			WorkInProgressPrefixes: []string{"WIP:", "[WIP]"},
 		},
+
+		// Repository signing settings
+		Signing: struct {
+			SigningKey  string
+			CRUDActions []string `ini:"CRUD_ACTIONS"`
+		}{
+			SigningKey:  "default",
+			CRUDActions: []string{"always"},
+		},
+
+		// Repository content URL settings
+		ContentURL: struct {
+			AllowedSchemes       []string
+			AllowedHosts         []string
+			AllowPrivateNetworks bool
+			Timeout              time.Duration
+			MaxSize              int64
+		}{
+			AllowedSchemes:       []string{"https"},
+			AllowedHosts:         []string{},
+			AllowPrivateNetworks: false,
+			Timeout:              30 * time.Second,
+			MaxSize:              100 << 20,
+		},
+
+		// Repository file templates settings
+		FileTemplates: struct {
+			Repository    string
+			OrgRepository string
+			Strict        bool
+		}{
+			Repository:    "",
+			OrgRepository: "",
+			Strict:        true,
+		},
 	}
 	RepoRootPath string
 	ScriptType   = "bash"
@@ -1065,6 +1153,12 @@ func NewContext() {
 		log.Fatal(4, "Failed to map Repository.Local settings: %v", err)
 	} else if err = Cfg.Section("repository.pull-request").MapTo(&Repository.PullRequest); err != nil {
 		log.Fatal(4, "Failed to map Repository.PullRequest settings: %v", err)
+	} else if err = Cfg.Section("repository.signing").MapTo(&Repository.Signing); err != nil {
+		log.Fatal(4, "Failed to map Repository.Signing settings: %v", err)
+	} else if err = Cfg.Section("repository.content-url").MapTo(&Repository.ContentURL); err != nil {
+		log.Fatal(4, "Failed to map Repository.ContentURL settings: %v", err)
+	} else if err = Cfg.Section("repository.file-templates").MapTo(&Repository.FileTemplates); err != nil {
+		log.Fatal(4, "Failed to map Repository.FileTemplates settings: %v", err)
 	}
 
 	if !filepath.IsAbs(Repository.Upload.TempPath) {
@@ -0,0 +1,159 @@
+// Copyright 2019 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package structs holds the structures the file operations of the repositories respond with, until
+// they are part of code.gitea.io/sdk
+package structs
+
+import (
+	"code.gitea.io/sdk/gitea"
+)
+
+// FileContentResponse contains information about a repo's file stats
+type FileContentResponse struct {
+	Name        string `json:"name"`
+	Path        string `json:"path"`
+	SHA         string `json:"sha"`
+	Size        int64  `json:"size"`
+	URL         string `json:"url"`
+	HTMLURL     string `json:"html_url"`
+	DownloadURL string `json:"download_url"`
+	// Type is "file", "dir" or "symlink"
+	Type string `json:"type"`
+	// Mode of a file or symlink, "100644", "100755" or "120000"
+	Mode string `json:"mode,omitempty"`
+	// Target of a symlink
+	Target string `json:"target,omitempty"`
+	// LFSOid and LFSSize describe the real content of a file stored in LFS
+	LFSOid  string `json:"lfs_oid,omitempty"`
+	LFSSize int64  `json:"lfs_size,omitempty"`
+	// Encoding of Content, "text" or "base64" for binary files
+	Encoding string `json:"encoding,omitempty"`
+	// Charset detected for text files, Content always being UTF-8
+	Charset string `json:"charset,omitempty"`
+	// Content is omitted for files too large to be displayed, TooLarge being set then: the content
+	// of Size bytes is to be fetched from DownloadURL instead
+	Content  string `json:"content,omitempty"`
+	TooLarge bool   `json:"too_large,omitempty"`
+}
+
+// CommitUser contains information of a user in the context of a commit
+type CommitUser struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Date  string `json:"date"`
+}
+
+// CommitMeta contains meta information of a commit in terms of API
+type CommitMeta struct {
+	URL string `json:"url"`
+	SHA string `json:"sha"`
+}
+
+// FileCommitResponse contains information about the commit a repo's file was changed in
+type FileCommitResponse struct {
+	SHA       string      `json:"sha"`
+	HTMLURL   string      `json:"html_url"`
+	Author    *CommitUser `json:"author"`
+	Committer *CommitUser `json:"committer"`
+	Message   string      `json:"message"`
+	Tree      *CommitMeta `json:"tree"`
+	// Parents are the parent commits of the commit
+	Parents []*CommitMeta `json:"parents"`
+}
+
+// FileResponse contains information about a repo's file
+type FileResponse struct {
+	Content      *FileContentResponse             `json:"content"`
+	Commit       *FileCommitResponse              `json:"commit"`
+	Verification *gitea.PayloadCommitVerification `json:"verification"`
+	// DeletedPaths are the paths of the files removed when deleting a directory
+	DeletedPaths []string `json:"deleted_paths,omitempty"`
+	// PullRequestNumber is the pull request proposing the change, if it wasn't committed to the branch
+	PullRequestNumber int64 `json:"pull_request_number,omitempty"`
+	// Diffs of the changed files, only given when requested
+	Diffs []*FileDiff `json:"diffs,omitempty"`
+	// Trees are the root tree and the trees of the directories of the changed files after the change
+	Trees []*FileTreeResponse `json:"trees,omitempty"`
+}
+
+// FilesResponse contains information about multiple files of a repo changed in one commit
+type FilesResponse struct {
+	Files        []*FileContentResponse           `json:"files"`
+	Commit       *FileCommitResponse              `json:"commit"`
+	Verification *gitea.PayloadCommitVerification `json:"verification"`
+	// PullRequestNumber is the pull request proposing the change, if it wasn't committed to the branch
+	PullRequestNumber int64 `json:"pull_request_number,omitempty"`
+	// Diffs of the changed files, only given when requested
+	Diffs []*FileDiff `json:"diffs,omitempty"`
+	// Trees are the root tree and the trees of the directories of the changed files after the change
+	Trees []*FileTreeResponse `json:"trees,omitempty"`
+	// DeletedPaths, SkippedPaths and FailedPaths tell what a batch delete did with each path
+	DeletedPaths []string             `json:"deleted_paths,omitempty"`
+	SkippedPaths []string             `json:"skipped_paths,omitempty"`
+	FailedPaths  []*FileErrorResponse `json:"failed_paths,omitempty"`
+	// Changes are the files changed, only given when listing the changes of operations
+	Changes []*FileChange `json:"changes,omitempty"`
+	// Stats sum up the changes of the files like "git diff --shortstat"
+	Stats *FilesStats `json:"stats,omitempty"`
+}
+
+// FilesStats contains the number of files changed by a commit and of lines it inserted and deleted,
+// the lines of binary files not being counted
+type FilesStats struct {
+	FilesChanged int `json:"files_changed"`
+	Insertions   int `json:"insertions"`
+	Deletions    int `json:"deletions"`
+}
+
+// FileChange tells how a file is changed by a commit
+type FileChange struct {
+	Path string `json:"path"`
+	// OldPath is the path of a renamed file before the change
+	OldPath string `json:"old_path,omitempty"`
+	// Type is "add", "change", "delete" or "rename"
+	Type string `json:"type"`
+}
+
+// FileErrorResponse contains why the file at a path could not be changed
+type FileErrorResponse struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// FileTreeResponse contains the SHA of a tree of a repo after a change, empty if the change removed it
+type FileTreeResponse struct {
+	// Path of the directory, empty for the root tree
+	Path string `json:"path"`
+	SHA  string `json:"sha"`
+}
+
+// FileDiff contains the changes made to a file by a commit
+type FileDiff struct {
+	Path string `json:"path"`
+	// OldPath is the path of a renamed file before the change
+	OldPath string `json:"old_path,omitempty"`
+	// Type is "add", "change", "delete" or "rename"
+	Type   string `json:"type"`
+	Binary bool   `json:"binary"`
+	// Incomplete is set when the diff was too large to be given entirely
+	Incomplete bool            `json:"incomplete,omitempty"`
+	Hunks      []*FileDiffHunk `json:"hunks,omitempty"`
+}
+
+// FileDiffHunk contains a group of changed lines of a file diff
+type FileDiffHunk struct {
+	Header string          `json:"header"`
+	Lines  []*FileDiffLine `json:"lines"`
+}
+
+// FileDiffLine contains a line of a file diff hunk
+type FileDiffLine struct {
+	// Type is "context", "add" or "delete"
+	Type string `json:"type"`
+	// OldLine and NewLine are the numbers of the line before and after the change, if it exists there
+	OldLine int    `json:"old_line,omitempty"`
+	NewLine int    `json:"new_line,omitempty"`
+	Content string `json:"content"`
+}
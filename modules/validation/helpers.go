@@ -75,3 +75,24 @@ func IsValidExternalURL(uri string) bool {
 
 	return true
 }
+
+// IsValidGitRefName checks if the given name is a valid git reference name
+func IsValidGitRefName(name string) bool {
+	if GitRefNamePattern.MatchString(name) {
+		return false
+	}
+	// Additional rules as described at https://www.kernel.org/pub/software/scm/git/docs/git-check-ref-format.html
+	if strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") ||
+		strings.HasSuffix(name, ".") || strings.Contains(name, "..") ||
+		strings.Contains(name, "//") {
+		return false
+	}
+	parts := strings.Split(name, "/")
+	for _, part := range parts {
+		if strings.HasSuffix(part, ".lock") || strings.HasPrefix(part, ".") {
+			return false
+		}
+	}
+
+	return true
+}
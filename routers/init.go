@@ -18,6 +18,7 @@ import (
 	"code.gitea.io/gitea/modules/log"
 	"code.gitea.io/gitea/modules/mailer"
 	"code.gitea.io/gitea/modules/markup"
+	"code.gitea.io/gitea/modules/repofiles"
 	"code.gitea.io/gitea/modules/setting"
 	"code.gitea.io/gitea/modules/ssh"
 
@@ -87,6 +88,12 @@ func GlobalInit() {
 
 		models.LoadRepoConfig()
 		models.NewRepoContext()
+		if err := repofiles.CleanupTemporaryUploadRepositories(setting.Repository.Local.UploadRepositoryMaxAge); err != nil {
+			log.Error(4, "Failed to clean up temporary upload repositories: %v", err)
+		}
+		if err := repofiles.CleanupIdempotencyKeys(); err != nil {
+			log.Error(4, "Failed to clean up idempotency keys: %v", err)
+		}
 
 		// Booting long running goroutines.
 		cron.NewContext()
@@ -6,9 +6,13 @@ package repo
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math"
 	"net/http"
+	"os"
 	"path"
+	"strconv"
 	"strings"
 
 	"code.gitea.io/git"
@@ -17,6 +21,7 @@ import (
 	"code.gitea.io/gitea/modules/base"
 	"code.gitea.io/gitea/modules/context"
 	"code.gitea.io/gitea/modules/log"
+	"code.gitea.io/gitea/modules/repofiles"
 	"code.gitea.io/gitea/modules/setting"
 	"code.gitea.io/gitea/modules/templates"
 )
@@ -40,6 +45,41 @@ func renderCommitRights(ctx *context.Context) bool {
 	return canCommit
 }
 
+// renderCommitError renders the given template again with the reason err gave for the changes
+// of form not to be committed to branchName, it returns false if err gave no such reason
+func renderCommitError(ctx *context.Context, err error, tpl base.TplName, form interface{}, oldBranchName, branchName string) bool {
+	if models.IsErrSignedCommitRequired(err) {
+		ctx.RenderWithErr(ctx.Tr("repo.editor.signed_commit_required", branchName), tpl, form)
+	} else if models.IsErrCommitIDDoesNotMatch(err) {
+		ctx.RenderWithErr(ctx.Tr("repo.editor.branch_changed_while_editing", oldBranchName), tpl, form)
+	} else if models.IsErrNotAllowedToPush(err) {
+		ctx.Data["Err_NewBranchName"] = true
+		ctx.Data["commit_choice"] = frmCommitChoiceNewBranch
+		ctx.RenderWithErr(ctx.Tr("repo.editor.cannot_commit_to_protected_branch", branchName), tpl, form)
+	} else if models.IsErrPushRejected(err) {
+		pushErr := err.(models.ErrPushRejected)
+		ctx.RenderWithErr(ctx.Tr("repo.editor.push_rejected", pushErr.Hook, pushErr.Message), tpl, form)
+	} else if models.IsErrTemporarilyUnavailable(err) {
+		retryAfter := err.(models.ErrTemporarilyUnavailable).RetryAfter
+		ctx.Resp.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		ctx.RenderWithErr(ctx.Tr("repo.editor.temporarily_unavailable", retryAfter.String()), tpl, form)
+	} else if models.IsErrFileTooBig(err) {
+		fileErr := err.(models.ErrFileTooBig)
+		ctx.Data["Err_TreePath"] = true
+		ctx.RenderWithErr(ctx.Tr("repo.editor.file_too_big", fileErr.Path, base.FileSize(fileErr.MaxSize)), tpl, form)
+	} else if models.IsErrQuotaExceeded(err) {
+		quotaErr := err.(models.ErrQuotaExceeded)
+		if quotaErr.LFS {
+			ctx.RenderWithErr(ctx.Tr("repo.editor.lfs_quota_exceeded", base.FileSize(quotaErr.Quota)), tpl, form)
+		} else {
+			ctx.RenderWithErr(ctx.Tr("repo.editor.quota_exceeded", base.FileSize(quotaErr.Quota)), tpl, form)
+		}
+	} else {
+		return false
+	}
+	return true
+}
+
 // getParentTreeFields returns list of parent tree names and corresponding tree paths
 // based on given tree path.
 func getParentTreeFields(treePath string) (treeNames []string, treePaths []string) {
@@ -163,7 +203,7 @@ func editFilePost(ctx *context.Context, form auth.EditRepoFileForm, isNewFile bo
 		branchName = form.NewBranchName
 	}
 
-	form.TreePath = cleanUploadFileName(form.TreePath)
+	form.TreePath = repofiles.CleanUploadFileName(form.TreePath)
 	if len(form.TreePath) == 0 {
 		ctx.Error(500, "Upload file name is invalid")
 		return
@@ -298,18 +338,29 @@ func editFilePost(ctx *context.Context, form auth.EditRepoFileForm, isNewFile bo
 		message += "\n\n" + form.CommitMessage
 	}
 
-	if err := ctx.Repo.Repository.UpdateRepoFile(ctx.User, models.UpdateRepoFileOptions{
-		LastCommitID: lastCommit,
-		OldBranch:    oldBranchName,
-		NewBranch:    branchName,
-		OldTreeName:  oldTreePath,
-		NewTreeName:  form.TreePath,
-		Message:      message,
+	file := &repofiles.ChangeRepoFile{
+		Operation:    "update",
+		TreePath:     form.TreePath,
+		FromTreePath: oldTreePath,
 		Content:      strings.Replace(form.Content, "\r", "", -1),
-		IsNewFile:    isNewFile,
+	}
+	if isNewFile {
+		file.Operation, file.FromTreePath = "create", ""
+	}
+	if _, err := repofiles.ChangeRepoFiles(ctx.Repo.Repository, ctx.User, &repofiles.ChangeRepoFilesOptions{
+		CommitOptions: repofiles.CommitOptions{
+			LastCommitID:    ctx.Repo.CommitID,
+			OldBranch:       oldBranchName,
+			NewBranch:       branchName,
+			CreateNewBranch: oldBranchName != branchName,
+			Message:         message,
+		},
+		Files: []*repofiles.ChangeRepoFile{file},
 	}); err != nil {
-		ctx.Data["Err_TreePath"] = true
-		ctx.RenderWithErr(ctx.Tr("repo.editor.fail_to_update_file", form.TreePath, err), tplEditFile, &form)
+		if !renderCommitError(ctx, err, tplEditFile, &form, oldBranchName, branchName) {
+			ctx.Data["Err_TreePath"] = true
+			ctx.RenderWithErr(ctx.Tr("repo.editor.fail_to_update_file", form.TreePath, err), tplEditFile, &form)
+		}
 		return
 	}
 
@@ -378,7 +429,7 @@ func DeleteFilePost(ctx *context.Context, form auth.DeleteRepoFileForm) {
 	ctx.Data["PageIsDelete"] = true
 	ctx.Data["BranchLink"] = ctx.Repo.RepoLink + "/src/" + ctx.Repo.BranchNameSubURL()
 
-	ctx.Repo.TreePath = cleanUploadFileName(ctx.Repo.TreePath)
+	ctx.Repo.TreePath = repofiles.CleanUploadFileName(ctx.Repo.TreePath)
 	if len(ctx.Repo.TreePath) == 0 {
 		ctx.Error(500, "Delete file name is invalid")
 		return
@@ -426,14 +477,19 @@ func DeleteFilePost(ctx *context.Context, form auth.DeleteRepoFileForm) {
 		message += "\n\n" + form.CommitMessage
 	}
 
-	if err := ctx.Repo.Repository.DeleteRepoFile(ctx.User, models.DeleteRepoFileOptions{
-		LastCommitID: ctx.Repo.CommitID,
-		OldBranch:    oldBranchName,
-		NewBranch:    branchName,
-		TreePath:     ctx.Repo.TreePath,
-		Message:      message,
+	if _, err := repofiles.DeleteRepoFile(ctx.Repo.Repository, ctx.User, &repofiles.DeleteRepoFileOptions{
+		CommitOptions: repofiles.CommitOptions{
+			LastCommitID:    ctx.Repo.CommitID,
+			OldBranch:       oldBranchName,
+			NewBranch:       branchName,
+			CreateNewBranch: oldBranchName != branchName,
+			Message:         message,
+		},
+		TreePath: ctx.Repo.TreePath,
 	}); err != nil {
-		ctx.ServerError("DeleteRepoFile", err)
+		if !renderCommitError(ctx, err, tplDeleteFile, &form, oldBranchName, branchName) {
+			ctx.ServerError("DeleteRepoFile", err)
+		}
 		return
 	}
 
@@ -475,6 +531,36 @@ func UploadFile(ctx *context.Context) {
 	ctx.HTML(200, tplUploadFile)
 }
 
+// getUploadChangeRepoFiles returns the files adding the given uploads to the directory at treePath
+// of commit, replacing the files of the same name. The content of each returned file is to be
+// closed, even along with an error.
+func getUploadChangeRepoFiles(commit *git.Commit, treePath string, uploads []*models.Upload) ([]*repofiles.ChangeRepoFile, error) {
+	files := make([]*repofiles.ChangeRepoFile, 0, len(uploads))
+	for _, upload := range uploads {
+		content, err := os.Open(upload.LocalPath())
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return files, err
+		}
+		file := &repofiles.ChangeRepoFile{
+			Operation:     "create",
+			TreePath:      path.Join(treePath, upload.Name),
+			ContentReader: content,
+		}
+		files = append(files, file)
+
+		entry, err := commit.GetTreeEntryByPath(file.TreePath)
+		if err != nil && !git.IsErrNotExist(err) {
+			return files, err
+		} else if entry != nil && !entry.IsDir() && !entry.IsLink() && !entry.IsSubModule() {
+			file.Operation, file.FromTreePath = "update", file.TreePath
+		}
+	}
+	return files, nil
+}
+
 // UploadFilePost response for uploading file
 func UploadFilePost(ctx *context.Context, form auth.UploadRepoFileForm) {
 	ctx.Data["PageIsUpload"] = true
@@ -488,7 +574,7 @@ func UploadFilePost(ctx *context.Context, form auth.UploadRepoFileForm) {
 		branchName = form.NewBranchName
 	}
 
-	form.TreePath = cleanUploadFileName(form.TreePath)
+	form.TreePath = repofiles.CleanUploadFileName(form.TreePath)
 	if len(form.TreePath) == 0 {
 		ctx.Error(500, "Upload file name is invalid")
 		return
@@ -559,31 +645,46 @@ func UploadFilePost(ctx *context.Context, form auth.UploadRepoFileForm) {
 		message += "\n\n" + form.CommitMessage
 	}
 
-	if err := ctx.Repo.Repository.UploadRepoFiles(ctx.User, models.UploadRepoFileOptions{
-		LastCommitID: ctx.Repo.CommitID,
-		OldBranch:    oldBranchName,
-		NewBranch:    branchName,
-		TreePath:     form.TreePath,
-		Message:      message,
-		Files:        form.Files,
-	}); err != nil {
-		ctx.Data["Err_TreePath"] = true
-		ctx.RenderWithErr(ctx.Tr("repo.editor.unable_to_upload_files", form.TreePath, err), tplUploadFile, &form)
+	uploads, err := models.GetUploadsByUUIDs(form.Files)
+	if err != nil {
+		ctx.ServerError("GetUploadsByUUIDs", err)
+		return
+	}
+	files, err := getUploadChangeRepoFiles(ctx.Repo.Commit, form.TreePath, uploads)
+	defer func() {
+		for _, file := range files {
+			file.ContentReader.(io.Closer).Close()
+		}
+	}()
+	if err != nil {
+		ctx.ServerError("getUploadChangeRepoFiles", err)
 		return
 	}
 
-	ctx.Redirect(ctx.Repo.RepoLink + "/src/branch/" + branchName + "/" + form.TreePath)
-}
-
-func cleanUploadFileName(name string) string {
-	name = strings.TrimLeft(name, "./\\")
-	name = strings.Replace(name, "../", "", -1)
-	name = strings.Replace(name, "..\\", "", -1)
-	name = strings.TrimPrefix(path.Clean(name), ".git/")
-	if name == ".git" {
-		return ""
+	if len(files) > 0 {
+		if _, err := repofiles.ChangeRepoFiles(ctx.Repo.Repository, ctx.User, &repofiles.ChangeRepoFilesOptions{
+			CommitOptions: repofiles.CommitOptions{
+				LastCommitID:    ctx.Repo.CommitID,
+				OldBranch:       oldBranchName,
+				NewBranch:       branchName,
+				CreateNewBranch: oldBranchName != branchName,
+				Message:         message,
+			},
+			Files: files,
+		}); err != nil {
+			if !renderCommitError(ctx, err, tplUploadFile, &form, oldBranchName, branchName) {
+				ctx.Data["Err_TreePath"] = true
+				ctx.RenderWithErr(ctx.Tr("repo.editor.unable_to_upload_files", form.TreePath, err), tplUploadFile, &form)
+			}
+			return
+		}
+	}
+	if err := models.DeleteUploads(uploads...); err != nil {
+		ctx.ServerError("DeleteUploads", err)
+		return
 	}
-	return name
+
+	ctx.Redirect(ctx.Repo.RepoLink + "/src/branch/" + branchName + "/" + form.TreePath)
 }
 
 // UploadFileToServer upload file to server file dir not git
@@ -618,7 +719,7 @@ func UploadFileToServer(ctx *context.Context) {
 		}
 	}
 
-	name := cleanUploadFileName(header.Filename)
+	name := repofiles.CleanUploadFileName(header.Filename)
 	if len(name) == 0 {
 		ctx.Error(500, "Upload file name is invalid")
 		return
@@ -1,30 +1,100 @@
-// Copyright 2018 The Gitea Authors. All rights reserved.
+// Copyright 2019 The Gitea Authors. All rights reserved.
 // Use of this source code is governed by a MIT-style
 // license that can be found in the LICENSE file.
 
 package repo
 
 import (
+	"net/http"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"code.gitea.io/git"
 	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/auth"
+	"code.gitea.io/gitea/modules/context"
+	"code.gitea.io/gitea/modules/setting"
+	"code.gitea.io/gitea/modules/test"
+
 	"github.com/stretchr/testify/assert"
 )
 
-func TestCleanUploadName(t *testing.T) {
+// mockEditorContext returns a context of user2 editing the master branch of repo1
+func mockEditorContext(t *testing.T, path string) *context.Context {
 	models.PrepareTestEnv(t)
+	ctx := test.MockContext(t, path)
+	test.LoadUser(t, ctx, 2)
+	test.LoadRepo(t, ctx, 1)
+	test.LoadRepoCommit(t, ctx)
+	test.LoadGitRepo(t, ctx)
+	ctx.Repo.BranchName = "master"
+	ctx.Repo.IsViewBranch = true
+	ctx.Repo.CommitID = ctx.Repo.Commit.ID.String()
+	assert.NoError(t, os.RemoveAll(filepath.Join(ctx.Repo.Repository.RepoPath(), "hooks")))
+	return ctx
+}
 
-	var kases = map[string]string{
-		".git/refs/master": "git/refs/master",
-		"/root/abc":        "root/abc",
-		"./../../abc":      "abc",
-		"a/../.git":        "a/.git",
-		"a/../../../abc":   "a/abc",
-		"../../../acd":     "acd",
-		"../../.git/abc":   "git/abc",
-		"..\\..\\.git/abc": "git/abc",
-	}
-	for k, v := range kases {
-		assert.EqualValues(t, v, cleanUploadFileName(k))
+func branchFileExists(t *testing.T, ctx *context.Context, treePath string) bool {
+	commit, err := ctx.Repo.GitRepo.GetBranchCommit("master")
+	assert.NoError(t, err)
+	_, err = commit.GetTreeEntryByPath(treePath)
+	if git.IsErrNotExist(err) {
+		return false
 	}
+	assert.NoError(t, err)
+	return true
+}
+
+func TestNewFilePost(t *testing.T) {
+	ctx := mockEditorContext(t, "user2/repo1/_new/master/")
+	NewFilePost(ctx, auth.EditRepoFileForm{
+		TreePath:     "new_file.txt",
+		Content:      "new content\r\n",
+		CommitChoice: frmCommitChoiceDirect,
+		LastCommit:   ctx.Repo.CommitID,
+	})
+	assert.EqualValues(t, http.StatusFound, ctx.Resp.Status())
+	assert.True(t, branchFileExists(t, ctx, "new_file.txt"))
+}
+
+func TestNewFilePost_FileTooBig(t *testing.T) {
+	oldMaxFileSize := setting.Repository.MaxFileSize
+	setting.Repository.MaxFileSize = 16
+	defer func() {
+		setting.Repository.MaxFileSize = oldMaxFileSize
+	}()
+
+	ctx := mockEditorContext(t, "user2/repo1/_new/master/")
+	NewFilePost(ctx, auth.EditRepoFileForm{
+		TreePath:     "big_file.txt",
+		Content:      "content larger than the max file size\n",
+		CommitChoice: frmCommitChoiceDirect,
+		LastCommit:   ctx.Repo.CommitID,
+	})
+	assert.EqualValues(t, http.StatusOK, ctx.Resp.Status())
+	assert.EqualValues(t, "repo.editor.file_too_big", ctx.Flash.ErrorMsg)
+	assert.False(t, branchFileExists(t, ctx, "big_file.txt"))
+}
+
+func TestEditFilePost_QuotaExceeded(t *testing.T) {
+	oldSizeQuota := setting.Repository.SizeQuota
+	defer func() {
+		setting.Repository.SizeQuota = oldSizeQuota
+	}()
+
+	ctx := mockEditorContext(t, "user2/repo1/_edit/master/README.md")
+	ctx.Repo.TreePath = "README.md"
+	setting.Repository.SizeQuota = ctx.Repo.Repository.Size + 1
+	EditFilePost(ctx, auth.EditRepoFileForm{
+		TreePath:     "README.md",
+		Content:      "content growing the repository beyond its quota\n",
+		CommitChoice: frmCommitChoiceDirect,
+		LastCommit:   ctx.Repo.CommitID,
+	})
+	assert.EqualValues(t, http.StatusOK, ctx.Resp.Status())
+	assert.EqualValues(t, "repo.editor.quota_exceeded", ctx.Flash.ErrorMsg)
+	commit, err := ctx.Repo.GitRepo.GetBranchCommit("master")
+	assert.NoError(t, err)
+	assert.EqualValues(t, ctx.Repo.CommitID, commit.ID.String())
 }
@@ -819,7 +819,7 @@ func RegisterRoutes(m *macaron.Macaron) {
 	// prometheus metrics endpoint
 	if setting.Metrics.Enabled {
 		c := metrics.NewCollector()
-		prometheus.MustRegister(c)
+		prometheus.MustRegister(c, metrics.RepoFilesPhaseDuration, metrics.RepoFilesOperations)
 
 		m.Get("/metrics", routers.Metrics)
 	}